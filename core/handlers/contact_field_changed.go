@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 
 	"github.com/jmoiron/sqlx"
@@ -22,6 +23,22 @@ func handleContactFieldChanged(ctx context.Context, rt *runtime.Runtime, tx *sql
 
 	slog.Debug("contact field changed", "contact", scene.ContactUUID(), "session", scene.SessionID(), "field", event.Field.Key, "value", event.Value)
 
+	// fields which no longer exist can't be recorded, and will be ignored by the commit hook too
+	if field := oa.FieldByKey(event.Field.Key); field != nil {
+		var value any
+		if event.Value != nil {
+			value = event.Value.Text.Native()
+		}
+
+		change, err := scene.RecordContactChange(ctx, tx, oa, models.ContactChangePropertyField, field, value)
+		if err != nil {
+			return fmt.Errorf("error recording contact change: %w", err)
+		}
+		if change != nil {
+			scene.AppendToEventPostCommitHook(hooks.InsertContactChangesHook, change)
+		}
+	}
+
 	scene.AppendToEventPreCommitHook(hooks.CommitFieldChangesHook, event)
 	scene.AppendToEventPreCommitHook(hooks.UpdateCampaignEventsHook, event)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
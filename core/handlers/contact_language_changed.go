@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 
 	"github.com/jmoiron/sqlx"
@@ -22,6 +23,14 @@ func handleContactLanguageChanged(ctx context.Context, rt *runtime.Runtime, tx *
 
 	slog.Debug("contact language changed", "contact", scene.ContactUUID(), "session", scene.SessionID(), "language", event.Language)
 
+	change, err := scene.RecordContactChange(ctx, tx, oa, models.ContactChangePropertyLanguage, nil, event.Language)
+	if err != nil {
+		return fmt.Errorf("error recording contact change: %w", err)
+	}
+	if change != nil {
+		scene.AppendToEventPostCommitHook(hooks.InsertContactChangesHook, change)
+	}
+
 	scene.AppendToEventPreCommitHook(hooks.CommitLanguageChangesHook, event)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
 
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 
 	"github.com/jmoiron/sqlx"
@@ -22,6 +23,14 @@ func handleContactNameChanged(ctx context.Context, rt *runtime.Runtime, tx *sqlx
 
 	slog.Debug("contact name changed", "contact", scene.ContactUUID(), "session", scene.SessionID(), "name", event.Name)
 
+	change, err := scene.RecordContactChange(ctx, tx, oa, models.ContactChangePropertyName, nil, event.Name)
+	if err != nil {
+		return fmt.Errorf("error recording contact change: %w", err)
+	}
+	if change != nil {
+		scene.AppendToEventPostCommitHook(hooks.InsertContactChangesHook, change)
+	}
+
 	scene.AppendToEventPreCommitHook(hooks.CommitNameChangesHook, event)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
 
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 
 	"github.com/jmoiron/sqlx"
@@ -22,6 +23,14 @@ func handleContactStatusChanged(ctx context.Context, rt *runtime.Runtime, tx *sq
 
 	slog.Debug("contact status changed", "contact", scene.ContactUUID(), "session", scene.SessionID(), "status", event.Status)
 
+	change, err := scene.RecordContactChange(ctx, tx, oa, models.ContactChangePropertyStatus, nil, string(event.Status))
+	if err != nil {
+		return fmt.Errorf("error recording contact change: %w", err)
+	}
+	if change != nil {
+		scene.AppendToEventPostCommitHook(hooks.InsertContactChangesHook, change)
+	}
+
 	scene.AppendToEventPreCommitHook(hooks.CommitStatusChangesHook, event)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
 
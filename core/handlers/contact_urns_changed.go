@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 
 	"github.com/jmoiron/sqlx"
@@ -22,6 +23,19 @@ func handleContactURNsChanged(ctx context.Context, rt *runtime.Runtime, tx *sqlx
 
 	slog.Debug("contact urns changed", "contact", scene.ContactUUID(), "session", scene.SessionID(), "urns", event.URNs)
 
+	identities := make([]string, len(event.URNs))
+	for i, u := range event.URNs {
+		identities[i] = string(u.Identity())
+	}
+
+	urnChange, err := scene.RecordContactChange(ctx, tx, oa, models.ContactChangePropertyURNs, nil, identities)
+	if err != nil {
+		return fmt.Errorf("error recording contact change: %w", err)
+	}
+	if urnChange != nil {
+		scene.AppendToEventPostCommitHook(hooks.InsertContactChangesHook, urnChange)
+	}
+
 	// create our URN changed event
 	change := &models.ContactURNsChanged{
 		ContactID: scene.ContactID(),
@@ -89,17 +89,25 @@ func handleMsgCreated(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa
 
 	// and the flow
 	var flow *models.Flow
-	run, _ := scene.Session().FindStep(e.StepUUID())
+	run, step := scene.Session().FindStep(e.StepUUID())
 	flowAsset, _ := oa.FlowByUUID(run.FlowReference().UUID)
 	if flowAsset != nil {
 		flow = flowAsset.(*models.Flow)
 	}
 
-	msg, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, scene.Session(), flow, event.Msg, event.CreatedOn())
+	msg, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, scene.Session(), flow, step.NodeUUID(), event.Msg, event.CreatedOn())
 	if err != nil {
 		return fmt.Errorf("error creating outgoing message to %s: %w", event.Msg.URN(), err)
 	}
 
+	// if this message was failed as a loop, the org's policy may want us to do more than fail it
+	if msg.FailedReason() == models.MsgFailedLooping {
+		policy := oa.Org().LoopPolicy()
+		if policy.Interrupt || policy.Incident {
+			scene.AppendToEventPostCommitHook(hooks.HandleLoopsHook, &hooks.MsgLoop{NodeUUID: step.NodeUUID(), Policy: policy})
+		}
+	}
+
 	// commit this message in the transaction
 	scene.AppendToEventPreCommitHook(hooks.CommitMessagesHook, msg)
 
@@ -0,0 +1,58 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// MsgLoop is a message which was failed because it looked like part of a loop
+type MsgLoop struct {
+	NodeUUID flows.NodeUUID
+	Policy   *models.LoopPolicy
+}
+
+// HandleLoopsHook is our hook for interrupting looping sessions and raising incidents for them
+var HandleLoopsHook models.EventCommitHook = &handleLoopsHook{}
+
+type handleLoopsHook struct{}
+
+// Apply interrupts the sessions of contacts which are looping and records the looping nodes on an incident
+func (h *handleLoopsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]any) error {
+	interruptContactIDs := make([]models.ContactID, 0, len(scenes))
+	incidentNodes := make([]flows.NodeUUID, 0, len(scenes))
+
+	for scene, args := range scenes {
+		interrupt := false
+		for _, a := range args {
+			loop := a.(*MsgLoop)
+			if loop.Policy.Interrupt {
+				interrupt = true
+			}
+			if loop.Policy.Incident {
+				incidentNodes = append(incidentNodes, loop.NodeUUID)
+			}
+		}
+		if interrupt {
+			interruptContactIDs = append(interruptContactIDs, scene.ContactID())
+		}
+	}
+
+	if len(interruptContactIDs) > 0 {
+		if err := models.InterruptSessionsForContactsTx(ctx, tx, interruptContactIDs); err != nil {
+			return fmt.Errorf("error interrupting looping sessions: %w", err)
+		}
+	}
+
+	if len(incidentNodes) > 0 {
+		if _, err := models.IncidentMessagesLooping(ctx, tx, rt.RP, oa, incidentNodes); err != nil {
+			return fmt.Errorf("error creating looping messages incident: %w", err)
+		}
+	}
+
+	return nil
+}
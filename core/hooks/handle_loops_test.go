@@ -0,0 +1,73 @@
+package hooks_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/hooks"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/redisx/assertredis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleLoopsHook(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	oa := testdata.Org1.Load(rt)
+	_, cathy, _ := testdata.Cathy.Load(rt, oa)
+	_, bob, _ := testdata.Bob.Load(rt, oa)
+
+	cathySessionID := testdata.InsertWaitingSession(rt, testdata.Org1, testdata.Cathy, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now(), false, nil)
+	bobSessionID := testdata.InsertWaitingSession(rt, testdata.Org1, testdata.Bob, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now(), false, nil)
+
+	node1 := flows.NodeUUID("5c1fd7ee-3a65-4d4d-8a8f-a9a5b1de42b8")
+	node2 := flows.NodeUUID("8f3b9a14-6f5a-4b0c-9d59-2c3b6ed5f0a1")
+
+	applyHook := func(scenes map[*models.Scene][]any) {
+		tx, err := rt.DB.BeginTxx(ctx, nil)
+		require.NoError(t, err)
+		require.NoError(t, hooks.HandleLoopsHook.Apply(ctx, rt, tx, oa, scenes))
+		require.NoError(t, tx.Commit())
+	}
+
+	// a policy which neither interrupts nor raises an incident does nothing
+	applyHook(map[*models.Scene][]any{
+		models.NewSceneForContact(cathy, models.ContactChangeSource{}): {&hooks.MsgLoop{NodeUUID: node1, Policy: models.DefaultLoopPolicy}},
+	})
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowsession WHERE id = $1`, cathySessionID).Returns("W")
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE incident_type = 'messages:looping'`).Returns(0)
+
+	// an interrupting policy only interrupts the sessions of the looping contacts
+	interruptPolicy := &models.LoopPolicy{Limit: 20, Window: 300, Key: models.LoopKeyNode, Interrupt: true}
+	applyHook(map[*models.Scene][]any{
+		models.NewSceneForContact(cathy, models.ContactChangeSource{}): {&hooks.MsgLoop{NodeUUID: node1, Policy: interruptPolicy}},
+	})
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowsession WHERE id = $1`, cathySessionID).Returns("I")
+	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowsession WHERE id = $1`, bobSessionID).Returns("W")
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE incident_type = 'messages:looping'`).Returns(0)
+
+	// an incident policy records the looping nodes against an incident without interrupting
+	incidentPolicy := &models.LoopPolicy{Limit: 20, Window: 300, Key: models.LoopKeyNode, Incident: true}
+	applyHook(map[*models.Scene][]any{
+		models.NewSceneForContact(bob, models.ContactChangeSource{}): {&hooks.MsgLoop{NodeUUID: node1, Policy: incidentPolicy}, &hooks.MsgLoop{NodeUUID: node2, Policy: incidentPolicy}},
+	})
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowsession WHERE id = $1`, bobSessionID).Returns("W")
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE incident_type = 'messages:looping' AND ended_on IS NULL`).Returns(1)
+
+	var incidentID models.IncidentID
+	rt.DB.Get(&incidentID, `SELECT id FROM notifications_incident WHERE incident_type = 'messages:looping'`)
+
+	assertredis.SMembers(t, rc, fmt.Sprintf("incident:%d:nodes", incidentID), []string{string(node1), string(node2)})
+}
@@ -0,0 +1,35 @@
+package hooks
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// InsertContactChangesHook is our hook for recording contact changes in the contact history
+var InsertContactChangesHook models.EventCommitHook = &insertContactChangesHook{}
+
+type insertContactChangesHook struct{}
+
+// Apply writes all the contact changes that were recorded
+func (h *insertContactChangesHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]any) error {
+	// gather all our changes
+	changes := make([]*models.ContactChange, 0, len(scenes))
+	for _, cs := range scenes {
+		for _, c := range cs {
+			changes = append(changes, c.(*models.ContactChange))
+		}
+	}
+
+	// history is written to DynamoDB after the contact changes themselves have been committed, so failing here would
+	// only stop the hooks which follow, e.g. sending messages, so we log the error and carry on
+	if err := models.InsertContactChanges(ctx, rt, changes); err != nil {
+		slog.Error("error inserting contact changes", "org_id", oa.OrgID(), "count", len(changes), "error", err)
+	}
+
+	return nil
+}
@@ -32,6 +32,8 @@ func (h *sendMessagesHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *s
 		msgs = append(msgs, sceneMsgs...)
 	}
 
-	msgio.QueueMessages(ctx, rt, tx, msgs)
+	// messages have already been committed, and preparing them makes calls to external services, so we don't want to
+	// do that inside our transaction
+	msgio.QueueMessages(ctx, rt, rt.DB, msgs)
 	return nil
 }
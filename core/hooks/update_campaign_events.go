@@ -110,7 +110,7 @@ func (h *updateCampaignEventsHook) Apply(ctx context.Context, rt *runtime.Runtim
 		tz := oa.Env().Timezone()
 		now := time.Now()
 		for ce := range addEvents {
-			scheduled, err := ce.ScheduleForContact(tz, now, s.Contact())
+			scheduled, err := ce.ScheduleForContact(tz, oa.Org().Holidays(), now, s.Contact())
 			if err != nil {
 				return fmt.Errorf("error calculating offset: %w", err)
 			}
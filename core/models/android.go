@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// AndroidMsg is an outgoing message as pulled by an Android relayer
+type AndroidMsg struct {
+	ID          MsgID          `json:"id"           db:"id"`
+	Text        string         `json:"text"         db:"text"`
+	Attachments pq.StringArray `json:"attachments"  db:"attachments"`
+	Phone       string         `json:"phone"        db:"phone"`
+	CreatedOn   time.Time      `json:"created_on"   db:"created_on"`
+}
+
+// claims the oldest queued messages for the channel by marking them as wired (W), skipping any which are being claimed
+// by a concurrent pull, so that each message is only ever returned by one pull
+const sqlClaimAndroidMsgsToSend = `
+WITH claimed AS (
+    UPDATE msgs_msg
+       SET status = 'W', modified_on = NOW()
+     WHERE id IN (
+        SELECT id
+          FROM msgs_msg
+         WHERE channel_id = $1 AND direction = 'O' AND status = 'Q' AND is_android
+         ORDER BY id
+         LIMIT $2
+           FOR UPDATE SKIP LOCKED
+     )
+ RETURNING id, text, attachments, contact_urn_id, created_on
+)
+SELECT c.id, c.text, COALESCE(c.attachments, '{}') AS attachments, u.path AS phone, c.created_on
+  FROM claimed c
+  JOIN contacts_contacturn u ON u.id = c.contact_urn_id
+ ORDER BY c.id`
+
+// GetAndroidMsgsToSend gets the oldest queued outgoing messages for the given Android channel and marks them as wired
+// so that they aren't returned by any other pull. Messages which are pulled but never acknowledged stay wired rather
+// than being returned again.
+func GetAndroidMsgsToSend(ctx context.Context, db *sqlx.DB, channelID ChannelID, limit int) ([]*AndroidMsg, error) {
+	msgs := make([]*AndroidMsg, 0, limit)
+
+	if err := db.SelectContext(ctx, &msgs, sqlClaimAndroidMsgsToSend, channelID, limit); err != nil {
+		return nil, fmt.Errorf("error claiming android messages to send: %w", err)
+	}
+
+	return msgs, nil
+}
+
+// AndroidMsgStatus is a status update for an outgoing message from an Android relayer
+type AndroidMsgStatus struct {
+	ID     MsgID     `json:"id"      validate:"required"`
+	Status MsgStatus `json:"status"  validate:"required,oneof=W S D F"`
+}
+
+type dbAndroidMsgStatus struct {
+	ID        MsgID     `db:"id"`
+	Status    MsgStatus `db:"status"`
+	ChannelID ChannelID `db:"channel_id"`
+}
+
+// statuses can only move forward, e.g. a message that has been delivered can't be marked as wired. Failures reported
+// by the relayer mean the device has given up trying to send the message.
+const sqlUpdateAndroidMsgStatuses = `
+UPDATE msgs_msg
+   SET status = s.status,
+       sent_on = CASE WHEN s.status IN ('W', 'S', 'D', 'R') THEN COALESCE(msgs_msg.sent_on, NOW()) ELSE msgs_msg.sent_on END,
+       failed_reason = CASE WHEN s.status = 'F' THEN 'V' ELSE msgs_msg.failed_reason END,
+       modified_on = NOW()
+  FROM (VALUES(:id, :status, :channel_id)) AS s(id, status, channel_id)
+ WHERE msgs_msg.id = s.id::bigint AND msgs_msg.channel_id = s.channel_id::int AND msgs_msg.direction = 'O' AND
+       msgs_msg.status NOT IN ('D', 'F') AND NOT (msgs_msg.status = 'S' AND s.status = 'W')`
+
+// UpdateAndroidMsgStatuses applies the given status updates from an Android relayer to messages on its channel,
+// ignoring any updates for messages which aren't outgoing messages on that channel
+func UpdateAndroidMsgStatuses(ctx context.Context, db DBorTx, channelID ChannelID, statuses []*AndroidMsgStatus) error {
+	is := make([]*dbAndroidMsgStatus, len(statuses))
+	for i, s := range statuses {
+		is[i] = &dbAndroidMsgStatus{ID: s.ID, Status: s.Status, ChannelID: channelID}
+	}
+
+	return BulkQuery(ctx, "updating android message statuses", db, sqlUpdateAndroidMsgStatuses, is)
+}
@@ -603,6 +603,15 @@ func (a *OrgAssets) Campaigns() []*Campaign {
 	return a.campaigns
 }
 
+func (a *OrgAssets) CampaignByID(campaignID CampaignID) *Campaign {
+	for _, c := range a.campaigns {
+		if c.ID() == campaignID {
+			return c
+		}
+	}
+	return nil
+}
+
 func (a *OrgAssets) CampaignByGroupID(groupID GroupID) []*Campaign {
 	return a.campaignsByGroup[groupID]
 }
@@ -2,12 +2,17 @@ package models
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
@@ -34,12 +39,82 @@ const (
 	BroadcastStatusInterrupted = BroadcastStatus("I")
 )
 
+// BroadcastVariant is one of the content variants of a split broadcast, sent to the given percentage of recipients
+type BroadcastVariant struct {
+	UUID         uuids.UUID                  `json:"uuid"         validate:"required,uuid4"`
+	Translations flows.BroadcastTranslations `json:"translations" validate:"required"`
+	Percent      int                         `json:"percent"      validate:"min=1,max=100"`
+}
+
+// BroadcastVariants is the list of content variants of a split broadcast
+type BroadcastVariants []*BroadcastVariant
+
+// Scan supports reading variants from JSON in database
+func (v *BroadcastVariants) Scan(value any) error {
+	if value == nil {
+		*v = nil
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("failed type assertion to []byte")
+	}
+	return json.Unmarshal(b, &v)
+}
+
+func (v BroadcastVariants) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// Validate checks that these variants are a valid split of recipients and that each has content in the base language
+func (v BroadcastVariants) Validate(baseLanguage i18n.Language) error {
+	if len(v) == 1 {
+		return errors.New("split broadcasts must have at least two variants")
+	}
+
+	total := 0
+	for _, variant := range v {
+		if _, ok := variant.Translations[baseLanguage]; !ok {
+			return fmt.Errorf("variant %s has no translation in base language '%s'", variant.UUID, baseLanguage)
+		}
+		total += variant.Percent
+	}
+	if len(v) > 0 && total != 100 {
+		return fmt.Errorf("variant percentages must add up to 100, got %d", total)
+	}
+	return nil
+}
+
+// ForContact deterministically picks the variant for the given contact, so that a contact always gets the same
+// variant of a given broadcast. For the children of a scheduled broadcast, pass the ID of the parent so that a contact
+// also gets the same variant each time the schedule fires.
+func (v BroadcastVariants) ForContact(broadcastID BroadcastID, contactID ContactID) *BroadcastVariant {
+	if len(v) == 0 {
+		return nil
+	}
+
+	bucket := int(crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d:%d", broadcastID, contactID))) % 100)
+
+	cumulative := 0
+	for _, variant := range v {
+		cumulative += variant.Percent
+		if bucket < cumulative {
+			return variant
+		}
+	}
+	return v[len(v)-1]
+}
+
 // Broadcast represents a broadcast that needs to be sent
 type Broadcast struct {
 	ID                BroadcastID                 `json:"broadcast_id,omitempty"` // null for non-persisted tasks used by flow actions
 	OrgID             OrgID                       `json:"org_id"`
 	Status            BroadcastStatus             `json:"status"`
 	Translations      flows.BroadcastTranslations `json:"translations"`
+	Variants          BroadcastVariants           `json:"variants,omitempty"`
 	BaseLanguage      i18n.Language               `json:"base_language"`
 	Expressions       bool                        `json:"expressions"`
 	OptInID           OptInID                     `json:"optin_id,omitempty"`
@@ -54,6 +129,7 @@ type Broadcast struct {
 	CreatedByID       UserID                      `json:"created_by_id,omitempty"`
 	ScheduleID        ScheduleID                  `json:"schedule_id,omitempty"`
 	ParentID          BroadcastID                 `json:"parent_id,omitempty"`
+	ContactsPerMinute int                         `json:"contacts_per_minute,omitempty"` // rate limit for sending, zero if none
 }
 
 type dbBroadcast struct {
@@ -61,6 +137,7 @@ type dbBroadcast struct {
 	OrgID             OrgID                              `db:"org_id"`
 	Status            BroadcastStatus                    `db:"status"`
 	Translations      JSONB[flows.BroadcastTranslations] `db:"translations"`
+	Variants          BroadcastVariants                  `db:"variants"`
 	BaseLanguage      i18n.Language                      `db:"base_language"`
 	OptInID           OptInID                            `db:"optin_id"`
 	TemplateID        TemplateID                         `db:"template_id"`
@@ -72,6 +149,7 @@ type dbBroadcast struct {
 	CreatedByID       UserID                             `db:"created_by_id"`
 	ScheduleID        ScheduleID                         `db:"schedule_id"`
 	ParentID          BroadcastID                        `db:"parent_id"`
+	ContactsPerMinute int                                `db:"contacts_per_minute"`
 }
 
 var ErrNoRecipients = errors.New("can't create broadcast with no recipients")
@@ -185,6 +263,27 @@ func (b *Broadcast) setStatus(ctx context.Context, db DBorTx, status BroadcastSt
 	return nil
 }
 
+// InterruptBroadcast sets the status of the given broadcast to INTERRUPTED so that any remaining batches aren't sent.
+// Returns false if there's no such broadcast or it has already completed, failed or been interrupted.
+func InterruptBroadcast(ctx context.Context, db DBorTx, orgID OrgID, bcastID BroadcastID) (bool, error) {
+	res, err := db.ExecContext(ctx, "UPDATE msgs_broadcast SET status = 'I', modified_on = NOW() WHERE id = $1 AND org_id = $2 AND status IN ('P', 'Q', 'S')", bcastID, orgID)
+	if err != nil {
+		return false, fmt.Errorf("error interrupting broadcast #%d: %w", bcastID, err)
+	}
+
+	rows, _ := res.RowsAffected()
+	return rows > 0, nil
+}
+
+// GetBroadcastStatus gets the current status of the given broadcast
+func GetBroadcastStatus(ctx context.Context, db DBorTx, bcastID BroadcastID) (BroadcastStatus, error) {
+	var status BroadcastStatus
+	if err := db.GetContext(ctx, &status, "SELECT status FROM msgs_broadcast WHERE id = $1", bcastID); err != nil {
+		return "", fmt.Errorf("error loading status of broadcast #%d: %w", bcastID, err)
+	}
+	return status, nil
+}
+
 // InsertBroadcast inserts the given broadcast into the DB
 func InsertBroadcast(ctx context.Context, db DBorTx, bcast *Broadcast) error {
 	dbb := &dbBroadcast{
@@ -192,6 +291,7 @@ func InsertBroadcast(ctx context.Context, db DBorTx, bcast *Broadcast) error {
 		OrgID:             bcast.OrgID,
 		Status:            bcast.Status,
 		Translations:      JSONB[flows.BroadcastTranslations]{bcast.Translations},
+		Variants:          bcast.Variants,
 		BaseLanguage:      bcast.BaseLanguage,
 		OptInID:           bcast.OptInID,
 		TemplateID:        bcast.TemplateID,
@@ -203,6 +303,7 @@ func InsertBroadcast(ctx context.Context, db DBorTx, bcast *Broadcast) error {
 		CreatedByID:       bcast.CreatedByID,
 		ScheduleID:        bcast.ScheduleID,
 		ParentID:          bcast.ParentID,
+		ContactsPerMinute: bcast.ContactsPerMinute,
 	}
 
 	err := BulkQuery(ctx, "inserting broadcast", db, sqlInsertBroadcast, []*dbBroadcast{dbb})
@@ -212,6 +313,20 @@ func InsertBroadcast(ctx context.Context, db DBorTx, bcast *Broadcast) error {
 
 	bcast.ID = dbb.ID
 
+	// contacts_per_minute is a column which RapidPro doesn't have yet so we only write it for rate limited broadcasts
+	if bcast.ContactsPerMinute > 0 {
+		if _, err := db.ExecContext(ctx, `UPDATE msgs_broadcast SET contacts_per_minute = $2 WHERE id = $1`, bcast.ID, bcast.ContactsPerMinute); err != nil {
+			return fmt.Errorf("error setting rate limit of broadcast #%d: %w", bcast.ID, err)
+		}
+	}
+
+	// variants is also a column which RapidPro doesn't have yet so we only write it for split broadcasts
+	if len(bcast.Variants) > 0 {
+		if _, err := db.ExecContext(ctx, `UPDATE msgs_broadcast SET variants = $2 WHERE id = $1`, bcast.ID, bcast.Variants); err != nil {
+			return fmt.Errorf("error setting variants of broadcast #%d: %w", bcast.ID, err)
+		}
+	}
+
 	// build up all our contact associations
 	contacts := make([]*broadcastContact, 0, len(bcast.ContactIDs))
 	for _, contactID := range bcast.ContactIDs {
@@ -245,6 +360,7 @@ func InsertChildBroadcast(ctx context.Context, db DBorTx, parent *Broadcast) (*B
 		OrgID:             parent.OrgID,
 		Status:            BroadcastStatusPending,
 		Translations:      parent.Translations,
+		Variants:          parent.Variants,
 		BaseLanguage:      parent.BaseLanguage,
 		Expressions:       parent.Expressions,
 		OptInID:           parent.OptInID,
@@ -257,6 +373,7 @@ func InsertChildBroadcast(ctx context.Context, db DBorTx, parent *Broadcast) (*B
 		Exclusions:        parent.Exclusions,
 		CreatedByID:       parent.CreatedByID,
 		ParentID:          parent.ID,
+		ContactsPerMinute: parent.ContactsPerMinute,
 	}
 
 	return child, InsertBroadcast(ctx, db, child)
@@ -282,8 +399,8 @@ const sqlInsertBroadcastContacts = `INSERT INTO msgs_broadcast_contacts(broadcas
 const sqlInsertBroadcastGroups = `INSERT INTO msgs_broadcast_groups(broadcast_id, contactgroup_id) VALUES(:broadcast_id, :contactgroup_id)`
 
 const sqlGetBroadcastByID = `
-SELECT id, org_id, status, translations, base_language, optin_id, template_id, template_variables, created_by_id
-  FROM msgs_broadcast 
+SELECT id, org_id, parent_id, status, translations, to_jsonb(b) -> 'variants' AS variants, base_language, optin_id, template_id, template_variables, created_by_id
+  FROM msgs_broadcast b
  WHERE id = $1`
 
 // GetBroadcastByID gets a broadcast by it's ID - NOTE this does not load all attributes of the broadcast
@@ -297,6 +414,8 @@ func GetBroadcastByID(ctx context.Context, db DBorTx, bcastID BroadcastID) (*Bro
 		OrgID:             b.OrgID,
 		Status:            b.Status,
 		Translations:      b.Translations.V,
+		Variants:          b.Variants,
+		ParentID:          b.ParentID,
 		BaseLanguage:      b.BaseLanguage,
 		Expressions:       true,
 		OptInID:           b.OptInID,
@@ -343,7 +462,20 @@ func (b *Broadcast) createMessage(rt *runtime.Runtime, oa *OrgAssets, c *Contact
 		return nil, fmt.Errorf("error creating flow contact for broadcast message: %w", err)
 	}
 
-	content, locale := b.Translations.ForContact(oa.Env(), contact, b.BaseLanguage)
+	// if this is a split broadcast, the contact gets the translations of their variant, which for a scheduled broadcast
+	// is picked using the parent so that it doesn't change between fires
+	variantBcastID := b.ID
+	if b.ParentID != NilBroadcastID {
+		variantBcastID = b.ParentID
+	}
+
+	translations := b.Translations
+	variant := b.Variants.ForContact(variantBcastID, c.ID())
+	if variant != nil {
+		translations = variant.Translations
+	}
+
+	content, locale := translations.ForContact(oa.Env(), contact, b.BaseLanguage)
 
 	var expressionsContext *types.XObject
 	if b.Expressions {
@@ -368,5 +500,47 @@ func (b *Broadcast) createMessage(rt *runtime.Runtime, oa *OrgAssets, c *Contact
 		return nil, fmt.Errorf("error creating outgoing message: %w", err)
 	}
 
+	// record which variant was sent so that variants can be compared
+	if variant != nil {
+		msg.m.Metadata["variant"] = string(variant.UUID)
+	}
+
 	return msg, nil
 }
+
+// BroadcastVariantStats are the delivery and reply counts for a variant of a split broadcast
+type BroadcastVariantStats struct {
+	UUID      uuids.UUID `json:"uuid"      db:"variant"`
+	Sent      int        `json:"sent"      db:"sent"`
+	Delivered int        `json:"delivered" db:"delivered"`
+	Failed    int        `json:"failed"    db:"failed"`
+	Replied   int        `json:"replied"   db:"replied"`
+}
+
+// BroadcastVariantReplyWindow is how long after a variant message is sent that an incoming message from the contact
+// is counted as a reply to it
+const BroadcastVariantReplyWindow = 24 * time.Hour
+
+const sqlSelectBroadcastVariantStats = `
+  SELECT m.metadata::jsonb->>'variant' AS variant,
+         count(*) AS sent,
+         count(*) FILTER (WHERE m.status IN ('D', 'R')) AS delivered,
+         count(*) FILTER (WHERE m.status = 'F') AS failed,
+         count(*) FILTER (WHERE EXISTS (
+             SELECT 1 FROM msgs_msg r 
+              WHERE r.contact_id = m.contact_id AND r.direction = 'I' AND r.created_on > m.created_on AND r.created_on <= m.created_on + make_interval(secs => $3)
+         )) AS replied
+    FROM msgs_msg m
+   WHERE m.org_id = $1 AND m.broadcast_id = $2 AND m.direction = 'O' AND m.metadata::jsonb ? 'variant'
+GROUP BY 1
+ORDER BY 1`
+
+// GetBroadcastVariantStats gets the delivery and reply counts for each variant of the given split broadcast
+func GetBroadcastVariantStats(ctx context.Context, db DBorTx, orgID OrgID, bcastID BroadcastID) ([]*BroadcastVariantStats, error) {
+	stats := make([]*BroadcastVariantStats, 0, 2)
+
+	if err := db.SelectContext(ctx, &stats, sqlSelectBroadcastVariantStats, orgID, bcastID, BroadcastVariantReplyWindow.Seconds()); err != nil {
+		return nil, fmt.Errorf("error selecting variant stats for broadcast #%d: %w", bcastID, err)
+	}
+	return stats, nil
+}
@@ -285,3 +285,93 @@ func TestBroadcastBatchCreateMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitBroadcasts(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	variantA := &models.BroadcastVariant{UUID: "8c1e5b8a-9a67-4c8e-bd4f-5e0bd2e4d8a4", Translations: flows.BroadcastTranslations{"eng": {Text: "Hi"}}, Percent: 50}
+	variantB := &models.BroadcastVariant{UUID: "2f7d0b1c-3e5e-4b0a-9b1d-1f1c6d2f7e01", Translations: flows.BroadcastTranslations{"eng": {Text: "Hey"}}, Percent: 50}
+
+	variantC := &models.BroadcastVariant{UUID: "6a0c2c9e-1b2f-4f4e-9b9e-3c8e6f1d2a7b", Translations: flows.BroadcastTranslations{"spa": {Text: "Hola"}}, Percent: 50}
+
+	assert.NoError(t, models.BroadcastVariants{}.Validate("eng"))
+	assert.NoError(t, models.BroadcastVariants{variantA, variantB}.Validate("eng"))
+	assert.EqualError(t, models.BroadcastVariants{variantA}.Validate("eng"), "split broadcasts must have at least two variants")
+	assert.EqualError(t, models.BroadcastVariants{variantA, variantA, variantB}.Validate("eng"), "variant percentages must add up to 100, got 150")
+	assert.EqualError(t, models.BroadcastVariants{variantA, variantC}.Validate("eng"), "variant 6a0c2c9e-1b2f-4f4e-9b9e-3c8e6f1d2a7b has no translation in base language 'eng'")
+
+	bcast := models.NewBroadcast(
+		testdata.Org1.ID,
+		flows.BroadcastTranslations{"eng": {Text: "Hello"}},
+		"eng",
+		true,
+		models.NilOptInID,
+		nil,
+		[]models.ContactID{testdata.Alexandria.ID, testdata.Bob.ID, testdata.Cathy.ID, testdata.George.ID},
+		nil,
+		"",
+		models.NoExclusions,
+		models.NilUserID,
+	)
+	bcast.Variants = models.BroadcastVariants{variantA, variantB}
+
+	err := models.InsertBroadcast(ctx, rt.DB, bcast)
+	require.NoError(t, err)
+
+	// variants are read back when loading the broadcast
+	loaded, err := models.GetBroadcastByID(ctx, rt.DB, bcast.ID)
+	require.NoError(t, err)
+	assert.Equal(t, bcast.Variants, loaded.Variants)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	batch := loaded.CreateBatch(bcast.ContactIDs, true, true)
+	msgs, err := loaded.CreateMessages(ctx, rt, oa, batch)
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(msgs))
+
+	// each contact gets the content of their variant, which is recorded on the message
+	for _, m := range msgs {
+		variant := bcast.Variants.ForContact(bcast.ID, m.ContactID())
+		assert.Equal(t, variant, bcast.Variants.ForContact(bcast.ID, m.ContactID())) // always the same variant
+		assert.Equal(t, variant.Translations["eng"].Text, m.Text())
+		assert.Equal(t, string(variant.UUID), m.Metadata()["variant"])
+	}
+
+	stats, err := models.GetBroadcastVariantStats(ctx, rt.DB, testdata.Org1.ID, bcast.ID)
+	require.NoError(t, err)
+
+	total := 0
+	for _, s := range stats {
+		total += s.Sent
+		assert.Equal(t, 0, s.Delivered)
+		assert.Equal(t, 0, s.Replied)
+	}
+	assert.Equal(t, 4, total)
+
+	// children of a scheduled broadcast pick variants using the parent so contacts get the same variant on every fire
+	child, err := models.InsertChildBroadcast(ctx, rt.DB, bcast)
+	require.NoError(t, err)
+
+	loadedChild, err := models.GetBroadcastByID(ctx, rt.DB, child.ID)
+	require.NoError(t, err)
+	assert.Equal(t, bcast.ID, loadedChild.ParentID)
+	assert.Equal(t, bcast.Variants, loadedChild.Variants)
+
+	childMsgs, err := loadedChild.CreateMessages(ctx, rt, oa, loadedChild.CreateBatch(bcast.ContactIDs, true, true))
+	require.NoError(t, err)
+
+	for _, m := range childMsgs {
+		variant := bcast.Variants.ForContact(bcast.ID, m.ContactID())
+		assert.Equal(t, string(variant.UUID), m.Metadata()["variant"])
+	}
+
+	// broadcasts without variants don't write the column
+	plain := models.NewBroadcast(testdata.Org1.ID, flows.BroadcastTranslations{"eng": {Text: "Hi"}}, "eng", true, models.NilOptInID, nil, nil, nil, "", models.NoExclusions, models.NilUserID)
+	require.NoError(t, models.InsertBroadcast(ctx, rt.DB, plain))
+
+	assertdb.Query(t, rt.DB, `SELECT variants IS NULL FROM msgs_broadcast WHERE id = $1`, plain.ID).Returns(true)
+}
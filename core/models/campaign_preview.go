@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CampaignEventPreviewDay is the number of fires on a single day in a campaign event preview
+type CampaignEventPreviewDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// CampaignEventPreviewFire is a single upcoming fire in a campaign event preview
+type CampaignEventPreviewFire struct {
+	ContactID ContactID `json:"contact_id"`
+	Scheduled time.Time `json:"scheduled"`
+}
+
+// CampaignEventPreview is what firing a proposed campaign event would look like over the coming days
+type CampaignEventPreview struct {
+	Total  int                         `json:"total"`
+	Days   []*CampaignEventPreviewDay  `json:"days"`
+	Sample []*CampaignEventPreviewFire `json:"sample"`
+}
+
+// NewCampaignEvent creates a new campaign event which hasn't been saved, e.g. to preview a proposed event
+func NewCampaignEvent(campaign *Campaign, field *Field, offset int, unit OffsetUnit, deliveryHour int, recurrence Recurrence, window *DeliveryWindow) *CampaignEvent {
+	e := &CampaignEvent{campaign: campaign}
+	e.e.RelativeToID = field.ID()
+	e.e.RelativeToKey = field.Key()
+	e.e.Offset = offset
+	e.e.Unit = unit
+	e.e.DeliveryHour = deliveryHour
+	e.e.Recurrence = recurrence
+	e.e.Window = window
+	return e
+}
+
+// PreviewCampaignEvent calculates the fires of the given event for the eligible contacts in its campaign group, and
+// returns the number of fires on each of the given number of days starting from now, plus a sample of the soonest
+func PreviewCampaignEvent(ctx context.Context, db *sqlx.DB, oa *OrgAssets, event *CampaignEvent, now time.Time, days, sampleSize int) (*CampaignEventPreview, error) {
+	field := oa.FieldByKey(event.RelativeToKey())
+	if field == nil {
+		return nil, fmt.Errorf("can't find field with key %s", event.RelativeToKey())
+	}
+
+	eligible, err := campaignEventEligibleContacts(ctx, db, event.Campaign().GroupID(), field, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to calculate eligible contacts for event: %w", err)
+	}
+
+	tz := oa.Env().Timezone()
+	today := now.In(tz)
+	start := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, tz)
+	end := start.AddDate(0, 0, days)
+
+	preview := &CampaignEventPreview{Days: make([]*CampaignEventPreviewDay, days)}
+	for i := range preview.Days {
+		preview.Days[i] = &CampaignEventPreviewDay{Date: start.AddDate(0, 0, i).Format(time.DateOnly)}
+	}
+
+	fires := make([]*CampaignEventPreviewFire, 0, 100)
+
+	for _, el := range eligible {
+		scheduled, err := event.ScheduleForTime(tz, oa.Org().Holidays(), now, *el.RelToValue)
+		if err != nil {
+			return nil, fmt.Errorf("error calculating offset for start: %s: %w", *el.RelToValue, err)
+		}
+
+		if scheduled == nil || !scheduled.Before(end) {
+			continue
+		}
+
+		// find the day of this fire, counting in days rather than hours because of DST
+		local := scheduled.In(tz)
+		day := int(time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC).Sub(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)) / (24 * time.Hour))
+
+		preview.Days[day].Count++
+		preview.Total++
+
+		fires = append(fires, &CampaignEventPreviewFire{ContactID: el.ContactID, Scheduled: *scheduled})
+	}
+
+	// sample is the soonest fires
+	slices.SortFunc(fires, func(a, b *CampaignEventPreviewFire) int {
+		if c := a.Scheduled.Compare(b.Scheduled); c != 0 {
+			return c
+		}
+		return int(a.ContactID - b.ContactID)
+	})
+	preview.Sample = fires[:min(sampleSize, len(fires))]
+
+	return preview, nil
+}
@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/dbutil"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
@@ -39,6 +41,9 @@ type OffsetUnit string
 // StartMode defines how a campaign event should be started
 type StartMode string
 
+// Recurrence defines whether a campaign event repeats on anniversaries of the date it is relative to
+type Recurrence string
+
 const (
 	// CreatedOnKey is key of created on system field
 	CreatedOnKey = "created_on"
@@ -69,6 +74,15 @@ const (
 
 	// StartModePassive means the flow should be started without interrupting the user in other flows
 	StartModePassive = StartMode("P")
+
+	// RecurrenceNone means the event fires once relative to the date
+	RecurrenceNone = Recurrence("")
+
+	// RecurrenceYearly means the event fires relative to every yearly anniversary of the date, e.g. birthdays
+	RecurrenceYearly = Recurrence("Y")
+
+	// RecurrenceMonthly means the event fires relative to every monthly anniversary of the date
+	RecurrenceMonthly = Recurrence("M")
 )
 
 // Campaign is our struct for a campaign and all its events
@@ -102,6 +116,75 @@ func (c *Campaign) GroupUUID() assets.GroupUUID { return c.c.GroupUUID }
 // Events returns the list of events for this campaign
 func (c *Campaign) Events() []*CampaignEvent { return c.c.Events }
 
+// DeliveryWindow restricts when a campaign event can fire. Fires that land outside of the window are pushed to the next
+// allowed time. If the end isn't after the start then the window is overnight, e.g. 22:00 to 06:00, and runs into the
+// next day, with a start equal to the end making a 24 hour window. Excluded days exclude the windows which start on them.
+type DeliveryWindow struct {
+	Start           string         `json:"start,omitempty"` // HH:MM in org timezone, inclusive
+	End             string         `json:"end,omitempty"`   // HH:MM in org timezone, exclusive
+	ExcludeWeekdays []time.Weekday `json:"exclude_weekdays,omitempty"`
+	ExcludeHolidays bool           `json:"exclude_holidays,omitempty"`
+}
+
+// parses a HH:MM time of day, returning the given default if it's empty or invalid
+func parseTimeOfDay(s string, def dates.TimeOfDay) dates.TimeOfDay {
+	if t, err := time.Parse("15:04", s); err == nil {
+		return dates.ExtractTimeOfDay(t)
+	}
+	return def
+}
+
+// Apply returns the first time which is at or after the given time and inside this window
+func (w *DeliveryWindow) Apply(t time.Time, tz *time.Location, holidays []dates.Date) time.Time {
+	start := parseTimeOfDay(w.Start, dates.NewTimeOfDay(0, 0, 0, 0))
+	end := parseTimeOfDay(w.End, dates.NewTimeOfDay(24, 0, 0, 0))
+	overnight := end.Compare(start) <= 0
+
+	excluded := func(d dates.Date) bool {
+		if slices.Contains(w.ExcludeWeekdays, d.Weekday()) {
+			return true
+		}
+		return w.ExcludeHolidays && slices.ContainsFunc(holidays, d.Equal)
+	}
+
+	t = t.In(tz)
+
+	// if every day is excluded we give up after a year and leave the time as is - overnight windows can take two
+	// iterations per day
+	for range 366 * 2 {
+		date := dates.ExtractDate(t)
+		tod := dates.ExtractTimeOfDay(t)
+		nextDay := start.Combine(dates.NewDate(date.Year, int(date.Month), date.Day+1), tz)
+
+		if overnight {
+			if tod.Compare(end) < 0 {
+				// we're in the part of the window which started the previous day
+				if !excluded(dates.ExtractDate(t.AddDate(0, 0, -1))) {
+					return t
+				}
+				t = start.Combine(date, tz)
+			} else if tod.Compare(start) < 0 {
+				t = start.Combine(date, tz)
+			} else if excluded(date) {
+				t = nextDay
+			} else {
+				return t
+			}
+			continue
+		}
+
+		if excluded(date) || tod.Compare(end) >= 0 {
+			t = nextDay
+			continue
+		}
+		if tod.Compare(start) < 0 {
+			return start.Combine(date, tz)
+		}
+		return t
+	}
+	return t
+}
+
 // CampaignEvent is our struct for an individual campaign event
 type CampaignEvent struct {
 	e struct {
@@ -114,6 +197,8 @@ type CampaignEvent struct {
 		Offset        int               `json:"offset"`
 		Unit          OffsetUnit        `json:"unit"`
 		DeliveryHour  int               `json:"delivery_hour"`
+		Recurrence    Recurrence        `json:"recurrence"`
+		Window        *DeliveryWindow   `json:"delivery_window"`
 		FlowID        FlowID            `json:"flow_id"`
 	}
 
@@ -144,7 +229,7 @@ func (e *CampaignEvent) QualifiesByField(contact *flows.Contact) bool {
 }
 
 // ScheduleForContact calculates the next fire ( if any) for the passed in contact
-func (e *CampaignEvent) ScheduleForContact(tz *time.Location, now time.Time, contact *flows.Contact) (*time.Time, error) {
+func (e *CampaignEvent) ScheduleForContact(tz *time.Location, holidays []dates.Date, now time.Time, contact *flows.Contact) (*time.Time, error) {
 	// we aren't part of the group, move on
 	if !e.QualifiesByGroup(contact) {
 		return nil, nil
@@ -183,7 +268,7 @@ func (e *CampaignEvent) ScheduleForContact(tz *time.Location, now time.Time, con
 	}
 
 	// calculate our next fire
-	scheduled, err := e.ScheduleForTime(tz, now, start)
+	scheduled, err := e.ScheduleForTime(tz, holidays, now, start)
 	if err != nil {
 		return nil, fmt.Errorf("error calculating offset for start: %s and event: %d: %w", start, e.ID(), err)
 	}
@@ -191,11 +276,52 @@ func (e *CampaignEvent) ScheduleForContact(tz *time.Location, now time.Time, con
 	return scheduled, nil
 }
 
-// ScheduleForTime calculates the next fire (if any) for the passed in time and timezone
-func (e *CampaignEvent) ScheduleForTime(tz *time.Location, now time.Time, start time.Time) (*time.Time, error) {
+// ScheduleForTime calculates the next fire (if any) for the passed in time, timezone and holidays. If the event is
+// recurring then this is the fire for the next anniversary of start that isn't in the past.
+func (e *CampaignEvent) ScheduleForTime(tz *time.Location, holidays []dates.Date, now time.Time, start time.Time) (*time.Time, error) {
 	// convert to our timezone
 	start = start.In(tz)
 
+	if e.Recurrence() == RecurrenceNone {
+		scheduled, err := e.scheduleForStart(tz, holidays, start)
+		if err != nil {
+			return nil, err
+		}
+
+		// if this is in the past, this is a no op
+		if scheduled.Before(now) {
+			return nil, nil
+		}
+		return &scheduled, nil
+	}
+
+	// fires for successive anniversaries are always increasing so we start with the anniversary nearest to now and
+	// then step backwards or forwards to find the first fire which isn't in the past
+	n := max(0, e.periodsBetween(start, now.In(tz)))
+
+	scheduled, err := e.scheduleForStart(tz, holidays, anniversary(start, e.Recurrence(), n))
+	if err != nil {
+		return nil, err
+	}
+
+	for n > 0 {
+		prev, _ := e.scheduleForStart(tz, holidays, anniversary(start, e.Recurrence(), n-1))
+		if prev.Before(now) {
+			break
+		}
+		scheduled = prev
+		n--
+	}
+	for scheduled.Before(now) {
+		n++
+		scheduled, _ = e.scheduleForStart(tz, holidays, anniversary(start, e.Recurrence(), n))
+	}
+
+	return &scheduled, nil
+}
+
+// calculates the fire for the passed in start time regardless of whether it's in the past
+func (e *CampaignEvent) scheduleForStart(tz *time.Location, holidays []dates.Date, start time.Time) (time.Time, error) {
 	// round to next minute, floored at 0 s/ns if we aren't already at 0
 	scheduled := start
 	if start.Second() > 0 || start.Nanosecond() > 0 {
@@ -213,7 +339,7 @@ func (e *CampaignEvent) ScheduleForTime(tz *time.Location, now time.Time, start
 	case OffsetWeek:
 		scheduled = scheduled.AddDate(0, 0, e.Offset()*7)
 	default:
-		return nil, fmt.Errorf("unknown offset unit: %s", e.Unit())
+		return time.Time{}, fmt.Errorf("unknown offset unit: %s", e.Unit())
 	}
 
 	// now set our delivery hour if set
@@ -221,12 +347,45 @@ func (e *CampaignEvent) ScheduleForTime(tz *time.Location, now time.Time, start
 		scheduled = time.Date(scheduled.Year(), scheduled.Month(), scheduled.Day(), e.DeliveryHour(), 0, 0, 0, tz)
 	}
 
-	// if this is in the past, this is a no op
-	if scheduled.Before(now) {
-		return nil, nil
+	// and finally push it into our delivery window if we have one
+	if w := e.DeliveryWindow(); w != nil {
+		windowed := w.Apply(scheduled, tz, holidays)
+
+		// if that pushed it to a later day, use our delivery hour on that day if it's allowed
+		if e.DeliveryHour() != NilDeliveryHour && !dates.ExtractDate(windowed).Equal(dates.ExtractDate(scheduled)) {
+			windowed = w.Apply(time.Date(windowed.Year(), windowed.Month(), windowed.Day(), e.DeliveryHour(), 0, 0, 0, tz), tz, holidays)
+		}
+
+		scheduled = windowed
 	}
 
-	return &scheduled, nil
+	return scheduled, nil
+}
+
+// returns the number of recurrence periods between the calendar months of the two times
+func (e *CampaignEvent) periodsBetween(t1, t2 time.Time) int {
+	if e.Recurrence() == RecurrenceYearly {
+		return t2.Year() - t1.Year()
+	}
+	return (t2.Year()-t1.Year())*12 + int(t2.Month()) - int(t1.Month())
+}
+
+// returns the nth anniversary of the given time, clamping the day to the end of the month if necessary, e.g. the
+// yearly anniversaries of Feb 29th are Feb 28th in non-leap years
+func anniversary(t time.Time, recurrence Recurrence, n int) time.Time {
+	year, month := t.Year(), int(t.Month())-1
+	if recurrence == RecurrenceYearly {
+		year += n
+	} else {
+		month += n
+		year += month / 12
+		month = month % 12
+	}
+
+	daysInMonth := time.Date(year, time.Month(month+2), 0, 0, 0, 0, 0, time.UTC).Day()
+	day := min(t.Day(), daysInMonth)
+
+	return time.Date(year, time.Month(month+1), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
 }
 
 // ID returns the database id for this campaign event
@@ -250,6 +409,12 @@ func (e *CampaignEvent) Unit() OffsetUnit { return e.e.Unit }
 // DeliveryHour returns the hour this event should send at, if any
 func (e *CampaignEvent) DeliveryHour() int { return e.e.DeliveryHour }
 
+// Recurrence returns whether this event recurs on anniversaries of the date it is relative to
+func (e *CampaignEvent) Recurrence() Recurrence { return e.e.Recurrence }
+
+// DeliveryWindow returns the window this event is restricted to firing in, if any
+func (e *CampaignEvent) DeliveryWindow() *DeliveryWindow { return e.e.Window }
+
 // Campaign returns the campaign this event is part of
 func (e *CampaignEvent) Campaign() *Campaign { return e.campaign }
 
@@ -285,6 +450,7 @@ func loadCampaigns(ctx context.Context, db *sql.DB, orgID OrgID) ([]*Campaign, e
 	return campaigns, nil
 }
 
+// columns which RapidPro doesn't have yet are read via to_jsonb so that loading campaigns doesn't fail without them
 const selectCampaignsSQL = `
 SELECT ROW_TO_JSON(r) FROM (SELECT
 	c.id as id,
@@ -304,6 +470,8 @@ SELECT ROW_TO_JSON(r) FROM (SELECT
             e.offset as offset,
 			e.unit as unit,
 			e.delivery_hour as delivery_hour,
+			COALESCE(to_jsonb(e) ->> 'recurrence', '') as recurrence,
+			to_jsonb(e) -> 'delivery_window' as delivery_window,
 			e.flow_id as flow_id
 		FROM 
 			campaigns_campaignevent e
@@ -538,7 +706,7 @@ func AddCampaignEventsForGroupAddition(ctx context.Context, tx DBorTx, oa *OrgAs
 				// and if we qualify by field
 				if e.QualifiesByField(contact) {
 					// calculate our scheduled fire
-					scheduled, err := e.ScheduleForContact(tz, time.Now(), contact)
+					scheduled, err := e.ScheduleForContact(tz, oa.Org().Holidays(), time.Now(), contact)
 					if err != nil {
 						return fmt.Errorf("error calculating schedule for event: %d and contact: %d: %w", e.ID(), c.ID(), err)
 					}
@@ -572,7 +740,7 @@ func ScheduleCampaignEvent(ctx context.Context, rt *runtime.Runtime, oa *OrgAsse
 		return fmt.Errorf("can't find field with key %s", event.RelativeToKey())
 	}
 
-	eligible, err := campaignEventEligibleContacts(ctx, rt.DB, event.campaign.GroupID(), field)
+	eligible, err := campaignEventEligibleContacts(ctx, rt.DB, event.campaign.GroupID(), field, nil)
 	if err != nil {
 		return fmt.Errorf("unable to calculate eligible contacts for event %d: %w", eventID, err)
 	}
@@ -584,7 +752,7 @@ func ScheduleCampaignEvent(ctx context.Context, rt *runtime.Runtime, oa *OrgAsse
 		start := *el.RelToValue
 
 		// calculate next fire for this contact
-		scheduled, err := event.ScheduleForTime(tz, time.Now(), start)
+		scheduled, err := event.ScheduleForTime(tz, oa.Org().Holidays(), time.Now(), start)
 		if err != nil {
 			return fmt.Errorf("error calculating offset for start: %s and event: %d: %w", start, eventID, err)
 		}
@@ -621,7 +789,56 @@ const sqlEligibleContactsForField = `
 INNER JOIN contacts_contactgroup_contacts gc ON gc.contact_id = c.id
      WHERE gc.contactgroup_id = $1 AND c.is_active = TRUE AND (c.fields->$2->>'datetime')::timestamptz IS NOT NULL`
 
-func campaignEventEligibleContacts(ctx context.Context, db *sqlx.DB, groupID GroupID, field *Field) ([]*eligibleContact, error) {
+// ScheduleNextRecurrences adds fires for the next occurrences of a recurring event for the contacts of the given fires,
+// which are being marked as fired or skipped in the same transaction so that the next occurrences can't be lost
+func ScheduleNextRecurrences(ctx context.Context, db DBorTx, oa *OrgAssets, event *CampaignEvent, fires []*EventFire) error {
+	if event.Recurrence() == RecurrenceNone || len(fires) == 0 {
+		return nil
+	}
+
+	field := oa.FieldByKey(event.RelativeToKey())
+	if field == nil {
+		return fmt.Errorf("can't find field with key %s", event.RelativeToKey())
+	}
+
+	firesByContact := make(map[ContactID]*EventFire, len(fires))
+	contactIDs := make([]ContactID, len(fires))
+	for i, f := range fires {
+		firesByContact[f.ContactID] = f
+		contactIDs[i] = f.ContactID
+	}
+
+	// contacts which have left the group or cleared the field won't be returned
+	eligible, err := campaignEventEligibleContacts(ctx, db, event.campaign.GroupID(), field, contactIDs)
+	if err != nil {
+		return fmt.Errorf("unable to calculate eligible contacts for event %d: %w", event.ID(), err)
+	}
+
+	fas := make([]*FireAdd, 0, len(eligible))
+	tz := oa.Env().Timezone()
+	now := time.Now()
+
+	for _, el := range eligible {
+		// next occurrence must be after the one just fired, and not in the past if that fire was late
+		after := firesByContact[el.ContactID].Scheduled.Add(time.Minute)
+		if after.Before(now) {
+			after = now
+		}
+
+		scheduled, err := event.ScheduleForTime(tz, oa.Org().Holidays(), after, *el.RelToValue)
+		if err != nil {
+			return fmt.Errorf("error calculating offset for start: %s and event: %d: %w", *el.RelToValue, event.ID(), err)
+		}
+
+		if scheduled != nil {
+			fas = append(fas, &FireAdd{ContactID: el.ContactID, EventID: event.ID(), Scheduled: *scheduled})
+		}
+	}
+
+	return AddEventFires(ctx, db, fas)
+}
+
+func campaignEventEligibleContacts(ctx context.Context, db DBorTx, groupID GroupID, field *Field, contactIDs []ContactID) ([]*eligibleContact, error) {
 	var query string
 	var params []any
 
@@ -637,23 +854,16 @@ func campaignEventEligibleContacts(ctx context.Context, db *sqlx.DB, groupID Gro
 		params = []any{groupID, field.UUID()}
 	}
 
-	rows, err := db.QueryxContext(ctx, query, params...)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("error querying for eligible contacts: %w", err)
+	// optionally restrict to the given contacts
+	if contactIDs != nil {
+		params = append(params, pq.Array(contactIDs))
+		query += fmt.Sprintf(" AND c.id = ANY($%d)", len(params))
 	}
-	defer rows.Close()
 
 	contacts := make([]*eligibleContact, 0, 100)
 
-	for rows.Next() {
-		contact := &eligibleContact{}
-
-		err := rows.StructScan(&contact)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning eligible contact result: %w", err)
-		}
-
-		contacts = append(contacts, contact)
+	if err := db.SelectContext(ctx, &contacts, query, params...); err != nil {
+		return nil, fmt.Errorf("error querying for eligible contacts: %w", err)
 	}
 
 	return contacts, nil
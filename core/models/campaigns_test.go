@@ -6,7 +6,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
@@ -68,7 +70,7 @@ func TestCampaignSchedule(t *testing.T) {
 		err := json.Unmarshal([]byte(evtJSON), evt)
 		require.NoError(t, err)
 
-		scheduled, err := evt.ScheduleForTime(tc.Timezone, tc.Now, tc.Start)
+		scheduled, err := evt.ScheduleForTime(tc.Timezone, nil, tc.Now, tc.Start)
 
 		if err != nil {
 			assert.True(t, tc.HasError, "%d: received unexpected error %s", i, err.Error())
@@ -81,6 +83,135 @@ func TestCampaignSchedule(t *testing.T) {
 	}
 }
 
+func TestCampaignScheduleRecurring(t *testing.T) {
+	utc := time.UTC
+
+	tcs := []struct {
+		Offset       int
+		Unit         models.OffsetUnit
+		DeliveryHour int
+		Recurrence   models.Recurrence
+		Now          time.Time
+		Start        time.Time
+		Scheduled    time.Time
+	}{
+		// birthday is later this year
+		{0, models.OffsetDay, 9, models.RecurrenceYearly, time.Date(2026, 3, 1, 0, 0, 0, 0, utc), time.Date(1990, 3, 15, 0, 0, 0, 0, utc), time.Date(2026, 3, 15, 9, 0, 0, 0, utc)},
+
+		// birthday has passed this year so schedule for next year
+		{0, models.OffsetDay, 9, models.RecurrenceYearly, time.Date(2026, 4, 1, 0, 0, 0, 0, utc), time.Date(1990, 3, 15, 0, 0, 0, 0, utc), time.Date(2027, 3, 15, 9, 0, 0, 0, utc)},
+
+		// a week before birthday which is this year but that has passed
+		{-7, models.OffsetDay, 9, models.RecurrenceYearly, time.Date(2026, 3, 10, 0, 0, 0, 0, utc), time.Date(1990, 3, 15, 0, 0, 0, 0, utc), time.Date(2027, 3, 8, 9, 0, 0, 0, utc)},
+
+		// a month after birthday which was last year but that hasn't passed
+		{5, models.OffsetWeek, 9, models.RecurrenceYearly, time.Date(2026, 1, 10, 0, 0, 0, 0, utc), time.Date(1990, 12, 15, 0, 0, 0, 0, utc), time.Date(2026, 1, 19, 9, 0, 0, 0, utc)},
+
+		// leap day birthdays are on Feb 28th in other years
+		{0, models.OffsetDay, 9, models.RecurrenceYearly, time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Date(1992, 2, 29, 0, 0, 0, 0, utc), time.Date(2026, 2, 28, 9, 0, 0, 0, utc)},
+
+		// monthly on the 31st is on the last day of shorter months
+		{0, models.OffsetDay, 9, models.RecurrenceMonthly, time.Date(2026, 2, 10, 0, 0, 0, 0, utc), time.Date(2020, 1, 31, 0, 0, 0, 0, utc), time.Date(2026, 2, 28, 9, 0, 0, 0, utc)},
+
+		// monthly which has passed this month
+		{2, models.OffsetHour, models.NilDeliveryHour, models.RecurrenceMonthly, time.Date(2026, 12, 20, 0, 0, 0, 0, utc), time.Date(2020, 6, 5, 10, 30, 0, 0, utc), time.Date(2027, 1, 5, 12, 30, 0, 0, utc)},
+
+		// date is in the future so first occurrence is the date itself
+		{0, models.OffsetDay, 9, models.RecurrenceYearly, time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Date(2030, 5, 1, 0, 0, 0, 0, utc), time.Date(2030, 5, 1, 9, 0, 0, 0, utc)},
+	}
+
+	for i, tc := range tcs {
+		evtJSON := fmt.Sprintf(`{"offset": %d, "unit": "%s", "delivery_hour": %d, "recurrence": "%s"}`, tc.Offset, tc.Unit, tc.DeliveryHour, tc.Recurrence)
+		evt := &models.CampaignEvent{}
+		err := json.Unmarshal([]byte(evtJSON), evt)
+		require.NoError(t, err)
+
+		scheduled, err := evt.ScheduleForTime(utc, nil, tc.Now, tc.Start)
+		assert.NoError(t, err, "%d: unexpected error", i)
+		if assert.NotNil(t, scheduled, "%d: expected schedule", i) {
+			assert.Equal(t, tc.Scheduled, *scheduled, "%d: mismatch in expected scheduled", i)
+		}
+	}
+}
+
+func TestCampaignScheduleWithWindow(t *testing.T) {
+	eastern, _ := time.LoadLocation("US/Eastern")
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, eastern)
+	holidays := []dates.Date{dates.NewDate(2026, 1, 19), dates.NewDate(2026, 1, 20)}
+
+	weekdays := &models.DeliveryWindow{Start: "08:00", End: "17:00", ExcludeWeekdays: []time.Weekday{time.Saturday, time.Sunday}}
+	weekdaysNoHolidays := &models.DeliveryWindow{Start: "08:00", End: "17:00", ExcludeWeekdays: []time.Weekday{time.Saturday, time.Sunday}, ExcludeHolidays: true}
+	mornings := &models.DeliveryWindow{End: "12:00"}
+	nights := &models.DeliveryWindow{Start: "22:00", End: "06:00", ExcludeWeekdays: []time.Weekday{time.Saturday}}
+	allDay := &models.DeliveryWindow{Start: "09:00", End: "09:00", ExcludeWeekdays: []time.Weekday{time.Saturday, time.Sunday}}
+
+	tcs := []struct {
+		DeliveryHour int
+		Window       *models.DeliveryWindow
+		Start        time.Time
+		Scheduled    time.Time
+	}{
+		{models.NilDeliveryHour, weekdays, time.Date(2026, 1, 14, 10, 30, 0, 0, eastern), time.Date(2026, 1, 15, 10, 30, 0, 0, eastern)}, // in window
+		{models.NilDeliveryHour, weekdays, time.Date(2026, 1, 14, 6, 30, 0, 0, eastern), time.Date(2026, 1, 15, 8, 0, 0, 0, eastern)},    // too early
+		{models.NilDeliveryHour, weekdays, time.Date(2026, 1, 14, 17, 0, 0, 0, eastern), time.Date(2026, 1, 16, 8, 0, 0, 0, eastern)},    // too late
+		{models.NilDeliveryHour, weekdays, time.Date(2026, 1, 15, 18, 0, 0, 0, eastern), time.Date(2026, 1, 19, 8, 0, 0, 0, eastern)},    // too late on friday
+		{9, weekdays, time.Date(2026, 1, 16, 12, 0, 0, 0, eastern), time.Date(2026, 1, 19, 9, 0, 0, 0, eastern)},                         // saturday
+		{9, weekdaysNoHolidays, time.Date(2026, 1, 16, 12, 0, 0, 0, eastern), time.Date(2026, 1, 21, 9, 0, 0, 0, eastern)},               // saturday then holidays
+		{models.NilDeliveryHour, mornings, time.Date(2026, 1, 14, 13, 0, 0, 0, eastern), time.Date(2026, 1, 16, 0, 0, 0, 0, eastern)},    // afternoon
+		{models.NilDeliveryHour, nights, time.Date(2026, 1, 14, 23, 0, 0, 0, eastern), time.Date(2026, 1, 15, 23, 0, 0, 0, eastern)},     // late night
+		{models.NilDeliveryHour, nights, time.Date(2026, 1, 14, 3, 0, 0, 0, eastern), time.Date(2026, 1, 15, 3, 0, 0, 0, eastern)},       // early morning
+		{models.NilDeliveryHour, nights, time.Date(2026, 1, 14, 12, 0, 0, 0, eastern), time.Date(2026, 1, 15, 22, 0, 0, 0, eastern)},     // daytime
+		{models.NilDeliveryHour, nights, time.Date(2026, 1, 16, 23, 0, 0, 0, eastern), time.Date(2026, 1, 18, 22, 0, 0, 0, eastern)},     // saturday night
+		{models.NilDeliveryHour, nights, time.Date(2026, 1, 17, 3, 0, 0, 0, eastern), time.Date(2026, 1, 18, 22, 0, 0, 0, eastern)},      // early sunday after saturday night
+		{models.NilDeliveryHour, allDay, time.Date(2026, 1, 14, 3, 0, 0, 0, eastern), time.Date(2026, 1, 15, 3, 0, 0, 0, eastern)},       // 24 hour window
+		{models.NilDeliveryHour, allDay, time.Date(2026, 1, 16, 10, 0, 0, 0, eastern), time.Date(2026, 1, 19, 9, 0, 0, 0, eastern)},      // weekend
+	}
+
+	for i, tc := range tcs {
+		evt := &models.CampaignEvent{}
+		err := json.Unmarshal(jsonx.MustMarshal(map[string]any{"offset": 1, "unit": "D", "delivery_hour": tc.DeliveryHour, "delivery_window": tc.Window}), evt)
+		require.NoError(t, err)
+
+		scheduled, err := evt.ScheduleForTime(eastern, holidays, now, tc.Start)
+		assert.NoError(t, err, "%d: unexpected error", i)
+		if assert.NotNil(t, scheduled, "%d: expected schedule", i) {
+			assert.Equal(t, tc.Scheduled, *scheduled, "%d: mismatch in expected scheduled", i)
+		}
+	}
+}
+
+func TestScheduleNextRecurrences(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET created_on = '2020-05-10T12:00:00Z' WHERE id = $1`, testdata.Cathy.ID)
+
+	event := testdata.InsertCampaignFlowEvent(rt, testdata.RemindersCampaign, testdata.Favorites, testdata.CreatedOnField, 0, "D")
+	rt.DB.MustExec(`UPDATE campaigns_campaignevent SET recurrence = 'Y' WHERE id = $1`, event.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshCampaigns)
+	require.NoError(t, err)
+
+	dbEvent := oa.CampaignEventByID(event.ID)
+	require.NotNil(t, dbEvent)
+	assert.Equal(t, models.RecurrenceYearly, dbEvent.Recurrence())
+
+	// Cathy is in the campaign group, George isn't
+	fires := []*models.EventFire{
+		{ContactID: testdata.Cathy.ID, EventID: event.ID, Scheduled: time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC)},
+		{ContactID: testdata.George.ID, EventID: event.ID, Scheduled: time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC)},
+	}
+	rt.DB.MustExec(`INSERT INTO contacts_contactgroup_contacts(contactgroup_id, contact_id) VALUES($1, $2) ON CONFLICT DO NOTHING`, testdata.DoctorsGroup.ID, testdata.Cathy.ID)
+	rt.DB.MustExec(`DELETE FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1 AND contact_id = $2`, testdata.DoctorsGroup.ID, testdata.George.ID)
+
+	err = models.ScheduleNextRecurrences(ctx, rt.DB, oa, dbEvent, fires)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1`, event.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1 AND contact_id = $2 AND scheduled > NOW() AND fired IS NULL AND date_part('month', scheduled) = 5`, event.ID, testdata.Cathy.ID).Returns(1)
+}
+
 func TestAddEventFires(t *testing.T) {
 	ctx, rt := testsuite.Runtime()
 
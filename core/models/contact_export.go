@@ -0,0 +1,440 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/export"
+)
+
+// ContactExportFormat is the file format of a contact export
+type ContactExportFormat string
+
+const (
+	ContactExportFormatCSV    = ContactExportFormat("csv")
+	ContactExportFormatXLSX   = ContactExportFormat("xlsx")
+	ContactExportFormatNDJSON = ContactExportFormat("ndjson")
+)
+
+var contactExportContentTypes = map[ContactExportFormat]string{
+	ContactExportFormatCSV:    "text/csv",
+	ContactExportFormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	ContactExportFormatNDJSON: "application/x-ndjson",
+}
+
+// ContactExportStatus is the status of a contact export
+type ContactExportStatus string
+
+const (
+	ContactExportStatusPending    = ContactExportStatus("P")
+	ContactExportStatusProcessing = ContactExportStatus("O")
+	ContactExportStatusComplete   = ContactExportStatus("C")
+	ContactExportStatusFailed     = ContactExportStatus("F")
+)
+
+const (
+	// how long we keep the state of an export, and how long each signing of its download URL is valid for
+	contactExportExpire    = 7 * 24 * time.Hour
+	contactExportURLExpire = 24 * time.Hour
+
+	// how many contacts we load at a time
+	contactExportBatchSize = 1000
+
+	// the size of the parts we upload, which must be at least 5MB for S3
+	contactExportPartSize = 8 * 1024 * 1024
+)
+
+// ContactExport is an asynchronous export of the contacts matching a query in a group. Its state is stored in redis so
+// that its progress can be checked while it's being written.
+type ContactExport struct {
+	UUID       uuids.UUID          `json:"uuid"`
+	OrgID      OrgID               `json:"org_id"`
+	GroupID    GroupID             `json:"group_id"`
+	Query      string              `json:"query"`
+	Format     ContactExportFormat `json:"format"`
+	Status     ContactExportStatus `json:"status"`
+	Total      int                 `json:"total"`
+	Exported   int                 `json:"exported"`
+	URL        string              `json:"url,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	CreatedOn  time.Time           `json:"created_on"`
+	FinishedOn *time.Time          `json:"finished_on"`
+}
+
+// NewContactExport creates a new pending contact export
+func NewContactExport(orgID OrgID, groupID GroupID, query string, format ContactExportFormat) *ContactExport {
+	return &ContactExport{
+		UUID:      uuids.NewV4(),
+		OrgID:     orgID,
+		GroupID:   groupID,
+		Query:     query,
+		Format:    format,
+		Status:    ContactExportStatusPending,
+		CreatedOn: dates.Now(),
+	}
+}
+
+func contactExportKey(orgID OrgID, uuid uuids.UUID) string {
+	return fmt.Sprintf("contact_export:%d:%s", orgID, uuid)
+}
+
+// GetContactExport gets a contact export by its UUID, or nil if it doesn't exist or has expired
+func GetContactExport(rc redis.Conn, orgID OrgID, uuid uuids.UUID) (*ContactExport, error) {
+	data, err := redis.Bytes(rc.Do("GET", contactExportKey(orgID, uuid)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting contact export: %w", err)
+	}
+
+	e := &ContactExport{}
+	if err := jsonx.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("error unmarshaling contact export: %w", err)
+	}
+	return e, nil
+}
+
+// Save saves the state of this export
+func (e *ContactExport) Save(rc redis.Conn) error {
+	if _, err := rc.Do("SET", contactExportKey(e.OrgID, e.UUID), jsonx.MustMarshal(e), "EX", int(contactExportExpire/time.Second)); err != nil {
+		return fmt.Errorf("error saving contact export: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed marks this export as failed with the given error
+func (e *ContactExport) MarkFailed(rc redis.Conn, cause error) error {
+	now := dates.Now()
+	e.Status = ContactExportStatusFailed
+	e.Error = cause.Error()
+	e.FinishedOn = &now
+	return e.Save(rc)
+}
+
+// Write writes the given contacts to this export's file in storage, loading them in batches and saving progress
+// after each batch. Once complete the export has a signed URL from which the file can be downloaded.
+func (e *ContactExport) Write(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contactIDs []ContactID) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	e.Status = ContactExportStatusProcessing
+	e.Total = len(contactIDs)
+	e.Exported = 0
+	if err := e.Save(rc); err != nil {
+		return err
+	}
+
+	upload, err := newS3MultipartWriter(ctx, rt.S3.Client, rt.Config.S3ExportsBucket, e.storageKey(), contactExportContentTypes[e.Format])
+	if err != nil {
+		return err
+	}
+
+	if err := e.write(ctx, rt, oa, rc, upload, contactIDs); err != nil {
+		upload.Abort()
+		return err
+	}
+
+	if err := upload.Close(); err != nil {
+		return fmt.Errorf("error completing export upload: %w", err)
+	}
+
+	now := dates.Now()
+	e.Status = ContactExportStatusComplete
+	e.FinishedOn = &now
+
+	if err := e.SignURL(ctx, rt); err != nil {
+		return err
+	}
+
+	return e.Save(rc)
+}
+
+// SignURL sets the download URL of this export, if it's complete, to a newly signed one. Signed URLs expire before the
+// state of the export does so this should be called whenever a complete export is returned.
+func (e *ContactExport) SignURL(ctx context.Context, rt *runtime.Runtime) error {
+	if e.Status != ContactExportStatusComplete {
+		return nil
+	}
+
+	presigned, err := s3.NewPresignClient(rt.S3.Client).PresignGetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(rt.Config.S3ExportsBucket), Key: aws.String(e.storageKey())}, s3.WithPresignExpires(contactExportURLExpire))
+	if err != nil {
+		return fmt.Errorf("error signing export URL: %w", err)
+	}
+
+	e.URL = presigned.URL
+	return nil
+}
+
+func (e *ContactExport) storageKey() string {
+	return fmt.Sprintf("%d/contact_exports/%s.%s", e.OrgID, e.UUID, e.Format)
+}
+
+func (e *ContactExport) write(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, rc redis.Conn, w io.Writer, contactIDs []ContactID) error {
+	cw := newContactExportWriter(e.Format, w, oa)
+
+	// keep the order of the IDs as that's the order of the search results
+	positions := make(map[ContactID]int, len(contactIDs))
+	for i, id := range contactIDs {
+		positions[id] = i
+	}
+
+	for batch := range slices.Chunk(contactIDs, contactExportBatchSize) {
+		contacts, err := LoadContacts(ctx, rt.ReadonlyDB, oa, batch)
+		if err != nil {
+			return fmt.Errorf("error loading contacts to export: %w", err)
+		}
+
+		slices.SortFunc(contacts, func(a, b *Contact) int { return positions[a.ID()] - positions[b.ID()] })
+
+		for _, c := range contacts {
+			if err := cw.Write(newExportedContact(c)); err != nil {
+				return fmt.Errorf("error writing contact to export: %w", err)
+			}
+		}
+
+		e.Exported += len(contacts)
+		if err := e.Save(rc); err != nil {
+			return err
+		}
+	}
+
+	return cw.Close()
+}
+
+// ExportedContact is a contact as written to an export
+type ExportedContact struct {
+	UUID       flows.ContactUUID `json:"uuid"`
+	Name       string            `json:"name"`
+	Language   string            `json:"language"`
+	Status     ContactStatus     `json:"status"`
+	CreatedOn  time.Time         `json:"created_on"`
+	LastSeenOn *time.Time        `json:"last_seen_on"`
+	URNs       []urns.URN        `json:"urns"`
+	Fields     map[string]string `json:"fields"`
+	Groups     []exportedGroup   `json:"groups"`
+}
+
+type exportedGroup struct {
+	UUID assets.GroupUUID `json:"uuid"`
+	Name string           `json:"name"`
+}
+
+func newExportedContact(c *Contact) *ExportedContact {
+	urnz := make([]urns.URN, len(c.URNs()))
+	for i, u := range c.URNs() {
+		urnz[i] = u.Identity() // strip query params which are internal
+	}
+
+	fields := make(map[string]string, len(c.Fields()))
+	for key, v := range c.Fields() {
+		if v != nil && v.Text != nil {
+			fields[key] = v.Text.Native()
+		}
+	}
+
+	groups := make([]exportedGroup, 0, len(c.Groups()))
+	for _, g := range c.Groups() {
+		if g.Type() == GroupTypeManual || g.Type() == GroupTypeSmart {
+			groups = append(groups, exportedGroup{UUID: g.UUID(), Name: g.Name()})
+		}
+	}
+
+	return &ExportedContact{
+		UUID:       c.UUID(),
+		Name:       c.Name(),
+		Language:   string(c.Language()),
+		Status:     c.Status(),
+		CreatedOn:  c.CreatedOn(),
+		LastSeenOn: c.LastSeenOn(),
+		URNs:       urnz,
+		Fields:     fields,
+		Groups:     groups,
+	}
+}
+
+type contactExportWriter interface {
+	Write(*ExportedContact) error
+	Close() error
+}
+
+func newContactExportWriter(format ContactExportFormat, w io.Writer, oa *OrgAssets) contactExportWriter {
+	switch format {
+	case ContactExportFormatXLSX:
+		return newTabularContactWriter(export.NewXLSXWriter(w), oa)
+	case ContactExportFormatNDJSON:
+		return &ndjsonContactWriter{enc: json.NewEncoder(w)}
+	default:
+		return newTabularContactWriter(export.NewCSVWriter(w), oa)
+	}
+}
+
+// writes contacts as JSON objects, one per line
+type ndjsonContactWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonContactWriter) Write(c *ExportedContact) error { return w.enc.Encode(c) }
+func (w *ndjsonContactWriter) Close() error                   { return nil }
+
+// writes contacts as rows with a column for each field of the org
+type tabularContactWriter struct {
+	tw        export.TableWriter
+	fieldKeys []string
+	started   bool
+	headers   []string
+}
+
+func newTabularContactWriter(tw export.TableWriter, oa *OrgAssets) *tabularContactWriter {
+	fs, _ := oa.Fields()
+	headers := []string{"Contact UUID", "Name", "Language", "Status", "Created On", "Last Seen On", "URNs"}
+	fieldKeys := make([]string, 0, len(fs))
+
+	for _, f := range fs {
+		fieldKeys = append(fieldKeys, f.Key())
+		headers = append(headers, fmt.Sprintf("Field:%s", f.Name()))
+	}
+
+	return &tabularContactWriter{tw: tw, fieldKeys: fieldKeys, headers: append(headers, "Groups")}
+}
+
+func (w *tabularContactWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.tw.WriteRow(w.headers)
+}
+
+func (w *tabularContactWriter) Write(c *ExportedContact) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	lastSeenOn := ""
+	if c.LastSeenOn != nil {
+		lastSeenOn = c.LastSeenOn.UTC().Format(time.RFC3339)
+	}
+
+	urnStrs := make([]string, len(c.URNs))
+	for i, u := range c.URNs {
+		urnStrs[i] = string(u)
+	}
+
+	groupNames := make([]string, len(c.Groups))
+	for i, g := range c.Groups {
+		groupNames[i] = g.Name
+	}
+
+	row := []string{string(c.UUID), c.Name, c.Language, string(c.Status), c.CreatedOn.UTC().Format(time.RFC3339), lastSeenOn, strings.Join(urnStrs, ", ")}
+	for _, k := range w.fieldKeys {
+		row = append(row, c.Fields[k])
+	}
+	row = append(row, strings.Join(groupNames, ", "))
+
+	return w.tw.WriteRow(row)
+}
+
+func (w *tabularContactWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	return w.tw.Close()
+}
+
+// an io.Writer which uploads what's written to it to S3 in parts, so that large files don't need to be held in memory
+type s3MultipartWriter struct {
+	ctx      context.Context
+	client   *s3.Client
+	bucket   string
+	key      string
+	uploadID *string
+	buf      bytes.Buffer
+	parts    []types.CompletedPart
+}
+
+func newS3MultipartWriter(ctx context.Context, client *s3.Client, bucket, key, contentType string) (*s3MultipartWriter, error) {
+	out, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		ACL:         types.ObjectCannedACLPrivate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating multipart upload: %w", err)
+	}
+
+	return &s3MultipartWriter{ctx: ctx, client: client, bucket: bucket, key: key, uploadID: out.UploadId}, nil
+}
+
+func (w *s3MultipartWriter) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+
+	if w.buf.Len() >= contactExportPartSize {
+		if err := w.uploadPart(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (w *s3MultipartWriter) uploadPart() error {
+	partNumber := aws.Int32(int32(len(w.parts) + 1))
+
+	out, err := w.client.UploadPart(w.ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(w.bucket),
+		Key:        aws.String(w.key),
+		UploadId:   w.uploadID,
+		PartNumber: partNumber,
+		Body:       bytes.NewReader(w.buf.Bytes()),
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading part %d: %w", *partNumber, err)
+	}
+
+	w.parts = append(w.parts, types.CompletedPart{ETag: out.ETag, PartNumber: partNumber})
+	w.buf.Reset()
+	return nil
+}
+
+// Close uploads whatever remains as the final part and completes the upload
+func (w *s3MultipartWriter) Close() error {
+	if w.buf.Len() > 0 || len(w.parts) == 0 {
+		if err := w.uploadPart(); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.client.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(w.bucket),
+		Key:             aws.String(w.key),
+		UploadId:        w.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: w.parts},
+	})
+	return err
+}
+
+// Abort cancels the upload so that S3 can discard any uploaded parts
+func (w *s3MultipartWriter) Abort() {
+	w.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket),
+		Key:      aws.String(w.key),
+		UploadId: w.uploadID,
+	})
+}
@@ -0,0 +1,80 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactExport(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis | testsuite.ResetStorage)
+
+	oa := testdata.Org1.Load(rt)
+	ids := []models.ContactID{testdata.Bob.ID, testdata.Cathy.ID}
+
+	export := models.NewContactExport(testdata.Org1.ID, testdata.DoctorsGroup.ID, "", models.ContactExportFormatNDJSON)
+	require.NoError(t, export.Save(rc))
+
+	loaded, err := models.GetContactExport(rc, testdata.Org1.ID, export.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ContactExportStatusPending, loaded.Status)
+
+	// exports are scoped to their org
+	loaded, err = models.GetContactExport(rc, testdata.Org2.ID, export.UUID)
+	assert.NoError(t, err)
+	assert.Nil(t, loaded)
+
+	err = export.Write(ctx, rt, oa, ids)
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ContactExportStatusComplete, export.Status)
+	assert.Equal(t, 2, export.Total)
+	assert.Equal(t, 2, export.Exported)
+	assert.NotEmpty(t, export.URL)
+	assert.NotNil(t, export.FinishedOn)
+
+	// URLs can be re-signed for complete exports
+	loaded, err = models.GetContactExport(rc, testdata.Org1.ID, export.UUID)
+	require.NoError(t, err)
+	loaded.URL = ""
+	assert.NoError(t, loaded.SignURL(ctx, rt))
+	assert.Contains(t, loaded.URL, "1/contact_exports/"+string(export.UUID)+".ndjson")
+
+	_, body, err := rt.S3.GetObject(ctx, rt.Config.S3ExportsBucket, "1/contact_exports/"+string(export.UUID)+".ndjson")
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, lines, 2)
+
+	// contacts are written in the order of the given IDs
+	bob := &models.ExportedContact{}
+	jsonx.MustUnmarshal([]byte(lines[0]), bob)
+	assert.Equal(t, testdata.Bob.UUID, bob.UUID)
+	assert.Equal(t, "Bob", bob.Name)
+
+	// and as CSV, with a contact which no longer exists and so isn't counted as exported
+	export = models.NewContactExport(testdata.Org1.ID, testdata.DoctorsGroup.ID, "", models.ContactExportFormatCSV)
+	err = export.Write(ctx, rt, oa, append(ids, models.ContactID(123456789)))
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, export.Total)
+	assert.Equal(t, 2, export.Exported)
+
+	_, body, err = rt.S3.GetObject(ctx, rt.Config.S3ExportsBucket, "1/contact_exports/"+string(export.UUID)+".csv")
+	require.NoError(t, err)
+
+	lines = strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "Contact UUID,Name,Language,Status,Created On,Last Seen On,URNs,Field:"))
+	assert.True(t, strings.HasPrefix(lines[2], string(testdata.Cathy.UUID)+",Cathy,"))
+}
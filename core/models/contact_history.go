@@ -0,0 +1,415 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// ContactChangeVia is how a change to a contact was made
+type ContactChangeVia string
+
+const (
+	ContactChangeViaUser   ContactChangeVia = "user"   // by a user in the UI
+	ContactChangeViaAPI    ContactChangeVia = "api"    // by a user through the API
+	ContactChangeViaImport ContactChangeVia = "import" // by a contact import
+	ContactChangeViaFlow   ContactChangeVia = "flow"   // by a flow session
+	ContactChangeViaSystem ContactChangeVia = "system" // by mailroom itself, e.g. handling an inbox message
+)
+
+// ContactChangeProperty is the property of a contact that was changed
+type ContactChangeProperty string
+
+const (
+	ContactChangePropertyName     ContactChangeProperty = "name"
+	ContactChangePropertyLanguage ContactChangeProperty = "language"
+	ContactChangePropertyStatus   ContactChangeProperty = "status"
+	ContactChangePropertyURNs     ContactChangeProperty = "urns"
+	ContactChangePropertyField    ContactChangeProperty = "field"
+	ContactChangePropertyMerge    ContactChangeProperty = "merge" // another contact was merged into this one
+)
+
+// ContactChangeSource is who or what is making changes to contacts outside of a flow session
+type ContactChangeSource struct {
+	Via      ContactChangeVia
+	UserID   UserID
+	ImportID ContactImportID
+}
+
+// ContactChange is a recorded change to a property of a contact
+type ContactChange struct {
+	UUID        uuids.UUID            `json:"uuid"                   dynamodbav:"UUID"`
+	ContactUUID flows.ContactUUID     `json:"contact_uuid"           dynamodbav:"ContactUUID"`
+	OrgID       OrgID                 `json:"-"                      dynamodbav:"OrgID"`
+	Property    ContactChangeProperty `json:"property"               dynamodbav:"Property"`
+	Field       string                `json:"field,omitempty"        dynamodbav:"Field,omitempty"`
+	OldValue    any                   `json:"old_value"              dynamodbav:"OldValue"`
+	NewValue    any                   `json:"new_value"              dynamodbav:"NewValue"`
+	Via         ContactChangeVia      `json:"via"                    dynamodbav:"Via"`
+	UserID      UserID                `json:"user_id,omitempty"      dynamodbav:"UserID,omitempty"`
+	ImportID    ContactImportID       `json:"import_id,omitempty"    dynamodbav:"ImportID,omitempty"`
+	SessionUUID flows.SessionUUID     `json:"session_uuid,omitempty" dynamodbav:"SessionUUID,omitempty"`
+	FlowID      FlowID                `json:"flow_id,omitempty"      dynamodbav:"FlowID,omitempty"`
+	CreatedOn   time.Time             `json:"created_on"             dynamodbav:"CreatedOn"`
+}
+
+// MarshalDynamo marshals this change to a DynamoDB item
+func (c *ContactChange) MarshalDynamo() (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMap(c)
+}
+
+// UnmarshalDynamo unmarshals this change from a DynamoDB item
+func (c *ContactChange) UnmarshalDynamo(m map[string]types.AttributeValue) error {
+	if err := attributevalue.UnmarshalMap(m, c); err != nil {
+		return fmt.Errorf("error unmarshaling contact change: %w", err)
+	}
+	return nil
+}
+
+const (
+	// how many times we retry writing items that DynamoDB returns as unprocessed, e.g. because of throttling
+	contactChangesMaxRetries = 5
+
+	// how long we wait before the first retry, doubling for each retry after that
+	contactChangesRetryBackoff = 100 * time.Millisecond
+)
+
+// InsertContactChanges writes the given contact changes to DynamoDB, retrying any which are returned as unprocessed
+func InsertContactChanges(ctx context.Context, rt *runtime.Runtime, changes []*ContactChange) error {
+	table := rt.Dynamo.TableName("ContactHistory")
+
+	for batch := range slices.Chunk(changes, 25) {
+		writeReqs := make([]types.WriteRequest, len(batch))
+
+		for i, c := range batch {
+			d, err := c.MarshalDynamo()
+			if err != nil {
+				return fmt.Errorf("error marshalling contact change: %w", err)
+			}
+			writeReqs[i] = types.WriteRequest{PutRequest: &types.PutRequest{Item: d}}
+		}
+
+		backoff := contactChangesRetryBackoff
+
+		for retries := 0; len(writeReqs) > 0; retries++ {
+			if retries > 0 {
+				if retries > contactChangesMaxRetries {
+					return fmt.Errorf("error writing contact changes to dynamo: %d items still unprocessed after %d retries", len(writeReqs), contactChangesMaxRetries)
+				}
+
+				slog.Debug("retrying unprocessed contact changes", "count", len(writeReqs), "retry", retries)
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(backoff):
+				}
+				backoff *= 2
+			}
+
+			resp, err := rt.Dynamo.Client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{table: writeReqs},
+			})
+			if err != nil {
+				return fmt.Errorf("error writing contact changes to dynamo: %w", err)
+			}
+
+			writeReqs = resp.UnprocessedItems[table]
+		}
+	}
+
+	return nil
+}
+
+// GetContactHistory returns up to limit recorded changes for the given contact, newest first. If before is provided
+// then only changes older than that change are returned, which allows paging through the history.
+func GetContactHistory(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactUUID flows.ContactUUID, before uuids.UUID, limit int) ([]*ContactChange, error) {
+	keyCond := "ContactUUID = :contact"
+	values := map[string]types.AttributeValue{
+		":contact": &types.AttributeValueMemberS{Value: string(contactUUID)},
+		":org":     &types.AttributeValueMemberN{Value: fmt.Sprint(orgID)},
+	}
+	if before != "" {
+		keyCond += " AND #uuid < :before"
+		values[":before"] = &types.AttributeValueMemberS{Value: string(before)}
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(rt.Dynamo.TableName("ContactHistory")),
+		KeyConditionExpression:    aws.String(keyCond),
+		FilterExpression:          aws.String("OrgID = :org"),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+	}
+	if before != "" {
+		input.ExpressionAttributeNames = map[string]string{"#uuid": "UUID"}
+	}
+
+	changes := make([]*ContactChange, 0, limit)
+
+	for len(changes) < limit {
+		input.Limit = aws.Int32(int32(limit - len(changes)))
+
+		resp, err := rt.Dynamo.Client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("error querying contact history: %w", err)
+		}
+
+		for _, item := range resp.Items {
+			c := &ContactChange{}
+			if err := c.UnmarshalDynamo(item); err != nil {
+				return nil, err
+			}
+			changes = append(changes, c)
+		}
+
+		if len(resp.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+
+	return changes, nil
+}
+
+// the state of a contact's properties before the changes in a scene, keyed by property or field:<key>
+type contactState map[string]any
+
+const sqlSelectContactStates = `
+SELECT c.id, c.name, c.language, c.status, COALESCE(c.fields, '{}') AS fields, ARRAY(
+	SELECT u.identity FROM contacts_contacturn u WHERE u.contact_id = c.id ORDER BY u.priority DESC, u.id
+) AS urns
+  FROM contacts_contact c
+ WHERE c.id = ANY($1)`
+
+// loads the states of the given contacts with a single query
+func loadContactStates(ctx context.Context, tx DBorTx, oa *OrgAssets, contactIDs []ContactID) (map[ContactID]contactState, error) {
+	rows, err := tx.QueryxContext(ctx, sqlSelectContactStates, pq.Array(contactIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error loading contact states: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[ContactID]contactState, len(contactIDs))
+
+	for rows.Next() {
+		row := &struct {
+			ID       ContactID       `db:"id"`
+			Name     *string         `db:"name"`
+			Language *string         `db:"language"`
+			Status   ContactStatus   `db:"status"`
+			Fields   json.RawMessage `db:"fields"`
+			URNs     pq.StringArray  `db:"urns"`
+		}{}
+
+		if err := rows.StructScan(row); err != nil {
+			return nil, fmt.Errorf("error scanning contact state: %w", err)
+		}
+
+		fields := make(map[assets.FieldUUID]struct {
+			Text string `json:"text"`
+		})
+		if err := json.Unmarshal(row.Fields, &fields); err != nil {
+			return nil, fmt.Errorf("error unmarshaling contact fields: %w", err)
+		}
+
+		state := contactState{
+			string(ContactChangePropertyName):     nilIfEmpty(row.Name),
+			string(ContactChangePropertyLanguage): nilIfEmpty(row.Language),
+			string(ContactChangePropertyStatus):   string(contactToFlowStatus[row.Status]),
+			string(ContactChangePropertyURNs):     []string(row.URNs),
+		}
+		for fieldUUID, value := range fields {
+			if f := oa.FieldByUUID(fieldUUID); f != nil && value.Text != "" {
+				state["field:"+f.Key()] = value.Text
+			}
+		}
+
+		states[row.ID] = state
+	}
+
+	return states, rows.Err()
+}
+
+func loadContactState(ctx context.Context, tx DBorTx, oa *OrgAssets, contactID ContactID) (contactState, error) {
+	states, err := loadContactStates(ctx, tx, oa, []ContactID{contactID})
+	if err != nil {
+		return nil, err
+	}
+	state, found := states[contactID]
+	if !found {
+		return nil, fmt.Errorf("error loading contact state: no such contact #%d", contactID)
+	}
+	return state, nil
+}
+
+// the types of events whose handlers record contact changes
+var contactChangeEventTypes = []string{
+	events.TypeContactFieldChanged,
+	events.TypeContactLanguageChanged,
+	events.TypeContactNameChanged,
+	events.TypeContactStatusChanged,
+	events.TypeContactURNsChanged,
+}
+
+// LoadContactStatesForEvents loads the state of the contacts of the given scenes which have events that will record
+// contact changes, with a single query rather than one per contact when their first change is recorded.
+func LoadContactStatesForEvents(ctx context.Context, tx DBorTx, oa *OrgAssets, scenes []*Scene, sceneEvents [][]flows.Event) error {
+	needState := make(map[ContactID]*Scene, len(scenes))
+
+	for i, scene := range scenes {
+		if scene.previousState == nil && slices.ContainsFunc(sceneEvents[i], func(e flows.Event) bool { return slices.Contains(contactChangeEventTypes, e.Type()) }) {
+			needState[scene.ContactID()] = scene
+		}
+	}
+	if len(needState) == 0 {
+		return nil
+	}
+
+	states, err := loadContactStates(ctx, tx, oa, slices.Collect(maps.Keys(needState)))
+	if err != nil {
+		return err
+	}
+
+	for contactID, scene := range needState {
+		if state, found := states[contactID]; found {
+			scene.previousState = state
+		}
+	}
+	return nil
+}
+
+func nilIfEmpty(s *string) any {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return *s
+}
+
+// RecordContactChange records a change to a property (or to the given field) of this scene's contact, using the
+// state of the contact in the database or from a previous change in this scene as the old value. Empty strings are
+// recorded as nil. Returns nil if the new value is the same as the old value.
+func (s *Scene) RecordContactChange(ctx context.Context, tx DBorTx, oa *OrgAssets, property ContactChangeProperty, field *Field, newValue any) (*ContactChange, error) {
+	if s.previousState == nil {
+		state, err := loadContactState(ctx, tx, oa, s.ContactID())
+		if err != nil {
+			return nil, err
+		}
+		s.previousState = state
+	}
+
+	key := string(property)
+	if field != nil {
+		key = "field:" + field.Key()
+	}
+
+	if v, ok := newValue.(string); ok && v == "" {
+		newValue = nil
+	}
+
+	oldValue := s.previousState[key]
+	if reflect.DeepEqual(oldValue, newValue) {
+		return nil, nil
+	}
+	s.previousState[key] = newValue
+
+	change := &ContactChange{
+		UUID:        uuids.NewV7(),
+		ContactUUID: s.ContactUUID(),
+		OrgID:       oa.OrgID(),
+		Property:    property,
+		OldValue:    oldValue,
+		NewValue:    newValue,
+		CreatedOn:   dates.Now(),
+	}
+	if field != nil {
+		change.Field = field.Key()
+	}
+
+	if s.session != nil {
+		change.Via = ContactChangeViaFlow
+		change.SessionUUID = s.session.UUID()
+		change.FlowID = s.session.CurrentFlowID()
+	} else {
+		change.Via = s.source.Via
+		change.UserID = s.source.UserID
+		change.ImportID = s.source.ImportID
+	}
+
+	return change, nil
+}
+
+// LoadContactState loads the current state of this scene's contact from the database to be used as the old values of
+// changes, if it hasn't been loaded already. Should be called before changes are made directly in the database which
+// will be recorded with RecordContactStateChanges.
+func (s *Scene) LoadContactState(ctx context.Context, tx DBorTx, oa *OrgAssets) error {
+	if s.previousState == nil {
+		state, err := loadContactState(ctx, tx, oa, s.ContactID())
+		if err != nil {
+			return err
+		}
+		s.previousState = state
+	}
+	return nil
+}
+
+// RecordContactStateChanges records a change for each property of this scene's contact whose value in the database
+// now differs from its previously loaded state.
+func (s *Scene) RecordContactStateChanges(ctx context.Context, tx DBorTx, oa *OrgAssets) ([]*ContactChange, error) {
+	if err := s.LoadContactState(ctx, tx, oa); err != nil {
+		return nil, err
+	}
+
+	current, err := loadContactState(ctx, tx, oa, s.ContactID())
+	if err != nil {
+		return nil, err
+	}
+
+	// include properties that have been cleared, and sort so changes are recorded in a consistent order
+	keys := make([]string, 0, len(current))
+	for k := range current {
+		keys = append(keys, k)
+	}
+	for k := range s.previousState {
+		if _, ok := current[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	changes := make([]*ContactChange, 0, len(keys))
+	for _, k := range keys {
+		property, field := ContactChangeProperty(k), (*Field)(nil)
+		if key, isField := strings.CutPrefix(k, "field:"); isField {
+			property, field = ContactChangePropertyField, oa.FieldByKey(key)
+		}
+
+		change, err := s.RecordContactChange(ctx, tx, oa, property, field, current[k])
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
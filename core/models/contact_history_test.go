@@ -0,0 +1,82 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	_ "github.com/nyaruka/mailroom/core/handlers"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactHistory(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetDynamo)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Cathy', fields = NULL WHERE id = $1`, testdata.Cathy.ID)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	contact, err := models.LoadContact(ctx, rt.DB, oa, testdata.Cathy.ID)
+	require.NoError(t, err)
+	flowContact, err := contact.FlowContact(oa)
+	require.NoError(t, err)
+
+	age := oa.SessionAssets().Fields().Get("age")
+
+	source := models.ContactChangeSource{Via: models.ContactChangeViaAPI, UserID: testdata.Admin.ID}
+	_, err = models.ApplyModifiers(ctx, rt, oa, source, map[*flows.Contact][]flows.Modifier{
+		flowContact: {
+			modifiers.NewName("Catherine"),
+			modifiers.NewField(age, "23"),
+			modifiers.NewField(age, "24"),
+			modifiers.NewName("Catherine"), // no change so not recorded
+		},
+	})
+	require.NoError(t, err)
+
+	changes, err := models.GetContactHistory(ctx, rt, testdata.Org1.ID, testdata.Cathy.UUID, "", 10)
+	require.NoError(t, err)
+
+	if assert.Len(t, changes, 3) {
+		// newest first
+		assert.Equal(t, models.ContactChangePropertyField, changes[0].Property)
+		assert.Equal(t, "age", changes[0].Field)
+		assert.Equal(t, "23", changes[0].OldValue)
+		assert.Equal(t, "24", changes[0].NewValue)
+
+		assert.Equal(t, models.ContactChangePropertyField, changes[1].Property)
+		assert.Equal(t, "age", changes[1].Field)
+		assert.Nil(t, changes[1].OldValue)
+		assert.Equal(t, "23", changes[1].NewValue)
+
+		assert.Equal(t, models.ContactChangePropertyName, changes[2].Property)
+		assert.Equal(t, "Cathy", changes[2].OldValue)
+		assert.Equal(t, "Catherine", changes[2].NewValue)
+		assert.Equal(t, models.ContactChangeViaAPI, changes[2].Via)
+		assert.Equal(t, testdata.Admin.ID, changes[2].UserID)
+		assert.Equal(t, testdata.Cathy.UUID, changes[2].ContactUUID)
+	}
+
+	// page through
+	changes, err = models.GetContactHistory(ctx, rt, testdata.Org1.ID, testdata.Cathy.UUID, "", 2)
+	require.NoError(t, err)
+	assert.Len(t, changes, 2)
+
+	changes, err = models.GetContactHistory(ctx, rt, testdata.Org1.ID, testdata.Cathy.UUID, changes[1].UUID, 2)
+	require.NoError(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, models.ContactChangePropertyName, changes[0].Property)
+	}
+
+	// changes aren't visible to other orgs
+	changes, err = models.GetContactHistory(ctx, rt, testdata.Org2.ID, testdata.Cathy.UUID, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, changes, 0)
+}
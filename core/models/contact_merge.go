@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// ContactMergeFieldsPolicy is how conflicting field values are resolved when merging contacts
+type ContactMergeFieldsPolicy string
+
+const (
+	ContactMergeKeepTarget = ContactMergeFieldsPolicy("keep_target")
+	ContactMergeKeepSource = ContactMergeFieldsPolicy("keep_source")
+)
+
+// ContactMerge is the result of merging one contact into another
+type ContactMerge struct {
+	URNs          int `json:"urns"`
+	Groups        int `json:"groups"`
+	Tickets       int `json:"tickets"`
+	Msgs          int `json:"msgs"`
+	Runs          int `json:"runs"`
+	EventFires    int `json:"event_fires"`
+	ChannelEvents int `json:"channel_events"`
+	Calls         int `json:"calls"`
+	Interrupted   int `json:"interrupted"`
+}
+
+// the || operator favors values on the right so the order of the operands decides which contact wins
+const sqlMergeContactKeepTarget = `
+UPDATE contacts_contact t
+   SET fields = COALESCE(s.fields, '{}') || COALESCE(t.fields, '{}'),
+       name = COALESCE(NULLIF(t.name, ''), s.name),
+       language = COALESCE(t.language, s.language),
+       modified_on = NOW()
+  FROM contacts_contact s
+ WHERE t.id = $1 AND s.id = $2`
+
+const sqlMergeContactKeepSource = `
+UPDATE contacts_contact t
+   SET fields = COALESCE(t.fields, '{}') || COALESCE(s.fields, '{}'),
+       name = COALESCE(NULLIF(s.name, ''), t.name),
+       language = COALESCE(s.language, t.language),
+       modified_on = NOW()
+  FROM contacts_contact s
+ WHERE t.id = $1 AND s.id = $2`
+
+// moved URNs are ranked below the target's own URNs so that its preferred URN doesn't change, and all are renumbered
+// down from the highest priority so that priorities stay positive and don't collide, returning how many were moved
+const sqlMergeContactURNs = `
+WITH ranked AS (
+    SELECT id, contact_id, ROW_NUMBER() OVER (ORDER BY contact_id = $1 DESC, priority DESC, id) AS rank
+      FROM contacts_contacturn
+     WHERE contact_id = $1 OR contact_id = $2
+), updated AS (
+    UPDATE contacts_contacturn u
+       SET contact_id = $1, priority = 1001 - r.rank
+      FROM ranked r
+     WHERE u.id = r.id
+ RETURNING r.contact_id
+)
+SELECT count(*) FROM updated WHERE contact_id = $2`
+
+// only manual groups are moved as query based groups are recalculated for the target
+const sqlMergeContactGroups = `
+INSERT INTO contacts_contactgroup_contacts(contactgroup_id, contact_id)
+     SELECT gc.contactgroup_id, $1
+       FROM contacts_contactgroup_contacts gc
+       JOIN contacts_contactgroup g ON g.id = gc.contactgroup_id
+      WHERE gc.contact_id = $2 AND g.group_type = 'M' AND NOT EXISTS (
+            SELECT 1 FROM contacts_contactgroup_contacts e WHERE e.contactgroup_id = gc.contactgroup_id AND e.contact_id = $1
+      )`
+
+// fires which haven't happened yet are dropped as they'll be rescheduled for the target if its groups qualify
+const sqlMergeContactEventFires = `
+UPDATE campaigns_eventfire SET contact_id = $1 WHERE contact_id = $2 AND fired IS NOT NULL`
+
+const sqlReleaseMergedContact = `
+UPDATE contacts_contact
+   SET is_active = FALSE, fields = '{}', modified_on = NOW()
+ WHERE id = $1`
+
+// MergeContacts moves everything belonging to the source contact to the target contact and then releases the source.
+// Callers should have locked both contacts, which should have been loaded with the given org assets.
+func MergeContacts(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userID UserID, source, target *Contact, policy ContactMergeFieldsPolicy) (*ContactMerge, error) {
+	if source.ID() == target.ID() {
+		return nil, fmt.Errorf("can't merge a contact into itself")
+	}
+
+	targetContact, err := target.FlowContact(oa)
+	if err != nil {
+		return nil, fmt.Errorf("error creating flow contact: %w", err)
+	}
+
+	// changes to the target are recorded in its history as changes by the user
+	scene := NewSceneForContact(targetContact, ContactChangeSource{Via: ContactChangeViaUser, UserID: userID})
+
+	m := &ContactMerge{}
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := scene.LoadContactState(ctx, tx, oa); err != nil {
+		return nil, fmt.Errorf("error loading target contact state: %w", err)
+	}
+
+	// interrupt the source's sessions before they're moved to the target
+	sessionIDs, err := getWaitingSessionsForContacts(ctx, tx, []ContactID{source.ID()})
+	if err != nil {
+		return nil, fmt.Errorf("error finding sessions for source contact: %w", err)
+	}
+	if err := exitSessionBatch(ctx, tx, sessionIDs, SessionStatusInterrupted); err != nil {
+		return nil, fmt.Errorf("error interrupting source contact: %w", err)
+	}
+	m.Interrupted = len(sessionIDs)
+
+	mergeFields := sqlMergeContactKeepTarget
+	if policy == ContactMergeKeepSource {
+		mergeFields = sqlMergeContactKeepSource
+	}
+
+	moves := []struct {
+		count *int
+		label string
+		sql   string
+	}{
+		{nil, "fields", mergeFields},
+		{&m.Groups, "groups", sqlMergeContactGroups},
+		{&m.Tickets, "tickets", `UPDATE tickets_ticket SET contact_id = $1 WHERE contact_id = $2`},
+		{&m.Msgs, "messages", `UPDATE msgs_msg SET contact_id = $1 WHERE contact_id = $2`},
+		{&m.Runs, "runs", `UPDATE flows_flowrun SET contact_id = $1 WHERE contact_id = $2`},
+		{nil, "sessions", `UPDATE flows_flowsession SET contact_id = $1 WHERE contact_id = $2`},
+		{&m.EventFires, "event fires", sqlMergeContactEventFires},
+		{&m.ChannelEvents, "channel events", `UPDATE channels_channelevent SET contact_id = $1 WHERE contact_id = $2`},
+		{&m.Calls, "calls", `UPDATE ivr_call SET contact_id = $1 WHERE contact_id = $2`},
+		{nil, "ticket events", `UPDATE tickets_ticketevent SET contact_id = $1 WHERE contact_id = $2`},
+		{nil, "notes", `UPDATE contacts_contactnote SET contact_id = $1 WHERE contact_id = $2`},
+		{nil, "airtime transfers", `UPDATE airtime_airtimetransfer SET contact_id = $1 WHERE contact_id = $2`},
+	}
+
+	if err := tx.GetContext(ctx, &m.URNs, sqlMergeContactURNs, target.ID(), source.ID()); err != nil {
+		return nil, fmt.Errorf("error merging URNs: %w", err)
+	}
+
+	for _, mv := range moves {
+		res, err := tx.ExecContext(ctx, mv.sql, target.ID(), source.ID())
+		if err != nil {
+			return nil, fmt.Errorf("error merging %s: %w", mv.label, err)
+		}
+		if mv.count != nil {
+			n, _ := res.RowsAffected()
+			*mv.count = int(n)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE contacts_contact SET ticket_count = (SELECT count(*) FROM tickets_ticket WHERE contact_id = $1) WHERE id = $1`, target.ID()); err != nil {
+		return nil, fmt.Errorf("error updating ticket count: %w", err)
+	}
+
+	// remove the source from groups and unfired campaign events, and release it
+	if _, err := tx.ExecContext(ctx, sqlDeleteAllContactGroups, oa.OrgID(), source.ID()); err != nil {
+		return nil, fmt.Errorf("error removing source contact from groups: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM campaigns_eventfire WHERE contact_id = $1 AND fired IS NULL`, source.ID()); err != nil {
+		return nil, fmt.Errorf("error deleting unfired event fires: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, sqlReleaseMergedContact, source.ID()); err != nil {
+		return nil, fmt.Errorf("error releasing source contact: %w", err)
+	}
+
+	// record the changes to the target's name, language, fields and URNs in its history
+	changes, err := scene.RecordContactStateChanges(ctx, tx, oa)
+	if err != nil {
+		return nil, fmt.Errorf("error recording merge changes: %w", err)
+	}
+
+	// and the merge itself so that the history shows which contact was merged in
+	merge, err := scene.RecordContactChange(ctx, tx, oa, ContactChangePropertyMerge, nil, map[string]any{"id": source.ID(), "uuid": source.UUID()})
+	if err != nil {
+		return nil, fmt.Errorf("error recording merge: %w", err)
+	}
+	changes = append(changes, merge)
+
+	// reload the target so that we can recalculate its query based groups with its new fields and URNs
+	merged, err := LoadContact(ctx, tx, oa, target.ID())
+	if err != nil {
+		return nil, fmt.Errorf("error reloading target contact: %w", err)
+	}
+	flowContact, err := merged.FlowContact(oa)
+	if err != nil {
+		return nil, fmt.Errorf("error creating flow contact: %w", err)
+	}
+	if err := CalculateDynamicGroups(ctx, tx, oa, []*flows.Contact{flowContact}); err != nil {
+		return nil, fmt.Errorf("error calculating dynamic groups: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing merge: %w", err)
+	}
+
+	// merge is already committed so don't error if we can't write its history
+	if err := InsertContactChanges(ctx, rt, changes); err != nil {
+		slog.Error("error inserting contact changes for merge", "error", err, "contact_id", target.ID())
+	}
+
+	return m, nil
+}
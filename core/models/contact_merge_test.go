@@ -0,0 +1,99 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeContacts(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetDynamo)
+
+	source := testdata.InsertContact(rt, testdata.Org1, "a3f1e0a8-54b7-4c9a-a1a5-3f1b3e1b2c01", "Bobby", "", models.ContactStatusActive)
+	target := testdata.InsertContact(rt, testdata.Org1, "a3f1e0a8-54b7-4c9a-a1a5-3f1b3e1b2c02", "Robert", "eng", models.ContactStatusActive)
+
+	source.URNID = testdata.InsertContactURN(rt, testdata.Org1, source, urns.URN("whatsapp:16055740001"), 1000, nil)
+	testdata.InsertContactURN(rt, testdata.Org1, target, urns.URN("tel:+16055740001"), 1000, nil)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = jsonb_build_object($2::text, jsonb_build_object('text', 'M')) WHERE id = $1`, source.ID, testdata.GenderField.UUID)
+	rt.DB.MustExec(`INSERT INTO contacts_contactgroup_contacts(contactgroup_id, contact_id) VALUES($1, $2)`, testdata.DoctorsGroup.ID, source.ID)
+
+	testdata.InsertIncomingMsg(rt, testdata.Org1, testdata.TwilioChannel, source, "hi", models.MsgStatusHandled)
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, source, "hello", nil, models.MsgStatusSent, false)
+	testdata.InsertOpenTicket(rt, testdata.Org1, source, testdata.DefaultTopic, time.Now(), nil)
+	testdata.InsertChannelEvent(rt, testdata.Org1, models.EventTypeMissedCall, testdata.TwilioChannel, source, models.EventStatusHandled)
+	testdata.InsertCall(rt, testdata.Org1, testdata.TwilioChannel, source)
+	testdata.InsertWaitingSession(rt, testdata.Org1, source, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), true, nil)
+
+	oa := testdata.Org1.Load(rt)
+
+	contacts, err := models.LoadContacts(ctx, rt.DB, oa, []models.ContactID{source.ID, target.ID})
+	require.NoError(t, err)
+	require.Len(t, contacts, 2)
+
+	sourceContact, targetContact := contacts[0], contacts[1]
+	if sourceContact.ID() != source.ID {
+		sourceContact, targetContact = targetContact, sourceContact
+	}
+
+	merge, err := models.MergeContacts(ctx, rt, oa, testdata.Admin.ID, sourceContact, targetContact, models.ContactMergeKeepTarget)
+	require.NoError(t, err)
+	assert.Equal(t, &models.ContactMerge{URNs: 1, Groups: 1, Tickets: 1, Msgs: 2, Runs: 0, EventFires: 0, ChannelEvents: 1, Calls: 1, Interrupted: 1}, merge)
+
+	// target keeps its name and language but gets the fields it didn't have
+	assertdb.Query(t, rt.DB, `SELECT name FROM contacts_contact WHERE id = $1`, target.ID).Returns("Robert")
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, target.ID, testdata.GenderField.UUID).Returns("M")
+	assertdb.Query(t, rt.DB, `SELECT ticket_count FROM contacts_contact WHERE id = $1`, target.ID).Returns(1)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contacturn WHERE contact_id = $1`, target.ID).Returns(2)
+
+	// moved URNs are ranked below the target's own URNs even though they had the same priority
+	assertdb.Query(t, rt.DB, `SELECT priority FROM contacts_contacturn WHERE identity = 'tel:+16055740001'`).Returns(1000)
+	assertdb.Query(t, rt.DB, `SELECT priority FROM contacts_contacturn WHERE identity = 'whatsapp:16055740001'`).Returns(999)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contact_id = $1 AND contactgroup_id = $2`, target.ID, testdata.DoctorsGroup.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1`, target.ID).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM channels_channelevent WHERE contact_id = $1`, target.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM ivr_call WHERE contact_id = $1`, target.ID).Returns(1)
+
+	// changes to the target are recorded in its history
+	changes, err := models.GetContactHistory(ctx, rt, testdata.Org1.ID, target.UUID, "", 10)
+	require.NoError(t, err)
+	if assert.Len(t, changes, 3) {
+		assert.Equal(t, models.ContactChangePropertyMerge, changes[0].Property)
+		assert.Nil(t, changes[0].OldValue)
+		test.AssertEqualJSON(t, []byte(fmt.Sprintf(`{"id": %d, "uuid": "%s"}`, source.ID, source.UUID)), jsonx.MustMarshal(changes[0].NewValue))
+		assert.Equal(t, models.ContactChangeViaUser, changes[0].Via)
+		assert.Equal(t, testdata.Admin.ID, changes[0].UserID)
+
+		assert.Equal(t, models.ContactChangePropertyURNs, changes[1].Property)
+		assert.Equal(t, []any{"tel:+16055740001", "whatsapp:16055740001"}, changes[1].NewValue)
+		assert.Equal(t, models.ContactChangeViaUser, changes[1].Via)
+		assert.Equal(t, testdata.Admin.ID, changes[1].UserID)
+
+		assert.Equal(t, models.ContactChangePropertyField, changes[2].Property)
+		assert.Equal(t, "gender", changes[2].Field)
+		assert.Nil(t, changes[2].OldValue)
+		assert.Equal(t, "M", changes[2].NewValue)
+	}
+
+	// source has been interrupted and released
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowsession WHERE contact_id = $1 AND status = 'W'`, target.ID).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT is_active FROM contacts_contact WHERE id = $1`, source.ID).Returns(false)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contact_id = $1`, source.ID).Returns(0)
+
+	// can't merge a contact into itself
+	_, err = models.MergeContacts(ctx, rt, oa, testdata.Admin.ID, targetContact, targetContact, models.ContactMergeKeepTarget)
+	assert.EqualError(t, err, "can't merge a contact into itself")
+}
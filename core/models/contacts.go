@@ -1073,7 +1073,7 @@ func CalculateDynamicGroups(ctx context.Context, db DBorTx, oa *OrgAssets, conta
 		for _, ce := range campaign.Events() {
 
 			for _, contact := range eligibleContacts {
-				scheduled, err := ce.ScheduleForContact(tz, now, contact)
+				scheduled, err := ce.ScheduleForContact(tz, oa.Org().Holidays(), now, contact)
 				if err != nil {
 					return fmt.Errorf("error calculating schedule for event: %d: %w", ce.ID(), err)
 				}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+)
+
+// ContentFilterAction is what a content filter decides should happen to a message
+type ContentFilterAction string
+
+const (
+	ContentFilterActionAllow  = ContentFilterAction("allow")
+	ContentFilterActionFlag   = ContentFilterAction("flag")
+	ContentFilterActionRedact = ContentFilterAction("redact")
+	ContentFilterActionBlock  = ContentFilterAction("block")
+)
+
+// ContentFilterDecision is the decision of a content filter about a message
+type ContentFilterDecision struct {
+	Action ContentFilterAction `json:"action"`
+	Reason string              `json:"reason,omitempty"`
+
+	// replacement text for redacted messages
+	Text string `json:"-"`
+
+	// labels to add to incoming messages
+	Labels []assets.LabelUUID `json:"-"`
+}
+
+// ContentFilter is something which can inspect the text of messages before they're sent or handled
+type ContentFilter interface {
+	Filter(ctx context.Context, direction MsgDirection, text string) (*ContentFilterDecision, error)
+}
+
+// ContentFilterConstructor creates a content filter from the config of an org
+type ContentFilterConstructor func(config map[string]any) (ContentFilter, error)
+
+const orgConfigContentFilter = "content_filter"
+
+var contentFilterConstructors = make(map[string]ContentFilterConstructor)
+
+// RegisterContentFilterType registers a new type of content filter
+func RegisterContentFilterType(typ string, constructor ContentFilterConstructor) {
+	contentFilterConstructors[typ] = constructor
+}
+
+// creates a content filter from the given org config value, returning nil if it's missing or invalid
+func readContentFilter(v any) ContentFilter {
+	config, _ := v.(map[string]any)
+	if config == nil {
+		return nil
+	}
+
+	typ, _ := config["type"].(string)
+	constructor := contentFilterConstructors[typ]
+	if constructor == nil {
+		slog.Error("unknown content filter type", "type", typ)
+		return nil
+	}
+
+	filter, err := constructor(config)
+	if err != nil {
+		slog.Error("error creating content filter", "type", typ, "error", err)
+		return nil
+	}
+	return filter
+}
+
+// FilterContent runs the given text through the org's content filter if it has one. If the filter errors, we log and
+// allow the message rather than hold up messaging.
+func (o *Org) FilterContent(ctx context.Context, direction MsgDirection, text string) *ContentFilterDecision {
+	if o.contentFilter == nil || text == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	decision, err := o.contentFilter.Filter(ctx, direction, text)
+	if err != nil {
+		slog.Error("error filtering message content", "org_id", o.ID(), "error", err)
+		return nil
+	}
+	if decision == nil || decision.Action == ContentFilterActionAllow {
+		return nil
+	}
+	return decision
+}
+
+const sqlUpdateMsgContentFilter = `
+UPDATE msgs_msg
+   SET metadata = (COALESCE(metadata, '{}')::jsonb || jsonb_build_object('content_filter', jsonb_build_object('action', $2::text, 'reason', $3::text)))::text
+ WHERE id = $1`
+
+// RecordIncomingContentFilter records the given content filter decision on an incoming message and applies its labels
+func RecordIncomingContentFilter(ctx context.Context, db DBorTx, oa *OrgAssets, msgID MsgID, decision *ContentFilterDecision) error {
+	if _, err := db.ExecContext(ctx, sqlUpdateMsgContentFilter, msgID, decision.Action, decision.Reason); err != nil {
+		return fmt.Errorf("error recording content filter decision on msg #%d: %w", msgID, err)
+	}
+
+	adds := make([]*MsgLabelAdd, 0, len(decision.Labels))
+	for _, labelUUID := range decision.Labels {
+		label := oa.LabelByUUID(labelUUID)
+		if label != nil {
+			adds = append(adds, &MsgLabelAdd{MsgID: msgID, LabelID: label.ID()})
+		}
+	}
+
+	return AddMsgLabels(ctx, db, adds)
+}
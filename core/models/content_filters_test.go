@@ -0,0 +1,142 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testFilter struct {
+	err error
+}
+
+func (f *testFilter) Filter(ctx context.Context, direction models.MsgDirection, text string) (*models.ContentFilterDecision, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if text == "bad" {
+		return &models.ContentFilterDecision{Action: models.ContentFilterActionBlock, Reason: "is bad"}, nil
+	}
+	if text == "rude" {
+		return &models.ContentFilterDecision{Action: models.ContentFilterActionRedact, Reason: "is rude", Text: "****"}, nil
+	}
+	return &models.ContentFilterDecision{Action: models.ContentFilterActionAllow}, nil
+}
+
+func registerTestFilter() {
+	models.RegisterContentFilterType("test", func(config map[string]any) (models.ContentFilter, error) {
+		if config["broken"] == true {
+			return &testFilter{err: errors.New("boom")}, nil
+		}
+		return &testFilter{}, nil
+	})
+}
+
+func TestFilterContent(t *testing.T) {
+	ctx := context.Background()
+
+	registerTestFilter()
+
+	// org without a content filter allows everything
+	org := &models.Org{}
+	require.NoError(t, org.UnmarshalJSON([]byte(`{"id": 1, "config": {}}`)))
+	assert.Nil(t, org.FilterContent(ctx, models.DirectionOut, "bad"))
+
+	// as does an org with an unknown filter type
+	org = &models.Org{}
+	require.NoError(t, org.UnmarshalJSON([]byte(`{"id": 1, "config": {"content_filter": {"type": "xxx"}}}`)))
+	assert.Nil(t, org.FilterContent(ctx, models.DirectionOut, "bad"))
+
+	org = &models.Org{}
+	require.NoError(t, org.UnmarshalJSON([]byte(`{"id": 1, "config": {"content_filter": {"type": "test"}}}`)))
+	assert.Nil(t, org.FilterContent(ctx, models.DirectionOut, "good"))
+	assert.Equal(t, &models.ContentFilterDecision{Action: models.ContentFilterActionBlock, Reason: "is bad"}, org.FilterContent(ctx, models.DirectionOut, "bad"))
+
+	// filter errors are treated as allowing the message
+	org = &models.Org{}
+	require.NoError(t, org.UnmarshalJSON([]byte(`{"id": 1, "config": {"content_filter": {"type": "test", "broken": true}}}`)))
+	assert.Nil(t, org.FilterContent(ctx, models.DirectionOut, "bad"))
+}
+
+func TestPrepareMessages(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	registerTestFilter()
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"content_filter": {"type": "test"}}' WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	channel := oa.ChannelByUUID(testdata.TwilioChannel.UUID)
+	_, cathy, _ := testdata.Cathy.Load(rt, oa)
+
+	newOutgoing := func(text string) *models.Msg {
+		out := flows.NewMsgOut(cathy.PreferredURN().URN(), assets.NewChannelReference(testdata.TwilioChannel.UUID, "Twilio"), &flows.MsgContent{Text: text}, nil, flows.NilMsgTopic, "", flows.NilUnsendableReason)
+		msg, err := models.NewOutgoingChatMsg(rt, oa.Org(), channel, cathy, out, testdata.Admin.ID)
+		require.NoError(t, err)
+		return msg
+	}
+
+	msgs := []*models.Msg{newOutgoing("good"), newOutgoing("bad"), newOutgoing("rude"), newOutgoing("bad")}
+
+	// messages aren't filtered when they're created
+	for _, m := range msgs {
+		assert.Equal(t, models.MsgStatusInitializing, m.Status())
+	}
+
+	require.NoError(t, models.InsertMessages(ctx, rt.DB, msgs))
+	require.NoError(t, models.PrepareMessages(ctx, rt, oa, rt.DB, msgs))
+
+	assert.Equal(t, models.MsgStatusQueued, msgs[0].Status())
+	assert.Equal(t, models.MsgStatusFailed, msgs[1].Status())
+	assert.Equal(t, models.MsgFailedContentFilter, msgs[1].FailedReason())
+	assert.Equal(t, models.MsgStatusQueued, msgs[2].Status())
+	assert.Equal(t, "****", msgs[2].Text())
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE status = 'F' AND failed_reason = 'B' AND metadata::jsonb->'content_filter'->>'reason' = 'is bad'`).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE status = 'Q' AND text = '****' AND metadata::jsonb->'content_filter'->>'action' = 'redact'`).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE status = 'Q' AND text = 'good' AND NOT COALESCE(metadata, '{}')::jsonb ? 'content_filter'`).Returns(1)
+
+	// preparing again is a noop
+	require.NoError(t, models.PrepareMessages(ctx, rt, oa, rt.DB, msgs))
+	assert.Equal(t, models.MsgStatusQueued, msgs[0].Status())
+}
+
+func TestRecordIncomingContentFilter(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	in1 := testdata.InsertIncomingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "buy now", models.MsgStatusPending)
+	in2 := testdata.InsertIncomingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "hello", models.MsgStatusPending)
+	rt.DB.MustExec(`UPDATE msgs_msg SET metadata = '{"topic": "agent"}' WHERE id = $1`, in2.ID)
+
+	decision := &models.ContentFilterDecision{Action: models.ContentFilterActionFlag, Reason: "spam", Labels: []assets.LabelUUID{testdata.ReportingLabel.UUID}}
+
+	err = models.RecordIncomingContentFilter(ctx, rt.DB, oa, in1.ID, decision)
+	assert.NoError(t, err)
+
+	err = models.RecordIncomingContentFilter(ctx, rt.DB, oa, in2.ID, decision)
+	assert.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT metadata::jsonb->'content_filter'->>'action' FROM msgs_msg WHERE id = $1`, in1.ID).Returns("flag")
+	assertdb.Query(t, rt.DB, `SELECT metadata::jsonb->'content_filter'->>'reason' FROM msgs_msg WHERE id = $1`, in2.ID).Returns("spam")
+	assertdb.Query(t, rt.DB, `SELECT metadata::jsonb->>'topic' FROM msgs_msg WHERE id = $1`, in2.ID).Returns("agent") // existing metadata is kept
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg_labels WHERE label_id = $1`, testdata.ReportingLabel.ID).Returns(2)
+}
@@ -16,7 +16,10 @@ import (
 type Scene struct {
 	contact *flows.Contact
 	session *Session
-	userID  UserID
+	source  ContactChangeSource
+
+	// state of the contact before changes in this scene, loaded when the first change is recorded
+	previousState contactState
 
 	preCommits  map[EventCommitHook][]any
 	postCommits map[EventCommitHook][]any
@@ -34,10 +37,10 @@ func NewSceneForSession(session *Session) *Scene {
 }
 
 // NewSceneForContact creates a new scene for the passed in contact, session will be nil
-func NewSceneForContact(contact *flows.Contact, userID UserID) *Scene {
+func NewSceneForContact(contact *flows.Contact, source ContactChangeSource) *Scene {
 	return &Scene{
 		contact: contact,
-		userID:  userID,
+		source:  source,
 
 		preCommits:  make(map[EventCommitHook][]any),
 		postCommits: make(map[EventCommitHook][]any),
@@ -60,7 +63,7 @@ func (s *Scene) ContactUUID() flows.ContactUUID { return s.contact.UUID() }
 func (s *Scene) Session() *Session { return s.session }
 
 // User returns the user ID for this scene if any
-func (s *Scene) UserID() UserID { return s.userID }
+func (s *Scene) UserID() UserID { return s.source.UserID }
 
 // AppendToEventPreCommitHook adds a new event to be handled by a pre commit hook
 func (s *Scene) AppendToEventPreCommitHook(hook EventCommitHook, event any) {
@@ -187,11 +190,11 @@ func ApplyEventPostCommitHooks(ctx context.Context, rt *runtime.Runtime, tx *sql
 }
 
 // HandleAndCommitEvents takes a set of contacts and events, handles the events and applies any hooks, and commits everything
-func HandleAndCommitEvents(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userID UserID, contactEvents map[*flows.Contact][]flows.Event) error {
+func HandleAndCommitEvents(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, source ContactChangeSource, contactEvents map[*flows.Contact][]flows.Event) error {
 	// create scenes for each contact
 	scenes := make([]*Scene, 0, len(contactEvents))
 	for contact := range contactEvents {
-		scene := NewSceneForContact(contact, userID)
+		scene := NewSceneForContact(contact, source)
 		scenes = append(scenes, scene)
 	}
 
@@ -201,6 +204,16 @@ func HandleAndCommitEvents(ctx context.Context, rt *runtime.Runtime, oa *OrgAsse
 		return fmt.Errorf("error beginning transaction: %w", err)
 	}
 
+	sceneEvents := make([][]flows.Event, len(scenes))
+	for i, scene := range scenes {
+		sceneEvents[i] = contactEvents[scene.Contact()]
+	}
+
+	// load the previous state of contacts being changed, so that changes can be recorded without a query per contact
+	if err := LoadContactStatesForEvents(ctx, tx, oa, scenes, sceneEvents); err != nil {
+		return fmt.Errorf("error loading contact states: %w", err)
+	}
+
 	// handle the events to create the hooks on each scene
 	for _, scene := range scenes {
 		err := HandleEvents(ctx, rt, tx, oa, scene, contactEvents[scene.Contact()])
@@ -242,7 +255,7 @@ func HandleAndCommitEvents(ctx context.Context, rt *runtime.Runtime, oa *OrgAsse
 // ApplyModifiers modifies contacts by applying modifiers and handling the resultant events
 // Note that we don't load the user object from org assets because it's possible that the user isn't part
 // of the org, e.g. customer support.
-func ApplyModifiers(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userID UserID, modifiersByContact map[*flows.Contact][]flows.Modifier) (map[*flows.Contact][]flows.Event, error) {
+func ApplyModifiers(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, source ContactChangeSource, modifiersByContact map[*flows.Contact][]flows.Modifier) (map[*flows.Contact][]flows.Event, error) {
 	// create an environment instance with location support
 	env := flows.NewAssetsEnvironment(oa.Env(), oa.SessionAssets().Locations())
 
@@ -259,7 +272,7 @@ func ApplyModifiers(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, use
 		eventsByContact[contact] = events
 	}
 
-	err := HandleAndCommitEvents(ctx, rt, oa, userID, eventsByContact)
+	err := HandleAndCommitEvents(ctx, rt, oa, source, eventsByContact)
 	if err != nil {
 		return nil, fmt.Errorf("error commiting events: %w", err)
 	}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dbutil"
+	"github.com/nyaruka/gocommon/jsonx"
+)
+
+// how long population state is kept for, after which the next population of a group will be a full one
+const groupPopulationExpire = time.Hour * 24 * 30
+
+// GroupPopulation is the state of the last or current population of a smart group. It's stored in redis so that
+// progress can be reported for large groups and so that later populations can only re-evaluate contacts which have
+// been modified since.
+type GroupPopulation struct {
+	GroupID     GroupID    `json:"group_id"`
+	Query       string     `json:"query"`
+	Incremental bool       `json:"incremental"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	StartedOn   time.Time  `json:"started_on"`
+	CompletedOn *time.Time `json:"completed_on"`
+
+	// all contacts modified on or before this time have been evaluated against the query
+	EvaluatedAsOf *time.Time `json:"evaluated_as_of"`
+}
+
+func groupPopulationKey(groupID GroupID) string {
+	return fmt.Sprintf("group_population:%d", groupID)
+}
+
+// GetGroupPopulation gets the state of the last or current population of the given group, or nil if there isn't one
+func GetGroupPopulation(rc redis.Conn, groupID GroupID) (*GroupPopulation, error) {
+	data, err := redis.Bytes(rc.Do("GET", groupPopulationKey(groupID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting group population: %w", err)
+	}
+
+	p := &GroupPopulation{}
+	if err := jsonx.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("error unmarshaling group population: %w", err)
+	}
+	return p, nil
+}
+
+// Save saves the state of this population
+func (p *GroupPopulation) Save(rc redis.Conn) error {
+	if _, err := rc.Do("SET", groupPopulationKey(p.GroupID), jsonx.MustMarshal(p), "EX", int(groupPopulationExpire/time.Second)); err != nil {
+		return fmt.Errorf("error saving group population: %w", err)
+	}
+	return nil
+}
+
+const sqlSelectContactIDsModifiedSince = `
+  SELECT id
+    FROM contacts_contact
+   WHERE org_id = $1 AND is_active = TRUE AND modified_on > $2
+ORDER BY id`
+
+// GetContactIDsModifiedSince returns the ids of the active contacts in the given org modified after the given time
+func GetContactIDsModifiedSince(ctx context.Context, db Queryer, orgID OrgID, since time.Time) ([]ContactID, error) {
+	rows, err := db.QueryContext(ctx, sqlSelectContactIDsModifiedSince, orgID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting contacts modified since %s: %w", since, err)
+	}
+
+	ids, err := dbutil.ScanAllSlice(rows, make([]ContactID, 0, 100))
+	if err != nil {
+		return nil, fmt.Errorf("error scanning contact ids: %w", err)
+	}
+	return ids, nil
+}
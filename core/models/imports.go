@@ -1,14 +1,19 @@
 package models
 
 import (
+	"cmp"
 	"context"
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/jsonx"
@@ -125,6 +130,12 @@ type importContact struct {
 	flowContact *flows.Contact
 	mods        []flows.Modifier
 	errors      []string
+	failed      bool
+
+	// extra information gathered for dry runs
+	urnErr        error
+	unknownFields []string
+	unknownGroups []assets.GroupUUID
 }
 
 func (b *ContactImportBatch) tryImport(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userID UserID) error {
@@ -132,22 +143,22 @@ func (b *ContactImportBatch) tryImport(ctx context.Context, rt *runtime.Runtime,
 		return fmt.Errorf("error marking as processing: %w", err)
 	}
 
-	// unmarshal this batch's specs
-	var specs []*ContactSpec
-	if err := jsonx.Unmarshal(b.Specs, &specs); err != nil {
-		return fmt.Errorf("error unmarsaling specs: %w", err)
-	}
-
 	// create our work data for each contact being created or updated
-	imports := make([]*importContact, len(specs))
-	for i := range imports {
-		imports[i] = &importContact{record: b.RecordStart + i, spec: specs[i]}
+	imports, err := b.loadImports(oa)
+	if err != nil {
+		return err
 	}
 
 	if err := b.getOrCreateContacts(ctx, rt.DB, oa, imports); err != nil {
 		return fmt.Errorf("error getting and creating contacts: %w", err)
 	}
 
+	source := ContactChangeSource{Via: ContactChangeViaImport, UserID: userID, ImportID: b.ImportID}
+
+	if err := b.recordCreatedContacts(ctx, rt, oa, source, imports); err != nil {
+		return fmt.Errorf("error recording created contacts: %w", err)
+	}
+
 	// gather up contacts and modifiers
 	modifiersByContact := make(map[*flows.Contact][]flows.Modifier, len(imports))
 	for _, imp := range imports {
@@ -158,7 +169,7 @@ func (b *ContactImportBatch) tryImport(ctx context.Context, rt *runtime.Runtime,
 	}
 
 	// and apply in bulk
-	_, err := ApplyModifiers(ctx, rt, oa, userID, modifiersByContact)
+	_, err = ApplyModifiers(ctx, rt, oa, source, modifiersByContact)
 	if err != nil {
 		return fmt.Errorf("error applying modifiers: %w", err)
 	}
@@ -170,96 +181,450 @@ func (b *ContactImportBatch) tryImport(ctx context.Context, rt *runtime.Runtime,
 	return nil
 }
 
-// for each import, fetches or creates the contact, creates the modifiers needed to set fields etc
-func (b *ContactImportBatch) getOrCreateContacts(ctx context.Context, db *sqlx.DB, oa *OrgAssets, imports []*importContact) error {
-	sa := oa.SessionAssets()
+// the maximum number of each kind of issue, e.g. errors, included in a dry run report
+const maxImportReportIssues = 100
+
+// ContactImportReport is the result of a dry run of a contact import
+type ContactImportReport struct {
+	NumCreate     int                `json:"num_create"`
+	NumUpdate     int                `json:"num_update"`
+	NumErrored    int                `json:"num_errored"`
+	InvalidURNs   []importInvalidURN `json:"invalid_urns"`
+	UnknownFields []string           `json:"unknown_fields"`
+	UnknownGroups []assets.GroupUUID `json:"unknown_groups"`
+	Truncated     []importTruncation `json:"truncated"`
+	Errors        []importError      `json:"errors"`
+	Incomplete    bool               `json:"incomplete"` // whether some records weren't checked or some issues aren't listed
+
+	// URN identities and match keys of contacts which would be created by earlier records
+	wouldCreate map[string]bool
+}
 
-	// build map of UUIDs to contacts
-	contactsByUUID, err := b.loadContactsByUUID(ctx, db, oa, imports)
+// NewContactImportReport creates a new empty dry run report
+func NewContactImportReport() *ContactImportReport {
+	return &ContactImportReport{
+		InvalidURNs:   []importInvalidURN{},
+		UnknownFields: []string{},
+		UnknownGroups: []assets.GroupUUID{},
+		Truncated:     []importTruncation{},
+		Errors:        []importError{},
+		wouldCreate:   make(map[string]bool),
+	}
+}
+
+// a URN which isn't valid in a particular record
+type importInvalidURN struct {
+	Record int      `json:"record"`
+	Row    int      `json:"row"`
+	URN    urns.URN `json:"urn"`
+}
+
+// a field value which will be truncated in a particular record
+type importTruncation struct {
+	Record int    `json:"record"`
+	Row    int    `json:"row"`
+	Field  string `json:"field"`
+	Length int    `json:"length"`
+}
+
+// DryRun works out what importing this batch would do without writing anything, and adds that to the given report
+func (b *ContactImportBatch) DryRun(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, report *ContactImportReport) error {
+	imports, err := b.loadImports(oa)
 	if err != nil {
-		return fmt.Errorf("error loading contacts by UUID: %w", err)
+		return err
+	}
+
+	if err := b.findContacts(ctx, rt.DB, oa, imports, report.wouldCreate); err != nil {
+		return fmt.Errorf("error finding contacts: %w", err)
+	}
+
+	unknownFields := make(map[string]bool, len(report.UnknownFields))
+	for _, k := range report.UnknownFields {
+		unknownFields[k] = true
+	}
+	unknownGroups := make(map[assets.GroupUUID]bool, len(report.UnknownGroups))
+	for _, g := range report.UnknownGroups {
+		unknownGroups[g] = true
 	}
 
 	for _, imp := range imports {
-		addModifier := func(m flows.Modifier) { imp.mods = append(imp.mods, m) }
-		addError := func(s string, args ...any) { imp.errors = append(imp.errors, fmt.Sprintf(s, args...)) }
-		spec := imp.spec
-
-		isActive := spec.Status == "" || spec.Status == flows.ContactStatusActive
-
-		uuid := spec.UUID
-		if uuid != "" {
-			imp.contact = contactsByUUID[uuid]
-			if imp.contact == nil {
-				addError("Unable to find contact with UUID '%s'", uuid)
-				continue
+		row := imp.spec.ImportRow
+
+		if imp.failed {
+			report.NumErrored++
+		} else if imp.created {
+			report.NumCreate++
+		} else {
+			report.NumUpdate++
+		}
+
+		var urnErr *URNError
+		if errors.As(imp.urnErr, &urnErr) && urnErr.Code == "invalid" {
+			report.InvalidURNs = addImportIssue(report, report.InvalidURNs, importInvalidURN{Record: imp.record, Row: row, URN: imp.spec.URNs[urnErr.Index]})
+		}
+
+		for _, k := range imp.unknownFields {
+			if !unknownFields[k] {
+				report.UnknownFields = append(report.UnknownFields, k)
+				unknownFields[k] = true
+			}
+		}
+		for _, g := range imp.unknownGroups {
+			if !unknownGroups[g] {
+				report.UnknownGroups = append(report.UnknownGroups, g)
+				unknownGroups[g] = true
 			}
+		}
 
-			imp.flowContact, err = imp.contact.FlowContact(oa)
-			if err != nil {
-				return fmt.Errorf("error creating flow contact for %d: %w", imp.contact.ID(), err)
+		for key, value := range imp.spec.Fields {
+			if length := utf8.RuneCountInString(value); length > rt.Config.MaxValueLength {
+				report.Truncated = addImportIssue(report, report.Truncated, importTruncation{Record: imp.record, Row: row, Field: key, Length: length})
 			}
+		}
 
-		} else {
-			imp.contact, imp.flowContact, imp.created, err = GetOrCreateContact(ctx, db, oa, spec.URNs, NilChannelID)
-			if err != nil {
-				urnStrs := make([]string, len(spec.URNs))
-				for i := range spec.URNs {
-					urnStrs[i] = string(spec.URNs[i].Identity())
-				}
+		for _, e := range imp.errors {
+			report.Errors = addImportIssue(report, report.Errors, importError{Record: imp.record, Row: row, Message: e})
+		}
+	}
 
-				addError("Unable to find or create contact with URNs %s", strings.Join(urnStrs, ", "))
-				continue
-			}
+	// make these deterministic as fields are iterated as a map
+	slices.Sort(report.UnknownFields)
+	slices.SortStableFunc(report.Truncated, func(a, b importTruncation) int {
+		return cmp.Or(cmp.Compare(a.Record, b.Record), strings.Compare(a.Field, b.Field))
+	})
+
+	return nil
+}
+
+// adds an issue to one of the lists of the given report, unless that list is full in which case the report is marked as
+// incomplete instead
+func addImportIssue[T any](report *ContactImportReport, issues []T, issue T) []T {
+	if len(issues) >= maxImportReportIssues {
+		report.Incomplete = true
+		return issues
+	}
+	return append(issues, issue)
+}
+
+// unmarshals this batch's specs and creates the work data for each contact being created or updated
+func (b *ContactImportBatch) loadImports(oa *OrgAssets) ([]*importContact, error) {
+	var specs []*ContactSpec
+	if err := jsonx.Unmarshal(b.Specs, &specs); err != nil {
+		return nil, fmt.Errorf("error unmarsaling specs: %w", err)
+	}
+
+	country := oa.Env().DefaultCountry()
+
+	imports := make([]*importContact, len(specs))
+	for i, spec := range specs {
+		if spec.NormalizeURNs {
+			spec.URNs = normalizeImportURNs(spec.URNs, country)
 		}
 
-		addModifier(modifiers.NewURNs(spec.URNs, modifiers.URNsAppend))
+		imports[i] = &importContact{record: b.RecordStart + i, spec: spec}
+	}
+	return imports, nil
+}
+
+// for each import, fetches or creates the contact, creates the modifiers needed to set fields etc
+func (b *ContactImportBatch) getOrCreateContacts(ctx context.Context, db *sqlx.DB, oa *OrgAssets, imports []*importContact) error {
+	contactsByUUID, contactsByMatch, err := b.loadExistingContacts(ctx, db, oa, imports)
+	if err != nil {
+		return err
+	}
+
+	// contacts created by earlier records with match values
+	createdByMatch := make(map[string]ContactID)
 
-		if spec.Name != nil {
-			addModifier(modifiers.NewName(*spec.Name))
+	for _, imp := range imports {
+		if imp.failed {
+			continue // e.g. match field isn't valid so we shouldn't fall back to creating a contact
 		}
-		if spec.Language != nil {
-			lang, err := i18n.ParseLanguage(*spec.Language)
+
+		if imp.spec.UUID != "" {
+			if err := imp.useContactByUUID(oa, contactsByUUID); err != nil {
+				return err
+			}
+		} else if matches, matched := contactsByMatch[imp]; matched {
+			if err := imp.useContactByMatch(oa, matches); err != nil {
+				return err
+			}
+		} else if createdID, ok := createdByMatch[imp.matchKey()]; ok {
+			// an earlier record created a contact with this match value so reload that to update it
+			contact, err := LoadContact(ctx, db, oa, createdID)
 			if err != nil {
-				addError("'%s' is not a valid language code", *spec.Language)
-			} else {
-				addModifier(modifiers.NewLanguage(lang))
+				return fmt.Errorf("error loading created contact: %w", err)
 			}
-		}
-		if !isActive {
-			if spec.Status == flows.ContactStatusArchived || spec.Status == flows.ContactStatusBlocked || spec.Status == flows.ContactStatusStopped {
-				addModifier(modifiers.NewStatus(spec.Status))
-			} else {
-				addError("'%s' is not a valid status", spec.Status)
+			if err := imp.useContact(oa, contact); err != nil {
+				return err
+			}
+		} else {
+			imp.contact, imp.flowContact, imp.created, err = GetOrCreateContact(ctx, db, oa, imp.spec.URNs, NilChannelID)
+			if err != nil {
+				imp.addURNsError()
+			} else if imp.created && imp.matchKey() != "" {
+				createdByMatch[imp.matchKey()] = imp.contact.ID()
 			}
 		}
 
-		for key, value := range spec.Fields {
-			field := sa.Fields().Get(key)
-			if field == nil {
-				addError("'%s' is not a valid contact field key", key)
-			} else {
-				addModifier(modifiers.NewField(field, value))
-			}
+		if !imp.failed {
+			imp.buildModifiers(oa)
+		}
+	}
+
+	return nil
+}
+
+// records the URNs of contacts created by this batch in their history, as those are set when the contact is created
+// rather than by modifiers
+func (b *ContactImportBatch) recordCreatedContacts(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, source ContactChangeSource, imports []*importContact) error {
+	changes := make([]*ContactChange, 0, len(imports))
+
+	for _, imp := range imports {
+		if !imp.created || len(imp.contact.URNs()) == 0 {
+			continue
+		}
+
+		identities := make([]string, len(imp.contact.URNs()))
+		for i, u := range imp.contact.URNs() {
+			identities[i] = string(u.Identity())
 		}
 
-		if len(spec.Groups) > 0 && isActive {
-			groups := make([]*flows.Group, 0, len(spec.Groups))
-			for _, uuid := range spec.Groups {
-				group := sa.Groups().Get(uuid)
-				if group == nil {
-					addError("'%s' is not a valid contact group UUID", uuid)
-				} else {
-					groups = append(groups, group)
+		// contact is new so doesn't have a previous state
+		scene := NewSceneForContact(imp.flowContact, source)
+		scene.previousState = contactState{}
+
+		change, err := scene.RecordContactChange(ctx, rt.DB, oa, ContactChangePropertyURNs, nil, identities)
+		if err != nil {
+			return err
+		}
+		if change != nil {
+			changes = append(changes, change)
+		}
+	}
+
+	return InsertContactChanges(ctx, rt, changes)
+}
+
+// like getOrCreateContacts but doesn't create contacts, only works out whether they would be created. Rather than loading
+// contacts, this only looks up the IDs of existing contacts with a few queries for the whole batch.
+func (b *ContactImportBatch) findContacts(ctx context.Context, db *sqlx.DB, oa *OrgAssets, imports []*importContact, wouldCreate map[string]bool) error {
+	existingUUIDs, err := b.findContactUUIDs(ctx, db, oa, imports)
+	if err != nil {
+		return fmt.Errorf("error finding contacts by UUID: %w", err)
+	}
+
+	idsByMatch, err := b.matchContactIDs(ctx, db, oa, imports)
+	if err != nil {
+		return fmt.Errorf("error finding contacts by match field: %w", err)
+	}
+
+	// normalize and validate the URNs of imports which will be looked up by URN so we can look up owners in one query
+	urnsByImport := make(map[*importContact][]urns.URN, len(imports))
+	allURNs := make([]urns.URN, 0, len(imports))
+	for _, imp := range imports {
+		if _, matched := idsByMatch[imp]; imp.spec.UUID != "" || matched || imp.failed {
+			continue
+		}
+
+		norm, err := nornalizeAndValidateURNs(imp.spec.URNs)
+		if err != nil {
+			imp.urnErr = err
+			imp.addURNsError()
+			continue
+		}
+
+		urnsByImport[imp] = norm
+		allURNs = append(allURNs, norm...)
+	}
+
+	owners, err := GetContactIDsFromURNs(ctx, db, oa.OrgID(), allURNs)
+	if err != nil {
+		return fmt.Errorf("error finding contacts by URN: %w", err)
+	}
+
+	for _, imp := range imports {
+		if imp.spec.UUID != "" {
+			if !existingUUIDs[imp.spec.UUID] {
+				imp.fail("Unable to find contact with UUID '%s'", imp.spec.UUID)
+			}
+		} else if ids, matched := idsByMatch[imp]; matched {
+			if len(ids) > 1 {
+				imp.fail("Multiple contacts have %s '%s'", imp.spec.MatchField, imp.matchValue())
+			}
+		} else if urnz, ok := urnsByImport[imp]; ok {
+			urnOwners := make(map[urns.URN]ContactID, len(urnz))
+			for _, u := range urnz {
+				urnOwners[u] = owners[u]
+			}
+
+			if numOwners := len(uniqueContactIDs(urnOwners)); numOwners > 1 {
+				imp.urnErr = errors.New("URNs belong to different contacts")
+				imp.addURNsError()
+			} else if numOwners == 0 {
+				// an earlier record may have already created a contact with these URNs or match value
+				keys := make([]string, 0, len(urnz)+1)
+				for _, u := range urnz {
+					keys = append(keys, string(u.Identity()))
+				}
+				if imp.matchKey() != "" {
+					keys = append(keys, imp.matchKey())
+				}
+
+				imp.created = true
+				for _, k := range keys {
+					if wouldCreate[k] {
+						imp.created = false
+					}
+					wouldCreate[k] = true
 				}
 			}
-			addModifier(modifiers.NewGroups(groups, modifiers.GroupsAdd))
 		}
+
+		if !imp.failed {
+			imp.buildModifiers(oa)
+		}
+	}
+
+	return nil
+}
+
+// loads the existing contacts which imports reference by UUID or match by a field value
+func (b *ContactImportBatch) loadExistingContacts(ctx context.Context, db *sqlx.DB, oa *OrgAssets, imports []*importContact) (map[flows.ContactUUID]*Contact, map[*importContact][]*Contact, error) {
+	contactsByUUID, err := b.loadContactsByUUID(ctx, db, oa, imports)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading contacts by UUID: %w", err)
+	}
+
+	contactsByMatch, err := b.loadContactsByMatch(ctx, db, oa, imports)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading contacts by match field: %w", err)
+	}
+
+	return contactsByUUID, contactsByMatch, nil
+}
+
+func (i *importContact) addError(s string, args ...any) {
+	i.errors = append(i.errors, fmt.Sprintf(s, args...))
+}
+
+// records an error which means we don't have a contact to update
+func (i *importContact) fail(s string, args ...any) {
+	i.addError(s, args...)
+	i.failed = true
+}
+
+func (i *importContact) addURNsError() {
+	urnStrs := make([]string, len(i.spec.URNs))
+	for j := range i.spec.URNs {
+		urnStrs[j] = string(i.spec.URNs[j].Identity())
+	}
+
+	i.fail("Unable to find or create contact with URNs %s", strings.Join(urnStrs, ", "))
+}
+
+func (i *importContact) useContactByUUID(oa *OrgAssets, contactsByUUID map[flows.ContactUUID]*Contact) error {
+	contact := contactsByUUID[i.spec.UUID]
+	if contact == nil {
+		i.fail("Unable to find contact with UUID '%s'", i.spec.UUID)
+		return nil
 	}
 
+	return i.useContact(oa, contact)
+}
+
+func (i *importContact) useContactByMatch(oa *OrgAssets, matches []*Contact) error {
+	if len(matches) > 1 {
+		i.fail("Multiple contacts have %s '%s'", i.spec.MatchField, i.matchValue())
+		return nil
+	}
+
+	return i.useContact(oa, matches[0])
+}
+
+func (i *importContact) useContact(oa *OrgAssets, contact *Contact) error {
+	var err error
+	i.contact = contact
+	i.flowContact, err = contact.FlowContact(oa)
+	if err != nil {
+		return fmt.Errorf("error creating flow contact for %d: %w", contact.ID(), err)
+	}
 	return nil
 }
 
+// gets a key which identifies the contact by this import's match field and value, if it has them
+func (i *importContact) matchKey() string {
+	if v := i.matchValue(); v != "" {
+		return i.spec.MatchField + ":" + v
+	}
+	return ""
+}
+
+// gets the value of this import's match field, if it has one
+func (i *importContact) matchValue() string {
+	if i.spec.MatchField == "" {
+		return ""
+	}
+	return strings.TrimSpace(i.spec.Fields[i.spec.MatchField])
+}
+
+func (i *importContact) buildModifiers(oa *OrgAssets) {
+	sa := oa.SessionAssets()
+	addModifier := func(m flows.Modifier) { i.mods = append(i.mods, m) }
+	spec := i.spec
+
+	isActive := spec.Status == "" || spec.Status == flows.ContactStatusActive
+
+	addModifier(modifiers.NewURNs(spec.URNs, modifiers.URNsAppend))
+
+	if spec.Name != nil {
+		addModifier(modifiers.NewName(*spec.Name))
+	}
+	if spec.Language != nil {
+		lang, err := i18n.ParseLanguage(*spec.Language)
+		if err != nil {
+			i.addError("'%s' is not a valid language code", *spec.Language)
+		} else {
+			addModifier(modifiers.NewLanguage(lang))
+		}
+	}
+	if !isActive {
+		if spec.Status == flows.ContactStatusArchived || spec.Status == flows.ContactStatusBlocked || spec.Status == flows.ContactStatusStopped {
+			addModifier(modifiers.NewStatus(spec.Status))
+		} else {
+			i.addError("'%s' is not a valid status", spec.Status)
+		}
+	}
+
+	for key, value := range spec.Fields {
+		if key == spec.MatchField {
+			value = i.matchValue() // write the value we matched on
+		}
+
+		field := sa.Fields().Get(key)
+		if field == nil {
+			i.addError("'%s' is not a valid contact field key", key)
+			i.unknownFields = append(i.unknownFields, key)
+		} else {
+			addModifier(modifiers.NewField(field, value))
+		}
+	}
+
+	if len(spec.Groups) > 0 && isActive {
+		groups := make([]*flows.Group, 0, len(spec.Groups))
+		for _, uuid := range spec.Groups {
+			group := sa.Groups().Get(uuid)
+			if group == nil {
+				i.addError("'%s' is not a valid contact group UUID", uuid)
+				i.unknownGroups = append(i.unknownGroups, uuid)
+			} else {
+				groups = append(groups, group)
+			}
+		}
+		addModifier(modifiers.NewGroups(groups, modifiers.GroupsAdd))
+	}
+}
+
 // loads any import contacts for which we have UUIDs
 func (b *ContactImportBatch) loadContactsByUUID(ctx context.Context, db DBorTx, oa *OrgAssets, imports []*importContact) (map[flows.ContactUUID]*Contact, error) {
 	uuids := make([]flows.ContactUUID, 0, 50)
@@ -282,6 +647,137 @@ func (b *ContactImportBatch) loadContactsByUUID(ctx context.Context, db DBorTx,
 	return contactsByUUID, nil
 }
 
+const sqlSelectContactUUIDs = `
+SELECT uuid
+  FROM contacts_contact
+ WHERE org_id = $1 AND is_active AND uuid = ANY($2)`
+
+// finds which of the UUIDs referenced by imports belong to existing contacts
+func (b *ContactImportBatch) findContactUUIDs(ctx context.Context, db DBorTx, oa *OrgAssets, imports []*importContact) (map[flows.ContactUUID]bool, error) {
+	uuids := make([]flows.ContactUUID, 0, 50)
+	for _, imp := range imports {
+		if imp.spec.UUID != "" {
+			uuids = append(uuids, imp.spec.UUID)
+		}
+	}
+
+	existing := make(map[flows.ContactUUID]bool, len(uuids))
+	if len(uuids) == 0 {
+		return existing, nil
+	}
+
+	var found []flows.ContactUUID
+	if err := db.SelectContext(ctx, &found, sqlSelectContactUUIDs, oa.OrgID(), pq.Array(uuids)); err != nil {
+		return nil, fmt.Errorf("error querying contacts by UUID: %w", err)
+	}
+	for _, uuid := range found {
+		existing[uuid] = true
+	}
+	return existing, nil
+}
+
+const sqlSelectContactIDsByFieldValue = `
+SELECT id, fields->$2->>'text' AS value
+  FROM contacts_contact
+ WHERE org_id = $1 AND is_active AND fields->$2->>'text' = ANY($3)
+ ORDER BY id`
+
+type contactFieldValue struct {
+	ID    ContactID `db:"id"`
+	Value string    `db:"value"`
+}
+
+// finds the IDs of existing contacts which match imports by the value of their match field
+func (b *ContactImportBatch) matchContactIDs(ctx context.Context, db DBorTx, oa *OrgAssets, imports []*importContact) (map[*importContact][]ContactID, error) {
+	importsByFieldValue := make(map[*Field]map[string][]*importContact)
+
+	for _, imp := range imports {
+		value := imp.matchValue()
+		if imp.spec.UUID != "" || value == "" {
+			continue
+		}
+
+		field := oa.FieldByKey(imp.spec.MatchField)
+		if field == nil {
+			imp.fail("Unable to match on '%s' as it is not a valid contact field key", imp.spec.MatchField)
+			continue
+		}
+
+		if importsByFieldValue[field] == nil {
+			importsByFieldValue[field] = make(map[string][]*importContact)
+		}
+		importsByFieldValue[field][value] = append(importsByFieldValue[field][value], imp)
+	}
+
+	idsByImport := make(map[*importContact][]ContactID)
+
+	for field, byValue := range importsByFieldValue {
+		values := make([]string, 0, len(byValue))
+		for v := range byValue {
+			values = append(values, v)
+		}
+
+		var matches []contactFieldValue
+		if err := db.SelectContext(ctx, &matches, sqlSelectContactIDsByFieldValue, oa.OrgID(), field.UUID(), pq.Array(values)); err != nil {
+			return nil, fmt.Errorf("error querying contacts by field value: %w", err)
+		}
+
+		for _, m := range matches {
+			for _, imp := range byValue[m.Value] {
+				idsByImport[imp] = append(idsByImport[imp], m.ID)
+			}
+		}
+	}
+
+	return idsByImport, nil
+}
+
+// loads existing contacts which match imports by the value of their match field
+func (b *ContactImportBatch) loadContactsByMatch(ctx context.Context, db DBorTx, oa *OrgAssets, imports []*importContact) (map[*importContact][]*Contact, error) {
+	idsByImport, err := b.matchContactIDs(ctx, db, oa, imports)
+	if err != nil {
+		return nil, err
+	}
+
+	allIDs := make([]ContactID, 0, 50)
+	for _, ids := range idsByImport {
+		allIDs = append(allIDs, ids...)
+	}
+
+	contacts, err := LoadContacts(ctx, db, oa, allIDs)
+	if err != nil {
+		return nil, err
+	}
+	contactsByID := make(map[ContactID]*Contact, len(contacts))
+	for _, c := range contacts {
+		contactsByID[c.ID()] = c
+	}
+
+	contactsByImport := make(map[*importContact][]*Contact, len(idsByImport))
+	for imp, ids := range idsByImport {
+		for _, id := range ids {
+			if c := contactsByID[id]; c != nil {
+				contactsByImport[imp] = append(contactsByImport[imp], c)
+			}
+		}
+	}
+	return contactsByImport, nil
+}
+
+// normalizes phone URNs which are in local formats to E164 using the given country
+func normalizeImportURNs(urnz []urns.URN, country i18n.Country) []urns.URN {
+	normalized := make([]urns.URN, len(urnz))
+	for i, u := range urnz {
+		normalized[i] = u
+		if u.Scheme() == urns.Phone.Prefix {
+			if n, err := urns.ParsePhone(u.Path(), country, false, false); err == nil {
+				normalized[i] = n
+			}
+		}
+	}
+	return normalized
+}
+
 func (b *ContactImportBatch) markProcessing(ctx context.Context, db DBorTx) error {
 	b.Status = ContactImportStatusProcessing
 	_, err := db.ExecContext(ctx, `UPDATE contacts_contactimportbatch SET status = $2 WHERE id = $1`, b.ID, b.Status)
@@ -366,6 +862,21 @@ func LoadContactImportBatch(ctx context.Context, db DBorTx, id ContactImportBatc
 	return b, nil
 }
 
+const sqlLoadContactImportBatches = `
+SELECT id, contact_import_id, status, specs, record_start, record_end
+  FROM contacts_contactimportbatch
+ WHERE contact_import_id = $1
+ ORDER BY record_start`
+
+// LoadContactImportBatches loads all the batches of the given contact import in record order
+func LoadContactImportBatches(ctx context.Context, db DBorTx, importID ContactImportID) ([]*ContactImportBatch, error) {
+	batches := make([]*ContactImportBatch, 0, 10)
+	if err := db.SelectContext(ctx, &batches, sqlLoadContactImportBatches, importID); err != nil {
+		return nil, fmt.Errorf("error loading batches for contact import id=%d: %w", importID, err)
+	}
+	return batches, nil
+}
+
 // ContactSpec describes a contact to be updated or created
 type ContactSpec struct {
 	UUID     flows.ContactUUID   `json:"uuid"`
@@ -376,6 +887,12 @@ type ContactSpec struct {
 	Fields   map[string]string   `json:"fields"`
 	Groups   []assets.GroupUUID  `json:"groups"`
 
+	// optional key of a contact field whose value in fields identifies an existing contact to update
+	MatchField string `json:"match_field,omitempty"`
+
+	// whether phone URNs should be normalized using the org's default country before matching
+	NormalizeURNs bool `json:"normalize_urns,omitempty"`
+
 	ImportRow int `json:"_import_row"`
 }
 
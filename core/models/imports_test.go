@@ -3,6 +3,7 @@ package models_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"sort"
 	"strings"
@@ -195,6 +196,134 @@ func TestLoadContactImport(t *testing.T) {
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactimportbatch WHERE status = 'P' AND finished_on IS NULL`).Returns(1)
 }
 
+func TestContactImportMatching(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetDynamo)
+
+	// give our org a country by setting country on a channel
+	rt.DB.MustExec(`UPDATE channels_channel SET country = 'US' WHERE id = $1`, testdata.TwilioChannel.ID)
+
+	// give Cathy a national ID in the gender field
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, jsonb_build_object('text', 'ID-123')) WHERE id = $1`, testdata.Cathy.ID, testdata.GenderField.UUID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg|models.RefreshChannels)
+	require.NoError(t, err)
+
+	importID := testdata.InsertContactImport(rt, testdata.Org1, testdata.Admin)
+	batchID := testdata.InsertContactImportBatch(rt, importID, []byte(`[
+		{"name": "Catherine", "match_field": "gender", "fields": {"gender": " ID-123 "}},
+		{"name": "Norbert", "match_field": "gender", "fields": {"gender": "ID-999"}, "urns": ["tel:(605) 574-0099"], "normalize_urns": true},
+		{"name": "Norbert Jr", "match_field": "gender", "fields": {"gender": "ID-999"}},
+		{"name": "Leah", "urns": ["tel:605-574-1111"], "normalize_urns": true},
+		{"name": "Goats", "match_field": "goats", "fields": {"goats": "1"}}
+	]`))
+
+	batch, err := models.LoadContactImportBatch(ctx, rt.DB, batchID)
+	require.NoError(t, err)
+
+	err = batch.Import(ctx, rt, oa, testdata.Admin.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT num_created, num_updated, num_errored FROM contacts_contactimportbatch WHERE id = $1`, batchID).
+		Columns(map[string]any{"num_created": int64(1), "num_updated": int64(3), "num_errored": int64(1)})
+
+	// Cathy was matched by her ID and by her normalized phone number rather than being duplicated
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE name IN ('Catherine', 'Leah') AND id != $1`, testdata.Cathy.ID).Returns(0)
+
+	// and her ID was written without the surrounding whitespace
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdata.Cathy.ID, testdata.GenderField.UUID).Returns("ID-123")
+
+	// the record with an invalid match field errored rather than creating a contact
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE name = 'Goats'`).Returns(0)
+
+	// the second record with the same ID updated the contact created by the first
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE fields->$1->>'text' = 'ID-999'`, testdata.GenderField.UUID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT c.name FROM contacts_contact c JOIN contacts_contacturn u ON u.contact_id = c.id WHERE u.identity = 'tel:+16055740099'`).Returns("Norbert Jr")
+
+	// the URNs of the created contact are recorded in its history as well as the changes made by modifiers
+	var norbertUUID flows.ContactUUID
+	require.NoError(t, rt.DB.Get(&norbertUUID, `SELECT c.uuid FROM contacts_contact c JOIN contacts_contacturn u ON u.contact_id = c.id WHERE u.identity = 'tel:+16055740099'`))
+
+	changes, err := models.GetContactHistory(ctx, rt, testdata.Org1.ID, norbertUUID, "", 10)
+	require.NoError(t, err)
+	if assert.Greater(t, len(changes), 0) {
+		urnChange := changes[len(changes)-1] // oldest
+		assert.Equal(t, models.ContactChangePropertyURNs, urnChange.Property)
+		assert.Nil(t, urnChange.OldValue)
+		assert.Equal(t, []any{"tel:+16055740099"}, urnChange.NewValue)
+		assert.Equal(t, models.ContactChangeViaImport, urnChange.Via)
+		assert.Equal(t, importID, urnChange.ImportID)
+	}
+}
+
+func TestContactImportDryRun(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	oa := testdata.Org1.Load(rt)
+
+	importID := testdata.InsertContactImport(rt, testdata.Org1, testdata.Admin)
+	batchID := testdata.InsertContactImportBatch(rt, importID, []byte(`[
+		{"name": "Norbert", "urns": ["tel:+16055740001"], "fields": {"gender": "`+strings.Repeat("x", 700)+`"}, "_import_row": 2},
+		{"name": "Norbert", "urns": ["tel:+16055740001"], "_import_row": 3},
+		{"name": "Cathy", "urns": ["tel:+16055741111"], "fields": {"goats": "3"}, "groups": ["3972dcc2-6749-4761-a896-7880d6165f2c"], "_import_row": 4},
+		{"name": "Bad", "urns": ["tel:xyz"], "_import_row": 5},
+		{"uuid": "8e879527-7e6d-4bff-abc8-b1d41cd4f702", "_import_row": 6}
+	]`))
+
+	batches, err := models.LoadContactImportBatches(ctx, rt.DB, importID)
+	require.NoError(t, err)
+	assert.Len(t, batches, 1)
+	assert.Equal(t, batchID, batches[0].ID)
+
+	report := models.NewContactImportReport()
+	err = batches[0].DryRun(ctx, rt, oa, report)
+	require.NoError(t, err)
+
+	test.AssertEqualJSON(t, []byte(`{
+		"num_create": 1,
+		"num_update": 2,
+		"num_errored": 2,
+		"invalid_urns": [{"record": 3, "row": 5, "urn": "tel:xyz"}],
+		"unknown_fields": ["goats"],
+		"unknown_groups": ["3972dcc2-6749-4761-a896-7880d6165f2c"],
+		"truncated": [{"record": 0, "row": 2, "field": "gender", "length": 700}],
+		"errors": [
+			{"record": 2, "row": 4, "message": "'goats' is not a valid contact field key"},
+			{"record": 2, "row": 4, "message": "'3972dcc2-6749-4761-a896-7880d6165f2c' is not a valid contact group UUID"},
+			{"record": 3, "row": 5, "message": "Unable to find or create contact with URNs tel:xyz"},
+			{"record": 4, "row": 6, "message": "Unable to find contact with UUID '8e879527-7e6d-4bff-abc8-b1d41cd4f702'"}
+		],
+		"incomplete": false
+	}`), jsonx.MustMarshal(report), "dry run report mismatch")
+
+	// nothing should have been written
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contacturn WHERE identity = 'tel:+16055740001'`).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT status FROM contacts_contactimportbatch WHERE id = $1`, batchID).Returns("P")
+
+	// issues beyond the limit of each kind aren't listed and the report is marked as incomplete
+	specs := make([]string, 150)
+	for i := range specs {
+		specs[i] = fmt.Sprintf(`{"name": "Bad", "urns": ["tel:xyz"], "_import_row": %d}`, i+2)
+	}
+	importID = testdata.InsertContactImport(rt, testdata.Org1, testdata.Admin)
+	testdata.InsertContactImportBatch(rt, importID, []byte(`[`+strings.Join(specs, ",")+`]`))
+
+	batches, err = models.LoadContactImportBatches(ctx, rt.DB, importID)
+	require.NoError(t, err)
+
+	report = models.NewContactImportReport()
+	err = batches[0].DryRun(ctx, rt, oa, report)
+	require.NoError(t, err)
+
+	assert.Equal(t, 150, report.NumErrored)
+	assert.Len(t, report.InvalidURNs, 100)
+	assert.Len(t, report.Errors, 100)
+	assert.True(t, report.Incomplete)
+}
+
 func TestContactSpecUnmarshal(t *testing.T) {
 	s := &models.ContactSpec{}
 	jsonx.Unmarshal([]byte(`{}`), s)
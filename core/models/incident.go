@@ -33,6 +33,7 @@ type IncidentType string
 const (
 	IncidentTypeOrgFlagged        IncidentType = "org:flagged"
 	IncidentTypeWebhooksUnhealthy IncidentType = "webhooks:unhealthy"
+	IncidentTypeMessagesLooping   IncidentType = "messages:looping" // RapidPro must also add this to its incident types
 )
 
 type Incident struct {
@@ -58,9 +59,19 @@ func (i *Incident) End(ctx context.Context, db DBorTx) error {
 
 // IncidentWebhooksUnhealthy ensures there is an open unhealthy webhooks incident for the given org
 func IncidentWebhooksUnhealthy(ctx context.Context, db DBorTx, rp *redis.Pool, oa *OrgAssets, nodes []flows.NodeUUID) (IncidentID, error) {
+	return getOrCreateNodesIncident(ctx, db, rp, oa, IncidentTypeWebhooksUnhealthy, nodes)
+}
+
+// IncidentMessagesLooping ensures there is an open looping messages incident for the given org
+func IncidentMessagesLooping(ctx context.Context, db DBorTx, rp *redis.Pool, oa *OrgAssets, nodes []flows.NodeUUID) (IncidentID, error) {
+	return getOrCreateNodesIncident(ctx, db, rp, oa, IncidentTypeMessagesLooping, nodes)
+}
+
+// ensures there is an open incident of the given type and records the given flow nodes against it
+func getOrCreateNodesIncident(ctx context.Context, db DBorTx, rp *redis.Pool, oa *OrgAssets, typ IncidentType, nodes []flows.NodeUUID) (IncidentID, error) {
 	id, err := getOrCreateIncident(ctx, db, oa, &Incident{
 		OrgID:     oa.OrgID(),
-		Type:      IncidentTypeWebhooksUnhealthy,
+		Type:      typ,
 		StartedOn: dates.Now(),
 		Scope:     "",
 	})
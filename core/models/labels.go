@@ -6,8 +6,6 @@ import (
 	"fmt"
 
 	"github.com/nyaruka/goflow/assets"
-
-	"github.com/jmoiron/sqlx"
 )
 
 type LabelID int
@@ -47,7 +45,7 @@ SELECT ROW_TO_JSON(r) FROM (
 ) r;`
 
 // AddMsgLabels inserts the passed in msg labels to our db
-func AddMsgLabels(ctx context.Context, tx *sqlx.Tx, adds []*MsgLabelAdd) error {
+func AddMsgLabels(ctx context.Context, tx DBorTx, adds []*MsgLabelAdd) error {
 	err := BulkQuery(ctx, "inserting msg labels", tx, sqlInsertMsgLabels, adds)
 	if err != nil {
 		return fmt.Errorf("error inserting new msg labels: %w", err)
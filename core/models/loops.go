@@ -0,0 +1,119 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/goflow/flows"
+)
+
+// LoopKey is what we use to decide whether two outgoing messages are repetitions of each other
+type LoopKey string
+
+const (
+	// LoopKeyContent counts messages to the same contact with the same text, and attachments if the policy includes them
+	LoopKeyContent = LoopKey("content")
+
+	// LoopKeyNode counts messages to the same contact from the same flow node. Messages which aren't sent from a flow
+	// node (e.g. broadcasts) are counted by content instead.
+	LoopKeyNode = LoopKey("node")
+
+	// LoopKeyContact counts all messages to the same contact
+	LoopKeyContact = LoopKey("contact")
+)
+
+const orgConfigLoopDetection = "loop_detection"
+
+// LoopPolicy is an org's policy for detecting and handling message loops
+type LoopPolicy struct {
+	Limit       int     `json:"limit"`
+	Window      int     `json:"window"` // in seconds
+	Key         LoopKey `json:"key"`
+	Attachments bool    `json:"attachments"` // whether attachments are part of the content of messages
+	Interrupt   bool    `json:"interrupt"`
+	Incident    bool    `json:"incident"`
+}
+
+// DefaultLoopPolicy is the policy used for orgs which don't configure their own - fail the message after 20
+// repetitions of the same content to the same contact in a 5 minute window.
+var DefaultLoopPolicy = &LoopPolicy{Limit: 20, Window: 300, Key: LoopKeyContent}
+
+// WindowDuration returns the window of this policy as a duration
+func (p *LoopPolicy) WindowDuration() time.Duration { return time.Second * time.Duration(p.Window) }
+
+// parses a loop policy from the given org config value, falling back to the default policy if it's missing or invalid
+func readLoopPolicy(v any) *LoopPolicy {
+	if v == nil {
+		return DefaultLoopPolicy
+	}
+
+	p := &LoopPolicy{Limit: DefaultLoopPolicy.Limit, Window: DefaultLoopPolicy.Window, Key: DefaultLoopPolicy.Key}
+	if err := jsonx.Unmarshal(jsonx.MustMarshal(v), p); err != nil {
+		return DefaultLoopPolicy
+	}
+	if p.Limit < 1 || p.Window < 60 || (p.Key != LoopKeyContent && p.Key != LoopKeyNode && p.Key != LoopKeyContact) {
+		return DefaultLoopPolicy
+	}
+	return p
+}
+
+var msgRepetitionsScript = redis.NewScript(1, `
+local key, msg_key, window = KEYS[1], ARGV[1], tonumber(ARGV[2])
+
+local count = redis.call("HINCRBY", key, msg_key, 1)
+redis.call("EXPIRE", key, window)
+
+return count
+`)
+
+// GetMsgRepetitions gets the number of repetitions of this msg for the given contact in the current window of the
+// given policy. Node is optional and is only used when the policy is keyed by node.
+func GetMsgRepetitions(rp *redis.Pool, policy *LoopPolicy, contact *flows.Contact, msg *flows.MsgOut, node flows.NodeUUID) (int, error) {
+	rc := rp.Get()
+	defer rc.Close()
+
+	window := policy.WindowDuration()
+	keyTime := dates.Now().UTC().Round(window).Format("2006-01-02T15:04")
+
+	var key string
+	if window == DefaultLoopPolicy.WindowDuration() {
+		key = fmt.Sprintf("msg_repetitions:%s", keyTime)
+	} else {
+		key = fmt.Sprintf("msg_repetitions:%d:%s", policy.Window, keyTime)
+	}
+
+	return redis.Int(msgRepetitionsScript.Do(rc, key, loopMsgKey(policy, contact, msg, node), policy.Window))
+}
+
+// builds the key within a repetitions window that identifies a message as a repetition of others
+func loopMsgKey(policy *LoopPolicy, contact *flows.Contact, msg *flows.MsgOut, node flows.NodeUUID) string {
+	switch policy.Key {
+	case LoopKeyContact:
+		return fmt.Sprint(contact.ID())
+	case LoopKeyNode:
+		if node == "" {
+			return loopContentKey(contact, msg, policy.Attachments) // no node to key on so fall back to content
+		}
+		return fmt.Sprintf("%d|@%s", contact.ID(), node)
+	default:
+		return loopContentKey(contact, msg, policy.Attachments)
+	}
+}
+
+// builds a repetitions key from the contact and the content of the message, optionally including its attachments
+func loopContentKey(contact *flows.Contact, msg *flows.MsgOut, withAttachments bool) string {
+	msgKey := fmt.Sprintf("%d|%s", contact.ID(), strings.ToLower(stringsx.Truncate(msg.Text(), 128)))
+	if withAttachments && len(msg.Attachments()) > 0 {
+		attachments := make([]string, len(msg.Attachments()))
+		for i, a := range msg.Attachments() {
+			attachments[i] = string(a)
+		}
+		msgKey += "|" + strings.Join(attachments, " ")
+	}
+	return msgKey
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/media"
+)
+
+// MediaLimit is the maximum size of a content type, or of a family of content types if it ends with a slash
+type MediaLimit struct {
+	ContentType string
+	MaxBytes    int
+}
+
+// MediaLimits are the attachment limits of a channel type
+type MediaLimits struct {
+	Allowed           []MediaLimit
+	MaxImageDimension int
+}
+
+func (l *MediaLimits) find(contentType string) *MediaLimit {
+	for i, a := range l.Allowed {
+		if a.ContentType == contentType || (strings.HasSuffix(a.ContentType, "/") && strings.HasPrefix(contentType, a.ContentType)) {
+			return &l.Allowed[i]
+		}
+	}
+	return nil
+}
+
+const mb = 1024 * 1024
+
+var channelMediaLimits = map[ChannelType]*MediaLimits{
+	"WAC": whatsAppMediaLimits,
+	"D3C": whatsAppMediaLimits,
+	"TG": {
+		Allowed: []MediaLimit{
+			{"image/jpeg", 10 * mb}, {"image/png", 10 * mb}, {"image/gif", 10 * mb},
+			{"audio/", 50 * mb}, {"video/", 50 * mb}, {"application/", 50 * mb},
+		},
+		MaxImageDimension: 10000,
+	},
+	"FBA": metaMediaLimits,
+	"IG":  metaMediaLimits,
+	"T": {
+		Allowed:           []MediaLimit{{"image/jpeg", 5 * mb}, {"image/png", 5 * mb}, {"image/gif", 5 * mb}},
+		MaxImageDimension: 4096,
+	},
+}
+
+var whatsAppMediaLimits = &MediaLimits{
+	Allowed: []MediaLimit{
+		{"image/jpeg", 5 * mb}, {"image/png", 5 * mb},
+		{"audio/aac", 16 * mb}, {"audio/mp4", 16 * mb}, {"audio/mpeg", 16 * mb}, {"audio/amr", 16 * mb}, {"audio/ogg", 16 * mb},
+		{"video/mp4", 16 * mb}, {"video/3gpp", 16 * mb},
+		{"application/", 100 * mb}, {"text/plain", 100 * mb},
+	},
+}
+
+var metaMediaLimits = &MediaLimits{
+	Allowed: []MediaLimit{{"image/", 25 * mb}, {"audio/", 25 * mb}, {"video/", 25 * mb}, {"application/", 25 * mb}},
+}
+
+// RegisterMediaLimits registers the attachment limits of a channel type
+func RegisterMediaLimits(channelType ChannelType, limits *MediaLimits) {
+	channelMediaLimits[channelType] = limits
+}
+
+// AttachmentError is returned when an attachment can't be sent on a channel and can't be converted so that it can be
+type AttachmentError struct {
+	Attachment utils.Attachment
+	Reason     string
+}
+
+func (e *AttachmentError) Error() string {
+	return fmt.Sprintf("attachment %s can't be sent: %s", e.Attachment.URL(), e.Reason)
+}
+
+// the largest attachment we'll download to check and convert
+const maxAttachmentFetchBytes = 100 * mb
+
+// how long we remember the result of preparing an attachment for a channel type
+const preparedAttachmentExpire = 24 * time.Hour
+
+var mediaHttpClient = &http.Client{Timeout: 30 * time.Second}
+
+type preparedAttachment struct {
+	Attachment utils.Attachment `json:"attachment,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// PrepareAttachment checks the given attachment against the limits of the given channel, converting it if necessary
+// and possible, in which case the converted file is stored and returned in place of the original. An AttachmentError
+// is returned if the attachment can't be sent on the channel.
+func PrepareAttachment(ctx context.Context, rt *runtime.Runtime, org *Org, channel *Channel, attachment utils.Attachment) (utils.Attachment, error) {
+	if !rt.Config.PrepareAttachments || channel == nil || attachment.ContentType() == "geo" {
+		return attachment, nil
+	}
+
+	limits := channelMediaLimits[channel.Type()]
+	if limits == nil {
+		return attachment, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	// many messages tend to share the same attachment so check whether we've already prepared this one
+	h := sha1.Sum([]byte(attachment))
+	cacheKey := fmt.Sprintf("prepared_attachment:%s:%s", channel.Type(), hex.EncodeToString(h[:]))
+
+	cached, err := redis.Bytes(rc.Do("GET", cacheKey))
+	if err != nil && err != redis.ErrNil {
+		return "", fmt.Errorf("error looking up prepared attachment: %w", err)
+	}
+	if cached != nil {
+		p := &preparedAttachment{}
+		if err := jsonx.Unmarshal(cached, p); err == nil {
+			if p.Error != "" {
+				return "", &AttachmentError{Attachment: attachment, Reason: p.Error}
+			}
+			return p.Attachment, nil
+		}
+	}
+
+	prepared, err := prepareAttachment(ctx, rt, org, limits, attachment)
+
+	var attErr *AttachmentError
+	if err != nil && !errors.As(err, &attErr) {
+		return "", err // don't remember errors that might be temporary
+	}
+
+	p := &preparedAttachment{Attachment: prepared}
+	if attErr != nil {
+		p.Error = attErr.Reason
+	}
+	if _, err := rc.Do("SET", cacheKey, jsonx.MustMarshal(p), "EX", int(preparedAttachmentExpire/time.Second)); err != nil {
+		return "", fmt.Errorf("error caching prepared attachment: %w", err)
+	}
+
+	if attErr != nil {
+		return "", attErr
+	}
+	return prepared, nil
+}
+
+func prepareAttachment(ctx context.Context, rt *runtime.Runtime, org *Org, limits *MediaLimits, attachment utils.Attachment) (utils.Attachment, error) {
+	contentType := attachment.ContentType()
+	isImage := strings.HasPrefix(contentType, "image/")
+	jpegLimit := limits.find("image/jpeg")
+	limit := limits.find(contentType)
+
+	// if this content type isn't supported, the only thing we can do is convert images to JPEG
+	if limit == nil && !(isImage && jpegLimit != nil) {
+		return "", &AttachmentError{Attachment: attachment, Reason: fmt.Sprintf("content type %s is not supported by channel", contentType)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, attachment.URL(), nil)
+	if err != nil {
+		return "", &AttachmentError{Attachment: attachment, Reason: "invalid URL"}
+	}
+	trace, err := httpx.DoTrace(mediaHttpClient, req, nil, nil, maxAttachmentFetchBytes)
+	if err == httpx.ErrResponseSize {
+		return "", &AttachmentError{Attachment: attachment, Reason: "file is too large to fetch"}
+	} else if err != nil {
+		return "", fmt.Errorf("error fetching attachment: %w", err)
+	}
+	if trace.Response.StatusCode/100 != 2 {
+		return "", fmt.Errorf("error fetching attachment, got status %d", trace.Response.StatusCode)
+	}
+	data := trace.ResponseBody
+
+	if isImage {
+		fitsDimensions := true
+		if cfg, _, err := media.ImageConfig(data); err == nil && limits.MaxImageDimension > 0 {
+			fitsDimensions = cfg.Width <= limits.MaxImageDimension && cfg.Height <= limits.MaxImageDimension
+		}
+		if limit != nil && len(data) <= limit.MaxBytes && fitsDimensions {
+			return attachment, nil
+		}
+		if jpegLimit == nil {
+			if !fitsDimensions {
+				return "", &AttachmentError{Attachment: attachment, Reason: fmt.Sprintf("image is larger than %dx%d pixels", limits.MaxImageDimension, limits.MaxImageDimension)}
+			}
+			return "", &AttachmentError{Attachment: attachment, Reason: fmt.Sprintf("image is larger than %d bytes", limit.MaxBytes)}
+		}
+
+		shrunk, err := media.ShrinkImage(data, limits.MaxImageDimension, jpegLimit.MaxBytes)
+		if err != nil {
+			return "", &AttachmentError{Attachment: attachment, Reason: fmt.Sprintf("image could not be converted: %s", err)}
+		}
+
+		return org.StoreAttachment(ctx, rt, string(uuids.NewV4())+".jpg", "image/jpeg", io.NopCloser(bytes.NewReader(shrunk)))
+	}
+
+	if len(data) > limit.MaxBytes {
+		return "", &AttachmentError{Attachment: attachment, Reason: fmt.Sprintf("file is larger than %d bytes", limit.MaxBytes)}
+	}
+	return attachment, nil
+}
@@ -0,0 +1,127 @@
+package models_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareAttachment(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis | testsuite.ResetStorage)
+
+	image, err := os.ReadFile("testdata/test.jpg")
+	require.NoError(t, err)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://example.com/test.jpg": {httpx.NewMockResponse(200, nil, image), httpx.NewMockResponse(200, nil, image), httpx.NewMockResponse(200, nil, image)},
+		"http://example.com/doc.pdf":  {httpx.NewMockResponse(200, nil, []byte(`%PDF-1.4 this is a PDF which is too big`))},
+		"http://example.com/doc.txt":  {httpx.NewMockResponse(200, nil, []byte(`small`))},
+	}))
+
+	models.RegisterMediaLimits("XX", &models.MediaLimits{
+		Allowed:           []models.MediaLimit{{ContentType: "image/jpeg", MaxBytes: 10000}, {ContentType: "application/pdf", MaxBytes: 20}, {ContentType: "text/", MaxBytes: 20}},
+		MaxImageDimension: 100,
+	})
+
+	org, err := models.LoadOrg(ctx, rt.DB.DB, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	testChannel := testdata.InsertChannel(rt, testdata.Org1, "XX", "Test", "123", []string{"tel"}, "SR", map[string]any{})
+	channel, err := models.GetChannelByID(ctx, rt.DB.DB, testChannel.ID)
+	require.NoError(t, err)
+
+	// disabled by default
+	prepared, err := models.PrepareAttachment(ctx, rt, org, channel, "audio/x-wav:http://example.com/test.wav")
+	assert.NoError(t, err)
+	assert.Equal(t, utils.Attachment("audio/x-wav:http://example.com/test.wav"), prepared)
+
+	rt.Config.PrepareAttachments = true
+	defer func() { rt.Config.PrepareAttachments = false }()
+
+	// unsupported types fail without needing to be fetched
+	_, err = models.PrepareAttachment(ctx, rt, org, channel, "audio/x-wav:http://example.com/test.wav")
+	assert.EqualError(t, err, "attachment http://example.com/test.wav can't be sent: content type audio/x-wav is not supported by channel")
+
+	// images which are too big are shrunk and stored
+	prepared, err = models.PrepareAttachment(ctx, rt, org, channel, "image/jpeg:http://example.com/test.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", prepared.ContentType())
+	assert.True(t, strings.HasPrefix(prepared.URL(), "http://localhost:9000/test-attachments/attachments/1/"), "unexpected url %s", prepared.URL())
+
+	// and the result is remembered so we don't fetch it again
+	again, err := models.PrepareAttachment(ctx, rt, org, channel, "image/jpeg:http://example.com/test.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, prepared, again)
+
+	// other files which are too big can't be converted
+	_, err = models.PrepareAttachment(ctx, rt, org, channel, "application/pdf:http://example.com/doc.pdf")
+	assert.EqualError(t, err, "attachment http://example.com/doc.pdf can't be sent: file is larger than 20 bytes")
+
+	prepared, err = models.PrepareAttachment(ctx, rt, org, channel, "text/plain:http://example.com/doc.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, utils.Attachment("text/plain:http://example.com/doc.txt"), prepared)
+
+	// attachments of new messages are prepared along with their other content before they're queued
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+	_, cathy, _ := testdata.Cathy.Load(rt, oa)
+
+	newOutgoing := func(attachment utils.Attachment) *models.Msg {
+		content := &flows.MsgContent{Text: "hi", Attachments: []utils.Attachment{attachment}}
+		out := flows.NewMsgOut(cathy.PreferredURN().URN(), assets.NewChannelReference(testChannel.UUID, "Test"), content, nil, flows.NilMsgTopic, i18n.NilLocale, flows.NilUnsendableReason)
+		msg, err := models.NewOutgoingChatMsg(rt, oa.Org(), oa.ChannelByID(testChannel.ID), cathy, out, testdata.Admin.ID)
+		require.NoError(t, err)
+		return msg
+	}
+
+	msg1 := newOutgoing("image/jpeg:http://example.com/test.jpg")
+	msg2 := newOutgoing("application/pdf:http://example.com/doc.pdf")
+	require.NoError(t, models.InsertMessages(ctx, rt.DB, []*models.Msg{msg1, msg2}))
+
+	err = models.PrepareMessages(ctx, rt, oa, rt.DB, []*models.Msg{msg1, msg2})
+	assert.NoError(t, err)
+	assert.Equal(t, models.MsgStatusQueued, msg1.Status())
+	assert.Equal(t, []utils.Attachment{prepared}, msg1.Attachments())
+	assert.Equal(t, models.MsgStatusFailed, msg2.Status())
+	assert.Equal(t, models.MsgFailedAttachment, msg2.FailedReason())
+
+	assertdb.Query(t, rt.DB, `SELECT attachments[1] FROM msgs_msg WHERE id = $1`, msg1.ID()).Returns(string(prepared))
+	assertdb.Query(t, rt.DB, `SELECT status, failed_reason FROM msgs_msg WHERE id = $1`, msg2.ID()).Columns(map[string]any{"status": "F", "failed_reason": "A"})
+
+	// images can't be converted if the channel doesn't support JPEG, and the error says which limit was exceeded
+	models.RegisterMediaLimits("YY", &models.MediaLimits{
+		Allowed:           []models.MediaLimit{{ContentType: "image/png", MaxBytes: 100}, {ContentType: "image/gif", MaxBytes: 10000000}},
+		MaxImageDimension: 10,
+	})
+	pngChannel := testdata.InsertChannel(rt, testdata.Org1, "YY", "PNG Only", "234", []string{"tel"}, "SR", map[string]any{})
+	channel, err = models.GetChannelByID(ctx, rt.DB.DB, pngChannel.ID)
+	require.NoError(t, err)
+
+	_, err = models.PrepareAttachment(ctx, rt, org, channel, "image/png:http://example.com/test.jpg")
+	assert.EqualError(t, err, "attachment http://example.com/test.jpg can't be sent: image is larger than 100 bytes")
+
+	_, err = models.PrepareAttachment(ctx, rt, org, channel, "image/gif:http://example.com/test.jpg")
+	assert.EqualError(t, err, "attachment http://example.com/test.jpg can't be sent: image is larger than 10x10 pixels")
+
+	// channels types without limits don't have their attachments checked
+	vonage, err := models.GetChannelByID(ctx, rt.DB.DB, testdata.VonageChannel.ID)
+	require.NoError(t, err)
+	prepared, err = models.PrepareAttachment(ctx, rt, org, vonage, "audio/x-wav:http://example.com/test.wav")
+	assert.NoError(t, err)
+	assert.Equal(t, utils.Attachment("audio/x-wav:http://example.com/test.wav"), prepared)
+}
@@ -11,7 +11,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/dates"
@@ -29,9 +28,6 @@ import (
 	"github.com/nyaruka/null/v3"
 )
 
-// maximum number of repeated messages to same contact allowed in 5 minute window
-const msgRepetitionLimit = 20
-
 // MsgID is our internal type for msg ids, which can be null/0
 type MsgID int64
 
@@ -66,7 +62,7 @@ type MsgStatus string
 const (
 	MsgStatusPending      = MsgStatus("P") // incoming msg created but not yet handled
 	MsgStatusHandled      = MsgStatus("H") // incoming msg handled
-	MsgStatusInitializing = MsgStatus("I") // outgoing message that failed to queue
+	MsgStatusInitializing = MsgStatus("I") // outgoing message that hasn't been prepared or failed to queue
 	MsgStatusQueued       = MsgStatus("Q") // outgoing msg created and queued to courier
 	MsgStatusWired        = MsgStatus("W") // outgoing msg requested to be sent via channel
 	MsgStatusSent         = MsgStatus("S") // outgoing msg having received sent confirmation from channel
@@ -87,6 +83,12 @@ const (
 	MsgFailedTooOld         = MsgFailedReason("O")
 	MsgFailedNoDestination  = MsgFailedReason("D")
 	MsgFailedChannelRemoved = MsgFailedReason("R")
+
+	// reasons which RapidPro must also add to the failed reason choices on its Msg model so that they can be displayed
+	MsgFailedContentFilter = MsgFailedReason("B") // blocked by the workspace's content filter
+	MsgFailedAttachment    = MsgFailedReason("A") // attachment can't be sent on the channel
+	MsgFailedCancelled     = MsgFailedReason("X") // broadcast was cancelled before msg was sent
+	MsgFailedDevice        = MsgFailedReason("V") // Android relayer device gave up sending msg
 )
 
 var unsendableToFailedReason = map[flows.UnsendableReason]MsgFailedReason{
@@ -350,26 +352,26 @@ func NewOutgoingOptInMsg(rt *runtime.Runtime, session *Session, flow *Flow, optI
 }
 
 // NewOutgoingFlowMsg creates an outgoing message for the passed in flow message
-func NewOutgoingFlowMsg(rt *runtime.Runtime, org *Org, channel *Channel, session *Session, flow *Flow, out *flows.MsgOut, createdOn time.Time) (*Msg, error) {
-	return newOutgoingTextMsg(rt, org, channel, session.Contact(), out, session, flow, NilBroadcastID, NilTicketID, NilOptInID, NilUserID, createdOn)
+func NewOutgoingFlowMsg(rt *runtime.Runtime, org *Org, channel *Channel, session *Session, flow *Flow, node flows.NodeUUID, out *flows.MsgOut, createdOn time.Time) (*Msg, error) {
+	return newOutgoingTextMsg(rt, org, channel, session.Contact(), out, session, flow, node, NilBroadcastID, NilTicketID, NilOptInID, NilUserID, createdOn)
 }
 
 // NewOutgoingBroadcastMsg creates an outgoing message which is part of a broadcast
 func NewOutgoingBroadcastMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *flows.Contact, out *flows.MsgOut, b *Broadcast) (*Msg, error) {
-	return newOutgoingTextMsg(rt, org, channel, contact, out, nil, nil, b.ID, NilTicketID, b.OptInID, b.CreatedByID, dates.Now())
+	return newOutgoingTextMsg(rt, org, channel, contact, out, nil, nil, "", b.ID, NilTicketID, b.OptInID, b.CreatedByID, dates.Now())
 }
 
 // NewOutgoingTicketMsg creates an outgoing message from a ticket
 func NewOutgoingTicketMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *flows.Contact, out *flows.MsgOut, ticketID TicketID, userID UserID) (*Msg, error) {
-	return newOutgoingTextMsg(rt, org, channel, contact, out, nil, nil, NilBroadcastID, ticketID, NilOptInID, userID, dates.Now())
+	return newOutgoingTextMsg(rt, org, channel, contact, out, nil, nil, "", NilBroadcastID, ticketID, NilOptInID, userID, dates.Now())
 }
 
 // NewOutgoingChatMsg creates an outgoing message from chat
 func NewOutgoingChatMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *flows.Contact, out *flows.MsgOut, userID UserID) (*Msg, error) {
-	return newOutgoingTextMsg(rt, org, channel, contact, out, nil, nil, NilBroadcastID, NilTicketID, NilOptInID, userID, dates.Now())
+	return newOutgoingTextMsg(rt, org, channel, contact, out, nil, nil, "", NilBroadcastID, NilTicketID, NilOptInID, userID, dates.Now())
 }
 
-func newOutgoingTextMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *flows.Contact, out *flows.MsgOut, session *Session, flow *Flow, broadcastID BroadcastID, ticketID TicketID, optInID OptInID, userID UserID, createdOn time.Time) (*Msg, error) {
+func newOutgoingTextMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *flows.Contact, out *flows.MsgOut, session *Session, flow *Flow, node flows.NodeUUID, broadcastID BroadcastID, ticketID TicketID, optInID OptInID, userID UserID, createdOn time.Time) (*Msg, error) {
 	msg := &Msg{}
 	m := &msg.m
 	m.UUID = out.UUID()
@@ -406,10 +408,8 @@ func newOutgoingTextMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact
 	msg.SetURN(out.URN())
 
 	// if we have attachments, add them
-	if len(out.Attachments()) > 0 {
-		for _, a := range out.Attachments() {
-			m.Attachments = append(m.Attachments, string(NormalizeAttachment(rt.Config, a)))
-		}
+	for _, a := range out.Attachments() {
+		m.Attachments = append(m.Attachments, string(NormalizeAttachment(rt.Config, a)))
 	}
 
 	if out.UnsendableReason() != flows.NilUnsendableReason {
@@ -421,11 +421,12 @@ func newOutgoingTextMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact
 		m.FailedReason = MsgFailedSuspended
 	} else {
 		// also fail right away if this looks like a loop
-		repetitions, err := GetMsgRepetitions(rt.RP, contact, out)
+		policy := org.LoopPolicy()
+		repetitions, err := GetMsgRepetitions(rt.RP, policy, contact, out, node)
 		if err != nil {
 			return nil, fmt.Errorf("error looking up msg repetitions: %w", err)
 		}
-		if repetitions >= msgRepetitionLimit {
+		if repetitions >= policy.Limit {
 			m.Status = MsgStatusFailed
 			m.FailedReason = MsgFailedLooping
 
@@ -433,6 +434,11 @@ func newOutgoingTextMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact
 		}
 	}
 
+	// if we're still sendable, we're initializing(I) until we've been prepared and can be queued
+	if m.Status != MsgStatusFailed {
+		m.Status = MsgStatusInitializing
+	}
+
 	// if we're a chat/ticket message, or we're responding to an incoming message in a flow, send as high priority
 	if (broadcastID == NilBroadcastID && session == nil) || (session != nil && session.IncomingMsgID() != NilMsgID) {
 		m.HighPriority = true
@@ -454,41 +460,141 @@ func newOutgoingTextMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact
 	return msg, nil
 }
 
-func buildMsgMetadata(m *flows.MsgOut) map[string]any {
-	metadata := make(map[string]any)
-	if m.Topic() != flows.NilMsgTopic {
-		metadata["topic"] = string(m.Topic())
-	}
-	return metadata
+const sqlUpdateMsgPrepared = `
+UPDATE msgs_msg m
+   SET text = r.text, attachments = r.attachments::text[], status = r.status, failed_reason = r.failed_reason, msg_count = r.msg_count::int, metadata = r.metadata, next_attempt = NULL, modified_on = NOW()
+  FROM (VALUES(:id, :text, :attachments, :status, :failed_reason, :msg_count, :metadata)) AS r(id, text, attachments, status, failed_reason, msg_count, metadata)
+ WHERE m.id = r.id::bigint`
+
+type preparedAttachmentResult struct {
+	attachment utils.Attachment
+	err        error
 }
 
-var msgRepetitionsScript = redis.NewScript(3, `
-local key, contact_id, text = KEYS[1], KEYS[2], KEYS[3]
+// PrepareMessages does the work for outgoing messages which requires calls to external services, i.e. checking and
+// converting their attachments for their channels, and giving the org's content filter a chance to block or redact
+// them. This is done once messages have been committed and before they're queued, so never inside a transaction.
+// Messages which need preparing are those which are initializing(I), i.e. new messages, and messages which failed to
+// be prepared or queued before. Prepared messages are saved as queued(Q), or failed(F) if they can't be sent, so that
+// the database records whether they've been prepared.
+func PrepareMessages(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, db DBorTx, msgs []*Msg) error {
+	// broadcasts often send the same content to many contacts so remember results for this batch
+	attachments := make(map[string]*preparedAttachmentResult)
+	decisions := make(map[string]*ContentFilterDecision)
+
+	prepared := make([]*Msg, 0, len(msgs))
+	redacted := make([]*Msg, 0)
+
+	for _, msg := range msgs {
+		m := &msg.m
+		if m.Status != MsgStatusInitializing {
+			continue
+		}
+
+		if m.Metadata == nil {
+			m.Metadata = null.Map[any]{}
+		}
+
+		channel := oa.ChannelByID(m.ChannelID)
+
+		var attachmentErr *AttachmentError
+		for i, a := range m.Attachments {
+			key := fmt.Sprintf("%d|%s", m.ChannelID, a)
+			result := attachments[key]
+			if result == nil {
+				att, err := PrepareAttachment(ctx, rt, oa.Org(), channel, utils.Attachment(a))
+				result = &preparedAttachmentResult{att, err}
+				attachments[key] = result
+			}
+
+			if result.err != nil {
+				if errors.As(result.err, &attachmentErr) {
+					break
+				}
+				slog.Error("error preparing attachment, sending as is", "attachment", a, "error", result.err)
+			} else if string(result.attachment) != a {
+				m.Attachments[i] = string(result.attachment)
+			}
+		}
 
-local msg_key = string.format("%d|%s", contact_id, string.lower(string.sub(text, 1, 128)))
-local count = 1
+		m.Status = MsgStatusQueued
 
--- try to look up in window
-local record = redis.call("HGET", key, msg_key)
-if record then
-	count = tonumber(record) + 1
-end
+		if attachmentErr != nil {
+			m.Status = MsgStatusFailed
+			m.FailedReason = MsgFailedAttachment
+			m.Metadata["attachment_error"] = attachmentErr.Error()
+		} else {
+			decision, filtered := decisions[m.Text]
+			if !filtered {
+				decision = oa.Org().FilterContent(ctx, DirectionOut, m.Text)
+				decisions[m.Text] = decision
+			}
+
+			if decision != nil {
+				switch decision.Action {
+				case ContentFilterActionBlock:
+					m.Status = MsgStatusFailed
+					m.FailedReason = MsgFailedContentFilter
+				case ContentFilterActionRedact:
+					m.Text = decision.Text
+					redacted = append(redacted, msg)
+				}
+				m.Metadata["content_filter"] = decision
+			}
+		}
 
--- write updated count and set expiration
-redis.call("HSET", key, msg_key, count)
-redis.call("EXPIRE", key, 300)
+		prepared = append(prepared, msg)
+	}
 
-return count
-`)
+	// redacted messages sent to phones need their segment counts updating
+	if err := updateMsgCounts(ctx, db, redacted); err != nil {
+		return err
+	}
 
-// GetMsgRepetitions gets the number of repetitions of this msg text for the given contact in the current 5 minute window
-func GetMsgRepetitions(rp *redis.Pool, contact *flows.Contact, msg *flows.MsgOut) (int, error) {
-	rc := rp.Get()
-	defer rc.Close()
+	is := make([]any, len(prepared))
+	for i := range prepared {
+		is[i] = &prepared[i].m
+	}
 
-	keyTime := dates.Now().UTC().Round(time.Minute * 5)
-	key := fmt.Sprintf("msg_repetitions:%s", keyTime.Format("2006-01-02T15:04"))
-	return redis.Int(msgRepetitionsScript.Do(rc, key, contact.ID(), msg.Text()))
+	return BulkQuery(ctx, "updating prepared messages", db, sqlUpdateMsgPrepared, is)
+}
+
+func updateMsgCounts(ctx context.Context, db DBorTx, msgs []*Msg) error {
+	urnIDs := make([]URNID, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.m.ContactURNID != nil {
+			urnIDs = append(urnIDs, *msg.m.ContactURNID)
+		}
+	}
+	if len(urnIDs) == 0 {
+		return nil
+	}
+
+	urnz, err := LoadContactURNs(ctx, db, urnIDs)
+	if err != nil {
+		return err
+	}
+
+	phoneURNs := make(map[URNID]bool, len(urnz))
+	for _, u := range urnz {
+		phoneURNs[u.ID] = u.Identity.Scheme() == urns.Phone.Prefix
+	}
+
+	for _, msg := range msgs {
+		m := &msg.m
+		if m.ContactURNID != nil && phoneURNs[*m.ContactURNID] {
+			m.MsgCount = gsm7.Segments(m.Text) + len(m.Attachments)
+		}
+	}
+	return nil
+}
+
+func buildMsgMetadata(m *flows.MsgOut) map[string]any {
+	metadata := make(map[string]any)
+	if m.Topic() != flows.NilMsgTopic {
+		metadata["topic"] = string(m.Topic())
+	}
+	return metadata
 }
 
 var sqlSelectMessagesByID = `
@@ -784,6 +890,59 @@ func FailChannelMessages(ctx context.Context, db *sql.DB, orgID OrgID, channelID
 	return nil
 }
 
+const sqlFailBroadcastMessages = `
+WITH rows AS (
+	SELECT id FROM msgs_msg
+	WHERE org_id = $1 AND broadcast_id = $2 AND direction = 'O' AND status IN ('I', 'Q')
+	LIMIT $4
+)
+   UPDATE msgs_msg SET status = 'F', failed_reason = $3, modified_on = NOW()
+    WHERE id IN (SELECT id FROM rows) AND status IN ('I', 'Q')
+RETURNING id, channel_id`
+
+// FailBroadcastMessages fails a batch of up to limit messages of the given broadcast which haven't yet been wired,
+// returning the ids of the failed messages grouped by channel so that they can be removed from courier queues.
+func FailBroadcastMessages(ctx context.Context, db DBorTx, orgID OrgID, bcastID BroadcastID, failedReason MsgFailedReason, limit int) (map[ChannelID][]MsgID, error) {
+	rows, err := db.QueryContext(ctx, sqlFailBroadcastMessages, orgID, bcastID, failedReason, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error failing messages for broadcast #%d: %w", bcastID, err)
+	}
+	defer rows.Close()
+
+	failed := make(map[ChannelID][]MsgID)
+	for rows.Next() {
+		var msgID MsgID
+		var channelID ChannelID
+		if err := rows.Scan(&msgID, &channelID); err != nil {
+			return nil, fmt.Errorf("error scanning failed message: %w", err)
+		}
+		failed[channelID] = append(failed[channelID], msgID)
+	}
+
+	return failed, rows.Err()
+}
+
+const sqlFailMessages = `UPDATE msgs_msg SET status = 'F', failed_reason = $2, modified_on = NOW() WHERE id = ANY($1)`
+
+// MarkMessagesFailed marks the passed in messages as failed(F) with the given reason
+func MarkMessagesFailed(ctx context.Context, db DBorTx, msgs []*Msg, failedReason MsgFailedReason) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	ids := make([]MsgID, len(msgs))
+	for i, msg := range msgs {
+		msg.m.Status = MsgStatusFailed
+		msg.m.FailedReason = failedReason
+		ids[i] = msg.ID()
+	}
+
+	if _, err := db.ExecContext(ctx, sqlFailMessages, pq.Array(ids), failedReason); err != nil {
+		return fmt.Errorf("error marking messages as failed: %w", err)
+	}
+	return nil
+}
+
 // CreateMsgOut creates a new outgoing message to the given contact, resolving the destination etc
 func CreateMsgOut(rt *runtime.Runtime, oa *OrgAssets, c *flows.Contact, content *flows.MsgContent, templateID TemplateID, templateVariables []string, locale i18n.Locale, expressionsContext *types.XObject) (*flows.MsgOut, *Channel) {
 	// resolve URN + channel for this contact
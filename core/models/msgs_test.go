@@ -61,7 +61,7 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 			Content:              &flows.MsgContent{Text: "hello"},
 			Flow:                 testdata.Favorites,
 			ResponseTo:           models.MsgID(123425),
-			ExpectedStatus:       models.MsgStatusQueued,
+			ExpectedStatus:       models.MsgStatusInitializing,
 			ExpectedFailedReason: models.NilMsgFailedReason,
 			ExpectedMetadata:     `{}`,
 			ExpectedMsgCount:     1,
@@ -81,7 +81,7 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 			Locale:               "eng-US",
 			Topic:                flows.MsgTopicPurchase,
 			Flow:                 testdata.SingleMessage,
-			ExpectedStatus:       models.MsgStatusQueued,
+			ExpectedStatus:       models.MsgStatusInitializing,
 			ExpectedFailedReason: models.NilMsgFailedReason,
 			ExpectedMetadata:     `{"topic": "purchase"}`,
 			ExpectedMsgCount:     1,
@@ -94,7 +94,7 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 			URNID:                testdata.Cathy.URNID,
 			Content:              &flows.MsgContent{Text: "test outgoing", Attachments: []utils.Attachment{utils.Attachment("image/jpeg:https://dl-foo.com/image.jpg")}},
 			Flow:                 testdata.Favorites,
-			ExpectedStatus:       models.MsgStatusQueued,
+			ExpectedStatus:       models.MsgStatusInitializing,
 			ExpectedFailedReason: models.NilMsgFailedReason,
 			ExpectedMetadata:     `{}`,
 			ExpectedMsgCount:     2,
@@ -169,7 +169,7 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 		}
 
 		flowMsg := flows.NewMsgOut(tc.URN, chRef, tc.Content, tc.Templating, tc.Topic, tc.Locale, tc.Unsendable)
-		msg, err := models.NewOutgoingFlowMsg(rt, oa.Org(), ch, session, flow, flowMsg, dates.Now())
+		msg, err := models.NewOutgoingFlowMsg(rt, oa.Org(), ch, session, flow, "", flowMsg, dates.Now())
 
 		assert.NoError(t, err)
 
@@ -228,14 +228,14 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 	newOutgoing := func(text string) *models.Msg {
 		content := &flows.MsgContent{Text: text}
 		flowMsg := flows.NewMsgOut(urns.URN(fmt.Sprintf("tel:+250700000001?id=%d", testdata.Cathy.URNID)), assets.NewChannelReference(testdata.TwilioChannel.UUID, "Twilio"), content, nil, flows.NilMsgTopic, i18n.NilLocale, flows.NilUnsendableReason)
-		msg, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, session, flow, flowMsg, dates.Now())
+		msg, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, session, flow, "", flowMsg, dates.Now())
 		require.NoError(t, err)
 		return msg
 	}
 
 	for i := 0; i < 19; i++ {
 		msg := newOutgoing("foo")
-		assert.Equal(t, models.MsgStatusQueued, msg.Status())
+		assert.Equal(t, models.MsgStatusInitializing, msg.Status())
 		assert.Equal(t, models.NilMsgFailedReason, msg.FailedReason())
 	}
 	for i := 0; i < 10; i++ {
@@ -245,9 +245,21 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 	}
 	for i := 0; i < 5; i++ {
 		msg := newOutgoing("bar")
-		assert.Equal(t, models.MsgStatusQueued, msg.Status())
+		assert.Equal(t, models.MsgStatusInitializing, msg.Status())
 		assert.Equal(t, models.NilMsgFailedReason, msg.FailedReason())
 	}
+
+	// orgs can configure their own loop detection policy, e.g. fail after 3 messages of any content to the same contact
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"loop_detection": {"limit": 3, "window": 600, "key": "contact", "attachments": true}}' WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+	assert.Equal(t, &models.LoopPolicy{Limit: 3, Window: 600, Key: models.LoopKeyContact, Attachments: true}, oa.Org().LoopPolicy())
+
+	assert.Equal(t, models.MsgStatusInitializing, newOutgoing("one").Status())
+	assert.Equal(t, models.MsgStatusInitializing, newOutgoing("two").Status())
+	assert.Equal(t, models.MsgFailedLooping, newOutgoing("three").FailedReason())
 }
 
 func TestGetMessagesByID(t *testing.T) {
@@ -400,7 +412,7 @@ func TestGetMsgRepetitions(t *testing.T) {
 	msg4 := flows.NewMsgOut(testdata.George.URN, nil, &flows.MsgContent{Text: "foo"}, nil, flows.NilMsgTopic, i18n.NilLocale, flows.NilUnsendableReason)
 
 	assertRepetitions := func(contact *flows.Contact, m *flows.MsgOut, expected int) {
-		count, err := models.GetMsgRepetitions(rt.RP, contact, m)
+		count, err := models.GetMsgRepetitions(rt.RP, models.DefaultLoopPolicy, contact, m, "")
 		require.NoError(t, err)
 		assert.Equal(t, expected, count)
 	}
@@ -418,6 +430,54 @@ func TestGetMsgRepetitions(t *testing.T) {
 		assertRepetitions(george, msg4, i+1)
 	}
 	assertredis.HGetAll(t, rc, "msg_repetitions:2021-11-18T12:15", map[string]string{"10000|foo": "30", "10000|bar": "5", "10002|foo": "5"})
+
+	// with a policy keyed by node, messages from the same node are repetitions regardless of content
+	nodePolicy := &models.LoopPolicy{Limit: 20, Window: 120, Key: models.LoopKeyNode}
+	node := flows.NodeUUID("5c1fd7ee-3a65-4d4d-8a8f-a9a5b1de42b8")
+
+	assertNodeRepetitions := func(m *flows.MsgOut, n flows.NodeUUID, expected int) {
+		count, err := models.GetMsgRepetitions(rt.RP, nodePolicy, cathy, m, n)
+		require.NoError(t, err)
+		assert.Equal(t, expected, count)
+	}
+
+	assertNodeRepetitions(msg1, node, 1)
+	assertNodeRepetitions(msg3, node, 2)
+
+	// messages without a node (e.g. broadcasts) fall back to being keyed by content
+	assertNodeRepetitions(msg1, "", 1)
+	assertNodeRepetitions(msg2, "", 2)
+	assertNodeRepetitions(msg3, "", 1)
+
+	assertredis.HGetAll(t, rc, "msg_repetitions:120:2021-11-18T12:14", map[string]string{
+		"10000|@5c1fd7ee-3a65-4d4d-8a8f-a9a5b1de42b8": "2",
+		"10000|foo": "2",
+		"10000|bar": "1",
+	})
+
+	// attachments are only part of the content if the policy includes them
+	msg5 := flows.NewMsgOut(testdata.Cathy.URN, nil, &flows.MsgContent{Text: "baz", Attachments: []utils.Attachment{"image/jpeg:a.jpg"}}, nil, flows.NilMsgTopic, i18n.NilLocale, flows.NilUnsendableReason)
+	msg6 := flows.NewMsgOut(testdata.Cathy.URN, nil, &flows.MsgContent{Text: "baz", Attachments: []utils.Attachment{"image/jpeg:b.jpg"}}, nil, flows.NilMsgTopic, i18n.NilLocale, flows.NilUnsendableReason)
+
+	assertRepetitions(cathy, msg5, 1)
+	assertRepetitions(cathy, msg6, 2)
+
+	attachmentsPolicy := &models.LoopPolicy{Limit: 20, Window: 180, Key: models.LoopKeyContent, Attachments: true}
+
+	assertAttachmentRepetitions := func(m *flows.MsgOut, expected int) {
+		count, err := models.GetMsgRepetitions(rt.RP, attachmentsPolicy, cathy, m, "")
+		require.NoError(t, err)
+		assert.Equal(t, expected, count)
+	}
+
+	assertAttachmentRepetitions(msg5, 1)
+	assertAttachmentRepetitions(msg6, 1)
+	assertAttachmentRepetitions(msg5, 2)
+
+	assertredis.HGetAll(t, rc, "msg_repetitions:180:2021-11-18T12:12", map[string]string{
+		"10000|baz|image/jpeg:a.jpg": "2",
+		"10000|baz|image/jpeg:b.jpg": "1",
+	})
 }
 
 func TestNormalizeAttachment(t *testing.T) {
@@ -587,12 +647,12 @@ func TestMsgTemplating(t *testing.T) {
 
 	// create a message with templating
 	out1 := flows.NewMsgOut(testdata.Cathy.URN, chRef, &flows.MsgContent{Text: "Hello"}, templating1, flows.NilMsgTopic, i18n.NilLocale, flows.NilUnsendableReason)
-	msg1, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, session, flow, out1, dates.Now())
+	msg1, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, session, flow, "", out1, dates.Now())
 	require.NoError(t, err)
 
 	// create a message without templating
 	out2 := flows.NewMsgOut(testdata.Cathy.URN, chRef, &flows.MsgContent{Text: "Hello"}, nil, flows.NilMsgTopic, i18n.NilLocale, flows.NilUnsendableReason)
-	msg2, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, session, flow, out2, dates.Now())
+	msg2, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, session, flow, "", out2, dates.Now())
 	require.NoError(t, err)
 
 	err = models.InsertMessages(ctx, rt.DB, []*models.Msg{msg1, msg2})
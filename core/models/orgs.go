@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/dbutil"
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/jsonx"
@@ -73,6 +74,12 @@ const (
 
 	configDTOneKey    = "dtone_key"
 	configDTOneSecret = "dtone_secret"
+
+	orgConfigHolidays        = "holidays"
+	orgConfigOutboxThreshold = "outbox_threshold"
+
+	// the outbox size at which an org's throttled tasks are paused, unless overridden in its config
+	defaultOutboxThreshold = 10_000
 )
 
 // Org is mailroom's type for RapidPro orgs. It also implements the envs.Environment interface for GoFlow
@@ -88,7 +95,12 @@ type Org struct {
 		Config          null.Map[any] `json:"config"`
 		OutboxCount     int           `json:"outbox_count"`
 	}
-	env envs.Environment
+	env           envs.Environment
+	loopPolicy    *LoopPolicy
+	contentFilter ContentFilter
+	holidays      []dates.Date
+
+	outboxThreshold int
 }
 
 // ID returns the id of the org
@@ -111,6 +123,15 @@ func (o *Org) Environment() envs.Environment { return o.env }
 
 func (o *Org) OutboxCount() int { return o.o.OutboxCount }
 
+// OutboxThreshold returns the outbox size at which this org's throttled tasks are paused
+func (o *Org) OutboxThreshold() int { return o.outboxThreshold }
+
+// LoopPolicy returns the policy used to detect message loops for this org
+func (o *Org) LoopPolicy() *LoopPolicy { return o.loopPolicy }
+
+// Holidays returns the dates this org considers holidays, which campaign events can be configured to not fire on
+func (o *Org) Holidays() []dates.Date { return o.holidays }
+
 // MarshalJSON is our custom marshaller so that our inner env get output
 func (o *Org) MarshalJSON() ([]byte, error) {
 	return json.Marshal(o.env)
@@ -127,6 +148,11 @@ func (o *Org) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+
+	o.loopPolicy = readLoopPolicy(o.o.Config[orgConfigLoopDetection])
+	o.contentFilter = readContentFilter(o.o.Config[orgConfigContentFilter])
+	o.holidays = readHolidays(o.o.Config[orgConfigHolidays])
+	o.outboxThreshold = readOutboxThreshold(o.o.Config[orgConfigOutboxThreshold])
 	return nil
 }
 
@@ -139,6 +165,29 @@ func (o *Org) ConfigValue(key string, def string) string {
 	return def
 }
 
+// parses a list of holidays from the given org config value which should be a list of YYYY-MM-DD dates, ignoring any
+// invalid values
+func readHolidays(v any) []dates.Date {
+	vs, _ := v.([]any)
+	holidays := make([]dates.Date, 0, len(vs))
+	for _, v := range vs {
+		s, _ := v.(string)
+		if t, err := time.Parse(time.DateOnly, s); err == nil {
+			holidays = append(holidays, dates.ExtractDate(t))
+		}
+	}
+	return holidays
+}
+
+// parses an outbox threshold from the given org config value which should be a positive number, using the default
+// threshold for any invalid value
+func readOutboxThreshold(v any) int {
+	if n, ok := v.(float64); ok && n >= 1 {
+		return int(n)
+	}
+	return defaultOutboxThreshold
+}
+
 // EmailService returns the email service for this org
 func (o *Org) EmailService(ctx context.Context, rt *runtime.Runtime, retries *smtpx.RetryConfig) (flows.EmailService, error) {
 	// first look for custom SMTP on this org
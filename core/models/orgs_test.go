@@ -32,6 +32,7 @@ func TestLoadOrg(t *testing.T) {
 	rt.DB.MustExec(`UPDATE orgs_org SET is_suspended = TRUE WHERE id = $1`, testdata.Org2.ID)
 	rt.DB.MustExec(`UPDATE orgs_org SET flow_languages = '{}' WHERE id = $1`, testdata.Org2.ID)
 	rt.DB.MustExec(`UPDATE orgs_org SET date_format = 'M' WHERE id = $1`, testdata.Org2.ID)
+	rt.DB.MustExec(`UPDATE orgs_org SET config = COALESCE(config, '{}') || '{"outbox_threshold": 500}' WHERE id = $1`, testdata.Org2.ID)
 
 	org, err := models.LoadOrg(ctx, rt.DB.DB, testdata.Org1.ID)
 	assert.NoError(t, err)
@@ -40,6 +41,7 @@ func TestLoadOrg(t *testing.T) {
 	assert.False(t, org.Suspended())
 	assert.Equal(t, "smtp://foo:bar", org.FlowSMTP())
 	assert.Equal(t, 0, org.OutboxCount())
+	assert.Equal(t, 10_000, org.OutboxThreshold())
 	assert.Equal(t, envs.DateFormatDayMonthYear, org.Environment().DateFormat())
 	assert.Equal(t, envs.TimeFormatHourMinute, org.Environment().TimeFormat())
 	assert.Equal(t, envs.RedactionPolicyNone, org.Environment().RedactionPolicy())
@@ -53,6 +55,7 @@ func TestLoadOrg(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, org.Suspended())
 	assert.Equal(t, "", org.FlowSMTP())
+	assert.Equal(t, 500, org.OutboxThreshold())
 	assert.Equal(t, envs.DateFormatMonthDayYear, org.Environment().DateFormat())
 	assert.Equal(t, []i18n.Language{}, org.Environment().AllowedLanguages())
 	assert.Equal(t, i18n.NilLanguage, org.Environment().DefaultLanguage())
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ScheduleFireID is our type for schedule fire IDs
+type ScheduleFireID int
+
+// ScheduleFireOutcome is what happened when a schedule was due to fire
+type ScheduleFireOutcome string
+
+const (
+	ScheduleFireOutcomeFired   = ScheduleFireOutcome("F") // broadcast or flow start created
+	ScheduleFireOutcomeSkipped = ScheduleFireOutcome("S") // missed and skipped according to the catch up policy
+	ScheduleFireOutcomeNoop    = ScheduleFireOutcome("N") // schedule has no active broadcast or trigger
+	ScheduleFireOutcomeFailed  = ScheduleFireOutcome("E") // error whilst firing
+)
+
+// ScheduleFire is a record of a schedule being due to fire and what happened
+type ScheduleFire struct {
+	ID          ScheduleFireID      `db:"id"            json:"id"`
+	OrgID       OrgID               `db:"org_id"        json:"-"`
+	ScheduleID  ScheduleID          `db:"schedule_id"   json:"schedule_id"`
+	ScheduledOn time.Time           `db:"scheduled_on"  json:"scheduled_on"`
+	FiredOn     time.Time           `db:"fired_on"      json:"fired_on"`
+	Outcome     ScheduleFireOutcome `db:"outcome"       json:"outcome"`
+	BroadcastID BroadcastID         `db:"broadcast_id"  json:"broadcast_id,omitempty"`
+	FlowStartID StartID             `db:"flow_start_id" json:"flow_start_id,omitempty"`
+}
+
+// NewScheduleFire creates a new fire record for the given schedule
+func NewScheduleFire(s *Schedule, scheduledOn, firedOn time.Time, outcome ScheduleFireOutcome) *ScheduleFire {
+	return &ScheduleFire{
+		OrgID:       s.OrgID,
+		ScheduleID:  s.ID,
+		ScheduledOn: scheduledOn,
+		FiredOn:     firedOn,
+		Outcome:     outcome,
+	}
+}
+
+const sqlInsertScheduleFire = `
+INSERT INTO schedules_schedulefire( org_id,  schedule_id,  scheduled_on,  fired_on,  outcome,  broadcast_id,  flow_start_id)
+                            VALUES(:org_id, :schedule_id, :scheduled_on, :fired_on, :outcome, :broadcast_id, :flow_start_id)
+  RETURNING id`
+
+// InsertScheduleFires inserts the given schedule fire records
+func InsertScheduleFires(ctx context.Context, db DBorTx, fires []*ScheduleFire) error {
+	return BulkQuery(ctx, "insert schedule fires", db, sqlInsertScheduleFire, fires)
+}
+
+const sqlInsertScheduleFireFailed = `
+INSERT INTO schedules_schedulefire(org_id, schedule_id, scheduled_on, fired_on, outcome)
+     SELECT $1, $2, $3, $4, 'E'
+      WHERE NOT EXISTS (SELECT 1 FROM schedules_schedulefire WHERE schedule_id = $2 AND scheduled_on = $3 AND outcome = 'E')`
+
+// InsertScheduleFireFailed records that the given schedule failed to fire at the given scheduled time. A failed fire
+// is retried every time schedules are checked, so this is only recorded once for each scheduled time.
+func InsertScheduleFireFailed(ctx context.Context, db DBorTx, s *Schedule, scheduledOn, firedOn time.Time) error {
+	if _, err := db.ExecContext(ctx, sqlInsertScheduleFireFailed, s.OrgID, s.ID, scheduledOn, firedOn); err != nil {
+		return fmt.Errorf("error inserting failed schedule fire: %w", err)
+	}
+	return nil
+}
+
+const sqlSelectScheduleFires = `
+  SELECT id, org_id, schedule_id, scheduled_on, fired_on, outcome, broadcast_id, flow_start_id
+    FROM schedules_schedulefire
+   WHERE org_id = $1 AND schedule_id = $2
+ORDER BY scheduled_on DESC, id DESC
+   LIMIT $3`
+
+// GetScheduleFires returns the most recent fire records for the given schedule, newest first
+func GetScheduleFires(ctx context.Context, db *sqlx.DB, orgID OrgID, scheduleID ScheduleID, limit int) ([]*ScheduleFire, error) {
+	fires := make([]*ScheduleFire, 0, limit)
+
+	if err := db.SelectContext(ctx, &fires, sqlSelectScheduleFires, orgID, scheduleID, limit); err != nil {
+		return nil, fmt.Errorf("error selecting schedule fires: %w", err)
+	}
+
+	return fires, nil
+}
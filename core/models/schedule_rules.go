@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+const (
+	// limits on rule values which stop rules being used to create schedules which are too expensive to evaluate
+	maxRuleInterval = 1000
+	maxRuleCount    = 10_000
+)
+
+// rules can't repeat more often than daily
+var ruleFrequencies = []rrule.Frequency{rrule.YEARLY, rrule.MONTHLY, rrule.WEEKLY, rrule.DAILY}
+
+// ScheduleRule is an iCalendar (RFC 5545) recurrence rule, with times evaluated in a timezone so that occurrences
+// stay at the same local time across DST changes. BYHOUR, BYMINUTE etc aren't supported - occurrences always happen
+// at the time of day of the start.
+type ScheduleRule struct {
+	opts  rrule.ROption
+	rrule *rrule.RRule
+}
+
+// ParseScheduleRule parses a recurrence rule which may be a bare rule like FREQ=WEEKLY;INTERVAL=2, or the RFC 5545
+// text form which includes a DTSTART line and an RRULE line. Times without a Z suffix are read in the given timezone.
+func ParseScheduleRule(s string, tz *time.Location) (*ScheduleRule, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\r\n", "\n")
+	if s == "" {
+		return nil, errors.New("rule has no RRULE")
+	}
+
+	opts, err := rrule.StrToROptionInLocation(s, tz)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(ruleFrequencies, opts.Freq) {
+		return nil, fmt.Errorf("unsupported frequency: %s", opts.Freq)
+	}
+	if len(opts.Byhour) > 0 || len(opts.Byminute) > 0 || len(opts.Bysecond) > 0 || len(opts.Byeaster) > 0 {
+		return nil, errors.New("rule can't include BYHOUR, BYMINUTE, BYSECOND or BYEASTER")
+	}
+	// the library reads an omitted INTERVAL or COUNT as zero, so explicit zeros have to be looked for in the rule itself
+	if opts.Interval < 0 || opts.Interval > maxRuleInterval || (opts.Interval == 0 && ruleHasPart(s, "INTERVAL")) {
+		return nil, fmt.Errorf("invalid INTERVAL value %d: must be between 1 and %d", opts.Interval, maxRuleInterval)
+	}
+	if opts.Count < 0 || opts.Count > maxRuleCount || (opts.Count == 0 && ruleHasPart(s, "COUNT")) {
+		return nil, fmt.Errorf("invalid COUNT value %d: must be between 1 and %d", opts.Count, maxRuleCount)
+	}
+	if opts.Count != 0 && !opts.Until.IsZero() {
+		return nil, errors.New("rule can't have both COUNT and UNTIL")
+	}
+
+	if !opts.Dtstart.IsZero() {
+		opts.Dtstart = opts.Dtstart.In(tz)
+	}
+
+	return newScheduleRule(*opts)
+}
+
+// checks whether the RRULE of the given rule text includes the given part, e.g. INTERVAL
+func ruleHasPart(s, name string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, "DTSTART") {
+			continue
+		}
+		for _, part := range strings.Split(strings.TrimPrefix(line, "RRULE:"), ";") {
+			if key, _, found := strings.Cut(part, "="); found && strings.EqualFold(strings.TrimSpace(key), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newScheduleRule(opts rrule.ROption) (*ScheduleRule, error) {
+	r := &ScheduleRule{opts: opts}
+
+	// without a start there's nothing to evaluate, and the library would default it to now
+	if !opts.Dtstart.IsZero() {
+		var err error
+		if r.rrule, err = rrule.NewRRule(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Start returns the start (DTSTART) of this rule, which is zero if it doesn't have one
+func (r *ScheduleRule) Start() time.Time { return r.opts.Dtstart }
+
+// WithStart returns a copy of this rule with the given start
+func (r *ScheduleRule) WithStart(start time.Time) (*ScheduleRule, error) {
+	opts := r.opts
+	opts.Dtstart = start
+	return newScheduleRule(opts)
+}
+
+// String returns the RFC 5545 text form of this rule, with its start as a local time
+func (r *ScheduleRule) String() string {
+	if r.opts.Dtstart.IsZero() {
+		return "RRULE:" + r.opts.RRuleString()
+	}
+	return "DTSTART:" + r.opts.Dtstart.Format(rrule.LocalDateTimeFormat) + "\nRRULE:" + r.opts.RRuleString()
+}
+
+// Next returns the first occurrence of this rule after the given time, or nil if there isn't one. Evaluating a rule
+// means iterating over its occurrences from its start, so if from is a known occurrence of this rule, e.g. the current
+// next fire of a schedule, then evaluation starts there instead. That's only possible for rules without a COUNT, but
+// those are bounded by their count anyway.
+func (r *ScheduleRule) Next(after time.Time, from *time.Time) *time.Time {
+	if r.rrule == nil {
+		return nil
+	}
+
+	rr := r.rrule
+	if r.opts.Count == 0 && from != nil && from.After(r.opts.Dtstart) && !from.After(after) {
+		rebased := *r.rrule
+		rebased.DTStart(from.In(r.opts.Dtstart.Location()))
+		rr = &rebased
+	}
+
+	next := rr.After(after, false)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
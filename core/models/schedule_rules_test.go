@@ -0,0 +1,162 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScheduleRule(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	tcs := []struct {
+		rule          string
+		expectedStr   string
+		expectedError string
+	}{
+		{rule: "FREQ=DAILY", expectedStr: "RRULE:FREQ=DAILY"},
+		{rule: "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", expectedStr: "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR"},
+		{rule: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=6", expectedStr: "RRULE:FREQ=MONTHLY;COUNT=6;BYDAY=-1FR"},
+		{rule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", expectedStr: "RRULE:FREQ=MONTHLY;BYSETPOS=-1;BYDAY=MO,TU,WE,TH,FR"},
+		{rule: "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH;WKST=SU", expectedStr: "RRULE:FREQ=YEARLY;WKST=SU;BYMONTH=11;BYDAY=+4TH"},
+		{rule: "DTSTART:20240620T090000\nRRULE:FREQ=DAILY;UNTIL=20240630T235959", expectedStr: "DTSTART:20240620T090000\nRRULE:FREQ=DAILY;UNTIL=20240701T065959Z"},
+		{rule: "DTSTART;TZID=America/Los_Angeles:20240620T090000\r\nRRULE:FREQ=DAILY", expectedStr: "DTSTART:20240620T090000\nRRULE:FREQ=DAILY"},
+		{rule: "DTSTART:20240620T160000Z\nRRULE:FREQ=DAILY", expectedStr: "DTSTART:20240620T090000\nRRULE:FREQ=DAILY"},
+
+		{rule: "", expectedError: "rule has no RRULE"},
+		{rule: "RRULE:INTERVAL=2", expectedError: "RRULE property FREQ is required"},
+		{rule: "FREQ=HOURLY", expectedError: "unsupported frequency: HOURLY"},
+		{rule: "FREQ=DAILY;BYHOUR=9", expectedError: "rule can't include BYHOUR, BYMINUTE, BYSECOND or BYEASTER"},
+		{rule: "FREQ=DAILY;INTERVAL", expectedError: "wrong format"},
+		{rule: "FREQ=DAILY;INTERVAL=1001", expectedError: "invalid INTERVAL value 1001: must be between 1 and 1000"},
+		{rule: "FREQ=DAILY;INTERVAL=0", expectedError: "invalid INTERVAL value 0: must be between 1 and 1000"},
+		{rule: "RRULE:FREQ=WEEKLY;COUNT=0", expectedError: "invalid COUNT value 0: must be between 1 and 10000"},
+		{rule: "FREQ=DAILY;COUNT=10001", expectedError: "invalid COUNT value 10001: must be between 1 and 10000"},
+		{rule: "DTSTART:20240620T090000\nRRULE:FREQ=MONTHLY;BYMONTHDAY=0", expectedError: "bymonthday must be between 1 and 31 or -1 and -31"},
+		{rule: "FREQ=MONTHLY;BYDAY=XX", expectedError: "undefined weekday: XX"},
+		{rule: "FREQ=DAILY;COUNT=3;UNTIL=20240630", expectedError: "rule can't have both COUNT and UNTIL"},
+	}
+
+	for _, tc := range tcs {
+		rule, err := models.ParseScheduleRule(tc.rule, la)
+		if tc.expectedError != "" {
+			assert.EqualError(t, err, tc.expectedError, "error mismatch for rule %q", tc.rule)
+		} else if assert.NoError(t, err, "unexpected error for rule %q", tc.rule) {
+			assert.Equal(t, tc.expectedStr, rule.String(), "string mismatch for rule %q", tc.rule)
+		}
+	}
+}
+
+func TestScheduleRuleOccurrences(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	dt := func(y int, m time.Month, d, h, min int) time.Time { return time.Date(y, m, d, h, min, 0, 0, la) }
+
+	tcs := []struct {
+		rule     string
+		expected []time.Time
+	}{
+		{ // every 2 days
+			rule:     "DTSTART:20240620T090000\nRRULE:FREQ=DAILY;INTERVAL=2",
+			expected: []time.Time{dt(2024, 6, 20, 9, 0), dt(2024, 6, 22, 9, 0), dt(2024, 6, 24, 9, 0), dt(2024, 6, 26, 9, 0)},
+		},
+		{ // weekdays only, until a date
+			rule:     "DTSTART:20240620T090000\nRRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;UNTIL=20240626T235959",
+			expected: []time.Time{dt(2024, 6, 20, 9, 0), dt(2024, 6, 21, 9, 0), dt(2024, 6, 24, 9, 0), dt(2024, 6, 25, 9, 0), dt(2024, 6, 26, 9, 0)},
+		},
+		{ // every 2 weeks on Monday and Friday, starting on a Thursday
+			rule:     "DTSTART:20240620T090000\nRRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			expected: []time.Time{dt(2024, 6, 21, 9, 0), dt(2024, 7, 1, 9, 0), dt(2024, 7, 5, 9, 0), dt(2024, 7, 15, 9, 0)},
+		},
+		{ // weekly on the start's weekday, limited by count
+			rule:     "DTSTART:20240620T090000\nRRULE:FREQ=WEEKLY;COUNT=3",
+			expected: []time.Time{dt(2024, 6, 20, 9, 0), dt(2024, 6, 27, 9, 0), dt(2024, 7, 4, 9, 0)},
+		},
+		{ // last Friday of the month
+			rule:     "DTSTART:20240620T090000\nRRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=6",
+			expected: []time.Time{dt(2024, 6, 28, 9, 0), dt(2024, 7, 26, 9, 0), dt(2024, 8, 30, 9, 0), dt(2024, 9, 27, 9, 0), dt(2024, 10, 25, 9, 0), dt(2024, 11, 29, 9, 0)},
+		},
+		{ // last weekday of the month
+			rule:     "DTSTART:20240620T090000\nRRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+			expected: []time.Time{dt(2024, 6, 28, 9, 0), dt(2024, 7, 31, 9, 0), dt(2024, 8, 30, 9, 0), dt(2024, 9, 30, 9, 0)},
+		},
+		{ // monthly on the 31st skips months without one
+			rule:     "DTSTART:20240131T090000\nRRULE:FREQ=MONTHLY",
+			expected: []time.Time{dt(2024, 1, 31, 9, 0), dt(2024, 3, 31, 9, 0), dt(2024, 5, 31, 9, 0), dt(2024, 7, 31, 9, 0)},
+		},
+		{ // last day of every 3rd month
+			rule:     "DTSTART:20240101T090000\nRRULE:FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=-1",
+			expected: []time.Time{dt(2024, 1, 31, 9, 0), dt(2024, 4, 30, 9, 0), dt(2024, 7, 31, 9, 0), dt(2024, 10, 31, 9, 0)},
+		},
+		{ // US thanksgiving
+			rule:     "DTSTART:20240101T120000\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH",
+			expected: []time.Time{dt(2024, 11, 28, 12, 0), dt(2025, 11, 27, 12, 0), dt(2026, 11, 26, 12, 0)},
+		},
+		{ // same local time across DST change
+			rule:     "DTSTART:20240309T093000\nRRULE:FREQ=DAILY;COUNT=2",
+			expected: []time.Time{dt(2024, 3, 9, 9, 30), dt(2024, 3, 10, 9, 30)},
+		},
+		{ // can never match
+			rule:     "DTSTART:20240101T090000\nRRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30",
+			expected: []time.Time{},
+		},
+	}
+
+	for _, tc := range tcs {
+		rule, err := models.ParseScheduleRule(tc.rule, la)
+		require.NoError(t, err)
+
+		actual := make([]time.Time, 0, len(tc.expected))
+		for next := rule.Next(rule.Start().Add(-time.Second), nil); next != nil && len(actual) < len(tc.expected); next = rule.Next(*next, nil) {
+			actual = append(actual, *next)
+		}
+
+		assert.Equal(t, tc.expected, actual, "occurrences mismatch for rule %q", tc.rule)
+	}
+
+	rule, _ := models.ParseScheduleRule("DTSTART:20240620T090000\nRRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=2", la)
+	assert.Equal(t, dt(2024, 6, 28, 9, 0), *rule.Next(dt(2024, 6, 20, 9, 0), nil))
+	assert.Equal(t, dt(2024, 7, 26, 9, 0), *rule.Next(dt(2024, 6, 28, 9, 0), nil))
+	assert.Nil(t, rule.Next(dt(2024, 7, 26, 9, 0), nil))
+
+	// nothing without a start
+	rule, _ = models.ParseScheduleRule("FREQ=DAILY", la)
+	assert.Nil(t, rule.Next(dt(2024, 6, 20, 9, 0), nil))
+}
+
+func TestScheduleRuleNextFromOccurrence(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	rules := []string{
+		"DTSTART:20240620T090000\nRRULE:FREQ=DAILY;INTERVAL=3",
+		"DTSTART:20240620T090000\nRRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+		"DTSTART:20240620T090000\nRRULE:FREQ=WEEKLY;INTERVAL=3",
+		"DTSTART:20240131T090000\nRRULE:FREQ=MONTHLY",
+		"DTSTART:20240620T090000\nRRULE:FREQ=MONTHLY;INTERVAL=2;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+		"DTSTART:20240229T090000\nRRULE:FREQ=YEARLY",
+		"DTSTART:20240620T090000\nRRULE:FREQ=DAILY;COUNT=5",
+	}
+
+	// evaluating from any occurrence should give the same occurrences as evaluating from the start
+	for _, r := range rules {
+		rule, err := models.ParseScheduleRule(r, la)
+		require.NoError(t, err)
+
+		var occurrences []time.Time
+		for next := rule.Next(rule.Start().Add(-time.Second), nil); next != nil && len(occurrences) < 20; next = rule.Next(*next, nil) {
+			occurrences = append(occurrences, *next)
+		}
+
+		for i, from := range occurrences {
+			for _, after := range occurrences[i:] {
+				assert.Equal(t, rule.Next(after, nil), rule.Next(after, &from), "next mismatch for rule %q after %s from %s", r, after, from)
+			}
+		}
+	}
+}
@@ -28,6 +28,24 @@ const (
 	RepeatPeriodDaily   = RepeatPeriod("D")
 	RepeatPeriodWeekly  = RepeatPeriod("W")
 	RepeatPeriodMonthly = RepeatPeriod("M")
+	RepeatPeriodRule    = RepeatPeriod("R")
+)
+
+// CatchUpPolicy is what a repeating schedule does about fires which were missed, e.g. because mailroom was down
+type CatchUpPolicy string
+
+const (
+	CatchUpPolicyOnce = CatchUpPolicy("O") // fire once for all missed fires
+	CatchUpPolicySkip = CatchUpPolicy("S") // skip missed fires
+	CatchUpPolicyAll  = CatchUpPolicy("A") // fire every missed fire, up to the schedule's catch up limit
+)
+
+const (
+	// fires which are more than this late are considered missed
+	scheduleMissedAfter = 15 * time.Minute
+
+	// max number of due fires of a schedule that we'll consider at once
+	maxScheduleDueFires = 100
 )
 
 // day of the week constants for weekly repeating schedules
@@ -53,16 +71,19 @@ var dayStrToDayInt = map[rune]time.Weekday{
 
 // Schedule represents a scheduled event
 type Schedule struct {
-	ID                 ScheduleID   `db:"id"                    json:"id"`
-	OrgID              OrgID        `db:"org_id"                json:"org_id"`
-	RepeatPeriod       RepeatPeriod `db:"repeat_period"         json:"repeat_period"`
-	RepeatHourOfDay    *int         `db:"repeat_hour_of_day"    json:"repeat_hour_of_day"`
-	RepeatMinuteOfHour *int         `db:"repeat_minute_of_hour" json:"repeat_minute_of_hour"`
-	RepeatDaysOfWeek   null.String  `db:"repeat_days_of_week"   json:"repeat_days_of_week"`
-	RepeatDayOfMonth   *int         `db:"repeat_day_of_month"   json:"repeat_day_of_month"`
-	NextFire           *time.Time   `db:"next_fire"             json:"next_fire"`
-	LastFire           *time.Time   `db:"last_fire"             json:"last_fire"`
-	IsPaused           bool         `db:"is_paused"`
+	ID                 ScheduleID    `db:"id"                    json:"id"`
+	OrgID              OrgID         `db:"org_id"                json:"org_id"`
+	RepeatPeriod       RepeatPeriod  `db:"repeat_period"         json:"repeat_period"`
+	RepeatHourOfDay    *int          `db:"repeat_hour_of_day"    json:"repeat_hour_of_day"`
+	RepeatMinuteOfHour *int          `db:"repeat_minute_of_hour" json:"repeat_minute_of_hour"`
+	RepeatDaysOfWeek   null.String   `db:"repeat_days_of_week"   json:"repeat_days_of_week"`
+	RepeatDayOfMonth   *int          `db:"repeat_day_of_month"   json:"repeat_day_of_month"`
+	RepeatRule         null.String   `db:"repeat_rule"           json:"repeat_rule"`
+	CatchUp            CatchUpPolicy `db:"catch_up"              json:"catch_up"`
+	CatchUpLimit       *int          `db:"catch_up_limit"        json:"catch_up_limit"`
+	NextFire           *time.Time    `db:"next_fire"             json:"next_fire"`
+	LastFire           *time.Time    `db:"last_fire"             json:"last_fire"`
+	IsPaused           bool          `db:"is_paused"`
 
 	// target that schedule has been loaded with
 	Broadcast *Broadcast `json:"broadcast,omitempty"`
@@ -79,6 +100,7 @@ func NewSchedule(oa *OrgAssets, start time.Time, repeatPeriod RepeatPeriod, repe
 	s := &Schedule{
 		OrgID:        oa.OrgID(),
 		RepeatPeriod: repeatPeriod,
+		CatchUp:      CatchUpPolicyOnce,
 		Timezone:     tz.String(),
 	}
 
@@ -125,13 +147,64 @@ func NewSchedule(oa *OrgAssets, start time.Time, repeatPeriod RepeatPeriod, repe
 	return s, nil
 }
 
+// NewRuleSchedule creates a new schedule object which repeats according to the given iCalendar recurrence rule, e.g.
+// FREQ=MONTHLY;BYDAY=-1FR for the last Friday of every month. The rule is evaluated from the given start time.
+func NewRuleSchedule(oa *OrgAssets, start time.Time, rule string) (*Schedule, error) {
+	tz := oa.Env().Timezone()
+
+	r, err := ParseScheduleRule(rule, tz)
+	if err != nil {
+		return nil, err
+	}
+	if !r.Start().IsZero() {
+		return nil, errors.New("rule can't include DTSTART, use the schedule start instead")
+	}
+	if r, err = r.WithStart(start.In(tz).Truncate(time.Minute)); err != nil {
+		return nil, err
+	}
+
+	// if the given start time is in the past, first fire is the next occurrence in the future
+	after := r.Start().Add(-time.Nanosecond)
+	if now := dates.Now(); r.Start().Before(now) {
+		after = now
+	}
+
+	next := r.Next(after, nil)
+	if next == nil {
+		return nil, errors.New("rule has no occurrences in the future")
+	}
+
+	return &Schedule{
+		OrgID:        oa.OrgID(),
+		RepeatPeriod: RepeatPeriodRule,
+		RepeatRule:   null.String(r.String()),
+		CatchUp:      CatchUpPolicyOnce,
+		NextFire:     next,
+		Timezone:     tz.String(),
+	}, nil
+}
+
 const sqlInsertSchedule = `
 INSERT INTO schedules_schedule( org_id,  repeat_period,  repeat_hour_of_day,  repeat_minute_of_hour,  repeat_days_of_week,  repeat_day_of_month,  next_fire,  is_paused)
 	                    VALUES(:org_id, :repeat_period, :repeat_hour_of_day, :repeat_minute_of_hour, :repeat_days_of_week, :repeat_day_of_month, :next_fire,      FALSE)
   RETURNING id`
 
+const sqlUpdateScheduleExtras = `
+UPDATE schedules_schedule SET repeat_rule = $2, catch_up = COALESCE(NULLIF($3, ''), 'O'), catch_up_limit = $4 WHERE id = $1`
+
 func (s *Schedule) Insert(ctx context.Context, db DBorTx) error {
-	return BulkQuery(ctx, "insert schedule", db, sqlInsertSchedule, []any{s})
+	if err := BulkQuery(ctx, "insert schedule", db, sqlInsertSchedule, []any{s}); err != nil {
+		return err
+	}
+
+	// these are columns which RapidPro doesn't have yet so we only write them for schedules which use them
+	if s.RepeatRule != "" || (s.CatchUp != "" && s.CatchUp != CatchUpPolicyOnce) || s.CatchUpLimit != nil {
+		if _, err := db.ExecContext(ctx, sqlUpdateScheduleExtras, s.ID, s.RepeatRule, s.CatchUp, s.CatchUpLimit); err != nil {
+			return fmt.Errorf("error setting repeat rule and catch up policy of schedule #%d: %w", s.ID, err)
+		}
+	}
+
+	return nil
 }
 
 func (s *Schedule) GetTimezone() (*time.Location, error) {
@@ -188,6 +261,10 @@ func (s *Schedule) GetNextFire(now time.Time) (*time.Time, error) {
 		return nil, nil
 	}
 
+	if s.RepeatPeriod == RepeatPeriodRule {
+		return s.getNextRuleFire(now)
+	}
+
 	// should have hour and minute on everything else
 	if s.RepeatHourOfDay == nil {
 		return nil, errors.New("no repeat_hour_of_day set")
@@ -268,6 +345,97 @@ func (s *Schedule) GetNextFire(now time.Time) (*time.Time, error) {
 	}
 }
 
+func (s *Schedule) getNextRuleFire(now time.Time) (*time.Time, error) {
+	if s.RepeatRule == "" {
+		return nil, errors.New("repeats by rule but has no repeat_rule")
+	}
+
+	tz, err := s.GetTimezone()
+	if err != nil {
+		return nil, fmt.Errorf("error loading timezone: %w", err)
+	}
+
+	rule, err := ParseScheduleRule(string(s.RepeatRule), tz)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repeat_rule: %w", err)
+	}
+	if rule.Start().IsZero() {
+		return nil, errors.New("repeat_rule has no DTSTART")
+	}
+
+	// as above, increment now by a minute to avoid double scheduling, and our current next fire is always an occurrence
+	// of the rule so we can evaluate it from there
+	return rule.Next(now.Add(time.Minute), s.NextFire), nil
+}
+
+// GetDueFires returns the fires of this schedule which are due as of now, split into those which should be fired and
+// those which were missed and should be skipped according to the schedule's catch up policy. Also returns the next fire
+// after now.
+func (s *Schedule) GetDueFires(now time.Time) ([]time.Time, []time.Time, *time.Time, error) {
+	var err error
+	var due []time.Time
+	next := s.NextFire
+
+	for next != nil && !next.After(now) && len(due) < maxScheduleDueFires {
+		due = append(due, *next)
+
+		if next, err = s.GetNextFire(*next); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// if there were more due fires than we consider, ignore the rest
+	if next != nil && !next.After(now) {
+		if next, err = s.GetNextFire(now); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if len(due) == 0 {
+		return nil, nil, next, nil
+	}
+
+	var fire, skip []time.Time
+
+	switch s.CatchUp {
+	case CatchUpPolicySkip:
+		for _, t := range due {
+			if now.Sub(t) > scheduleMissedAfter {
+				skip = append(skip, t)
+			} else {
+				fire = append(fire, t)
+			}
+		}
+	case CatchUpPolicyAll:
+		limit := len(due)
+		if s.CatchUpLimit != nil {
+			limit = min(max(*s.CatchUpLimit, 1), limit)
+		}
+		skip, fire = due[:len(due)-limit], due[len(due)-limit:]
+	default:
+		skip, fire = due[:len(due)-1], due[len(due)-1:]
+	}
+
+	return fire, skip, next, nil
+}
+
+// GetNextFires returns up to count fires of this schedule starting with its next fire
+func (s *Schedule) GetNextFires(count int) ([]time.Time, error) {
+	fires := make([]time.Time, 0, count)
+	next := s.NextFire
+
+	for next != nil && len(fires) < count {
+		fires = append(fires, *next)
+
+		var err error
+		if next, err = s.GetNextFire(*next); err != nil {
+			return nil, err
+		}
+	}
+
+	return fires, nil
+}
+
 // returns number of days in the month for the passed in date using crazy golang date magic
 func daysInMonth(t time.Time) int {
 	// day 0 of a month is previous day of previous month, months can be > 12 and roll years
@@ -285,6 +453,9 @@ SELECT ROW_TO_JSON(s) FROM (
         s.repeat_day_of_month,
         s.repeat_days_of_week,
         s.repeat_period,
+        to_jsonb(s) ->> 'repeat_rule' AS repeat_rule,
+        COALESCE(to_jsonb(s) ->> 'catch_up', 'O') AS catch_up,
+        to_jsonb(s) -> 'catch_up_limit' AS catch_up_limit,
         s.next_fire,
         s.last_fire,
         o.timezone AS timezone,
@@ -293,11 +464,13 @@ SELECT ROW_TO_JSON(s) FROM (
                 b.id AS broadcast_id,
                 s.org_id,
                 b.translations,
+                to_jsonb(b) -> 'variants' AS variants,
                 b.base_language,
                 TRUE AS expressions,
                 b.optin_id,
                 b.template_id,
                 b.template_variables,
+                COALESCE((to_jsonb(b) ->> 'contacts_per_minute')::int, 0) AS contacts_per_minute,
                 (SELECT ARRAY_AGG(bc.contact_id) FROM (SELECT contact_id FROM msgs_broadcast_contacts WHERE broadcast_id = b.id) bc) AS contact_ids,
                 (SELECT ARRAY_AGG(bg.contactgroup_id) FROM (SELECT contactgroup_id FROM msgs_broadcast_groups WHERE broadcast_id = b.id) bg) AS group_ids
             FROM
@@ -83,6 +83,36 @@ func TestNewSchedule(t *testing.T) {
 	assert.Equal(t, 15, *sched.RepeatMinuteOfHour)
 	assert.Equal(t, 20, *sched.RepeatDayOfMonth)
 	assert.Equal(t, time.Date(2024, 7, 20, 7, 15, 0, 0, oa.Env().Timezone()), *sched.NextFire)
+
+	_, err = models.NewRuleSchedule(oa, time.Date(2024, 6, 20, 14, 45, 55, 0, time.UTC), "FREQ=HOURLY")
+	assert.EqualError(t, err, "unsupported frequency: HOURLY")
+
+	_, err = models.NewRuleSchedule(oa, time.Date(2024, 6, 20, 14, 45, 55, 0, time.UTC), "DTSTART:20240620T074500\nRRULE:FREQ=DAILY")
+	assert.EqualError(t, err, "rule can't include DTSTART, use the schedule start instead")
+
+	_, err = models.NewRuleSchedule(oa, time.Date(2024, 6, 20, 14, 15, 55, 0, time.UTC), "FREQ=DAILY;COUNT=1")
+	assert.EqualError(t, err, "rule has no occurrences in the future")
+
+	// create rule schedule with start in the future
+	sched, err = models.NewRuleSchedule(oa, time.Date(2024, 6, 20, 14, 45, 55, 0, time.UTC), "FREQ=WEEKLY;BYDAY=MO,FR")
+	assert.NoError(t, err)
+	assert.Equal(t, testdata.Org1.ID, sched.OrgID)
+	assert.Equal(t, models.RepeatPeriodRule, sched.RepeatPeriod)
+	assert.Equal(t, "DTSTART:20240620T074500\nRRULE:FREQ=WEEKLY;BYDAY=MO,FR", string(sched.RepeatRule))
+	assert.Equal(t, time.Date(2024, 6, 21, 7, 45, 0, 0, oa.Env().Timezone()), *sched.NextFire)
+
+	fires, err := sched.GetNextFires(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 6, 21, 7, 45, 0, 0, oa.Env().Timezone()),
+		time.Date(2024, 6, 24, 7, 45, 0, 0, oa.Env().Timezone()),
+		time.Date(2024, 6, 28, 7, 45, 0, 0, oa.Env().Timezone()),
+	}, fires)
+
+	// create rule schedule with start in the past
+	sched, err = models.NewRuleSchedule(oa, time.Date(2024, 6, 20, 14, 15, 55, 0, time.UTC), "FREQ=DAILY")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 21, 7, 15, 0, 0, oa.Env().Timezone()), *sched.NextFire)
 }
 
 func TestGetExpired(t *testing.T) {
@@ -336,6 +366,45 @@ func TestGetNextFire(t *testing.T) {
 			Schedule:      []byte(`{"repeat_period": "M", "repeat_day_of_month": 10, "repeat_hour_of_day": 12, "repeat_minute_of_hour": 30}`),
 			ExpectedNexts: []time.Time{time.Date(2019, 3, 10, 12, 30, 0, 0, la)},
 		},
+		{
+			Label:         "rule repeat with no rule set",
+			Now:           time.Date(2019, 8, 20, 13, 57, 0, 0, la),
+			Timezone:      "America/Los_Angeles",
+			Schedule:      []byte(`{"repeat_period": "R"}`),
+			ExpectedError: "repeats by rule but has no repeat_rule",
+		},
+		{
+			Label:         "rule repeat with invalid rule",
+			Now:           time.Date(2019, 8, 20, 13, 57, 0, 0, la),
+			Timezone:      "America/Los_Angeles",
+			Schedule:      []byte(`{"repeat_period": "R", "repeat_rule": "FREQ=HOURLY"}`),
+			ExpectedError: "error parsing repeat_rule: unsupported frequency: HOURLY",
+		},
+		{
+			Label:         "rule repeat with no start",
+			Now:           time.Date(2019, 8, 20, 13, 57, 0, 0, la),
+			Timezone:      "America/Los_Angeles",
+			Schedule:      []byte(`{"repeat_period": "R", "repeat_rule": "RRULE:FREQ=DAILY"}`),
+			ExpectedError: "repeat_rule has no DTSTART",
+		},
+		{
+			Label:    "rule repeat on last Friday of month across DST end",
+			Now:      time.Date(2019, 8, 30, 9, 0, 0, 0, la),
+			Timezone: "America/Los_Angeles",
+			Schedule: []byte(`{"repeat_period": "R", "repeat_rule": "DTSTART:20190801T090000\nRRULE:FREQ=MONTHLY;BYDAY=-1FR"}`),
+			ExpectedNexts: []time.Time{
+				time.Date(2019, 9, 27, 9, 0, 0, 0, la),
+				time.Date(2019, 10, 25, 9, 0, 0, 0, la),
+				time.Date(2019, 11, 29, 9, 0, 0, 0, la),
+			},
+		},
+		{
+			Label:         "rule repeat with no more occurrences",
+			Now:           time.Date(2019, 8, 30, 9, 0, 0, 0, la),
+			Timezone:      "America/Los_Angeles",
+			Schedule:      []byte(`{"repeat_period": "R", "repeat_rule": "DTSTART:20190801T090000\nRRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=1"}`),
+			ExpectedNexts: []time.Time{},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -367,3 +436,50 @@ func TestGetNextFire(t *testing.T) {
 		}
 	}
 }
+
+func TestGetDueFires(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	dt := func(d, h, m int) time.Time { return time.Date(2019, 8, d, h, m, 0, 0, la) }
+	ref := func(t time.Time) *time.Time { return &t }
+	limit := 2
+
+	tcs := []struct {
+		period       models.RepeatPeriod
+		catchUp      models.CatchUpPolicy
+		catchUpLimit *int
+		now          time.Time
+		expectedFire []time.Time
+		expectedSkip []time.Time
+		expectedNext *time.Time
+	}{
+		{models.RepeatPeriodDaily, models.CatchUpPolicyOnce, nil, dt(20, 12, 5), []time.Time{dt(20, 12, 0)}, []time.Time{dt(17, 12, 0), dt(18, 12, 0), dt(19, 12, 0)}, ref(dt(21, 12, 0))},
+		{models.RepeatPeriodDaily, models.CatchUpPolicyOnce, nil, dt(20, 11, 0), []time.Time{dt(19, 12, 0)}, []time.Time{dt(17, 12, 0), dt(18, 12, 0)}, ref(dt(20, 12, 0))},
+		{models.RepeatPeriodDaily, models.CatchUpPolicySkip, nil, dt(20, 12, 5), []time.Time{dt(20, 12, 0)}, []time.Time{dt(17, 12, 0), dt(18, 12, 0), dt(19, 12, 0)}, ref(dt(21, 12, 0))},
+		{models.RepeatPeriodDaily, models.CatchUpPolicySkip, nil, dt(20, 11, 0), nil, []time.Time{dt(17, 12, 0), dt(18, 12, 0), dt(19, 12, 0)}, ref(dt(20, 12, 0))},
+		{models.RepeatPeriodDaily, models.CatchUpPolicyAll, &limit, dt(20, 12, 5), []time.Time{dt(19, 12, 0), dt(20, 12, 0)}, []time.Time{dt(17, 12, 0), dt(18, 12, 0)}, ref(dt(21, 12, 0))},
+		{models.RepeatPeriodDaily, models.CatchUpPolicyAll, nil, dt(20, 12, 5), []time.Time{dt(17, 12, 0), dt(18, 12, 0), dt(19, 12, 0), dt(20, 12, 0)}, []time.Time{}, ref(dt(21, 12, 0))},
+		{models.RepeatPeriodNever, models.CatchUpPolicyOnce, nil, dt(20, 12, 5), []time.Time{dt(17, 12, 0)}, []time.Time{}, nil},
+		{models.RepeatPeriodNever, models.CatchUpPolicySkip, nil, dt(20, 12, 5), nil, []time.Time{dt(17, 12, 0)}, nil},
+	}
+
+	for i, tc := range tcs {
+		hour, minute := 12, 0
+		sched := &models.Schedule{
+			RepeatPeriod:       tc.period,
+			RepeatHourOfDay:    &hour,
+			RepeatMinuteOfHour: &minute,
+			CatchUp:            tc.catchUp,
+			CatchUpLimit:       tc.catchUpLimit,
+			NextFire:           ref(dt(17, 12, 0)),
+			Timezone:           "America/Los_Angeles",
+		}
+
+		fire, skip, next, err := sched.GetDueFires(tc.now)
+		assert.NoError(t, err, "%d: unexpected error", i)
+		assert.Equal(t, tc.expectedFire, fire, "%d: fire mismatch", i)
+		assert.Equal(t, tc.expectedSkip, skip, "%d: skip mismatch", i)
+		assert.Equal(t, tc.expectedNext, next, "%d: next mismatch", i)
+	}
+}
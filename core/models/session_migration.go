@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/null/v3"
+)
+
+// SessionMigrationDirection is which way session outputs are being migrated
+type SessionMigrationDirection string
+
+const (
+	SessionMigrationToStorage = SessionMigrationDirection("to_storage")
+	SessionMigrationToDB      = SessionMigrationDirection("to_db")
+)
+
+const sessionMigrationKey = "session_output_migration"
+
+// SessionMigration is the state of a migration of waiting session outputs between the database and storage. It's
+// stored in redis so that it can be resumed if interrupted.
+type SessionMigration struct {
+	Direction   SessionMigrationDirection `json:"direction"`
+	BatchSize   int                       `json:"batch_size"`
+	MaxPerRun   int                       `json:"max_per_run"`
+	Cursor      SessionID                 `json:"cursor"`
+	Migrated    int                       `json:"migrated"`
+	Failed      int                       `json:"failed"`
+	StartedOn   time.Time                 `json:"started_on"`
+	CompletedOn *time.Time                `json:"completed_on"`
+}
+
+// StartSessionMigration starts a new migration of session outputs, replacing any existing migration
+func StartSessionMigration(rc redis.Conn, direction SessionMigrationDirection, batchSize, maxPerRun int) (*SessionMigration, error) {
+	m := &SessionMigration{Direction: direction, BatchSize: batchSize, MaxPerRun: maxPerRun, StartedOn: dates.Now()}
+	return m, m.Save(rc)
+}
+
+// GetSessionMigration gets the current or last session output migration, or nil if there isn't one
+func GetSessionMigration(rc redis.Conn) (*SessionMigration, error) {
+	data, err := redis.Bytes(rc.Do("GET", sessionMigrationKey))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting session migration: %w", err)
+	}
+
+	m := &SessionMigration{}
+	if err := jsonx.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("error unmarshaling session migration: %w", err)
+	}
+	return m, nil
+}
+
+// Save saves the state of this migration
+func (m *SessionMigration) Save(rc redis.Conn) error {
+	if _, err := rc.Do("SET", sessionMigrationKey, jsonx.MustMarshal(m)); err != nil {
+		return fmt.Errorf("error saving session migration: %w", err)
+	}
+	return nil
+}
+
+const sqlCountSessionsToMigrateToStorage = `SELECT count(*) FROM flows_flowsession WHERE status = 'W' AND output IS NOT NULL AND output_url IS NULL AND id > $1`
+const sqlCountSessionsToMigrateToDB = `SELECT count(*) FROM flows_flowsession WHERE status = 'W' AND output_url IS NOT NULL AND id > $1`
+
+// Remaining counts the waiting sessions which this migration has yet to process
+func (m *SessionMigration) Remaining(ctx context.Context, db *sqlx.DB) (int, error) {
+	sql := sqlCountSessionsToMigrateToStorage
+	if m.Direction == SessionMigrationToDB {
+		sql = sqlCountSessionsToMigrateToDB
+	}
+
+	var count int
+	if err := db.GetContext(ctx, &count, sql, m.Cursor); err != nil {
+		return 0, fmt.Errorf("error counting sessions to migrate: %w", err)
+	}
+	return count, nil
+}
+
+const sqlSelectSessionsToMigrateToStorage = `
+SELECT s.id, s.uuid, s.org_id, s.contact_id, s.created_on, s.output, s.output_url, c.uuid AS contact_uuid
+  FROM flows_flowsession s
+  JOIN contacts_contact c ON c.id = s.contact_id
+ WHERE s.status = 'W' AND s.output IS NOT NULL AND s.output_url IS NULL AND s.id > $1
+ ORDER BY s.id
+ LIMIT $2`
+
+const sqlSelectSessionsToMigrateToDB = `
+SELECT s.id, s.uuid, s.org_id, s.contact_id, s.created_on, s.output, s.output_url, c.uuid AS contact_uuid
+  FROM flows_flowsession s
+  JOIN contacts_contact c ON c.id = s.contact_id
+ WHERE s.status = 'W' AND s.output_url IS NOT NULL AND s.id > $1
+ ORDER BY s.id
+ LIMIT $2`
+
+// the output_url and output guards make sure we don't overwrite anything written since we read the session
+const sqlUpdateMigratedSessionToStorage = `
+UPDATE flows_flowsession
+   SET output = NULL, output_url = $3
+ WHERE id = $1 AND status = 'W' AND output_url IS NULL AND md5(output) = $2`
+
+const sqlUpdateMigratedSessionToDB = `
+UPDATE flows_flowsession
+   SET output = $3, output_url = NULL
+ WHERE id = $1 AND status = 'W' AND output_url = $2`
+
+type sessionToMigrate struct {
+	ID          SessionID         `db:"id"`
+	UUID        flows.SessionUUID `db:"uuid"`
+	OrgID       OrgID             `db:"org_id"`
+	ContactID   ContactID         `db:"contact_id"`
+	CreatedOn   time.Time         `db:"created_on"`
+	Output      null.String       `db:"output"`
+	OutputURL   null.String       `db:"output_url"`
+	ContactUUID flows.ContactUUID `db:"contact_uuid"`
+}
+
+// MigrateBatch migrates the next batch of sessions and returns how many were processed, updating the state of this
+// migration but not saving it.
+func (m *SessionMigration) MigrateBatch(ctx context.Context, rt *runtime.Runtime) (int, error) {
+	sql := sqlSelectSessionsToMigrateToStorage
+	if m.Direction == SessionMigrationToDB {
+		sql = sqlSelectSessionsToMigrateToDB
+	}
+
+	rows := make([]*sessionToMigrate, 0, m.BatchSize)
+	if err := rt.DB.SelectContext(ctx, &rows, sql, m.Cursor, m.BatchSize); err != nil {
+		return 0, fmt.Errorf("error selecting sessions to migrate: %w", err)
+	}
+	if len(rows) == 0 {
+		now := dates.Now()
+		m.CompletedOn = &now
+		return 0, nil
+	}
+
+	var err error
+	if m.Direction == SessionMigrationToDB {
+		err = m.migrateToDB(ctx, rt, rows)
+	} else {
+		err = m.migrateToStorage(ctx, rt, rows)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	m.Cursor = rows[len(rows)-1].ID
+	return len(rows), nil
+}
+
+func (m *SessionMigration) migrateToStorage(ctx context.Context, rt *runtime.Runtime, rows []*sessionToMigrate) error {
+	sessions := make([]*Session, 0, len(rows))
+	md5s := make([]string, 0, len(rows))
+	for _, r := range rows {
+		s := &Session{contactUUID: r.ContactUUID}
+		s.s.ID = r.ID
+		s.s.UUID = r.UUID
+		s.s.OrgID = r.OrgID
+		s.s.ContactID = r.ContactID
+		s.s.CreatedOn = r.CreatedOn
+		s.s.Output = r.Output
+
+		// sessions whose output can't be decoded are skipped rather than failing the whole batch
+		if _, err := s.Output(); err != nil {
+			slog.Error("error decoding session output to migrate", "session", r.UUID, "error", err)
+			m.Failed++
+			continue
+		}
+
+		sessions = append(sessions, s)
+		md5s = append(md5s, fmt.Sprintf("%x", md5.Sum([]byte(r.Output))))
+	}
+
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	if err := WriteSessionOutputsToStorage(ctx, rt, sessions); err != nil {
+		return err
+	}
+
+	for i, s := range sessions {
+		res, err := rt.DB.ExecContext(ctx, sqlUpdateMigratedSessionToStorage, s.ID(), md5s[i], s.OutputURL())
+		if err != nil {
+			return fmt.Errorf("error updating migrated session #%d: %w", s.ID(), err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			m.Migrated++
+		}
+	}
+	return nil
+}
+
+func (m *SessionMigration) migrateToDB(ctx context.Context, rt *runtime.Runtime, rows []*sessionToMigrate) error {
+	for _, r := range rows {
+		output, err := ReadSessionOutput(ctx, rt, string(r.OutputURL))
+		if err != nil {
+			slog.Error("error reading session output to migrate", "session", r.UUID, "error", err)
+			m.Failed++
+			continue
+		}
+
+		encoded, err := encodeSessionOutput(SessionCompression(rt.Config.SessionCompression), output)
+		if err != nil {
+			return fmt.Errorf("error encoding session output: %w", err)
+		}
+
+		res, err := rt.DB.ExecContext(ctx, sqlUpdateMigratedSessionToDB, r.ID, r.OutputURL, encoded)
+		if err != nil {
+			return fmt.Errorf("error updating migrated session #%d: %w", r.ID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			m.Migrated++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/nyaruka/gocommon/aws/s3x"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// SessionCompression is a compression method for session outputs
+type SessionCompression string
+
+const (
+	SessionCompressionNone = SessionCompression("none")
+	SessionCompressionGzip = SessionCompression("gzip")
+	SessionCompressionZstd = SessionCompression("zstd")
+)
+
+// extensions added to storage paths of compressed outputs
+var sessionCompressionExtensions = map[SessionCompression]string{
+	SessionCompressionGzip: ".gz",
+	SessionCompressionZstd: ".zst",
+}
+
+// content types of stored compressed outputs
+var sessionCompressionContentTypes = map[SessionCompression]string{
+	SessionCompressionGzip: "application/gzip",
+	SessionCompressionZstd: "application/zstd",
+}
+
+// gets the content type of a stored output compressed with the given method
+func sessionContentType(method SessionCompression) string {
+	if ct, ok := sessionCompressionContentTypes[method]; ok {
+		return ct
+	}
+	return "application/json"
+}
+
+// compressed outputs in the database are base64 encoded and prefixed with their method, which can't be confused with
+// uncompressed outputs as those are always JSON objects
+const sessionOutputPrefixSep = ":"
+
+var zstdEncoder, _ = zstd.NewWriter(nil)
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+func compressSessionOutput(method SessionCompression, output []byte) ([]byte, error) {
+	switch method {
+	case SessionCompressionGzip:
+		b := &bytes.Buffer{}
+		w := gzip.NewWriter(b)
+		if _, err := w.Write(output); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case SessionCompressionZstd:
+		return zstdEncoder.EncodeAll(output, nil), nil
+	}
+	return output, nil
+}
+
+func decompressSessionOutput(method SessionCompression, data []byte) ([]byte, error) {
+	switch method {
+	case SessionCompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case SessionCompressionZstd:
+		return zstdDecoder.DecodeAll(data, nil)
+	}
+	return data, nil
+}
+
+// encodes a session output for the database column using the given compression method
+func encodeSessionOutput(method SessionCompression, output []byte) (string, error) {
+	if method == "" || method == SessionCompressionNone {
+		return string(output), nil
+	}
+
+	compressed, err := compressSessionOutput(method, output)
+	if err != nil {
+		return "", fmt.Errorf("error compressing session output: %w", err)
+	}
+	return string(method) + sessionOutputPrefixSep + base64.StdEncoding.EncodeToString(compressed), nil
+}
+
+// decodes a session output from the database column, which may or may not be compressed
+func decodeSessionOutput(encoded string) ([]byte, error) {
+	if encoded == "" || encoded[0] == '{' {
+		return []byte(encoded), nil
+	}
+
+	method, data, found := strings.Cut(encoded, sessionOutputPrefixSep)
+	if !found {
+		return nil, fmt.Errorf("invalid encoded session output")
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding session output: %w", err)
+	}
+
+	output, err := decompressSessionOutput(SessionCompression(method), compressed)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing session output: %w", err)
+	}
+	return output, nil
+}
+
+// SessionObject is a session output to be written to session storage
+type SessionObject struct {
+	Key         string
+	Body        []byte
+	ContentType string
+
+	// set by the storage once written
+	URL string
+}
+
+// SessionStorage is somewhere other than the database that session outputs can be written to and read from
+type SessionStorage interface {
+	Put(ctx context.Context, objects []*SessionObject) error
+	Get(ctx context.Context, url string) ([]byte, error)
+}
+
+// GetSessionStorage returns the configured session storage, or nil if outputs are stored in the database
+func GetSessionStorage(rt *runtime.Runtime) SessionStorage {
+	switch rt.Config.SessionStorage {
+	case "s3":
+		return &s3SessionStorage{s3: rt.S3, bucket: rt.Config.S3SessionsBucket}
+	case "fs":
+		return &fsSessionStorage{dir: rt.Config.SessionStoragePath}
+	}
+	return nil
+}
+
+// gets the session storage which the given output URL was written to, regardless of current configuration
+func sessionStorageForURL(rt *runtime.Runtime, outputURL string) SessionStorage {
+	if strings.HasPrefix(outputURL, "file://") {
+		return &fsSessionStorage{dir: rt.Config.SessionStoragePath}
+	}
+	return &s3SessionStorage{s3: rt.S3, bucket: rt.Config.S3SessionsBucket}
+}
+
+// ReadSessionOutput reads the session output stored at the given URL, decompressing it if necessary
+func ReadSessionOutput(ctx context.Context, rt *runtime.Runtime, outputURL string) ([]byte, error) {
+	data, err := sessionStorageForURL(rt, outputURL).Get(ctx, outputURL)
+	if err != nil {
+		return nil, err
+	}
+
+	for method, ext := range sessionCompressionExtensions {
+		if strings.HasSuffix(outputURL, ext) {
+			output, err := decompressSessionOutput(method, data)
+			if err != nil {
+				return nil, fmt.Errorf("error decompressing session output from %s: %w", outputURL, err)
+			}
+			return output, nil
+		}
+	}
+
+	return data, nil
+}
+
+type s3SessionStorage struct {
+	s3     *s3x.Service
+	bucket string
+}
+
+func (s *s3SessionStorage) Put(ctx context.Context, objects []*SessionObject) error {
+	uploads := make([]*s3x.Upload, len(objects))
+	for i, o := range objects {
+		uploads[i] = &s3x.Upload{
+			Bucket:      s.bucket,
+			Key:         o.Key,
+			Body:        o.Body,
+			ContentType: o.ContentType,
+			ACL:         types.ObjectCannedACLPrivate,
+		}
+	}
+
+	if err := s.s3.BatchPut(ctx, uploads, 32); err != nil {
+		return err
+	}
+
+	for i, o := range objects {
+		o.URL = uploads[i].URL
+	}
+	return nil
+}
+
+func (s *s3SessionStorage) Get(ctx context.Context, outputURL string) ([]byte, error) {
+	// strip just the path out of our output URL
+	u, err := url.Parse(outputURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing output URL: %s: %w", outputURL, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+
+	_, output, err := s.s3.GetObject(ctx, s.bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("error reading session from s3 bucket=%s key=%s: %w", s.bucket, key, err)
+	}
+	return output, nil
+}
+
+// session storage on the local filesystem, for development and testing
+type fsSessionStorage struct {
+	dir string
+}
+
+func (s *fsSessionStorage) Put(ctx context.Context, objects []*SessionObject) error {
+	dir, err := filepath.Abs(s.dir)
+	if err != nil {
+		return fmt.Errorf("error resolving session storage path: %w", err)
+	}
+
+	for _, o := range objects {
+		path := filepath.Join(dir, filepath.FromSlash(o.Key))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("error creating session storage directory: %w", err)
+		}
+		if err := os.WriteFile(path, o.Body, 0644); err != nil {
+			return fmt.Errorf("error writing session to %s: %w", path, err)
+		}
+
+		o.URL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+	return nil
+}
+
+func (s *fsSessionStorage) Get(ctx context.Context, outputURL string) ([]byte, error) {
+	u, err := url.Parse(outputURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing output URL: %s: %w", outputURL, err)
+	}
+
+	output, err := os.ReadFile(filepath.FromSlash(u.Path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading session from %s: %w", u.Path, err)
+	}
+	return output, nil
+}
@@ -0,0 +1,44 @@
+package models_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSSessionStorage(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := runtime.NewDefaultConfig()
+	cfg.SessionStorage = "fs"
+	cfg.SessionStoragePath = t.TempDir()
+	rt := &runtime.Runtime{Config: cfg}
+
+	storage := models.GetSessionStorage(rt)
+	require.NotNil(t, storage)
+
+	objs := []*models.SessionObject{
+		{Key: "orgs/1/c/1234/session1.json", Body: []byte(`{"uuid": "1"}`)},
+		{Key: "orgs/1/c/1234/session2.json", Body: []byte(`{"uuid": "2"}`)},
+	}
+	require.NoError(t, storage.Put(ctx, objs))
+
+	assert.True(t, strings.HasPrefix(objs[0].URL, "file://"+cfg.SessionStoragePath))
+	assert.True(t, strings.HasSuffix(objs[0].URL, "/orgs/1/c/1234/session1.json"))
+
+	output, err := models.ReadSessionOutput(ctx, rt, objs[1].URL)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"uuid": "2"}`, string(output))
+
+	_, err = models.ReadSessionOutput(ctx, rt, "file://"+cfg.SessionStoragePath+"/missing.json")
+	assert.ErrorContains(t, err, "error reading session from")
+
+	// db storage has no external storage
+	cfg.SessionStorage = "db"
+	assert.Nil(t, models.GetSessionStorage(rt))
+}
@@ -7,17 +7,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"net/url"
 	"path"
 	"slices"
-	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
-	"github.com/nyaruka/gocommon/aws/s3x"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
@@ -83,6 +79,9 @@ type Session struct {
 	contact *flows.Contact
 	runs    []*FlowRun
 
+	// only set when loaded without a contact, e.g. for output migrations
+	contactUUID flows.ContactUUID
+
 	seenRuns map[flows.RunUUID]time.Time
 
 	// we keep around a reference to the sprint associated with this session
@@ -99,7 +98,6 @@ func (s *Session) UUID() flows.SessionUUID            { return flows.SessionUUID
 func (s *Session) SessionType() FlowType              { return s.s.SessionType }
 func (s *Session) Status() SessionStatus              { return s.s.Status }
 func (s *Session) Responded() bool                    { return s.s.Responded }
-func (s *Session) Output() string                     { return string(s.s.Output) }
 func (s *Session) OutputURL() string                  { return string(s.s.OutputURL) }
 func (s *Session) ContactID() ContactID               { return s.s.ContactID }
 func (s *Session) OrgID() OrgID                       { return s.s.OrgID }
@@ -115,8 +113,8 @@ func (s *Session) IncomingMsgID() MsgID               { return s.incomingMsgID }
 func (s *Session) IncomingMsgExternalID() null.String { return s.incomingExternalID }
 func (s *Session) Scene() *Scene                      { return s.scene }
 
-// StoragePath returns the path for the session
-func (s *Session) StoragePath() string {
+// StoragePath returns the path for the session with the given output
+func (s *Session) StoragePath(output []byte) string {
 	ts := s.CreatedOn().UTC().Format(storageTSFormat)
 
 	// example output: orgs/1/c/20a5/20a5534c-b2ad-4f18-973a-f1aa3b4e6c74/20060102T150405.123Z_session_8a7fc501-177b-4567-a0aa-81c48e6de1c5_51df83ac21d3cf136d8341f0b11cb1a7.json"
@@ -126,12 +124,15 @@ func (s *Session) StoragePath() string {
 		"c",
 		string(s.ContactUUID()[:4]),
 		string(s.ContactUUID()),
-		fmt.Sprintf("%s_session_%s_%s.json", ts, s.UUID(), s.OutputMD5()),
+		fmt.Sprintf("%s_session_%s_%x.json", ts, s.UUID(), md5.Sum(output)),
 	)
 }
 
 // ContactUUID returns the UUID of our contact
 func (s *Session) ContactUUID() flows.ContactUUID {
+	if s.contact == nil {
+		return s.contactUUID
+	}
 	return s.contact.UUID()
 }
 
@@ -160,9 +161,27 @@ func (s *Session) Timeout() *time.Duration {
 	return s.timeout
 }
 
-// OutputMD5 returns the md5 of the passed in session
-func (s *Session) OutputMD5() string {
-	return fmt.Sprintf("%x", md5.Sum([]byte(s.s.Output)))
+// Output returns the output of this session, decompressing it if necessary
+func (s *Session) Output() ([]byte, error) {
+	output, err := decodeSessionOutput(string(s.s.Output))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding output of session %s: %w", s.UUID(), err)
+	}
+	return output, nil
+}
+
+// compresses our output for writing to the database if that's configured
+func (s *Session) encodeOutput(cfg *runtime.Config) error {
+	output, err := decodeSessionOutput(string(s.s.Output))
+	if err != nil {
+		return err
+	}
+	encoded, err := encodeSessionOutput(SessionCompression(cfg.SessionCompression), output)
+	if err != nil {
+		return err
+	}
+	s.s.Output = null.String(encoded)
+	return nil
 }
 
 // SetIncomingMsg set the incoming message that this session should be associated with in this sprint
@@ -184,7 +203,12 @@ func (s *Session) Call() *Call {
 
 // FlowSession creates a flow session for the passed in session object. It also populates the runs we know about
 func (s *Session) FlowSession(ctx context.Context, rt *runtime.Runtime, sa flows.SessionAssets, env envs.Environment) (flows.Session, error) {
-	session, err := goflow.Engine(rt).ReadSession(sa, json.RawMessage(s.s.Output), assets.IgnoreMissing)
+	output, err := decodeSessionOutput(string(s.s.Output))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode session output: %w", err)
+	}
+
+	session, err := goflow.Engine(rt).ReadSession(sa, json.RawMessage(output), assets.IgnoreMissing)
 	if err != nil {
 		return nil, fmt.Errorf("unable to unmarshal session: %w", err)
 	}
@@ -261,6 +285,7 @@ const sqlUpdateSessionNoOutput = `
 UPDATE 
 	flows_flowsession
 SET 
+	output = NULL,
 	output_url = :output_url,
 	status = :status, 
 	ended_on = :ended_on,
@@ -371,15 +396,26 @@ func (s *Session) Update(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx,
 	// the SQL statement we'll use to update this session
 	updateSQL := sqlUpdateSession
 
-	// if writing to S3, do so
-	if rt.Config.SessionStorage == "s3" {
-		err := WriteSessionOutputsToStorage(ctx, rt, []*Session{s})
-		if err != nil {
-			slog.Error("error writing session to s3", "error", err)
+	// if writing to external storage, do so, and if that fails then keep the output in the database instead
+	storedOutput := false
+	if GetSessionStorage(rt) != nil {
+		if err := WriteSessionOutputsToStorage(ctx, rt, []*Session{s}); err != nil {
+			slog.Error("error writing session to storage, writing output to database", "session", s.UUID(), "error", err)
+		} else {
+			storedOutput = true
 		}
+	}
 
+	if storedOutput {
 		// don't write output in our SQL
 		updateSQL = sqlUpdateSessionNoOutput
+	} else {
+		if err := s.encodeOutput(rt.Config); err != nil {
+			return fmt.Errorf("error encoding session output: %w", err)
+		}
+
+		// output is now in the database so any previously stored output is stale
+		s.s.OutputURL = ""
 	}
 
 	// write our new session state to the db
@@ -643,8 +679,8 @@ func InsertSessions(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *O
 	insertEndedSQL := sqlInsertEndedSession
 	insertWaitingSQL := sqlInsertWaitingSession
 
-	// if writing our sessions to S3, do so
-	if rt.Config.SessionStorage == "s3" {
+	// if writing our sessions to external storage, do so
+	if GetSessionStorage(rt) != nil {
 		err := WriteSessionOutputsToStorage(ctx, rt, sessions)
 		if err != nil {
 			return nil, fmt.Errorf("error writing sessions to storage: %w", err)
@@ -652,6 +688,12 @@ func InsertSessions(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *O
 
 		insertEndedSQL = sqlInsertEndedSessionNoOutput
 		insertWaitingSQL = sqlInsertWaitingSessionNoOutput
+	} else {
+		for _, s := range sessions {
+			if err := s.encodeOutput(rt.Config); err != nil {
+				return nil, fmt.Errorf("error encoding session output: %w", err)
+			}
+		}
 	}
 
 	// insert our ended sessions first
@@ -693,24 +735,31 @@ func InsertSessions(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *O
 		return nil, fmt.Errorf("error saving flow statistics: %w", err)
 	}
 
-	// apply our all events for the session
+	// gather all the events to handle for each session
 	scenes := make([]*Scene, 0, len(ss))
+	sceneEvents := make([][]flows.Event, len(sessions))
 	for i, s := range sessions {
-		var eventsToHandle []flows.Event
+		scenes = append(scenes, s.Scene())
 
 		// if session didn't fail, we need to handle this sprint's events
 		if s.Status() != SessionStatusFailed {
-			eventsToHandle = append(eventsToHandle, sprints[i].Events()...)
+			sceneEvents[i] = append(sceneEvents[i], sprints[i].Events()...)
 		}
 
-		eventsToHandle = append(eventsToHandle, NewSprintEndedEvent(contacts[i], false))
+		sceneEvents[i] = append(sceneEvents[i], NewSprintEndedEvent(contacts[i], false))
+	}
+
+	// load the previous state of contacts being changed, so that changes can be recorded without a query per contact
+	if err := LoadContactStatesForEvents(ctx, tx, oa, scenes, sceneEvents); err != nil {
+		return nil, fmt.Errorf("error loading contact states: %w", err)
+	}
 
-		err = HandleEvents(ctx, rt, tx, oa, s.Scene(), eventsToHandle)
+	// apply our all events for the session
+	for i, s := range sessions {
+		err = HandleEvents(ctx, rt, tx, oa, s.Scene(), sceneEvents[i])
 		if err != nil {
 			return nil, fmt.Errorf("error applying events for session: %d: %w", s.ID(), err)
 		}
-
-		scenes = append(scenes, s.Scene())
 	}
 
 	// gather all our pre commit events, group them by hook
@@ -778,18 +827,11 @@ func FindWaitingSessionForContact(ctx context.Context, rt *runtime.Runtime, oa *
 
 	// load our output from storage if necessary
 	if session.OutputURL() != "" {
-		// strip just the path out of our output URL
-		u, err := url.Parse(session.OutputURL())
-		if err != nil {
-			return nil, fmt.Errorf("error parsing output URL: %s: %w", session.OutputURL(), err)
-		}
-		key := strings.TrimPrefix(u.Path, "/")
-
 		start := time.Now()
 
-		_, output, err := rt.S3.GetObject(ctx, rt.Config.S3SessionsBucket, key)
+		output, err := ReadSessionOutput(ctx, rt, session.OutputURL())
 		if err != nil {
-			return nil, fmt.Errorf("error reading session from s3 bucket=%s key=%s: %w", rt.Config.S3SessionsBucket, key, err)
+			return nil, err
 		}
 
 		slog.Debug("loaded session from storage", "elapsed", time.Since(start), "output_url", session.OutputURL())
@@ -799,32 +841,46 @@ func FindWaitingSessionForContact(ctx context.Context, rt *runtime.Runtime, oa *
 	return session, nil
 }
 
-// WriteSessionsToStorage writes the outputs of the passed in sessions to our storage (S3), updating the
-// output_url for each on success. Failure of any will cause all to fail.
+// WriteSessionOutputsToStorage writes the outputs of the passed in sessions to our storage (S3 or filesystem),
+// updating the output_url for each on success. Failure of any will cause all to fail.
 func WriteSessionOutputsToStorage(ctx context.Context, rt *runtime.Runtime, sessions []*Session) error {
 	start := time.Now()
 
-	uploads := make([]*s3x.Upload, len(sessions))
+	storage := GetSessionStorage(rt)
+	if storage == nil {
+		return fmt.Errorf("no session storage configured")
+	}
+
+	compression := SessionCompression(rt.Config.SessionCompression)
+
+	objects := make([]*SessionObject, len(sessions))
 	for i, s := range sessions {
-		uploads[i] = &s3x.Upload{
-			Bucket:      rt.Config.S3SessionsBucket,
-			Key:         s.StoragePath(),
-			Body:        []byte(s.Output()),
-			ContentType: "application/json",
-			ACL:         types.ObjectCannedACLPrivate,
+		output, err := s.Output()
+		if err != nil {
+			return err
+		}
+
+		body, err := compressSessionOutput(compression, output)
+		if err != nil {
+			return fmt.Errorf("error compressing session output: %w", err)
+		}
+
+		objects[i] = &SessionObject{
+			Key:         s.StoragePath(output) + sessionCompressionExtensions[compression],
+			Body:        body,
+			ContentType: sessionContentType(compression),
 		}
 	}
 
-	err := rt.S3.BatchPut(ctx, uploads, 32)
-	if err != nil {
+	if err := storage.Put(ctx, objects); err != nil {
 		return fmt.Errorf("error writing sessions to storage: %w", err)
 	}
 
 	for i, s := range sessions {
-		s.s.OutputURL = null.String(uploads[i].URL)
+		s.s.OutputURL = null.String(objects[i].URL)
 	}
 
-	slog.Debug("wrote sessions to s3", "elapsed", time.Since(start), "count", len(sessions))
+	slog.Debug("wrote sessions to storage", "elapsed", time.Since(start), "count", len(sessions))
 	return nil
 }
 
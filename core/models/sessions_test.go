@@ -504,3 +504,71 @@ func assertSessionAndRunStatus(t *testing.T, rt *runtime.Runtime, sessionID mode
 	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowsession WHERE id = $1`, sessionID).Columns(map[string]any{"status": string(status)})
 	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowrun WHERE session_id = $1`, sessionID).Columns(map[string]any{"status": string(status)})
 }
+
+func TestSessionOutputCompressionAndStorage(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetStorage)
+	defer func() {
+		rt.Config.SessionStorage = "db"
+		rt.Config.SessionCompression = "none"
+	}()
+
+	testFlows := testdata.ImportFlows(rt, testdata.Org1, "testdata/session_test_flows.json")
+	flow := testFlows[0]
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshFlows)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		storage     string
+		compression string
+		contact     *testdata.Contact
+		outputLike  string
+		urlLike     string
+	}{
+		{"db", "gzip", testdata.Cathy, "gzip:%", ""},
+		{"db", "zstd", testdata.Bob, "zstd:%", ""},
+		{"fs", "zstd", testdata.George, "", "file://%.json.zst"},
+		{"fs", "none", testdata.Alexandria, "", "file://%.json"},
+	}
+
+	for i, tc := range tcs {
+		rt.Config.SessionStorage = tc.storage
+		rt.Config.SessionCompression = tc.compression
+
+		modelContact, flowContact, _ := tc.contact.Load(rt, oa)
+
+		_, flowSession, sprint := test.NewSessionBuilder().WithAssets(oa.SessionAssets()).WithFlow(flow.UUID).
+			WithContact(tc.contact.UUID, flows.ContactID(tc.contact.ID), "Bob", "eng", "").MustBuild()
+
+		tx := rt.DB.MustBegin()
+		_, err := models.InsertSessions(ctx, rt, tx, oa, []flows.Session{flowSession}, []flows.Sprint{sprint}, []*models.Contact{modelContact}, nil)
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+
+		if tc.outputLike != "" {
+			assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowsession WHERE contact_id = $1 AND output LIKE $2 AND output_url IS NULL`, tc.contact.ID, tc.outputLike).Returns(1, "%d: output mismatch", i)
+		} else {
+			assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowsession WHERE contact_id = $1 AND output IS NULL AND output_url LIKE $2`, tc.contact.ID, tc.urlLike).Returns(1, "%d: output url mismatch", i)
+		}
+
+		// session can be loaded and read regardless of how its output was stored
+		session, err := models.FindWaitingSessionForContact(ctx, rt, oa, models.FlowTypeMessaging, flowContact)
+		require.NoError(t, err, "%d: error loading session", i)
+
+		fs, err := session.FlowSession(ctx, rt, oa.SessionAssets(), oa.Env())
+		require.NoError(t, err, "%d: error reading session", i)
+		assert.Equal(t, flowSession.UUID(), fs.UUID(), "%d: session UUID mismatch", i)
+	}
+
+	// a corrupt output is an error rather than an empty output
+	rt.DB.MustExec(`UPDATE flows_flowsession SET output = 'gzip:xxx' WHERE contact_id = $1`, testdata.Cathy.ID)
+
+	_, cathy, _ := testdata.Cathy.Load(rt, oa)
+	session, err := models.FindWaitingSessionForContact(ctx, rt, oa, models.FlowTypeMessaging, cathy)
+	require.NoError(t, err)
+
+	_, err = session.Output()
+	assert.ErrorContains(t, err, "error decoding output of session")
+}
@@ -2,11 +2,16 @@ package models
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/gocommon/uuids"
@@ -52,10 +57,13 @@ const (
 
 // Exclusions are preset exclusion conditions
 type Exclusions struct {
-	NonActive         bool `json:"non_active"`          // contacts who are blocked, stopped or archived
-	InAFlow           bool `json:"in_a_flow"`           // contacts who are currently in a flow (including this one)
-	StartedPreviously bool `json:"started_previously"`  // contacts who have been in this flow in the last 90 days
-	NotSeenSinceDays  int  `json:"not_seen_since_days"` // contacts who have not been seen for more than this number of days
+	NonActive         bool `json:"non_active"`           // contacts who are blocked, stopped or archived
+	InAFlow           bool `json:"in_a_flow"`            // contacts who are currently in a flow (including this one)
+	StartedPreviously bool `json:"started_previously"`   // contacts who have been in this flow in the last 90 days
+	NotSeenSinceDays  int  `json:"not_seen_since_days"`  // contacts who have not been seen for more than this number of days
+	StartedSinceHours int  `json:"started_since_hours"`  // contacts who have been started in any flow in this number of hours
+	BulkMsgsSinceDays int  `json:"bulk_msgs_since_days"` // contacts who have received more than bulk_msgs_max bulk msgs in this number of days
+	BulkMsgsMax       int  `json:"bulk_msgs_max"`
 }
 
 // NoExclusions is a constant for the empty value
@@ -76,6 +84,55 @@ func (e *Exclusions) Scan(value any) error {
 
 func (e Exclusions) Value() (driver.Value, error) { return json.Marshal(e) }
 
+// HasFrequencyCaps returns whether these exclusions include caps on how often contacts are started or messaged, which
+// can't be expressed as a contact query and so must be checked against the database
+func (e Exclusions) HasFrequencyCaps() bool {
+	return e.StartedSinceHours > 0 || e.BulkMsgsSinceDays > 0
+}
+
+const sqlSelectContactsWithinFrequencyCaps = `
+    SELECT c.id
+      FROM unnest($1::int[]) WITH ORDINALITY AS c(id, ord)
+     WHERE ($2::timestamptz IS NULL OR NOT EXISTS (
+               SELECT 1 FROM flows_flowsession s WHERE s.contact_id = c.id AND s.created_on > $2
+           ))
+       AND ($3::timestamptz IS NULL OR (
+               SELECT count(*) FROM (
+                   SELECT 1 FROM msgs_msg m WHERE m.contact_id = c.id AND m.created_on > $3 AND m.direction = 'O' AND m.high_priority IS NOT TRUE LIMIT $4 + 1
+               ) bm
+           ) <= $4)
+  ORDER BY c.ord`
+
+// FilterByFrequencyCaps returns the given contacts minus any excluded by the frequency caps of the given exclusions,
+// i.e. those who have been started in a flow or sent too many bulk messages recently
+func FilterByFrequencyCaps(ctx context.Context, db DBorTx, excs Exclusions, contactIDs []ContactID) ([]ContactID, error) {
+	if !excs.HasFrequencyCaps() || len(contactIDs) == 0 {
+		return contactIDs, nil
+	}
+
+	var startedSince, msgsSince *time.Time
+	if excs.StartedSinceHours > 0 {
+		t := dates.Now().Add(-time.Hour * time.Duration(excs.StartedSinceHours))
+		startedSince = &t
+	}
+	if excs.BulkMsgsSinceDays > 0 {
+		t := dates.Now().Add(-time.Hour * time.Duration(24*excs.BulkMsgsSinceDays))
+		msgsSince = &t
+	}
+
+	filtered := make([]ContactID, 0, len(contactIDs))
+
+	for batch := range slices.Chunk(contactIDs, 10_000) {
+		var ids []ContactID
+		if err := db.SelectContext(ctx, &ids, sqlSelectContactsWithinFrequencyCaps, pq.Array(batch), startedSince, msgsSince, excs.BulkMsgsMax); err != nil {
+			return nil, fmt.Errorf("error filtering contacts by frequency caps: %w", err)
+		}
+		filtered = append(filtered, ids...)
+	}
+
+	return filtered, nil
+}
+
 // FlowStart represents the top level flow start in our system
 type FlowStart struct {
 	ID          StartID     `json:"start_id"      db:"id"` // null for non-persisted tasks used by flow actions
@@ -94,6 +151,8 @@ type FlowStart struct {
 	CreateContact   bool        `json:"create_contact"`
 	Exclusions      Exclusions  `json:"exclusions"             db:"exclusions"`
 
+	ContactsPerMinute int `json:"contacts_per_minute,omitempty" db:"contacts_per_minute"` // rate limit for starting, zero if none
+
 	Params         null.JSON `json:"params,omitempty"          db:"params"`
 	ParentSummary  null.JSON `json:"parent_summary,omitempty"  db:"parent_summary"`
 	SessionHistory null.JSON `json:"session_history,omitempty" db:"session_history"`
@@ -139,6 +198,11 @@ func (s *FlowStart) WithExcludeInAFlow(exclude bool) *FlowStart {
 	return s
 }
 
+func (s *FlowStart) WithContactsPerMinute(rate int) *FlowStart {
+	s.ContactsPerMinute = rate
+	return s
+}
+
 func (s *FlowStart) WithCreateContact(create bool) *FlowStart {
 	s.CreateContact = create
 	return s
@@ -201,6 +265,54 @@ func (s *FlowStart) setStatus(ctx context.Context, db DBorTx, status StartStatus
 	return nil
 }
 
+// AddProgress increments the number of contacts of this start which have been processed
+func (s *FlowStart) AddProgress(ctx context.Context, db DBorTx, count int) error {
+	if s.ID != NilStartID {
+		_, err := db.ExecContext(ctx, "UPDATE flows_flowstart SET progress = progress + $2, modified_on = NOW() WHERE id = $1", s.ID, count)
+		if err != nil {
+			return fmt.Errorf("error updating progress of start #%d: %w", s.ID, err)
+		}
+	}
+	return nil
+}
+
+// InterruptFlowStart sets the status of the given start to INTERRUPTED so that any remaining batches aren't started.
+// Returns false if there's no such start or it has already completed, failed or been interrupted.
+func InterruptFlowStart(ctx context.Context, db DBorTx, orgID OrgID, startID StartID) (bool, error) {
+	res, err := db.ExecContext(ctx, "UPDATE flows_flowstart SET status = 'I', modified_on = NOW() WHERE id = $1 AND org_id = $2 AND status IN ('P', 'Q', 'S')", startID, orgID)
+	if err != nil {
+		return false, fmt.Errorf("error interrupting start #%d: %w", startID, err)
+	}
+
+	rows, _ := res.RowsAffected()
+	return rows > 0, nil
+}
+
+// FlowStartProgress is the progress of a start through its contacts
+type FlowStartProgress struct {
+	Status  StartStatus `json:"status"  db:"status"`
+	Total   int         `json:"total"   db:"contact_count"`
+	Started int         `json:"started" db:"progress"`
+}
+
+// progress is a column which RapidPro doesn't have yet so is read via to_jsonb
+const sqlSelectFlowStartProgress = `
+SELECT status, COALESCE(contact_count, 0) AS contact_count, COALESCE((to_jsonb(s) ->> 'progress')::int, 0) AS progress
+  FROM flows_flowstart s
+ WHERE id = $1 AND org_id = $2`
+
+// GetFlowStartProgress gets the progress of the given start, returning nil if there's no such start
+func GetFlowStartProgress(ctx context.Context, db DBorTx, orgID OrgID, startID StartID) (*FlowStartProgress, error) {
+	p := &FlowStartProgress{}
+	if err := db.GetContext(ctx, p, sqlSelectFlowStartProgress, startID, orgID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error loading progress of start #%d: %w", startID, err)
+	}
+	return p, nil
+}
+
 const sqlGetFlowStartByID = `
 SELECT id, uuid, org_id, status, start_type, created_by_id, flow_id, params, parent_summary, session_history 
   FROM flows_flowstart 
@@ -233,6 +345,15 @@ func InsertFlowStarts(ctx context.Context, db DBorTx, starts []*FlowStart) error
 		return fmt.Errorf("error inserting flow starts: %w", err)
 	}
 
+	// contacts_per_minute is a column which RapidPro doesn't have yet so we only write it for rate limited starts
+	for _, start := range starts {
+		if start.ContactsPerMinute > 0 {
+			if _, err := db.ExecContext(ctx, `UPDATE flows_flowstart SET contacts_per_minute = $2 WHERE id = $1`, start.ID, start.ContactsPerMinute); err != nil {
+				return fmt.Errorf("error setting rate limit of flow start #%d: %w", start.ID, err)
+			}
+		}
+	}
+
 	// build up all our contact associations
 	contacts := make([]*startContact, 0, len(starts))
 	for _, start := range starts {
@@ -129,7 +129,10 @@ func TestStartsBuilding(t *testing.T) {
 			"in_a_flow": false,
         	"non_active": false,
         	"not_seen_since_days": 0,
-        	"started_previously": false
+        	"started_previously": false,
+        	"started_since_hours": 0,
+        	"bulk_msgs_since_days": 0,
+        	"bulk_msgs_max": 0
 		},
 		"flow_id": %d,
 		"group_ids": [%d],
@@ -142,3 +145,45 @@ func TestStartsBuilding(t *testing.T) {
 		"start_type": "M"
 	}`, testdata.Cathy.ID, testdata.Bob.ID, testdata.TestersGroup.ID, testdata.Favorites.ID, testdata.DoctorsGroup.ID)), marshalled)
 }
+
+func TestFilterByFrequencyCaps(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	// Bob was started in a flow 2 hours ago, George 2 days ago
+	bobSessionID := testdata.InsertFlowSession(rt, testdata.Org1, testdata.Bob, models.FlowTypeMessaging, models.SessionStatusCompleted, testdata.Favorites, models.NilCallID)
+	georgeSessionID := testdata.InsertFlowSession(rt, testdata.Org1, testdata.George, models.FlowTypeMessaging, models.SessionStatusCompleted, testdata.Favorites, models.NilCallID)
+	rt.DB.MustExec(`UPDATE flows_flowsession SET created_on = NOW() - INTERVAL '2 hours' WHERE id = $1`, bobSessionID)
+	rt.DB.MustExec(`UPDATE flows_flowsession SET created_on = NOW() - INTERVAL '2 days' WHERE id = $1`, georgeSessionID)
+
+	// Cathy received 3 bulk messages, 1 of which was 10 days ago, and Alexandria 3 high priority messages
+	for _, text := range []string{"one", "two", "three"} {
+		testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, text, nil, models.MsgStatusSent, false)
+		testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Alexandria, text, nil, models.MsgStatusSent, true)
+	}
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = NOW() - INTERVAL '10 days' WHERE contact_id = $1 AND text = 'one'`, testdata.Cathy.ID)
+
+	contactIDs := []models.ContactID{testdata.Alexandria.ID, testdata.Cathy.ID, testdata.George.ID, testdata.Bob.ID}
+
+	tcs := []struct {
+		exclusions models.Exclusions
+		expected   []models.ContactID
+	}{
+		{models.NoExclusions, []models.ContactID{testdata.Alexandria.ID, testdata.Cathy.ID, testdata.George.ID, testdata.Bob.ID}},
+		{models.Exclusions{InAFlow: true}, []models.ContactID{testdata.Alexandria.ID, testdata.Cathy.ID, testdata.George.ID, testdata.Bob.ID}},
+		{models.Exclusions{StartedSinceHours: 1}, []models.ContactID{testdata.Alexandria.ID, testdata.Cathy.ID, testdata.George.ID, testdata.Bob.ID}},
+		{models.Exclusions{StartedSinceHours: 24}, []models.ContactID{testdata.Alexandria.ID, testdata.Cathy.ID, testdata.George.ID}},
+		{models.Exclusions{StartedSinceHours: 72}, []models.ContactID{testdata.Alexandria.ID, testdata.Cathy.ID}},
+		{models.Exclusions{BulkMsgsSinceDays: 7, BulkMsgsMax: 2}, []models.ContactID{testdata.Alexandria.ID, testdata.Cathy.ID, testdata.George.ID, testdata.Bob.ID}},
+		{models.Exclusions{BulkMsgsSinceDays: 7, BulkMsgsMax: 1}, []models.ContactID{testdata.Alexandria.ID, testdata.George.ID, testdata.Bob.ID}},
+		{models.Exclusions{BulkMsgsSinceDays: 30, BulkMsgsMax: 2}, []models.ContactID{testdata.Alexandria.ID, testdata.George.ID, testdata.Bob.ID}},
+		{models.Exclusions{BulkMsgsSinceDays: 7, BulkMsgsMax: 1, StartedSinceHours: 24}, []models.ContactID{testdata.Alexandria.ID, testdata.George.ID}},
+	}
+
+	for i, tc := range tcs {
+		actual, err := models.FilterByFrequencyCaps(ctx, rt.DB, tc.exclusions, contactIDs)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, actual, "%d: filtered contacts mismatch", i)
+	}
+}
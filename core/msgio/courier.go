@@ -298,6 +298,110 @@ func ClearCourierQueues(rc redis.Conn, ch *models.Channel) error {
 	return err
 }
 
+// how many batches we ask redis for at a time when scanning courier queues for messages to remove
+const queueRemoveScanCount = 100
+
+var queueReplaceScript = redis.NewScript(1, `
+-- KEYS: [PriorityQueueKey]
+-- ARGV: [OldItem, Score, NewItem]
+
+-- if courier has already popped the batch then there's nothing to replace
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+  return 0
+end
+
+-- otherwise re-add what's left of the batch with its original score so it keeps its place in the queue
+if ARGV[3] ~= "" then
+  redis.call("ZADD", KEYS[1], ARGV[2], ARGV[3])
+end
+return 1
+`)
+
+// RemoveCourierMessages removes the given messages from the courier queues (priority and bulk) for the given channel.
+// Queues are scanned in chunks so that large queues don't block redis. Batches which contain other messages are
+// re-queued without the removed messages. Returns the number of messages removed.
+func RemoveCourierMessages(rc redis.Conn, ch *models.Channel, msgIDs []models.MsgID) (int, error) {
+	if len(msgIDs) == 0 {
+		return 0, nil
+	}
+
+	remove := make(map[models.MsgID]bool, len(msgIDs))
+	for _, id := range msgIDs {
+		remove[id] = true
+	}
+
+	queueKey := fmt.Sprintf("msgs:%s|%d", ch.UUID(), ch.TPS())
+	removed := 0
+
+	for _, priority := range []int{highPriority, bulkPriority} {
+		priorityQueueKey := fmt.Sprintf("%s/%d", queueKey, priority)
+		cursor := 0
+
+		for {
+			values, err := redis.Values(rc.Do("ZSCAN", priorityQueueKey, cursor, "COUNT", queueRemoveScanCount))
+			if err != nil {
+				return removed, fmt.Errorf("error scanning courier queue: %w", err)
+			}
+			cursor, _ = redis.Int(values[0], nil)
+			items, _ := redis.Strings(values[1], nil)
+
+			// items are returned as member, score pairs
+			for i := 0; i+1 < len(items); i += 2 {
+				item, score := items[i], items[i+1]
+
+				remaining, numRemoved, err := removeFromCourierBatch(item, remove)
+				if err != nil {
+					return removed, err
+				}
+				if numRemoved == 0 {
+					continue
+				}
+
+				replaced, err := redis.Int(queueReplaceScript.Do(rc, priorityQueueKey, item, score, remaining))
+				if err != nil {
+					return removed, fmt.Errorf("error removing messages from courier queue: %w", err)
+				}
+				if replaced == 1 {
+					removed += numRemoved
+				}
+			}
+
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// removes the given messages from a queued batch, returning the JSON of the remaining messages (empty if there are
+// none) and how many messages were removed
+func removeFromCourierBatch(item string, remove map[models.MsgID]bool) (string, int, error) {
+	var batch []json.RawMessage
+	if err := json.Unmarshal([]byte(item), &batch); err != nil {
+		return "", 0, fmt.Errorf("error unmarshaling queued courier batch: %w", err)
+	}
+
+	remaining := make([]json.RawMessage, 0, len(batch))
+	for _, m := range batch {
+		msg := &struct {
+			ID models.MsgID `json:"id"`
+		}{}
+		if err := json.Unmarshal(m, msg); err != nil {
+			return "", 0, fmt.Errorf("error unmarshaling queued courier message: %w", err)
+		}
+		if !remove[msg.ID] {
+			remaining = append(remaining, m)
+		}
+	}
+
+	if len(remaining) == 0 {
+		return "", len(batch), nil
+	}
+	return string(jsonx.MustMarshal(remaining)), len(batch) - len(remaining), nil
+}
+
 // see https://github.com/nyaruka/courier/blob/main/attachments.go#L23
 type fetchAttachmentRequest struct {
 	ChannelType models.ChannelType `json:"channel_type"`
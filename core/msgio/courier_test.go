@@ -69,7 +69,7 @@ func TestNewCourierMsg(t *testing.T) {
 	session, err := models.FindWaitingSessionForContact(ctx, rt, oa, models.FlowTypeMessaging, cathy)
 	require.NoError(t, err)
 
-	msg1, err := models.NewOutgoingFlowMsg(rt, oa.Org(), facebook, session, flow, flowMsg1, time.Date(2021, 11, 9, 14, 3, 30, 0, time.UTC))
+	msg1, err := models.NewOutgoingFlowMsg(rt, oa.Org(), facebook, session, flow, "", flowMsg1, time.Date(2021, 11, 9, 14, 3, 30, 0, time.UTC))
 	require.NoError(t, err)
 
 	// insert to db so that it gets an id and time field values
@@ -124,7 +124,7 @@ func TestNewCourierMsg(t *testing.T) {
 	)
 	in1 := testdata.InsertIncomingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "test", models.MsgStatusHandled)
 	session.SetIncomingMsg(in1.ID, null.String("EX123"))
-	msg2, err := models.NewOutgoingFlowMsg(rt, oa.Org(), twilio, session, flow, flowMsg2, time.Date(2021, 11, 9, 14, 3, 30, 0, time.UTC))
+	msg2, err := models.NewOutgoingFlowMsg(rt, oa.Org(), twilio, session, flow, "", flowMsg2, time.Date(2021, 11, 9, 14, 3, 30, 0, time.UTC))
 	require.NoError(t, err)
 
 	err = models.InsertMessages(ctx, rt.DB, []*models.Msg{msg2})
@@ -313,6 +313,63 @@ func TestClearChannelCourierQueue(t *testing.T) {
 
 }
 
+func TestRemoveCourierMessages(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg|models.RefreshChannels)
+	require.NoError(t, err)
+
+	_, _, cathyURNs := testdata.Cathy.Load(rt, oa)
+	_, _, bobURNs := testdata.Bob.Load(rt, oa)
+	twilio := oa.ChannelByUUID(testdata.TwilioChannel.UUID)
+
+	cathyMsg1 := (&msgSpec{Channel: testdata.TwilioChannel, Contact: testdata.Cathy}).createMsg(t, rt, oa)
+	cathyMsg2 := (&msgSpec{Channel: testdata.TwilioChannel, Contact: testdata.Cathy}).createMsg(t, rt, oa)
+	cathyMsg3 := (&msgSpec{Channel: testdata.TwilioChannel, Contact: testdata.Cathy, HighPriority: true}).createMsg(t, rt, oa)
+	bobMsg := (&msgSpec{Channel: testdata.TwilioChannel, Contact: testdata.Bob, HighPriority: true}).createMsg(t, rt, oa)
+
+	msgio.QueueCourierMessages(rc, oa, testdata.Cathy.ID, twilio, []msgio.Send{{Msg: cathyMsg1, URN: cathyURNs[0]}, {Msg: cathyMsg2, URN: cathyURNs[0]}, {Msg: cathyMsg3, URN: cathyURNs[0]}})
+	msgio.QueueCourierMessages(rc, oa, testdata.Bob.ID, twilio, []msgio.Send{{Msg: bobMsg, URN: bobURNs[0]}})
+
+	testsuite.AssertCourierQueues(t, map[string][]int{
+		"msgs:74729f45-7f29-4868-9dc4-90e491e3c7d8|10/0": {2},
+		"msgs:74729f45-7f29-4868-9dc4-90e491e3c7d8|10/1": {1, 1},
+	})
+
+	// nothing to remove
+	removed, err := msgio.RemoveCourierMessages(rc, twilio, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	// batch with only some of its messages being removed is re-queued with the rest of its messages
+	removed, err = msgio.RemoveCourierMessages(rc, twilio, []models.MsgID{cathyMsg1.ID(), cathyMsg3.ID(), bobMsg.ID()})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	testsuite.AssertCourierQueues(t, map[string][]int{
+		"msgs:74729f45-7f29-4868-9dc4-90e491e3c7d8|10/0": {1},
+	})
+
+	queued, err := redis.Strings(rc.Do("ZRANGE", "msgs:74729f45-7f29-4868-9dc4-90e491e3c7d8|10/0", 0, -1))
+	require.NoError(t, err)
+	assert.Contains(t, queued[0], fmt.Sprintf(`"id":%d,`, cathyMsg2.ID()))
+
+	// removing messages that have already been removed does nothing
+	removed, err = msgio.RemoveCourierMessages(rc, twilio, []models.MsgID{cathyMsg1.ID()})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, err = msgio.RemoveCourierMessages(rc, twilio, []models.MsgID{cathyMsg1.ID(), cathyMsg2.ID()})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	testsuite.AssertCourierQueues(t, map[string][]int{})
+}
+
 func TestPushCourierBatch(t *testing.T) {
 	ctx, rt := testsuite.Runtime()
 	rc := rt.RP.Get()
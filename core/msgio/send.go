@@ -32,8 +32,8 @@ func QueueMessages(ctx context.Context, rt *runtime.Runtime, db models.DBorTx, m
 			}
 		}
 
-		// any messages that failed to queue should be moved back to initializing(I) (they are queued(Q) at creation to
-		// save an update in the common case)
+		// any messages that failed to queue should be moved back to initializing(I) so that they're retried (messages
+		// that were prepared will have been moved to queued(Q) by that)
 		err := models.MarkMessagesForRequeuing(ctx, db, retry)
 		if err != nil {
 			slog.Error("error marking messages as initializing", "error", err)
@@ -75,14 +75,26 @@ func tryToQueue(ctx context.Context, rt *runtime.Runtime, db models.DBorTx, msgs
 		if err != nil {
 			slog.Error("error getting org assets", "error", err)
 		} else {
-			queued = append(queued, tryToQueueForOrg(ctx, rt, oa, orgSends)...)
+			queued = append(queued, tryToQueueForOrg(ctx, rt, db, oa, orgSends)...)
 		}
 	}
 
 	return queued
 }
 
-func tryToQueueForOrg(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, sends []Send) []*models.Msg {
+func tryToQueueForOrg(ctx context.Context, rt *runtime.Runtime, db models.DBorTx, oa *models.OrgAssets, sends []Send) []*models.Msg {
+	msgs := make([]*models.Msg, len(sends))
+	for i, s := range sends {
+		msgs[i] = s.Msg
+	}
+
+	// initializing messages need to be prepared before they can be queued, and that may fail some of them.. if preparing
+	// them fails then none are queued and they'll be retried later
+	if err := models.PrepareMessages(ctx, rt, oa, db, msgs); err != nil {
+		slog.Error("error preparing messages", "error", err)
+		return nil
+	}
+
 	// sends by courier, organized by contact+channel
 	courierSends := make(map[contactAndChannel][]Send, 100)
 
@@ -0,0 +1,54 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+const (
+	BackendElastic  = "elastic"
+	BackendPostgres = "postgres"
+)
+
+// Backend is something which can search the contacts in an org using parsed contact queries
+type Backend interface {
+	// Count returns the number of contacts matching the given query and group (if provided)
+	Count(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, query *contactql.ContactQuery) (int64, error)
+
+	// Estimate returns the number of contacts matching the given query which is counted exactly up to the given
+	// threshold, and above that is an approximation no less than the threshold, or just a lower bound if the backend
+	// can't estimate it
+	Estimate(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, query *contactql.ContactQuery, threshold int) (*ContactTotalEstimate, error)
+
+	// Page returns a page of matching contact ids using the given sort, and the total number of matches
+	Page(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, excludeIDs []models.ContactID, query *contactql.ContactQuery, sort string, offset, pageSize int) ([]models.ContactID, int64, error)
+
+	// IDs returns up to limit matching contact ids, sorted by id. Limit of -1 means return all.
+	IDs(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, status models.ContactStatus, query *contactql.ContactQuery, limit int) ([]models.ContactID, error)
+
+	// NewestModifiedOn returns the newest modified_on of the contacts in the org which are visible to searches
+	NewestModifiedOn(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) (*time.Time, error)
+
+	// DeindexByID removes the given contacts from the backend's index, returning the number removed
+	DeindexByID(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, contactIDs []models.ContactID) (int, error)
+
+	// DeindexByOrg removes up to limit contacts in the given org from the backend's index, returning the number removed
+	DeindexByOrg(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, limit int) (int, error)
+}
+
+var backends = map[string]Backend{
+	BackendElastic:  &elasticBackend{},
+	BackendPostgres: &postgresBackend{},
+}
+
+// GetBackend returns the search backend selected in the config, defaulting to elastic
+func GetBackend(rt *runtime.Runtime) Backend {
+	if b, ok := backends[rt.Config.SearchBackend]; ok {
+		return b
+	}
+	return backends[BackendElastic]
+}
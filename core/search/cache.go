@@ -0,0 +1,81 @@
+package search
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// InvalidateSearchCache invalidates all cached search results for the given org. This is needed for changes which
+// don't make the newest modified_on visible to the backend any newer, e.g. contacts being released or de-indexed.
+func InvalidateSearchCache(rt *runtime.Runtime, orgID models.OrgID) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if _, err := rc.Do("INCR", fmt.Sprintf("search_cache_version:%d", orgID)); err != nil {
+		return fmt.Errorf("error invalidating search cache: %w", err)
+	}
+	return nil
+}
+
+// cachedSearch returns the result of the given search from the cache if it's there, and otherwise performs the search
+// and caches its result. Keys include the newest modified_on visible to the backend so that any change to contacts in
+// the org invalidates previous results, and the org's cache version so that other changes can invalidate them too.
+// Results expire after the configured TTL regardless.
+func cachedSearch[T any](ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, key []any, fn func() (T, error)) (T, error) {
+	if rt.Config.SearchCacheTTL <= 0 {
+		return fn()
+	}
+
+	var result T
+
+	newest, err := GetBackend(rt).NewestModifiedOn(ctx, rt, oa)
+	if err != nil {
+		return result, fmt.Errorf("error getting search freshness: %w", err)
+	}
+	var freshness int64
+	if newest != nil {
+		freshness = newest.UnixNano()
+	}
+
+	rc := rt.RP.Get()
+	version, err := redis.Int(rc.Do("GET", fmt.Sprintf("search_cache_version:%d", oa.OrgID())))
+	if err != nil && err != redis.ErrNil {
+		rc.Close()
+		return result, fmt.Errorf("error getting search cache version: %w", err)
+	}
+
+	hash := sha1.Sum(jsonx.MustMarshal(append([]any{rt.Config.SearchBackend, freshness, version}, key...)))
+	cacheKey := fmt.Sprintf("search_cache:%d:%x", oa.OrgID(), hash)
+
+	data, err := redis.Bytes(rc.Do("GET", cacheKey))
+	rc.Close()
+
+	if err == nil {
+		if err := jsonx.Unmarshal(data, &result); err != nil {
+			return result, fmt.Errorf("error unmarshaling cached search: %w", err)
+		}
+		return result, nil
+	} else if err != redis.ErrNil {
+		return result, fmt.Errorf("error getting cached search: %w", err)
+	}
+
+	result, err = fn()
+	if err != nil {
+		return result, err
+	}
+
+	rc = rt.RP.Get()
+	defer rc.Close()
+
+	if _, err := rc.Do("SET", cacheKey, jsonx.MustMarshal(result), "EX", rt.Config.SearchCacheTTL); err != nil {
+		return result, fmt.Errorf("error caching search: %w", err)
+	}
+
+	return result, nil
+}
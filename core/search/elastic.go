@@ -0,0 +1,290 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/operationtype"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/totalhitsrelation"
+	"github.com/nyaruka/gocommon/elastic"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/contactql/es"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// AssetMapper maps resolved assets in queries to how we identify them in ES which in the case
+// of flows and groups is their ids. We can do this by just type cracking them to their models.
+type AssetMapper struct{}
+
+func (m *AssetMapper) Flow(f assets.Flow) int64 {
+	return int64(f.(*models.Flow).ID())
+}
+
+func (m *AssetMapper) Group(g assets.Group) int64 {
+	return int64(g.(*models.Group).ID())
+}
+
+var assetMapper = &AssetMapper{}
+
+// BuildElasticQuery turns the passed in contact ql query into an elastic query
+func BuildElasticQuery(oa *models.OrgAssets, group *models.Group, status models.ContactStatus, excludeIDs []models.ContactID, query *contactql.ContactQuery) elastic.Query {
+	// filter by org and active contacts
+	must := []elastic.Query{
+		elastic.Term("org_id", oa.OrgID()),
+		elastic.Term("is_active", true),
+	}
+
+	// and group if present
+	if group != nil {
+		must = append(must, elastic.Term("group_ids", group.ID()))
+	}
+
+	// and status if present
+	if status != models.NilContactStatus {
+		must = append(must, elastic.Term("status", status))
+	}
+
+	// and by user query if present
+	if query != nil {
+		must = append(must, es.ToElasticQuery(oa.Env(), assetMapper, query))
+	}
+
+	not := []elastic.Query{}
+
+	// exclude ids if present
+	if len(excludeIDs) > 0 {
+		ids := make([]string, len(excludeIDs))
+		for i := range excludeIDs {
+			ids[i] = fmt.Sprintf("%d", excludeIDs[i])
+		}
+		not = append(not, elastic.Ids(ids...))
+	}
+
+	return elastic.Bool(must, not)
+}
+
+// searches contacts in the elastic index maintained by rp-indexer
+type elasticBackend struct{}
+
+func (b *elasticBackend) Count(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, query *contactql.ContactQuery) (int64, error) {
+	if rt.ES == nil {
+		return 0, fmt.Errorf("no elastic client available, check your configuration")
+	}
+
+	eq := BuildElasticQuery(oa, group, models.NilContactStatus, nil, query)
+	src := map[string]any{"query": eq}
+
+	count, err := rt.ES.Count().Index(rt.Config.ElasticContactsIndex).Routing(oa.OrgID().String()).Raw(bytes.NewReader(jsonx.MustMarshal(src))).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error performing count: %w", err)
+	}
+
+	return count.Count, nil
+}
+
+func (b *elasticBackend) Estimate(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, query *contactql.ContactQuery, threshold int) (*ContactTotalEstimate, error) {
+	if rt.ES == nil {
+		return nil, fmt.Errorf("no elastic client available, check your configuration")
+	}
+
+	// elastic stops counting hits at the threshold which is much cheaper than an exact count for large results, but
+	// that means all we know about larger results is that they're at least the threshold
+	src := map[string]any{
+		"_source":          false,
+		"query":            BuildElasticQuery(oa, group, models.NilContactStatus, nil, query),
+		"size":             0,
+		"track_total_hits": threshold,
+	}
+
+	results, err := rt.ES.Search().Index(rt.Config.ElasticContactsIndex).Routing(oa.OrgID().String()).Raw(bytes.NewReader(jsonx.MustMarshal(src))).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error performing count: %w", err)
+	}
+
+	atLeast := results.Hits.Total.Relation == totalhitsrelation.Gte
+
+	return &ContactTotalEstimate{Total: results.Hits.Total.Value, Approximate: atLeast, LowerBound: atLeast}, nil
+}
+
+func (b *elasticBackend) Page(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, excludeIDs []models.ContactID, query *contactql.ContactQuery, sort string, offset, pageSize int) ([]models.ContactID, int64, error) {
+	if rt.ES == nil {
+		return nil, 0, fmt.Errorf("no elastic client available, check your configuration")
+	}
+
+	eq := BuildElasticQuery(oa, group, models.NilContactStatus, excludeIDs, query)
+
+	fieldSort, err := es.ToElasticSort(sort, oa.SessionAssets())
+	if err != nil {
+		return nil, 0, fmt.Errorf("error parsing sort: %w", err)
+	}
+
+	src := map[string]any{
+		"_source":          false,
+		"query":            eq,
+		"sort":             []any{fieldSort},
+		"from":             offset,
+		"size":             pageSize,
+		"track_total_hits": true,
+	}
+
+	results, err := rt.ES.Search().Index(rt.Config.ElasticContactsIndex).Routing(oa.OrgID().String()).Raw(bytes.NewReader(jsonx.MustMarshal(src))).Do(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error performing query: %w", err)
+	}
+
+	ids := make([]models.ContactID, 0, pageSize)
+	ids = appendIDsFromHits(ids, results.Hits.Hits)
+
+	return ids, results.Hits.Total.Value, nil
+}
+
+func (b *elasticBackend) IDs(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, status models.ContactStatus, query *contactql.ContactQuery, limit int) ([]models.ContactID, error) {
+	index := rt.Config.ElasticContactsIndex
+
+	if rt.ES == nil {
+		return nil, fmt.Errorf("no elastic client available, check your configuration")
+	}
+
+	eq := BuildElasticQuery(oa, group, status, nil, query)
+	sort := elastic.SortBy("id", true)
+	ids := make([]models.ContactID, 0, 100)
+
+	// if limit provided that can be done with single search, do that
+	if limit >= 0 && limit <= 10_000 {
+		src := map[string]any{
+			"_source":          false,
+			"query":            eq,
+			"sort":             []any{sort},
+			"from":             0,
+			"size":             limit,
+			"track_total_hits": false,
+		}
+
+		results, err := rt.ES.Search().Index(index).Routing(oa.OrgID().String()).Raw(bytes.NewReader(jsonx.MustMarshal(src))).Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error searching ES index: %w", err)
+		}
+		return appendIDsFromHits(ids, results.Hits.Hits), nil
+	}
+
+	// for larger limits we need to take a point in time and iterate through multiple search requests using search_after
+	pit, err := rt.ES.OpenPointInTime(index).Routing(oa.OrgID().String()).KeepAlive("1m").Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ES point-in-time: %w", err)
+	}
+
+	src := map[string]any{
+		"_source":          false,
+		"query":            eq,
+		"sort":             []any{sort},
+		"pit":              map[string]any{"id": pit.Id, "keep_alive": "1m"},
+		"size":             10_000,
+		"track_total_hits": false,
+	}
+
+	for {
+		results, err := rt.ES.Search().Raw(bytes.NewReader(jsonx.MustMarshal(src))).Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error searching ES index: %w", err)
+		}
+
+		if len(results.Hits.Hits) == 0 {
+			break
+		}
+
+		ids = appendIDsFromHits(ids, results.Hits.Hits)
+
+		lastHit := results.Hits.Hits[len(results.Hits.Hits)-1]
+		src["search_after"] = lastHit.Sort
+	}
+
+	if _, err := rt.ES.ClosePointInTime().Id(pit.Id).Do(ctx); err != nil {
+		return nil, fmt.Errorf("error closing ES point-in-time: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (b *elasticBackend) NewestModifiedOn(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) (*time.Time, error) {
+	if rt.ES == nil {
+		return nil, fmt.Errorf("no elastic client available, check your configuration")
+	}
+
+	src := map[string]any{
+		"_source":          []string{"modified_on"},
+		"query":            elastic.Term("org_id", oa.OrgID()),
+		"sort":             []any{elastic.SortBy("modified_on_mu", false)},
+		"size":             1,
+		"track_total_hits": false,
+	}
+
+	results, err := rt.ES.Search().Index(rt.Config.ElasticContactsIndex).Routing(oa.OrgID().String()).Raw(bytes.NewReader(jsonx.MustMarshal(src))).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error searching ES index: %w", err)
+	}
+	if len(results.Hits.Hits) == 0 {
+		return nil, nil
+	}
+
+	doc := &struct {
+		ModifiedOn time.Time `json:"modified_on"`
+	}{}
+	if err := jsonx.Unmarshal(results.Hits.Hits[0].Source_, doc); err != nil {
+		return nil, fmt.Errorf("error unmarshaling indexed contact: %w", err)
+	}
+	return &doc.ModifiedOn, nil
+}
+
+func (b *elasticBackend) DeindexByID(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, contactIDs []models.ContactID) (int, error) {
+	cmds := &bytes.Buffer{}
+	for _, id := range contactIDs {
+		cmds.Write(jsonx.MustMarshal(map[string]any{"delete": map[string]any{"_id": id.String()}}))
+		cmds.WriteString("\n")
+	}
+
+	resp, err := rt.ES.Bulk().Index(rt.Config.ElasticContactsIndex).Routing(orgID.String()).Raw(bytes.NewReader(cmds.Bytes())).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error deindexing deleted contacts from elastic: %w", err)
+	}
+
+	deleted := 0
+	for _, r := range resp.Items {
+		if r[operationtype.Delete].Status == 200 {
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (b *elasticBackend) DeindexByOrg(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, limit int) (int, error) {
+	src := map[string]any{
+		"query":    elastic.Term("org_id", orgID),
+		"max_docs": limit,
+	}
+
+	resp, err := rt.ES.DeleteByQuery(rt.Config.ElasticContactsIndex).Routing(orgID.String()).Raw(bytes.NewReader(jsonx.MustMarshal(src))).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error deindexing contacts in org #%d from elastic: %w", orgID, err)
+	}
+
+	return int(*resp.Deleted), nil
+}
+
+// utility to convert search hits to contact IDs and append them to the given slice
+func appendIDsFromHits(ids []models.ContactID, hits []types.Hit) []models.ContactID {
+	for _, hit := range hits {
+		id, err := strconv.Atoi(*hit.Id_)
+		if err == nil {
+			ids = append(ids, models.ContactID(id))
+		}
+	}
+	return ids
+}
@@ -4,38 +4,54 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
 )
 
+const (
+	// how many group additions or removals are made between saves of population progress
+	populateProgressBatchSize = 10_000
+
+	// how many contacts are loaded at a time when evaluating them in process
+	evaluateBatchSize = 500
+
+	// how far back before the last indexed or evaluated time we re-evaluate contacts, to allow for contacts being
+	// committed with a modified_on slightly older than the newest one already visible
+	evaluateOverlap = time.Second * 5
+)
+
 // PopulateSmartGroup calculates which members should be part of a group and populates the contacts
 // for that group by performing the minimum number of inserts / deletes.
+//
+// Membership is calculated by querying elastic but any contacts modified since the last contact that was indexed are
+// then evaluated in process, so that changes that the indexer hasn't seen yet aren't missed.
 func PopulateSmartGroup(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, groupID models.GroupID, query string) (int, error) {
 	err := models.UpdateGroupStatus(ctx, rt.DB, groupID, models.GroupStatusEvaluating)
 	if err != nil {
 		return 0, fmt.Errorf("error marking dynamic group as evaluating: %w", err)
 	}
 
-	start := time.Now()
+	pop := &models.GroupPopulation{GroupID: groupID, Query: query, StartedOn: dates.Now()}
+	if err := savePopulation(rt, pop); err != nil {
+		return 0, err
+	}
 
-	// we have a bit of a race with the indexer process.. we want to make sure that any contacts that changed
-	// before this group was updated but after the last index are included, so if a contact was modified
-	// more recently than 10 seconds ago, we wait that long before starting in populating our group
+	// get the newest modified_on in the database and in the index before querying, so that we know which contacts
+	// the query results might be stale for
 	newest, err := models.GetNewestContactModifiedOn(ctx, rt.DB, oa)
 	if err != nil {
 		return 0, fmt.Errorf("error getting most recent contact modified_on for org: %d: %w", oa.OrgID(), err)
 	}
-	if newest != nil {
-		n := *newest
-
-		// if it was more recent than 10 seconds ago, sleep until it has been 10 seconds
-		if n.Add(time.Second * 10).After(start) {
-			sleep := n.Add(time.Second * 10).Sub(start)
-			slog.Info("sleeping before evaluating dynamic group", "sleep", sleep)
-			time.Sleep(sleep)
-		}
+	newestIndexed, err := GetNewestIndexedModifiedOn(ctx, rt, oa)
+	if err != nil {
+		return 0, fmt.Errorf("error getting most recent indexed modified_on for org: %d: %w", oa.OrgID(), err)
 	}
 
 	// get current set of contacts in our group
@@ -69,16 +85,32 @@ func PopulateSmartGroup(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 		removals = append(removals, id)
 	}
 
-	// first remove all the contacts
-	err = models.RemoveContactsFromGroupAndCampaigns(ctx, rt.DB, oa, groupID, removals)
-	if err != nil {
-		return 0, fmt.Errorf("error removing contacts from group: %d: %w", groupID, err)
+	if err := applyGroupChanges(ctx, rt, oa, pop, adds, removals); err != nil {
+		return 0, err
 	}
 
-	// then add them all
-	err = models.AddContactsToGroupAndCampaigns(ctx, rt.DB, oa, groupID, adds)
-	if err != nil {
-		return 0, fmt.Errorf("error adding contacts to group: %d: %w", groupID, err)
+	count := len(new)
+	changed := make([]models.ContactID, 0, len(adds)+len(removals))
+	changed = append(changed, adds...)
+	changed = append(changed, removals...)
+
+	// if the indexer is behind the database, evaluate the contacts it hasn't seen yet ourselves. If nothing has been
+	// indexed for this org yet then that would be every contact, so we rely on the query results and leave the group
+	// without an evaluated time so that the next refresh is also a full population.
+	evaluatedAsOf := newest
+	if newestIndexed == nil {
+		evaluatedAsOf = nil
+	} else if newest != nil && newest.After(*newestIndexed) {
+		slog.Info("index behind database, evaluating unindexed contacts", "group_id", groupID, "newest", *newest, "newest_indexed", *newestIndexed)
+
+		lateAdds, lateRemovals, err := evaluateContactsModifiedSince(ctx, rt, oa, pop, query, newestIndexed.Add(-evaluateOverlap))
+		if err != nil {
+			return 0, err
+		}
+
+		count += len(lateAdds) - len(lateRemovals)
+		changed = append(changed, lateAdds...)
+		changed = append(changed, lateRemovals...)
 	}
 
 	// mark our group as no longer evaluating
@@ -88,14 +120,204 @@ func PopulateSmartGroup(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 	}
 
 	// finally update modified_on for all affected contacts to ensure these changes are seen by rp-indexer
-	changed := make([]models.ContactID, 0, len(adds))
-	changed = append(changed, adds...)
-	changed = append(changed, removals...)
-
 	err = models.UpdateContactModifiedOn(ctx, rt.DB, changed)
 	if err != nil {
 		return 0, fmt.Errorf("error updating contact modified_on after group population: %w", err)
 	}
 
-	return len(new), nil
+	// group membership is part of searches so cached results may no longer be correct
+	if err := InvalidateSearchCache(rt, oa.OrgID()); err != nil {
+		return 0, err
+	}
+
+	pop.EvaluatedAsOf = evaluatedAsOf
+	completedOn := dates.Now()
+	pop.CompletedOn = &completedOn
+	if err := savePopulation(rt, pop); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// RefreshSmartGroup updates the membership of a group by only evaluating contacts which have been modified since the
+// group was last populated. If the group hasn't been populated before, its query has changed since, or its query can
+// match contacts differently without them being modified, then it is fully populated instead.
+func RefreshSmartGroup(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, groupID models.GroupID, query string) (int, error) {
+	rc := rt.RP.Get()
+	last, err := models.GetGroupPopulation(rc, groupID)
+	rc.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	if last == nil || last.Query != query || last.CompletedOn == nil || last.EvaluatedAsOf == nil || !canRefreshIncrementally(oa, query) {
+		return PopulateSmartGroup(ctx, rt, oa, groupID, query)
+	}
+
+	if err := models.UpdateGroupStatus(ctx, rt.DB, groupID, models.GroupStatusEvaluating); err != nil {
+		return 0, fmt.Errorf("error marking dynamic group as evaluating: %w", err)
+	}
+
+	pop := &models.GroupPopulation{GroupID: groupID, Query: query, Incremental: true, StartedOn: dates.Now(), EvaluatedAsOf: last.EvaluatedAsOf}
+	if err := savePopulation(rt, pop); err != nil {
+		return 0, err
+	}
+
+	newest, err := models.GetNewestContactModifiedOn(ctx, rt.DB, oa)
+	if err != nil {
+		return 0, fmt.Errorf("error getting most recent contact modified_on for org: %d: %w", oa.OrgID(), err)
+	}
+
+	adds, removals, err := evaluateContactsModifiedSince(ctx, rt, oa, pop, query, last.EvaluatedAsOf.Add(-evaluateOverlap))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := models.UpdateGroupStatus(ctx, rt.DB, groupID, models.GroupStatusReady); err != nil {
+		return 0, fmt.Errorf("error marking dynamic group as ready: %w", err)
+	}
+
+	changed := slices.Concat(adds, removals)
+	if err := models.UpdateContactModifiedOn(ctx, rt.DB, changed); err != nil {
+		return 0, fmt.Errorf("error updating contact modified_on after group refresh: %w", err)
+	}
+
+	if err := InvalidateSearchCache(rt, oa.OrgID()); err != nil {
+		return 0, err
+	}
+
+	if newest != nil {
+		pop.EvaluatedAsOf = newest
+	}
+	completedOn := dates.Now()
+	pop.CompletedOn = &completedOn
+	if err := savePopulation(rt, pop); err != nil {
+		return 0, err
+	}
+
+	count, err := models.GetGroupContactCount(ctx, rt.DB.DB, groupID)
+	if err != nil {
+		return 0, fmt.Errorf("error getting count of contacts in group: %d: %w", groupID, err)
+	}
+	return count, nil
+}
+
+// whether the given query only matches contacts differently when they're modified. Date conditions are evaluated as
+// days in the org's current timezone, and two digit years are read relative to the current year, so queries on dates
+// can match differently as time passes and need to be fully evaluated.
+func canRefreshIncrementally(oa *models.OrgAssets, query string) bool {
+	parsed, err := contactql.ParseQuery(oa.Env(), query, oa.SessionAssets())
+	if err != nil {
+		return false
+	}
+
+	inspection := contactql.Inspect(parsed)
+	if slices.Contains(inspection.Attributes, contactql.AttributeCreatedOn) || slices.Contains(inspection.Attributes, contactql.AttributeLastSeenOn) {
+		return false
+	}
+	for _, ref := range inspection.Fields {
+		if field := oa.FieldByKey(ref.Key); field != nil && field.Type() == assets.FieldTypeDatetime {
+			return false
+		}
+	}
+	return true
+}
+
+// GetNewestIndexedModifiedOn returns the newest modified_on of a contact in the given org that is visible to searches
+func GetNewestIndexedModifiedOn(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) (*time.Time, error) {
+	return GetBackend(rt).NewestModifiedOn(ctx, rt, oa)
+}
+
+// evaluates the query against all contacts modified since the given time and updates their membership of the group
+func evaluateContactsModifiedSince(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, pop *models.GroupPopulation, query string, since time.Time) ([]models.ContactID, []models.ContactID, error) {
+	group := oa.GroupByID(pop.GroupID)
+	if group == nil {
+		return nil, nil, fmt.Errorf("unable to find group: %d", pop.GroupID)
+	}
+
+	parsed, err := contactql.ParseQuery(oa.Env(), query, oa.SessionAssets())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing query: %s: %w", query, err)
+	}
+
+	ids, err := models.GetContactIDsModifiedSince(ctx, rt.DB, oa.OrgID(), since)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	adds := make([]models.ContactID, 0, 100)
+	removals := make([]models.ContactID, 0, 100)
+
+	for idBatch := range slices.Chunk(ids, evaluateBatchSize) {
+		contacts, err := models.LoadContacts(ctx, rt.DB, oa, idBatch)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading contacts to evaluate for group: %d: %w", pop.GroupID, err)
+		}
+
+		for _, c := range contacts {
+			contact, err := c.FlowContact(oa)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error creating flow contact: %w", err)
+			}
+
+			isMember := contact.Groups().FindByUUID(group.UUID()) != nil
+			shouldBe := contact.Status() == flows.ContactStatusActive && contactql.EvaluateQuery(oa.Env(), parsed, contact)
+
+			if shouldBe && !isMember {
+				adds = append(adds, c.ID())
+			} else if !shouldBe && isMember {
+				removals = append(removals, c.ID())
+			}
+		}
+	}
+
+	if err := applyGroupChanges(ctx, rt, oa, pop, adds, removals); err != nil {
+		return nil, nil, err
+	}
+
+	return adds, removals, nil
+}
+
+// removes and then adds contacts to the group in batches, saving progress after each batch
+func applyGroupChanges(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, pop *models.GroupPopulation, adds, removals []models.ContactID) error {
+	pop.Total += len(adds) + len(removals)
+	if err := savePopulation(rt, pop); err != nil {
+		return err
+	}
+
+	for batch := range slices.Chunk(removals, populateProgressBatchSize) {
+		if err := models.RemoveContactsFromGroupAndCampaigns(ctx, rt.DB, oa, pop.GroupID, batch); err != nil {
+			return fmt.Errorf("error removing contacts from group: %d: %w", pop.GroupID, err)
+		}
+		if err := updatePopulationProgress(rt, pop, len(batch)); err != nil {
+			return err
+		}
+	}
+
+	for batch := range slices.Chunk(adds, populateProgressBatchSize) {
+		if err := models.AddContactsToGroupAndCampaigns(ctx, rt.DB, oa, pop.GroupID, batch); err != nil {
+			return fmt.Errorf("error adding contacts to group: %d: %w", pop.GroupID, err)
+		}
+		if err := updatePopulationProgress(rt, pop, len(batch)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func updatePopulationProgress(rt *runtime.Runtime, pop *models.GroupPopulation, processed int) error {
+	pop.Processed += processed
+
+	slog.Debug("smart group population progress", "group_id", pop.GroupID, "processed", pop.Processed, "total", pop.Total)
+
+	return savePopulation(rt, pop)
+}
+
+func savePopulation(rt *runtime.Runtime, pop *models.GroupPopulation) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	return pop.Save(rc)
 }
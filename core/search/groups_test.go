@@ -80,3 +80,100 @@ func TestSmartGroups(t *testing.T) {
 			Returns(len(tc.expectedEventIDs), "wrong contacts with events for query: %s", tc.query)
 	}
 }
+
+func TestSmartGroupsUnindexedContacts(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	testsuite.ReindexElastic(ctx)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshCampaigns|models.RefreshGroups)
+	assert.NoError(t, err)
+
+	newestIndexed, err := search.GetNewestIndexedModifiedOn(ctx, rt, oa)
+	assert.NoError(t, err)
+	assert.NotNil(t, newestIndexed)
+
+	// rename Bob without reindexing so that the index is behind the database
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Robert', modified_on = NOW() + INTERVAL '1 minute' WHERE id = $1`, testdata.Bob.ID)
+
+	count, err := search.PopulateSmartGroup(ctx, rt, oa, testdata.DoctorsGroup.ID, "name = robert")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	contactIDs, err := models.GetGroupContactIDs(ctx, rt.DB, testdata.DoctorsGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdata.Bob.ID}, contactIDs)
+
+	pop, err := models.GetGroupPopulation(rc, testdata.DoctorsGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "name = robert", pop.Query)
+	assert.False(t, pop.Incremental)
+	assert.Equal(t, pop.Total, pop.Processed)
+	assert.NotNil(t, pop.CompletedOn)
+	assert.NotNil(t, pop.EvaluatedAsOf)
+}
+
+func TestRefreshSmartGroup(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	testsuite.ReindexElastic(ctx)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshCampaigns|models.RefreshGroups)
+	assert.NoError(t, err)
+
+	// with no previous population, a refresh is a full population
+	count, err := search.RefreshSmartGroup(ctx, rt, oa, testdata.DoctorsGroup.ID, "name = bob")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	pop, err := models.GetGroupPopulation(rc, testdata.DoctorsGroup.ID)
+	assert.NoError(t, err)
+	assert.False(t, pop.Incremental)
+
+	// rename Cathy and Bob without reindexing
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Bob', modified_on = NOW() + INTERVAL '1 minute' WHERE id = $1`, testdata.Cathy.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Robert', modified_on = NOW() + INTERVAL '1 minute' WHERE id = $1`, testdata.Bob.ID)
+	rt.DB.MustExec(`UPDATE contacts_contactgroup SET status = 'I' WHERE id = $1`, testdata.DoctorsGroup.ID)
+
+	count, err = search.RefreshSmartGroup(ctx, rt, oa, testdata.DoctorsGroup.ID, "name = bob")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM contacts_contactgroup WHERE id = $1`, testdata.DoctorsGroup.ID).Returns("R")
+
+	contactIDs, err := models.GetGroupContactIDs(ctx, rt.DB, testdata.DoctorsGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdata.Cathy.ID}, contactIDs)
+
+	pop, err = models.GetGroupPopulation(rc, testdata.DoctorsGroup.ID)
+	assert.NoError(t, err)
+	assert.True(t, pop.Incremental)
+	assert.Equal(t, 2, pop.Total)
+	assert.Equal(t, 2, pop.Processed)
+
+	// changing the query means a full population
+	_, err = search.RefreshSmartGroup(ctx, rt, oa, testdata.DoctorsGroup.ID, "name = robert")
+	assert.NoError(t, err)
+
+	pop, err = models.GetGroupPopulation(rc, testdata.DoctorsGroup.ID)
+	assert.NoError(t, err)
+	assert.False(t, pop.Incremental)
+
+	// queries on dates are always fully populated, even if the query hasn't changed
+	_, err = search.RefreshSmartGroup(ctx, rt, oa, testdata.DoctorsGroup.ID, "created_on > 01-01-20")
+	assert.NoError(t, err)
+	_, err = search.RefreshSmartGroup(ctx, rt, oa, testdata.DoctorsGroup.ID, "created_on > 01-01-20")
+	assert.NoError(t, err)
+
+	pop, err = models.GetGroupPopulation(rc, testdata.DoctorsGroup.ID)
+	assert.NoError(t, err)
+	assert.False(t, pop.Incremental)
+}
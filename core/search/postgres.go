@@ -0,0 +1,516 @@
+package search
+
+import (
+	"context"
+
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/dbutil"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// searches contacts directly in the database, so doesn't need an index to be maintained but is only suitable for
+// deployments with small numbers of contacts
+type postgresBackend struct{}
+
+func (b *postgresBackend) Count(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, query *contactql.ContactQuery) (int64, error) {
+	where, args := BuildPostgresQuery(oa, group, models.NilContactStatus, nil, query)
+
+	var count int64
+	if err := rt.ReadonlyDB.QueryRowContext(ctx, `SELECT count(*) FROM contacts_contact c WHERE `+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error performing count: %w", err)
+	}
+
+	return count, nil
+}
+
+func (b *postgresBackend) Estimate(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, query *contactql.ContactQuery, threshold int) (*ContactTotalEstimate, error) {
+	where, args := BuildPostgresQuery(oa, group, models.NilContactStatus, nil, query)
+
+	// count exactly but stop once we pass the threshold
+	var count int64
+	if err := rt.ReadonlyDB.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM (SELECT 1 FROM contacts_contact c WHERE %s LIMIT %d) s`, where, threshold+1), args...).Scan(&count); err != nil {
+		return nil, fmt.Errorf("error performing count: %w", err)
+	}
+	if count <= int64(threshold) {
+		return &ContactTotalEstimate{Total: count}, nil
+	}
+
+	// otherwise use the query planner's estimate of the number of rows
+	var planJSON []byte
+	if err := rt.ReadonlyDB.QueryRowContext(ctx, `EXPLAIN (FORMAT JSON) SELECT 1 FROM contacts_contact c WHERE `+where, args...).Scan(&planJSON); err != nil {
+		return nil, fmt.Errorf("error estimating count: %w", err)
+	}
+
+	plans := []struct {
+		Plan struct {
+			Rows int64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}{}
+	if err := jsonx.Unmarshal(planJSON, &plans); err != nil || len(plans) == 0 {
+		return nil, fmt.Errorf("error parsing query plan: %w", err)
+	}
+
+	return &ContactTotalEstimate{Total: max(plans[0].Plan.Rows, int64(threshold)), Approximate: true}, nil
+}
+
+func (b *postgresBackend) Page(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, excludeIDs []models.ContactID, query *contactql.ContactQuery, sort string, offset, pageSize int) ([]models.ContactID, int64, error) {
+	qb := newPostgresQueryBuilder(oa)
+	where := qb.where(group, models.NilContactStatus, excludeIDs, query)
+
+	// sorting by a field adds an arg which the count query doesn't use so take a copy of the args before that
+	whereArgs := slices.Clone(qb.args)
+
+	orderBy, err := qb.sort(sort)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error parsing sort: %w", err)
+	}
+
+	var total int64
+	if err := rt.ReadonlyDB.QueryRowContext(ctx, `SELECT count(*) FROM contacts_contact c WHERE `+where, whereArgs...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error performing query: %w", err)
+	}
+
+	sql := fmt.Sprintf(`SELECT c.id FROM contacts_contact c WHERE %s ORDER BY %s OFFSET %d LIMIT %d`, where, orderBy, offset, pageSize)
+
+	ids, err := queryContactIDs(ctx, rt, sql, qb.args, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ids, total, nil
+}
+
+func (b *postgresBackend) IDs(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, status models.ContactStatus, query *contactql.ContactQuery, limit int) ([]models.ContactID, error) {
+	where, args := BuildPostgresQuery(oa, group, status, nil, query)
+
+	sql := `SELECT c.id FROM contacts_contact c WHERE ` + where + ` ORDER BY c.id`
+	if limit >= 0 {
+		sql += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+
+	return queryContactIDs(ctx, rt, sql, args, 100)
+}
+
+// the database is always up to date, but reading from the same database as searches means we allow for replica lag
+func (b *postgresBackend) NewestModifiedOn(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) (*time.Time, error) {
+	return models.GetNewestContactModifiedOn(ctx, rt.ReadonlyDB, oa)
+}
+
+// there's no index to remove contacts from so these are no-ops
+func (b *postgresBackend) DeindexByID(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, contactIDs []models.ContactID) (int, error) {
+	return 0, nil
+}
+
+func (b *postgresBackend) DeindexByOrg(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, limit int) (int, error) {
+	return 0, nil
+}
+
+func queryContactIDs(ctx context.Context, rt *runtime.Runtime, sql string, args []any, capacity int) ([]models.ContactID, error) {
+	rows, err := rt.ReadonlyDB.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error performing query: %w", err)
+	}
+
+	ids, err := dbutil.ScanAllSlice(rows, make([]models.ContactID, 0, capacity))
+	if err != nil {
+		return nil, fmt.Errorf("error scanning contact ids: %w", err)
+	}
+	return ids, nil
+}
+
+// BuildPostgresQuery turns the passed in contact ql query into a SQL condition on contacts_contact aliased as c,
+// returning the condition and its arguments
+func BuildPostgresQuery(oa *models.OrgAssets, group *models.Group, status models.ContactStatus, excludeIDs []models.ContactID, query *contactql.ContactQuery) (string, []any) {
+	qb := newPostgresQueryBuilder(oa)
+	return qb.where(group, status, excludeIDs, query), qb.args
+}
+
+// contact status is stored as single char codes
+var postgresStatusCodes = map[string]string{
+	"active":   "A",
+	"blocked":  "B",
+	"stopped":  "S",
+	"archived": "V",
+}
+
+// location values are stored as paths like "Rwanda > Kigali City" but are matched by their last part
+const postgresLocationName = `LOWER(TRIM(substring(%s from '(?!.* > )([^>]+)')))`
+
+var postgresLikeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type postgresQueryBuilder struct {
+	orgID    models.OrgID
+	env      envs.Environment
+	resolver contactql.Resolver
+	args     []any
+}
+
+func newPostgresQueryBuilder(oa *models.OrgAssets) *postgresQueryBuilder {
+	return &postgresQueryBuilder{orgID: oa.OrgID(), env: oa.Env(), resolver: oa.SessionAssets()}
+}
+
+// adds an argument and returns its placeholder
+func (b *postgresQueryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *postgresQueryBuilder) where(group *models.Group, status models.ContactStatus, excludeIDs []models.ContactID, query *contactql.ContactQuery) string {
+	// filter by org and active contacts
+	conds := []string{"c.org_id = " + b.arg(b.orgID), "c.is_active = TRUE"}
+
+	// and group if present
+	if group != nil {
+		conds = append(conds, b.inGroup(group.ID()))
+	}
+
+	// and status if present
+	if status != models.NilContactStatus {
+		conds = append(conds, "c.status = "+b.arg(status))
+	}
+
+	// and by user query if present
+	if query != nil {
+		conds = append(conds, b.node(query.Root()))
+	}
+
+	// exclude ids if present
+	if len(excludeIDs) > 0 {
+		conds = append(conds, "NOT (c.id = ANY("+b.arg(pq.Array(excludeIDs))+"))")
+	}
+
+	return strings.Join(conds, " AND ")
+}
+
+func (b *postgresQueryBuilder) node(node contactql.QueryNode) string {
+	switch n := node.(type) {
+	case *contactql.BoolCombination:
+		children := make([]string, len(n.Children()))
+		for i, child := range n.Children() {
+			children[i] = b.node(child)
+		}
+
+		op := " OR "
+		if n.Operator() == contactql.BoolOperatorAnd {
+			op = " AND "
+		}
+		return "(" + strings.Join(children, op) + ")"
+	case *contactql.Condition:
+		switch n.PropertyType() {
+		case contactql.PropertyTypeField:
+			return b.fieldCondition(n)
+		case contactql.PropertyTypeAttribute:
+			return b.attributeCondition(n)
+		case contactql.PropertyTypeURN:
+			return b.schemeCondition(n)
+		default:
+			panic(fmt.Sprintf("unsupported property type: %s", n.PropertyType()))
+		}
+	default:
+		panic(fmt.Sprintf("unsupported node type: %T", n))
+	}
+}
+
+func isSetOrUnset(c *contactql.Condition) bool {
+	return (c.Operator() == contactql.OpEqual || c.Operator() == contactql.OpNotEqual) && c.Value() == ""
+}
+
+func setOrUnset(c *contactql.Condition, isSet string) string {
+	if c.Operator() == contactql.OpEqual {
+		return "NOT " + isSet
+	}
+	return isSet
+}
+
+// conditions are built so that they're never NULL, which means they can always be safely negated
+func nonNull(cond string) string {
+	return "COALESCE(" + cond + ", FALSE)"
+}
+
+func (b *postgresQueryBuilder) fieldCondition(c *contactql.Condition) string {
+	field := b.resolver.ResolveField(c.PropertyKey())
+	fieldType := field.Type()
+	value := fmt.Sprintf("(c.fields->%s->>'%s')", b.arg(field.UUID()), fieldType)
+
+	if isSetOrUnset(c) {
+		return setOrUnset(c, value+" IS NOT NULL")
+	}
+
+	switch fieldType {
+	case assets.FieldTypeText:
+		return b.textCondition(c, "LOWER"+value, strings.ToLower(c.Value()), "text field")
+	case assets.FieldTypeNumber:
+		return b.numberCondition(c, value+"::numeric", "number field")
+	case assets.FieldTypeDatetime:
+		return b.dateCondition(c, value+"::timestamptz", "datetime field")
+	case assets.FieldTypeState, assets.FieldTypeDistrict, assets.FieldTypeWard:
+		return b.textCondition(c, fmt.Sprintf(postgresLocationName, value), strings.ToLower(c.Value()), "location field")
+	}
+
+	panic(fmt.Sprintf("unsupported field type: %s", fieldType))
+}
+
+func (b *postgresQueryBuilder) attributeCondition(c *contactql.Condition) string {
+	key := c.PropertyKey()
+	value := strings.ToLower(c.Value())
+
+	// special case for set/unset for name and language
+	if isSetOrUnset(c) && (key == contactql.AttributeName || key == contactql.AttributeLanguage) {
+		return setOrUnset(c, fmt.Sprintf("COALESCE(c.%s, '') != ''", key))
+	}
+
+	switch key {
+	case contactql.AttributeUUID:
+		return b.textCondition(c, "c.uuid::text", value, "UUID attribute")
+	case contactql.AttributeID:
+		id, err := strconv.Atoi(value)
+		match := "FALSE"
+		if err == nil {
+			match = "c.id = " + b.arg(id)
+		}
+
+		switch c.Operator() {
+		case contactql.OpEqual:
+			return match
+		case contactql.OpNotEqual:
+			return "NOT " + match
+		default:
+			panic(fmt.Sprintf("unsupported ID attribute operator: %s", c.Operator()))
+		}
+	case contactql.AttributeName:
+		if c.Operator() == contactql.OpContains {
+			return nonNull("c.name ILIKE " + b.arg("%"+postgresLikeEscaper.Replace(c.Value())+"%"))
+		}
+		return b.textCondition(c, "LOWER(c.name)", value, "name attribute")
+	case contactql.AttributeStatus:
+		return b.textCondition(c, "c.status", postgresStatusCodes[value], "status attribute")
+	case contactql.AttributeLanguage:
+		return b.textCondition(c, "c.language", value, "language attribute")
+	case contactql.AttributeCreatedOn:
+		return b.dateCondition(c, "c.created_on", "created_on attribute")
+	case contactql.AttributeLastSeenOn:
+		if isSetOrUnset(c) {
+			return setOrUnset(c, "c.last_seen_on IS NOT NULL")
+		}
+		return b.dateCondition(c, "c.last_seen_on", "last_seen_on attribute")
+	case contactql.AttributeURN:
+		if isSetOrUnset(c) {
+			return setOrUnset(c, b.hasURN("", ""))
+		}
+
+		switch c.Operator() {
+		case contactql.OpEqual:
+			return b.hasURN("", "LOWER(u.path) = "+b.arg(value))
+		case contactql.OpNotEqual:
+			return "NOT " + b.hasURN("", "LOWER(u.path) = "+b.arg(value))
+		case contactql.OpContains:
+			return b.hasURN("", "u.path ILIKE "+b.arg("%"+postgresLikeEscaper.Replace(value)+"%"))
+		default:
+			panic(fmt.Sprintf("unsupported URN attribute operator: %s", c.Operator()))
+		}
+	case contactql.AttributeGroup:
+		if isSetOrUnset(c) {
+			return setOrUnset(c, "EXISTS (SELECT 1 FROM contacts_contactgroup_contacts gc WHERE gc.contact_id = c.id)")
+		}
+
+		group := c.ValueAsGroup(b.resolver).(*models.Group)
+
+		switch c.Operator() {
+		case contactql.OpEqual:
+			return b.inGroup(group.ID())
+		case contactql.OpNotEqual:
+			return "NOT " + b.inGroup(group.ID())
+		default:
+			panic(fmt.Sprintf("unsupported group attribute operator: %s", c.Operator()))
+		}
+	case contactql.AttributeFlow:
+		if isSetOrUnset(c) {
+			return setOrUnset(c, "c.current_flow_id IS NOT NULL")
+		}
+
+		flow := c.ValueAsFlow(b.resolver).(*models.Flow)
+
+		switch c.Operator() {
+		case contactql.OpEqual:
+			return nonNull("c.current_flow_id = " + b.arg(flow.ID()))
+		case contactql.OpNotEqual:
+			return "NOT " + nonNull("c.current_flow_id = "+b.arg(flow.ID()))
+		default:
+			panic(fmt.Sprintf("unsupported flow attribute operator: %s", c.Operator()))
+		}
+	case contactql.AttributeHistory:
+		if isSetOrUnset(c) {
+			return setOrUnset(c, "EXISTS (SELECT 1 FROM flows_flowrun r WHERE r.contact_id = c.id)")
+		}
+
+		flow := c.ValueAsFlow(b.resolver).(*models.Flow)
+		inHistory := "EXISTS (SELECT 1 FROM flows_flowrun r WHERE r.contact_id = c.id AND r.flow_id = " + b.arg(flow.ID()) + ")"
+
+		switch c.Operator() {
+		case contactql.OpEqual:
+			return inHistory
+		case contactql.OpNotEqual:
+			return "NOT " + inHistory
+		default:
+			panic(fmt.Sprintf("unsupported history attribute operator: %s", c.Operator()))
+		}
+	case contactql.AttributeTickets:
+		return b.numberCondition(c, "c.ticket_count", "tickets attribute")
+	default:
+		panic(fmt.Sprintf("unsupported contact attribute: %s", key))
+	}
+}
+
+func (b *postgresQueryBuilder) schemeCondition(c *contactql.Condition) string {
+	scheme := c.PropertyKey()
+	value := strings.ToLower(c.Value())
+
+	if isSetOrUnset(c) {
+		return setOrUnset(c, b.hasURN(scheme, ""))
+	}
+
+	switch c.Operator() {
+	case contactql.OpEqual:
+		return b.hasURN(scheme, "LOWER(u.path) = "+b.arg(value))
+	case contactql.OpNotEqual:
+		return "NOT " + b.hasURN(scheme, "LOWER(u.path) = "+b.arg(value))
+	case contactql.OpContains:
+		return b.hasURN(scheme, "u.path ILIKE "+b.arg("%"+postgresLikeEscaper.Replace(value)+"%"))
+	default:
+		panic(fmt.Sprintf("unsupported scheme operator: %s", c.Operator()))
+	}
+}
+
+func (b *postgresQueryBuilder) inGroup(groupID models.GroupID) string {
+	return "EXISTS (SELECT 1 FROM contacts_contactgroup_contacts gc WHERE gc.contact_id = c.id AND gc.contactgroup_id = " + b.arg(groupID) + ")"
+}
+
+func (b *postgresQueryBuilder) hasURN(scheme, cond string) string {
+	conds := []string{"u.contact_id = c.id"}
+	if scheme != "" {
+		conds = append(conds, "u.scheme = "+b.arg(scheme))
+	}
+	if cond != "" {
+		conds = append(conds, cond)
+	}
+	return "EXISTS (SELECT 1 FROM contacts_contacturn u WHERE " + strings.Join(conds, " AND ") + ")"
+}
+
+func (b *postgresQueryBuilder) textCondition(c *contactql.Condition, expr, value, name string) string {
+	match := nonNull(expr + " = " + b.arg(value))
+
+	switch c.Operator() {
+	case contactql.OpEqual:
+		return match
+	case contactql.OpNotEqual:
+		return "NOT " + match
+	default:
+		panic(fmt.Sprintf("unsupported %s operator: %s", name, c.Operator()))
+	}
+}
+
+func (b *postgresQueryBuilder) numberCondition(c *contactql.Condition, expr, name string) string {
+	value, _ := c.ValueAsNumber()
+	v := b.arg(value.String()) + "::numeric"
+
+	switch c.Operator() {
+	case contactql.OpEqual:
+		return nonNull(expr + " = " + v)
+	case contactql.OpNotEqual:
+		return "NOT " + nonNull(expr+" = "+v)
+	case contactql.OpGreaterThan:
+		return nonNull(expr + " > " + v)
+	case contactql.OpGreaterThanOrEqual:
+		return nonNull(expr + " >= " + v)
+	case contactql.OpLessThan:
+		return nonNull(expr + " < " + v)
+	case contactql.OpLessThanOrEqual:
+		return nonNull(expr + " <= " + v)
+	default:
+		panic(fmt.Sprintf("unsupported %s operator: %s", name, c.Operator()))
+	}
+}
+
+// dates are matched against the whole day in the org's timezone
+func (b *postgresQueryBuilder) dateCondition(c *contactql.Condition, expr, name string) string {
+	value, _ := c.ValueAsDate(b.env)
+	start, end := dates.DayToUTCRange(value, value.Location())
+
+	switch c.Operator() {
+	case contactql.OpEqual:
+		return nonNull(fmt.Sprintf("%s >= %s AND %s < %s", expr, b.arg(start), expr, b.arg(end)))
+	case contactql.OpNotEqual:
+		return "NOT " + nonNull(fmt.Sprintf("%s >= %s AND %s < %s", expr, b.arg(start), expr, b.arg(end)))
+	case contactql.OpGreaterThan:
+		return nonNull(expr + " >= " + b.arg(end))
+	case contactql.OpGreaterThanOrEqual:
+		return nonNull(expr + " >= " + b.arg(start))
+	case contactql.OpLessThan:
+		return nonNull(expr + " < " + b.arg(start))
+	case contactql.OpLessThanOrEqual:
+		return nonNull(expr + " < " + b.arg(end))
+	default:
+		panic(fmt.Sprintf("unsupported %s operator: %s", name, c.Operator()))
+	}
+}
+
+// returns the ORDER BY clause for the passed in sort by string
+func (b *postgresQueryBuilder) sort(sortBy string) (string, error) {
+	// default to most recent first by id
+	if sortBy == "" {
+		return "c.id DESC", nil
+	}
+
+	// figure out if we are ascending or descending (default is ascending, can be changed with leading -)
+	property := sortBy
+	direction := "ASC"
+	if strings.HasPrefix(sortBy, "-") {
+		direction = "DESC"
+		property = sortBy[1:]
+	}
+
+	property = strings.ToLower(property)
+
+	var expr string
+
+	switch property {
+	case contactql.AttributeName:
+		expr = "LOWER(c.name)"
+	case contactql.AttributeID, contactql.AttributeCreatedOn, contactql.AttributeLastSeenOn, contactql.AttributeLanguage:
+		expr = "c." + property
+	default:
+		// we are sorting by a custom field
+		field := b.resolver.ResolveField(property)
+		if field == nil {
+			return "", fmt.Errorf("no such field with key: %s", property)
+		}
+
+		value := fmt.Sprintf("(c.fields->%s->>'%s')", b.arg(field.UUID()), field.Type())
+
+		switch field.Type() {
+		case assets.FieldTypeNumber:
+			expr = value + "::numeric"
+		case assets.FieldTypeDatetime:
+			expr = value + "::timestamptz"
+		case assets.FieldTypeState, assets.FieldTypeDistrict, assets.FieldTypeWard:
+			expr = fmt.Sprintf(postgresLocationName, value)
+		default:
+			expr = "LOWER" + value
+		}
+	}
+
+	// contacts without values are always last, and ties are broken by id so that pages are stable
+	return fmt.Sprintf("%s %s NULLS LAST, c.id %s", expr, direction, direction), nil
+}
@@ -0,0 +1,106 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/search"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPostgresQuery(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	parse := func(q string) *contactql.ContactQuery {
+		parsed, err := contactql.ParseQuery(oa.Env(), q, oa.SessionAssets())
+		require.NoError(t, err)
+		return parsed
+	}
+
+	where, args := search.BuildPostgresQuery(oa, nil, models.NilContactStatus, nil, nil)
+	assert.Equal(t, `c.org_id = $1 AND c.is_active = TRUE`, where)
+	assert.Equal(t, []any{testdata.Org1.ID}, args)
+
+	doctors := oa.GroupByID(testdata.DoctorsGroup.ID)
+	where, args = search.BuildPostgresQuery(oa, doctors, models.ContactStatusActive, []models.ContactID{testdata.Bob.ID}, parse(`age > 10 OR gender != "M"`))
+	assert.Equal(t, `c.org_id = $1 AND c.is_active = TRUE `+
+		`AND EXISTS (SELECT 1 FROM contacts_contactgroup_contacts gc WHERE gc.contact_id = c.id AND gc.contactgroup_id = $2) `+
+		`AND c.status = $3 `+
+		`AND (COALESCE((c.fields->$4->>'number')::numeric > $5::numeric, FALSE) OR NOT COALESCE(LOWER(c.fields->$6->>'text') = $7, FALSE)) `+
+		`AND NOT (c.id = ANY($8))`, where)
+	assert.Len(t, args, 8)
+	assert.Equal(t, "10", args[4])
+	assert.Equal(t, "m", args[6])
+
+	where, args = search.BuildPostgresQuery(oa, nil, models.NilContactStatus, nil, parse(`tel = ""`))
+	assert.Equal(t, `c.org_id = $1 AND c.is_active = TRUE AND NOT EXISTS (SELECT 1 FROM contacts_contacturn u WHERE u.contact_id = c.id AND u.scheme = $2)`, where)
+	assert.Equal(t, []any{testdata.Org1.ID, "tel"}, args)
+}
+
+func TestPostgresBackend(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer func() { rt.Config.SearchBackend = search.BackendElastic }()
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	queries := []string{
+		"",
+		"cathy OR bob",
+		"name = \"Bob\"",
+		"name = \"\"",
+		"age >= 30",
+		"age != 30",
+		"gender = M",
+		"gender = \"\"",
+		"joined > 2019-01-01",
+		"created_on < 2030-01-01",
+		"last_seen_on = \"\"",
+		"tel = +16055741111",
+		"tel ~ 6055",
+		"urn != \"\"",
+		"group = Doctors",
+		"group != Doctors",
+		"status = blocked",
+		"tickets > 0",
+		"id = 10000",
+		"uuid = 6393abc0-283d-4c9b-a1b3-641a035c34bf",
+		"language = eng",
+	}
+
+	for _, query := range queries {
+		rt.Config.SearchBackend = search.BackendElastic
+		_, esTotal, err := search.GetContactTotal(ctx, rt, oa, nil, query)
+		require.NoError(t, err, "error counting with elastic for query: %s", query)
+		esIDs, err := search.GetContactIDsForQuery(ctx, rt, oa, nil, models.NilContactStatus, query, -1)
+		require.NoError(t, err, "error searching with elastic for query: %s", query)
+
+		rt.Config.SearchBackend = search.BackendPostgres
+		_, pgTotal, err := search.GetContactTotal(ctx, rt, oa, nil, query)
+		require.NoError(t, err, "error counting with postgres for query: %s", query)
+		pgIDs, err := search.GetContactIDsForQuery(ctx, rt, oa, nil, models.NilContactStatus, query, -1)
+		require.NoError(t, err, "error searching with postgres for query: %s", query)
+
+		assert.Equal(t, esTotal, pgTotal, "total mismatch for query: %s", query)
+		assert.Equal(t, esIDs, pgIDs, "ids mismatch for query: %s", query)
+	}
+
+	// check paging with sorting
+	for _, sort := range []string{"", "name", "-created_on", "age", "-gender"} {
+		_, ids, total, err := search.GetContactIDsForQueryPage(ctx, rt, oa, nil, nil, "", sort, 0, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(124), total)
+		assert.Len(t, ids, 2)
+	}
+
+	_, _, _, err = search.GetContactIDsForQueryPage(ctx, rt, oa, nil, nil, "", "goats", 0, 2)
+	assert.EqualError(t, err, "error parsing sort: no such field with key: goats")
+}
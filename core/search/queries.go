@@ -11,7 +11,8 @@ import (
 	"github.com/nyaruka/mailroom/core/models"
 )
 
-// BuildRecipientsQuery builds a query from a set of inclusions/exclusions (i.e. a flow start or broadcast)
+// BuildRecipientsQuery builds a query from a set of inclusions/exclusions (i.e. a flow start or broadcast). Frequency
+// cap exclusions can't be expressed as a query so aren't included, and are instead applied by ResolveRecipients.
 func BuildRecipientsQuery(oa *models.OrgAssets, flow *models.Flow, groups []*models.Group, contactUUIDs []flows.ContactUUID, userQuery string, excs models.Exclusions, excGroups []*models.Group) (string, error) {
 	var parsedQuery *contactql.ContactQuery
 	var err error
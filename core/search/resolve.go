@@ -93,10 +93,26 @@ func ResolveRecipients(ctx context.Context, rt *runtime.Runtime, oa *models.OrgA
 			return nil, fmt.Errorf("error building query: %w", err)
 		}
 
-		matches, err = GetContactIDsForQuery(ctx, rt, oa, nil, models.ContactStatusActive, query, limit)
+		// frequency caps can't be part of the query so are applied to the matches afterwards, which means we can't
+		// limit the search itself without possibly ending up with fewer contacts than the limit
+		queryLimit := limit
+		if recipients.Exclusions.HasFrequencyCaps() {
+			queryLimit = -1
+		}
+
+		matches, err = GetContactIDsForQuery(ctx, rt, oa, nil, models.ContactStatusActive, query, queryLimit)
 		if err != nil {
 			return nil, fmt.Errorf("error performing contact search: %w", err)
 		}
+
+		matches, err = models.FilterByFrequencyCaps(ctx, rt.DB, recipients.Exclusions, matches)
+		if err != nil {
+			return nil, fmt.Errorf("error applying frequency caps: %w", err)
+		}
+
+		if limit >= 0 && len(matches) > limit {
+			matches = matches[:limit]
+		}
 	}
 
 	// only add created contacts if not excluding contacts based on last seen - other exclusions can't apply to a newly
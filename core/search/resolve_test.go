@@ -23,6 +23,18 @@ func TestResolveRecipients(t *testing.T) {
 	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshGroups)
 	require.NoError(t, err)
 
+	// George was started in a flow just now and Alexandria 3 days ago
+	testdata.InsertFlowSession(rt, testdata.Org1, testdata.George, models.FlowTypeMessaging, models.SessionStatusCompleted, testdata.Favorites, models.NilCallID)
+	alexSessionID := testdata.InsertFlowSession(rt, testdata.Org1, testdata.Alexandria, models.FlowTypeMessaging, models.SessionStatusCompleted, testdata.Favorites, models.NilCallID)
+	rt.DB.MustExec(`UPDATE flows_flowsession SET created_on = NOW() - INTERVAL '3 days' WHERE id = $1`, alexSessionID)
+
+	// Cathy has received 2 bulk messages, Bob 1 bulk message and 2 high priority messages
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Bulk 1", nil, models.MsgStatusSent, false)
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Bulk 2", nil, models.MsgStatusSent, false)
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Bulk 1", nil, models.MsgStatusSent, false)
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Reply 1", nil, models.MsgStatusSent, true)
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Reply 2", nil, models.MsgStatusSent, true)
+
 	tcs := []struct {
 		flow        *testdata.Flow
 		recipients  *search.Recipients
@@ -88,6 +100,30 @@ func TestResolveRecipients(t *testing.T) {
 			limit:       -1,
 			expectedIDs: []models.ContactID{30002},
 		},
+		{ // 8 exclude contacts started in any flow recently
+			recipients: &search.Recipients{
+				GroupIDs:   []models.GroupID{group1.ID},
+				Exclusions: models.Exclusions{StartedSinceHours: 24},
+			},
+			limit:       -1,
+			expectedIDs: []models.ContactID{testdata.Alexandria.ID},
+		},
+		{ // 9 exclude contacts who have received too many bulk messages recently
+			recipients: &search.Recipients{
+				Query:      `name = "Cathy" OR name = "Bob"`,
+				Exclusions: models.Exclusions{BulkMsgsSinceDays: 7, BulkMsgsMax: 1},
+			},
+			limit:       -1,
+			expectedIDs: []models.ContactID{testdata.Bob.ID},
+		},
+		{ // 10 limit is applied after frequency caps
+			recipients: &search.Recipients{
+				Query:      `name = "Cathy" OR name = "Bob"`,
+				Exclusions: models.Exclusions{BulkMsgsSinceDays: 7, BulkMsgsMax: 1},
+			},
+			limit:       1,
+			expectedIDs: []models.ContactID{testdata.Bob.ID},
+		},
 	}
 
 	for i, tc := range tcs {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/flows"
@@ -11,6 +12,7 @@ import (
 	"github.com/nyaruka/mailroom/core/search"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/redisx/assertredis"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -223,3 +225,90 @@ func TestGetContactIDsForQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestEstimateContactTotal(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer func() {
+		rt.Config.SearchBackend = search.BackendElastic
+		rt.Config.SearchEstimateAbove = 0
+	}()
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	for _, backend := range []string{search.BackendElastic, search.BackendPostgres} {
+		rt.Config.SearchBackend = backend
+
+		// under the threshold totals are exact
+		rt.Config.SearchEstimateAbove = 100
+		_, estimate, err := search.EstimateContactTotal(ctx, rt, oa, nil, "cathy OR bob")
+		assert.NoError(t, err)
+		assert.Equal(t, &search.ContactTotalEstimate{Total: 2}, estimate, "estimate mismatch for backend %s", backend)
+
+		// over the threshold they're approximate but never less than the threshold
+		_, estimate, err = search.EstimateContactTotal(ctx, rt, oa, nil, "")
+		assert.NoError(t, err)
+		assert.True(t, estimate.Approximate, "expected approximate for backend %s", backend)
+		assert.GreaterOrEqual(t, estimate.Total, int64(100))
+
+		// elastic can only tell us the total is at least the threshold
+		assert.Equal(t, backend == search.BackendElastic, estimate.LowerBound, "lower bound mismatch for backend %s", backend)
+
+		// and zero threshold means always exact
+		rt.Config.SearchEstimateAbove = 0
+		_, estimate, err = search.EstimateContactTotal(ctx, rt, oa, nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, &search.ContactTotalEstimate{Total: 124}, estimate)
+	}
+}
+
+func TestSearchCaching(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	rt.Config.SearchCacheTTL = 60
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	_, total, err := search.GetContactTotal(ctx, rt, oa, nil, "cathy OR bob")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+
+	_, ids, total, err := search.GetContactIDsForQueryPage(ctx, rt, oa, nil, nil, "cathy OR bob", "id", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID}, ids)
+	assert.Equal(t, int64(2), total)
+
+	keys, err := redis.Strings(rc.Do("KEYS", "search_cache:*"))
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	// modifying a contact changes the freshness of the index and so invalidates them
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Robert', modified_on = NOW() + INTERVAL '1 minute' WHERE id = $1`, testdata.Bob.ID)
+	testsuite.ReindexElastic(ctx)
+
+	_, total, err = search.GetContactTotal(ctx, rt, oa, nil, "cathy OR bob")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	_, total, err = search.GetContactTotal(ctx, rt, oa, nil, "cathy OR robert")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+
+	// removing a contact from the index doesn't change the freshness of the index but does invalidate cached results
+	_, err = search.DeindexContactsByID(ctx, rt, testdata.Org1.ID, []models.ContactID{testdata.Cathy.ID})
+	require.NoError(t, err)
+	_, err = rt.ES.Indices.Refresh().Index(rt.Config.ElasticContactsIndex).Do(ctx)
+	require.NoError(t, err)
+
+	assertredis.Get(t, rc, fmt.Sprintf("search_cache_version:%d", testdata.Org1.ID), "1")
+
+	_, total, err = search.GetContactTotal(ctx, rt, oa, nil, "cathy OR robert")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+}
@@ -17,10 +17,17 @@ import (
 
 const (
 	maxBatchSize = 100
+
+	// max number of fires of a throttled campaign that we expect to be queued but not yet fired, which limits how many
+	// of its fires we load beyond its limit
+	maxThrottledQueued = 10 * maxBatchSize
 )
 
 var campaignsMarker = redisx.NewIntervalSet("campaign_event", time.Hour*24, 2)
 
+// number of fires queued for each throttled campaign in the current minute
+var campaignsQueued = redisx.NewIntervalSeries("campaign_event_queued", time.Minute, 1)
+
 func init() {
 	tasks.RegisterCron("campaign_event", &QueueEventsCron{})
 }
@@ -41,7 +48,7 @@ func (c *QueueEventsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[str
 	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
 	defer cancel()
 
-	rows, err := rt.DB.QueryxContext(ctx, expiredEventsQuery)
+	rows, err := rt.DB.QueryxContext(ctx, expiredEventsQuery, maxThrottledQueued)
 	if err != nil {
 		return nil, fmt.Errorf("error loading expired campaign events: %w", err)
 	}
@@ -52,7 +59,28 @@ func (c *QueueEventsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[str
 
 	orgID := models.NilOrgID
 	var task *FireCampaignEventTask
-	numFires, numDupes, numTasks := 0, 0, 0
+	var taskCampaignID models.CampaignID
+	var taskThrottled bool
+	numFires, numDupes, numThrottled, numTasks := 0, 0, 0, 0
+
+	// fires of each throttled campaign queued this minute, which includes those queued by this run
+	throttledQueued := make(map[models.CampaignID]int)
+
+	// queues the current task, and records its fires against its campaign if that's throttled, so that if this run
+	// fails part way through, fires which were queued still count against their campaign's limit
+	queueTask := func() error {
+		if err := c.queueFiresTask(rt.RP, orgID, task); err != nil {
+			return fmt.Errorf("error queueing task: %w", err)
+		}
+		numTasks++
+
+		if taskThrottled {
+			if err := campaignsQueued.Record(rc, fmt.Sprint(taskCampaignID), int64(len(task.FireIDs))); err != nil {
+				return fmt.Errorf("error recording queued fires for campaign: %w", err)
+			}
+		}
+		return nil
+	}
 
 	for rows.Next() {
 		row := &eventFireRow{}
@@ -76,6 +104,25 @@ func (c *QueueEventsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[str
 			continue
 		}
 
+		// throttled campaigns only have as many fires queued per minute as their limit - fires which were queued earlier
+		// but haven't been fired don't count against that, so fires stuck in a failed task can't stall the campaign
+		if row.CampaignLimit != nil {
+			queued, seen := throttledQueued[row.CampaignID]
+			if !seen {
+				total, err := campaignsQueued.Total(rc, fmt.Sprint(row.CampaignID))
+				if err != nil {
+					return nil, fmt.Errorf("error getting queued fires for campaign: %w", err)
+				}
+				queued = int(total)
+			}
+			if queued >= *row.CampaignLimit {
+				throttledQueued[row.CampaignID] = queued
+				numThrottled++
+				continue
+			}
+			throttledQueued[row.CampaignID] = queued + 1
+		}
+
 		// if this is the same event as our current task, and we haven't reached the fire per task limit, add it there
 		if task != nil && row.EventID == task.EventID && len(task.FireIDs) < maxBatchSize {
 			task.FireIDs = append(task.FireIDs, row.FireID)
@@ -84,15 +131,15 @@ func (c *QueueEventsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[str
 
 		// if not, queue up current task...
 		if task != nil {
-			err = c.queueFiresTask(rt.RP, orgID, task)
-			if err != nil {
-				return nil, fmt.Errorf("error queueing task: %w", err)
+			if err := queueTask(); err != nil {
+				return nil, err
 			}
-			numTasks++
 		}
 
 		// and create a new one based on this row
 		orgID = row.OrgID
+		taskCampaignID = row.CampaignID
+		taskThrottled = row.CampaignLimit != nil
 		task = &FireCampaignEventTask{
 			FireIDs:      []models.FireID{row.FireID},
 			EventID:      row.EventID,
@@ -105,13 +152,12 @@ func (c *QueueEventsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[str
 
 	// queue our last task if we have one
 	if task != nil {
-		if err := c.queueFiresTask(rt.RP, orgID, task); err != nil {
-			return nil, fmt.Errorf("error queueing task: %w", err)
+		if err := queueTask(); err != nil {
+			return nil, err
 		}
-		numTasks++
 	}
 
-	return map[string]any{"fires": numFires, "dupes": numDupes, "tasks": numTasks}, nil
+	return map[string]any{"fires": numFires, "dupes": numDupes, "throttled": numThrottled, "tasks": numTasks}, nil
 }
 
 func (c *QueueEventsCron) queueFiresTask(rp *redis.Pool, orgID models.OrgID, task *FireCampaignEventTask) error {
@@ -136,38 +182,101 @@ func (c *QueueEventsCron) queueFiresTask(rp *redis.Pool, orgID models.OrgID, tas
 }
 
 type eventFireRow struct {
-	FireID       models.FireID   `db:"fire_id"`
-	EventID      int64           `db:"event_id"`
-	EventUUID    string          `db:"event_uuid"`
-	FlowUUID     assets.FlowUUID `db:"flow_uuid"`
-	CampaignUUID string          `db:"campaign_uuid"`
-	CampaignName string          `db:"campaign_name"`
-	OrgID        models.OrgID    `db:"org_id"`
+	FireID        models.FireID     `db:"fire_id"`
+	EventID       int64             `db:"event_id"`
+	EventUUID     string            `db:"event_uuid"`
+	FlowUUID      assets.FlowUUID   `db:"flow_uuid"`
+	CampaignID    models.CampaignID `db:"campaign_id"`
+	CampaignUUID  string            `db:"campaign_uuid"`
+	CampaignName  string            `db:"campaign_name"`
+	CampaignLimit *int              `db:"campaign_limit"`
+	OrgID         models.OrgID      `db:"org_id"`
 }
 
+// Selects due event fires, along with the limit on how many fires can be queued per minute for throttled campaigns.
+// That's their max fires per minute, or if they're spreading fires, what's needed for the current backlog of the
+// campaign to be worked through by the time its oldest fire is the given number of minutes late. The backlog of each
+// throttled campaign is aggregated on its own and then only as many of its fires are loaded as could be queued, plus
+// those which might already be queued.
+//
+// Throttling columns don't exist in RapidPro yet so are read via to_jsonb.
 const expiredEventsQuery = `
+WITH throttled AS (
+    SELECT
+        c.id as campaign_id,
+        (to_jsonb(c) ->> 'max_fires_per_minute')::int as max_fires_per_minute,
+        (to_jsonb(c) ->> 'spread_minutes')::int as spread_minutes
+    FROM
+        campaigns_campaign c
+    WHERE
+        (to_jsonb(c) ->> 'max_fires_per_minute') IS NOT NULL OR COALESCE((to_jsonb(c) ->> 'spread_minutes')::int, 0) > 0
+),
+throttled_limits AS (
+    SELECT
+        t.campaign_id,
+        CASE
+            WHEN COALESCE(t.spread_minutes, 0) > 0 THEN LEAST(COALESCE(t.max_fires_per_minute, b.due), CEIL(b.due / GREATEST(t.spread_minutes - EXTRACT(EPOCH FROM NOW() - b.oldest) / 60, 1)))::int
+            ELSE t.max_fires_per_minute
+        END as campaign_limit
+    FROM
+        throttled t
+    CROSS JOIN LATERAL (
+        SELECT COUNT(*) as due, MIN(ef.scheduled) as oldest
+          FROM campaigns_eventfire ef
+          JOIN campaigns_campaignevent ce ON ce.id = ef.event_id
+         WHERE ce.campaign_id = t.campaign_id AND ce.is_active = TRUE AND ef.fired IS NULL AND ef.scheduled <= NOW()
+    ) b
+    WHERE
+        b.due > 0
+),
+due AS (
+    SELECT
+        f.fire_id, f.event_id, f.scheduled, l.campaign_id, l.campaign_limit
+    FROM
+        throttled_limits l
+    CROSS JOIN LATERAL (
+        SELECT ef.id as fire_id, ef.event_id, ef.scheduled
+          FROM campaigns_eventfire ef
+          JOIN campaigns_campaignevent ce ON ce.id = ef.event_id
+         WHERE ce.campaign_id = l.campaign_id AND ce.is_active = TRUE AND ef.fired IS NULL AND ef.scheduled <= NOW()
+      ORDER BY ef.scheduled, ef.event_id, ef.id
+         LIMIT l.campaign_limit + $1
+    ) f
+
+    UNION ALL
+
+    SELECT
+        ef.id, ef.event_id, ef.scheduled, ce.campaign_id, NULL::int
+    FROM
+        campaigns_eventfire ef
+    JOIN
+        campaigns_campaignevent ce ON ce.id = ef.event_id
+    WHERE
+        ef.fired IS NULL AND ef.scheduled <= NOW() AND ce.is_active = TRUE AND
+        ce.campaign_id NOT IN (SELECT campaign_id FROM throttled)
+)
 SELECT
-    ef.id as fire_id,
-    ef.event_id as event_id,
+    d.fire_id as fire_id,
+    d.event_id as event_id,
     ce.uuid as event_uuid,
-	f.uuid as flow_uuid,
-	c.uuid as campaign_uuid,
+    f.uuid as flow_uuid,
+    c.id as campaign_id,
+    c.uuid as campaign_uuid,
     c.name as campaign_name,
+    d.campaign_limit as campaign_limit,
     f.org_id as org_id
 FROM
-    campaigns_eventfire ef,
+    due d,
     campaigns_campaignevent ce,
     campaigns_campaign c,
     flows_flow f
 WHERE
-    ef.fired IS NULL AND ef.scheduled <= NOW() AND
-	ce.id = ef.event_id AND
-	ce.is_active = TRUE AND
-    f.id = ce.flow_id AND
-    ce.campaign_id = c.id
+    ce.id = d.event_id AND
+    c.id = d.campaign_id AND
+    f.id = ce.flow_id
 ORDER BY
-    DATE_TRUNC('minute', scheduled) ASC,
-    ef.event_id ASC
+    DATE_TRUNC('minute', d.scheduled) ASC,
+    d.event_id ASC
 LIMIT
     25000;
 `
@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/jsonx"
@@ -37,7 +39,7 @@ func TestQueueEventFires(t *testing.T) {
 	cron := &campaigns.QueueEventsCron{}
 	res, err := cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"fires": 0, "dupes": 0, "tasks": 0}, res)
+	assert.Equal(t, map[string]any{"fires": 0, "dupes": 0, "throttled": 0, "tasks": 0}, res)
 
 	assertFireTasks(t, rt, testdata.Org1, [][]models.FireID{})
 	assertFireTasks(t, rt, testdata.Org2, [][]models.FireID{})
@@ -52,7 +54,7 @@ func TestQueueEventFires(t *testing.T) {
 	// schedule our campaign to be started
 	res, err = cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"fires": 4, "dupes": 0, "tasks": 3}, res)
+	assert.Equal(t, map[string]any{"fires": 4, "dupes": 0, "throttled": 0, "tasks": 3}, res)
 
 	assertFireTasks(t, rt, testdata.Org1, [][]models.FireID{{fire1ID, fire2ID}, {fire4ID}})
 	assertFireTasks(t, rt, testdata.Org2, [][]models.FireID{{fire3ID}})
@@ -60,7 +62,7 @@ func TestQueueEventFires(t *testing.T) {
 	// running again won't double add those fires
 	res, err = cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"fires": 4, "dupes": 4, "tasks": 0}, res)
+	assert.Equal(t, map[string]any{"fires": 4, "dupes": 4, "throttled": 0, "tasks": 0}, res)
 
 	assertFireTasks(t, rt, testdata.Org1, [][]models.FireID{{fire1ID, fire2ID}, {fire4ID}})
 	assertFireTasks(t, rt, testdata.Org2, [][]models.FireID{{fire3ID}})
@@ -77,7 +79,7 @@ func TestQueueEventFires(t *testing.T) {
 
 	res, err = cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"fires": 114, "dupes": 4, "tasks": 2}, res)
+	assert.Equal(t, map[string]any{"fires": 114, "dupes": 4, "throttled": 0, "tasks": 2}, res)
 
 	queuedTasks := testsuite.CurrentTasks(t, rt, "batch")
 	org1Tasks := queuedTasks[testdata.Org1.ID]
@@ -96,6 +98,75 @@ func TestQueueEventFires(t *testing.T) {
 	assert.Equal(t, 100, len(tk1.FireIDs))
 	assert.Equal(t, 10, len(tk2.FireIDs))
 }
+
+func TestQueueEventFiresThrottled(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer dates.SetNowFunc(time.Now)
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	// counts of queued fires are per minute so move forward a minute between runs to simulate the cron
+	now := time.Now()
+	nextMinute := func() {
+		now = now.Add(time.Minute)
+		dates.SetNowFunc(dates.NewFixedNow(now))
+	}
+	dates.SetNowFunc(dates.NewFixedNow(now))
+
+	// limit the reminders campaign to 2 fires per minute
+	rt.DB.MustExec(`UPDATE campaigns_campaign SET max_fires_per_minute = 2 WHERE id = $1`, testdata.RemindersCampaign.ID)
+	defer rt.DB.MustExec(`UPDATE campaigns_campaign SET max_fires_per_minute = NULL, spread_minutes = NULL WHERE id = $1`, testdata.RemindersCampaign.ID)
+
+	fireIDs := make([]models.FireID, 10)
+	for i := range fireIDs {
+		contact := testdata.InsertContact(rt, testdata.Org1, flows.ContactUUID(uuids.NewV4()), fmt.Sprintf("Jim %d", i), i18n.NilLanguage, models.ContactStatusActive)
+		fireIDs[i] = testdata.InsertEventFire(rt, contact, testdata.RemindersEvent1, time.Now().Add(-time.Minute))
+	}
+
+	cron := &campaigns.QueueEventsCron{}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"fires": 10, "dupes": 0, "throttled": 8, "tasks": 1}, res)
+
+	assertFireTasks(t, rt, testdata.Org1, [][]models.FireID{{fireIDs[0], fireIDs[1]}})
+
+	// fires queued this minute count against the limit
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"fires": 10, "dupes": 2, "throttled": 8, "tasks": 0}, res)
+
+	// next minute we can queue more, even though the previous ones haven't been fired
+	nextMinute()
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"fires": 10, "dupes": 2, "throttled": 6, "tasks": 1}, res)
+
+	assertFireTasks(t, rt, testdata.Org1, [][]models.FireID{{fireIDs[0], fireIDs[1]}, {fireIDs[2], fireIDs[3]}})
+
+	rt.DB.MustExec(`UPDATE campaigns_eventfire SET fired = NOW() WHERE id = ANY($1)`, pq.Array(fireIDs[:4]))
+
+	// switch to spreading the remaining 6 fires over 4 minutes, which since they're already 30 seconds late, means we
+	// queue 2 this minute
+	nextMinute()
+	rt.DB.MustExec(`UPDATE campaigns_campaign SET max_fires_per_minute = NULL, spread_minutes = 4 WHERE id = $1`, testdata.RemindersCampaign.ID)
+	rt.DB.MustExec(`UPDATE campaigns_eventfire SET scheduled = NOW() - INTERVAL '30 seconds' WHERE id = ANY($1)`, pq.Array(fireIDs))
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"fires": 6, "dupes": 0, "throttled": 4, "tasks": 1}, res)
+
+	// and once the oldest is more than 4 minutes late, everything is queued
+	nextMinute()
+	rt.DB.MustExec(`UPDATE campaigns_eventfire SET scheduled = NOW() - INTERVAL '5 minutes' WHERE id = ANY($1)`, pq.Array(fireIDs))
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"fires": 6, "dupes": 2, "throttled": 0, "tasks": 1}, res)
+}
+
 func TestQueueAndFireEvent(t *testing.T) {
 	ctx, rt := testsuite.Runtime()
 	rc := rt.RP.Get()
@@ -174,9 +174,18 @@ func FireCampaignEvents(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 
 	// mark the skipped fires as skipped and record as handled
 	skipped := slices.Collect(maps.Values(firesToSkip))
-	err = models.MarkEventsFired(ctx, rt.DB, skipped, time.Now(), models.FireResultSkipped)
-	if err != nil {
-		return nil, fmt.Errorf("error marking events skipped: %w", err)
+	if len(skipped) > 0 {
+		tx, err := rt.DB.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error starting transaction: %w", err)
+		}
+		if err := markEventFires(ctx, tx, oa, dbEvent, skipped, time.Now(), models.FireResultSkipped); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error marking events skipped: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("error committing skipped events: %w", err)
+		}
 	}
 
 	handled := skipped
@@ -186,7 +195,7 @@ func FireCampaignEvents(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 		fired := slices.Collect(maps.Values(firesToFire))
 
 		err := handler.TriggerIVRFlow(ctx, rt, oa.OrgID(), dbFlow.ID(), slices.Collect(maps.Keys(firesToFire)), func(ctx context.Context, tx *sqlx.Tx) error {
-			return models.MarkEventsFired(ctx, tx, fired, time.Now(), models.FireResultFired)
+			return markEventFires(ctx, tx, oa, dbEvent, fired, time.Now(), models.FireResultFired)
 		})
 		if err != nil {
 			return nil, fmt.Errorf("error triggering ivr flow start: %w", err)
@@ -208,7 +217,7 @@ func FireCampaignEvents(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 		}
 
 		// mark those events as fired
-		err := models.MarkEventsFired(ctx, tx, fired, firedOn, models.FireResultFired)
+		err := markEventFires(ctx, tx, oa, dbEvent, fired, firedOn, models.FireResultFired)
 		if err != nil {
 			return fmt.Errorf("error marking events fired: %w", err)
 		}
@@ -238,3 +247,15 @@ func FireCampaignEvents(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 
 	return handled, nil
 }
+
+// marks the given fires with the given result and, if the event is recurring, schedules the next occurrences for their
+// contacts in the same transaction
+func markEventFires(ctx context.Context, tx *sqlx.Tx, oa *models.OrgAssets, event *models.CampaignEvent, fires []*models.EventFire, fired time.Time, result models.EventFireResult) error {
+	if err := models.MarkEventsFired(ctx, tx, fires, fired, result); err != nil {
+		return err
+	}
+	if err := models.ScheduleNextRecurrences(ctx, tx, oa, event, fires); err != nil {
+		return fmt.Errorf("error scheduling next recurrences: %w", err)
+	}
+	return nil
+}
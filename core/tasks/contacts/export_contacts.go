@@ -0,0 +1,76 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/search"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// TypeExportContacts is the type of the export contacts task
+const TypeExportContacts = "export_contacts"
+
+func init() {
+	tasks.RegisterType(TypeExportContacts, func() tasks.Task { return &ExportContactsTask{} })
+}
+
+// ExportContactsTask is our task to write the contacts of an export to storage
+type ExportContactsTask struct {
+	ExportUUID uuids.UUID `json:"export_uuid"`
+}
+
+func (t *ExportContactsTask) Type() string {
+	return TypeExportContacts
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ExportContactsTask) Timeout() time.Duration {
+	return time.Hour * 4
+}
+
+func (t *ExportContactsTask) WithAssets() models.Refresh {
+	return models.RefreshFields | models.RefreshGroups
+}
+
+// Perform finds the contacts matching the export's query and writes them to its file
+func (t *ExportContactsTask) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	export, err := models.GetContactExport(rc, oa.OrgID(), t.ExportUUID)
+	if err != nil {
+		return err
+	}
+	if export == nil {
+		return fmt.Errorf("no such contact export %s", t.ExportUUID)
+	}
+
+	if err := t.perform(ctx, rt, oa, export); err != nil {
+		if err := export.MarkFailed(rc, err); err != nil {
+			return fmt.Errorf("error marking contact export as failed: %w", err)
+		}
+		return fmt.Errorf("error exporting contacts: %w", err)
+	}
+
+	return nil
+}
+
+func (t *ExportContactsTask) perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, export *models.ContactExport) error {
+	group := oa.GroupByID(export.GroupID)
+	if group == nil {
+		return errors.New("no such group")
+	}
+
+	ids, err := search.GetContactIDsForQuery(ctx, rt, oa, group, models.NilContactStatus, export.Query, -1)
+	if err != nil {
+		return fmt.Errorf("error querying contacts: %w", err)
+	}
+
+	return export.Write(ctx, rt, oa, ids)
+}
@@ -24,8 +24,9 @@ func init() {
 
 // PopulateDynamicGroupTask is our task to populate the contacts for a dynamic group
 type PopulateDynamicGroupTask struct {
-	GroupID models.GroupID `json:"group_id"`
-	Query   string         `json:"query"`
+	GroupID     models.GroupID `json:"group_id"`
+	Query       string         `json:"query"`
+	Incremental bool           `json:"incremental,omitempty"`
 }
 
 func (t *PopulateDynamicGroupTask) Type() string {
@@ -52,9 +53,15 @@ func (t *PopulateDynamicGroupTask) Perform(ctx context.Context, rt *runtime.Runt
 
 	start := time.Now()
 
-	slog.Info("starting population of smart group", "group_id", t.GroupID, "org_id", oa.OrgID(), "query", t.Query)
+	slog.Info("starting population of smart group", "group_id", t.GroupID, "org_id", oa.OrgID(), "query", t.Query, "incremental", t.Incremental)
 
-	count, err := search.PopulateSmartGroup(ctx, rt, oa, t.GroupID, t.Query)
+	// incremental populations only re-evaluate contacts modified since the last population
+	populate := search.PopulateSmartGroup
+	if t.Incremental {
+		populate = search.RefreshSmartGroup
+	}
+
+	count, err := populate(ctx, rt, oa, t.GroupID, t.Query)
 	if err != nil {
 		return fmt.Errorf("error populating smart group: %d: %w", t.GroupID, err)
 	}
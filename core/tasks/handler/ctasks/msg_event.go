@@ -81,6 +81,13 @@ func (t *MsgEventTask) Perform(ctx context.Context, rt *runtime.Runtime, oa *mod
 		return nil
 	}
 
+	// give the org's content filter a chance to flag and label this message
+	if decision := oa.Org().FilterContent(ctx, models.DirectionIn, t.Text); decision != nil {
+		if err := models.RecordIncomingContentFilter(ctx, rt.DB, oa, t.MsgID, decision); err != nil {
+			return fmt.Errorf("error recording content filter decision: %w", err)
+		}
+	}
+
 	// if we have URNs make sure the message URN is our highest priority (this is usually a noop)
 	if len(contact.URNs()) > 0 {
 		err := contact.UpdatePreferredURN(ctx, rt.DB, oa, t.URNID, channel)
@@ -232,7 +239,7 @@ func handleAsInbox(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsset
 	contact.SetLastSeenOn(msgEvent.CreatedOn())
 	contactEvents := map[*flows.Contact][]flows.Event{contact: {msgEvent}}
 
-	err := models.HandleAndCommitEvents(ctx, rt, oa, models.NilUserID, contactEvents)
+	err := models.HandleAndCommitEvents(ctx, rt, oa, models.ContactChangeSource{Via: models.ContactChangeViaSystem}, contactEvents)
 	if err != nil {
 		return fmt.Errorf("error handling inbox message events: %w", err)
 	}
@@ -29,7 +29,7 @@ func (c *EndIncidentsCron) AllInstances() bool {
 
 // EndIncidents checks open incidents and end any that no longer apply
 func (c *EndIncidentsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
-	incidents, err := models.GetOpenIncidents(ctx, rt.DB, []models.IncidentType{models.IncidentTypeWebhooksUnhealthy})
+	incidents, err := models.GetOpenIncidents(ctx, rt.DB, []models.IncidentType{models.IncidentTypeWebhooksUnhealthy, models.IncidentTypeMessagesLooping})
 	if err != nil {
 		return nil, fmt.Errorf("error fetching open incidents: %w", err)
 	}
@@ -45,6 +45,14 @@ func (c *EndIncidentsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[st
 			if ended {
 				numEnded++
 			}
+		} else if incident.Type == models.IncidentTypeMessagesLooping {
+			ended, err := checkLoopingIncident(ctx, rt, incident)
+			if err != nil {
+				return nil, fmt.Errorf("error checking looping incident #%d: %w", incident.ID, err)
+			}
+			if ended {
+				numEnded++
+			}
 		}
 	}
 
@@ -52,7 +60,7 @@ func (c *EndIncidentsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[st
 }
 
 func checkWebhookIncident(ctx context.Context, rt *runtime.Runtime, incident *models.Incident) (bool, error) {
-	nodeUUIDs, err := getWebhookIncidentNodes(rt, incident)
+	nodeUUIDs, err := getIncidentNodes(rt, incident)
 
 	if err != nil {
 		return false, fmt.Errorf("error getting webhook nodes: %w", err)
@@ -73,7 +81,7 @@ func checkWebhookIncident(ctx context.Context, rt *runtime.Runtime, incident *mo
 	}
 
 	if len(healthyNodeUUIDs) > 0 {
-		if err := removeWebhookIncidentNodes(rt, incident, healthyNodeUUIDs); err != nil {
+		if err := removeIncidentNodes(rt, incident, healthyNodeUUIDs); err != nil {
 			return false, fmt.Errorf("error removing nodes from webhook incident: %w", err)
 		}
 	}
@@ -93,7 +101,25 @@ func checkWebhookIncident(ctx context.Context, rt *runtime.Runtime, incident *mo
 	return false, nil
 }
 
-func getWebhookIncidentNodes(rt *runtime.Runtime, incident *models.Incident) ([]flows.NodeUUID, error) {
+// a looping incident ends once its set of looping nodes has expired, i.e. no loops have been detected for 30 minutes
+func checkLoopingIncident(ctx context.Context, rt *runtime.Runtime, incident *models.Incident) (bool, error) {
+	nodeUUIDs, err := getIncidentNodes(rt, incident)
+	if err != nil {
+		return false, fmt.Errorf("error getting looping nodes: %w", err)
+	}
+
+	if len(nodeUUIDs) == 0 {
+		if err := incident.End(ctx, rt.DB); err != nil {
+			return false, fmt.Errorf("error ending incident: %w", err)
+		}
+		slog.Info("ended looping incident", "incident_id", incident.ID)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func getIncidentNodes(rt *runtime.Runtime, incident *models.Incident) ([]flows.NodeUUID, error) {
 	rc := rt.RP.Get()
 	defer rc.Close()
 
@@ -110,7 +136,7 @@ func getWebhookIncidentNodes(rt *runtime.Runtime, incident *models.Incident) ([]
 	return nodeUUIDs, nil
 }
 
-func removeWebhookIncidentNodes(rt *runtime.Runtime, incident *models.Incident, nodes []flows.NodeUUID) error {
+func removeIncidentNodes(rt *runtime.Runtime, incident *models.Incident, nodes []flows.NodeUUID) error {
 	rc := rt.RP.Get()
 	defer rc.Close()
 
@@ -77,6 +77,11 @@ func (t *StartIVRFlowBatchTask) Perform(ctx context.Context, rt *runtime.Runtime
 		slog.Debug("requested call for contact", "contact_id", contact.ID(), "status", session.Status(), "start_id", start.ID, "external_id", session.ExternalID())
 	}
 
+	// progress is only informational so don't fail the batch (and restart its contacts) if it can't be updated
+	if err := start.AddProgress(ctx, rt.DB, len(t.ContactIDs)); err != nil {
+		slog.Warn("error updating start progress", "start_id", start.ID, "error", err)
+	}
+
 	// if this is a last batch, mark our start as started
 	if t.IsLast {
 		if err := start.SetCompleted(ctx, rt.DB); err != nil {
@@ -0,0 +1,77 @@
+package msgs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/msgio"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// TypeFailBroadcastMessages is the type of the task to fail the unsent messages of a cancelled broadcast
+const TypeFailBroadcastMessages = "fail_broadcast_messages"
+
+// how many messages we fail in each update
+const failBroadcastMessagesBatchSize = 1000
+
+func init() {
+	tasks.RegisterType(TypeFailBroadcastMessages, func() tasks.Task { return &FailBroadcastMessagesTask{} })
+}
+
+// FailBroadcastMessagesTask is our task to fail messages of a broadcast which haven't been wired and remove them from
+// the courier queues.
+type FailBroadcastMessagesTask struct {
+	BroadcastID models.BroadcastID `json:"broadcast_id"`
+}
+
+func (t *FailBroadcastMessagesTask) Type() string {
+	return TypeFailBroadcastMessages
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *FailBroadcastMessagesTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+func (t *FailBroadcastMessagesTask) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+// Perform implements tasks.Task
+func (t *FailBroadcastMessagesTask) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	for {
+		failed, err := models.FailBroadcastMessages(ctx, rt.DB, oa.OrgID(), t.BroadcastID, models.MsgFailedCancelled, failBroadcastMessagesBatchSize)
+		if err != nil {
+			return fmt.Errorf("error failing broadcast messages: %w", err)
+		}
+
+		numFailed := 0
+
+		for channelID, msgIDs := range failed {
+			numFailed += len(msgIDs)
+
+			channel := oa.ChannelByID(channelID)
+			if channel == nil {
+				continue // no channel means msgs were never queued, or the channel's queues have already been cleared
+			}
+
+			if _, err := msgio.RemoveCourierMessages(rc, channel, msgIDs); err != nil {
+				// msgs are already failed so don't error, courier will just send them anyway
+				slog.Error("error removing broadcast messages from courier queues", "error", err, "channel_id", channelID, "broadcast_id", t.BroadcastID)
+			}
+		}
+
+		if numFailed < failBroadcastMessagesBatchSize {
+			break
+		}
+	}
+
+	return nil
+}
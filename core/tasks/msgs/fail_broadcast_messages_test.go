@@ -0,0 +1,43 @@
+package msgs_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/msgs"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailBroadcastMessages(t *testing.T) {
+	_, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	bcastID := testdata.InsertBroadcast(rt, testdata.Org1, "eng", map[i18n.Language]string{"eng": "Oops"}, nil, models.NilScheduleID, []*testdata.Contact{testdata.Cathy, testdata.Bob, testdata.George}, nil)
+	rt.DB.MustExec(`UPDATE msgs_broadcast SET status = 'I' WHERE id = $1`, bcastID)
+
+	insertBroadcastMsg := func(contact *testdata.Contact, status models.MsgStatus) {
+		m := testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, contact, "Oops", nil, status, false)
+		rt.DB.MustExec(`UPDATE msgs_msg SET broadcast_id = $2 WHERE id = $1`, m.ID, bcastID)
+	}
+
+	insertBroadcastMsg(testdata.Cathy, models.MsgStatusInitializing)
+	insertBroadcastMsg(testdata.Bob, models.MsgStatusQueued)
+	insertBroadcastMsg(testdata.George, models.MsgStatusWired)
+
+	// and a queued message which isn't part of the broadcast
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi", nil, models.MsgStatusQueued, false)
+
+	testsuite.QueueBatchTask(t, rt, testdata.Org1, &msgs.FailBroadcastMessagesTask{BroadcastID: bcastID})
+
+	taskCounts := testsuite.FlushTasks(t, rt)
+	assert.Equal(t, map[string]int{"fail_broadcast_messages": 1}, taskCounts)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND status = 'F' AND failed_reason = 'X'`, bcastID).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND status = 'W'`, bcastID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id IS NULL AND status = 'Q'`).Returns(1)
+}
@@ -37,7 +37,16 @@ func (c *RetryMessagesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[s
 		return nil, nil // nothing to retry
 	}
 
-	err = models.MarkMessagesQueued(ctx, rt.DB, msgs)
+	// initializing messages haven't been prepared, or failed to queue after being prepared, and become queued when
+	// they're prepared again, but errored messages have been prepared and can be marked as queued now
+	errored := make([]*models.Msg, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Status() != models.MsgStatusInitializing {
+			errored = append(errored, m)
+		}
+	}
+
+	err = models.MarkMessagesQueued(ctx, rt.DB, errored)
 	if err != nil {
 		return nil, fmt.Errorf("error marking messages as queued: %w", err)
 	}
@@ -5,11 +5,15 @@ import (
 	"time"
 
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/tasks/msgs"
+	_ "github.com/nyaruka/mailroom/services/filters/words"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRetryErroredMessages(t *testing.T) {
@@ -58,3 +62,43 @@ func TestRetryErroredMessages(t *testing.T) {
 		"msgs:19012bfd-3ce3-4cae-9bb9-76cf92c73d49|10/1": {1}, // vonage, high priority
 	})
 }
+
+func TestRetryUnpreparedMessages(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"content_filter": {"type": "words", "words": ["bad"], "action": "block"}}' WHERE id = $1`, testdata.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	channel := oa.ChannelByUUID(testdata.TwilioChannel.UUID)
+	_, cathy, _ := testdata.Cathy.Load(rt, oa)
+
+	out := flows.NewMsgOut(cathy.PreferredURN().URN(), assets.NewChannelReference(testdata.TwilioChannel.UUID, "Twilio"), &flows.MsgContent{Text: "this is bad"}, nil, flows.NilMsgTopic, "", flows.NilUnsendableReason)
+	msg, err := models.NewOutgoingChatMsg(rt, oa.Org(), channel, cathy, out, testdata.Admin.ID)
+	require.NoError(t, err)
+	require.NoError(t, models.InsertMessages(ctx, rt.DB, []*models.Msg{msg}))
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM msgs_msg WHERE id = $1`, msg.ID()).Returns("I")
+
+	// preparing fails because the transaction is already done, so the message is requeued without being prepared
+	tx := rt.DB.MustBegin()
+	require.NoError(t, tx.Rollback())
+	assert.Error(t, models.PrepareMessages(ctx, rt, oa, tx, []*models.Msg{msg}))
+	require.NoError(t, models.MarkMessagesForRequeuing(ctx, rt.DB, []*models.Msg{msg}))
+
+	rt.DB.MustExec(`UPDATE msgs_msg SET next_attempt = NOW() - INTERVAL '1 minute' WHERE id = $1`, msg.ID())
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM msgs_msg WHERE id = $1`, msg.ID()).Returns("I")
+
+	res, err := (&msgs.RetryMessagesCron{}).Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"retried": 1}, res)
+
+	// message is prepared when it's retried and so is still blocked by the content filter
+	assertdb.Query(t, rt.DB, `SELECT status, failed_reason FROM msgs_msg WHERE id = $1`, msg.ID()).Columns(map[string]any{"status": "F", "failed_reason": "B"})
+
+	testsuite.AssertCourierQueues(t, map[string][]int{})
+}
@@ -106,24 +106,25 @@ func createBroadcastBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 		q = tasks.HandlerQueue
 	}
 
-	rc := rt.RP.Get()
-	defer rc.Close()
+	// if broadcast is rate limited, batches are smaller if necessary and released at intervals
+	batchSize, batchInterval := tasks.BatchRateLimit(startBatchSize, bcast.ContactsPerMinute)
 
 	// create tasks for batches of contacts
-	idBatches := slices.Collect(slices.Chunk(contactIDs, startBatchSize))
+	idBatches := slices.Collect(slices.Chunk(contactIDs, batchSize))
+	batchTasks := make([]tasks.Task, len(idBatches))
+
 	for i, idBatch := range idBatches {
 		isFirst := (i == 0)
 		isLast := (i == len(idBatches)-1)
 
-		batch := bcast.CreateBatch(idBatch, isFirst, isLast)
-		err = tasks.Queue(rc, q, bcast.OrgID, &SendBroadcastBatchTask{BroadcastBatch: batch}, queues.DefaultPriority)
-		if err != nil {
-			if i == 0 {
-				return fmt.Errorf("error queuing broadcast batch: %w", err)
-			}
-			// if we've already queued other batches.. we don't want to error and have the task be retried
-			slog.Error("error queuing broadcast batch", "error", err)
-		}
+		batchTasks[i] = &SendBroadcastBatchTask{BroadcastBatch: bcast.CreateBatch(idBatch, isFirst, isLast)}
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := tasks.QueueBatches(rc, q, bcast.OrgID, batchTasks, queues.DefaultPriority, batchInterval); err != nil {
+		return fmt.Errorf("error queuing broadcast batch: %w", err)
 	}
 
 	return nil
@@ -67,6 +67,20 @@ func (t *SendBroadcastBatchTask) Perform(ctx context.Context, rt *runtime.Runtim
 		return fmt.Errorf("error creating broadcast messages: %w", err)
 	}
 
+	// broadcast may have been interrupted while we were creating messages, in which case fail them rather than queue them
+	if t.BroadcastID != models.NilBroadcastID {
+		status, err := models.GetBroadcastStatus(ctx, rt.DB, t.BroadcastID)
+		if err != nil {
+			return fmt.Errorf("error checking broadcast status: %w", err)
+		}
+		if status == models.BroadcastStatusInterrupted {
+			if err := models.MarkMessagesFailed(ctx, rt.DB, msgs, models.MsgFailedCancelled); err != nil {
+				return fmt.Errorf("error failing messages of interrupted broadcast: %w", err)
+			}
+			return nil
+		}
+	}
+
 	msgio.QueueMessages(ctx, rt, rt.DB, msgs)
 
 	// if this is our last batch, mark broadcast as done
@@ -17,6 +17,7 @@ import (
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 	"github.com/nyaruka/mailroom/utils/queues"
+	"github.com/nyaruka/redisx/assertredis"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -213,8 +214,10 @@ func TestSendBroadcastTask(t *testing.T) {
 		query           string
 		exclusions      models.Exclusions
 		createdByID     models.UserID
+		perMinute       int
 		queue           *queues.FairSorted
 		expectedBatches int
+		expectedDelayed int
 		expectedMsgs    map[string]int
 	}{
 		{
@@ -271,6 +274,20 @@ func TestSendBroadcastTask(t *testing.T) {
 			expectedBatches: 1,
 			expectedMsgs:    map[string]int{"goodbye": 1},
 		},
+		{
+			translations: flows.BroadcastTranslations{
+				"eng": {Text: "slowly"},
+			},
+			baseLanguage:    "eng",
+			expressions:     true,
+			query:           "name = Cathy OR name = George OR name = Bob",
+			exclusions:      models.NoExclusions,
+			perMinute:       1,
+			queue:           tasks.BatchQueue,
+			expectedBatches: 1,
+			expectedDelayed: 1,
+			expectedMsgs:    map[string]int{"slowly": 1},
+		},
 	}
 
 	lastNow := time.Now()
@@ -283,6 +300,7 @@ func TestSendBroadcastTask(t *testing.T) {
 		}
 
 		bcast := models.NewBroadcast(oa.OrgID(), tc.translations, tc.baseLanguage, tc.expressions, optInID, tc.groupIDs, tc.contactIDs, tc.URNs, tc.query, tc.exclusions, tc.createdByID)
+		bcast.ContactsPerMinute = tc.perMinute
 		err := models.InsertBroadcast(ctx, rt.DB, bcast)
 		assert.NoError(t, err)
 
@@ -295,6 +313,7 @@ func TestSendBroadcastTask(t *testing.T) {
 
 		// assert our count of batches
 		assert.Equal(t, tc.expectedBatches, taskCounts["send_broadcast_batch"], "%d: unexpected batch count", i)
+		assertredis.ZCard(t, rc, "tasks:throttled:delayed", tc.expectedDelayed, "%d: unexpected delayed batch count", i)
 
 		// assert our count of msgs created
 		actualMsgs := make(map[string]int)
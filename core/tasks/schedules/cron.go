@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/tasks"
 	"github.com/nyaruka/mailroom/core/tasks/msgs"
@@ -49,15 +50,16 @@ func (c *schedulesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[strin
 	broadcasts := 0
 	triggers := 0
 	noops := 0
+	skipped := 0
 
 	for _, s := range unfired {
 		log := log.With("schedule_id", s.ID)
 		now := time.Now()
 
-		// calculate our next fire
-		nextFire, err := s.GetNextFire(now)
+		// calculate which fires are due, which of those we're skipping, and our next fire
+		fires, skips, nextFire, err := s.GetDueFires(now)
 		if err != nil {
-			log.Error("error calculating next fire for schedule", "error", err)
+			log.Error("error calculating due fires for schedule", "error", err)
 			continue
 		}
 
@@ -68,43 +70,39 @@ func (c *schedulesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[strin
 			continue
 		}
 
-		var task tasks.Task
+		records := make([]*models.ScheduleFire, 0, len(fires)+len(skips))
+		for _, t := range skips {
+			records = append(records, models.NewScheduleFire(s, t, now, models.ScheduleFireOutcomeSkipped))
+		}
+
+		var toQueue []tasks.Task
+		var fireErr error
+		var failedFire time.Time
 
-		// if it is a broadcast
-		if s.Broadcast != nil {
-			log = log.With("broadcast_id", s.Broadcast.ID)
+		for _, t := range fires {
+			record := models.NewScheduleFire(s, t, now, models.ScheduleFireOutcomeFired)
 
-			// clone our broadcast, our schedule broadcast is just a template
-			bcast, err := models.InsertChildBroadcast(ctx, tx, s.Broadcast)
+			task, err := fireSchedule(ctx, tx, s, record)
 			if err != nil {
-				log.Error("error inserting new broadcast for schedule", "error", err)
-				tx.Rollback()
-				continue
+				fireErr, failedFire = err, t
+				break
 			}
 
-			// add our task to send this broadcast
-			task = &msgs.SendBroadcastTask{Broadcast: bcast}
-			broadcasts++
-
-		} else if s.Trigger != nil {
-			log = log.With("trigger_id", s.Trigger.ID())
+			if task != nil {
+				toQueue = append(toQueue, task)
+			}
+			records = append(records, record)
+		}
 
-			start := s.Trigger.CreateStart()
+		// next fire isn't advanced so we'll retry this fire next time, but only record the failure once
+		if fireErr != nil {
+			log.Error("error firing schedule", "error", fireErr)
+			tx.Rollback()
 
-			// insert our flow start
-			err := models.InsertFlowStarts(ctx, tx, []*models.FlowStart{start})
-			if err != nil {
-				log.Error("error inserting new flow start for schedule", "error", err)
-				tx.Rollback()
-				continue
+			if err := models.InsertScheduleFireFailed(ctx, rt.DB, s, failedFire, now); err != nil {
+				log.Error("error recording failed schedule fire", "error", err)
 			}
-
-			// add our flow start task
-			task = &starts.StartFlowTask{FlowStart: start}
-			triggers++
-		} else {
-			log.Error("schedule found with no associated active broadcast or trigger")
-			noops++
+			continue
 		}
 
 		if nextFire != nil {
@@ -133,8 +131,26 @@ func (c *schedulesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[strin
 			continue
 		}
 
-		// add our task if we have one
-		if task != nil {
+		// recording fires is outside of the transaction so that failing to record them doesn't stop the schedule firing
+		if err := models.InsertScheduleFires(ctx, rt.DB, records); err != nil {
+			log.Error("error recording schedule fires", "error", err)
+		}
+
+		for _, r := range records {
+			switch {
+			case r.Outcome == models.ScheduleFireOutcomeSkipped:
+				skipped++
+			case r.Outcome == models.ScheduleFireOutcomeNoop:
+				noops++
+			case r.BroadcastID != models.NilBroadcastID:
+				broadcasts++
+			case r.FlowStartID != models.NilStartID:
+				triggers++
+			}
+		}
+
+		// add our tasks
+		for _, task := range toQueue {
 			err = tasks.Queue(rc, tasks.BatchQueue, s.OrgID, task, queues.HighPriority)
 			if err != nil {
 				log.Error(fmt.Sprintf("error queueing %s task from schedule", task.Type()), "error", err)
@@ -142,5 +158,42 @@ func (c *schedulesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[strin
 		}
 	}
 
-	return map[string]any{"broadcasts": broadcasts, "triggers": triggers, "noops": noops}, nil
+	return map[string]any{"broadcasts": broadcasts, "triggers": triggers, "noops": noops, "skipped": skipped}, nil
+}
+
+// creates the broadcast or flow start for a single fire of the given schedule, updating the fire record with what was
+// created, and returns the task to queue (if any)
+func fireSchedule(ctx context.Context, tx *sqlx.Tx, s *models.Schedule, record *models.ScheduleFire) (tasks.Task, error) {
+	log := slog.With("comp", "schedules_cron", "schedule_id", s.ID)
+
+	// if it is a broadcast
+	if s.Broadcast != nil {
+		// clone our broadcast, our schedule broadcast is just a template
+		bcast, err := models.InsertChildBroadcast(ctx, tx, s.Broadcast)
+		if err != nil {
+			return nil, fmt.Errorf("error inserting new broadcast for schedule: %w", err)
+		}
+
+		record.BroadcastID = bcast.ID
+
+		// add our task to send this broadcast
+		return &msgs.SendBroadcastTask{Broadcast: bcast}, nil
+
+	} else if s.Trigger != nil {
+		start := s.Trigger.CreateStart()
+
+		// insert our flow start
+		if err := models.InsertFlowStarts(ctx, tx, []*models.FlowStart{start}); err != nil {
+			return nil, fmt.Errorf("error inserting new flow start for schedule: %w", err)
+		}
+
+		record.FlowStartID = start.ID
+
+		// add our flow start task
+		return &starts.StartFlowTask{FlowStart: start}, nil
+	}
+
+	log.Error("schedule found with no associated active broadcast or trigger")
+	record.Outcome = models.ScheduleFireOutcomeNoop
+	return nil, nil
 }
@@ -1,6 +1,7 @@
 package schedules
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -42,7 +43,7 @@ func TestCheckSchedules(t *testing.T) {
 	cron := &schedulesCron{}
 	res, err := cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"broadcasts": 2, "triggers": 2, "noops": 1}, res)
+	assert.Equal(t, map[string]any{"broadcasts": 2, "triggers": 2, "noops": 1, "skipped": 0}, res)
 
 	// should have 2 flow starts added to our DB ready to go
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowstart WHERE flow_id = $1 AND start_type = 'T' AND status = 'P'`, testdata.Favorites.ID).Returns(2)
@@ -83,3 +84,47 @@ func TestCheckSchedules(t *testing.T) {
 	// check the tasks created
 	testsuite.AssertBatchTasks(t, testdata.Org1.ID, map[string]int{"start_flow": 2, "send_broadcast": 2})
 }
+
+func TestCheckSchedulesCatchUp(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	// schedules which fire at noon every other day and have missed 4 fires, the last of which was yesterday
+	tz := testdata.Org1.Load(rt).Env().Timezone()
+	today := time.Now().In(tz)
+	start := time.Date(today.Year(), today.Month(), today.Day()-7, 12, 0, 0, 0, tz)
+	rule := fmt.Sprintf("DTSTART:%s\nRRULE:FREQ=DAILY;INTERVAL=2", start.Format("20060102T150405"))
+
+	insertSchedule := func(catchUp models.CatchUpPolicy, limit *int) models.ScheduleID {
+		s := testdata.InsertSchedule(rt, testdata.Org1, models.RepeatPeriodRule, start)
+		rt.DB.MustExec(`UPDATE schedules_schedule SET repeat_rule = $2, catch_up = $3, catch_up_limit = $4 WHERE id = $1`, s, rule, catchUp, limit)
+		testdata.InsertBroadcast(rt, testdata.Org1, "eng", map[i18n.Language]string{"eng": "Hi"}, nil, s, []*testdata.Contact{testdata.Cathy}, nil)
+		return s
+	}
+
+	limit := 2
+	s1 := insertSchedule(models.CatchUpPolicyOnce, nil)
+	s2 := insertSchedule(models.CatchUpPolicySkip, nil)
+	s3 := insertSchedule(models.CatchUpPolicyAll, &limit)
+
+	cron := &schedulesCron{}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"broadcasts": 3, "triggers": 0, "noops": 0, "skipped": 9}, res)
+
+	// all should have the same next fire of tomorrow
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedule WHERE next_fire = $1`, start.AddDate(0, 0, 8)).Returns(3)
+
+	// and have a log of fires
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedulefire WHERE schedule_id = $1 AND outcome = 'S'`, s1).Returns(3)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedulefire WHERE schedule_id = $1 AND outcome = 'F' AND scheduled_on = $2 AND broadcast_id IS NOT NULL`, s1, start.AddDate(0, 0, 6)).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedulefire WHERE schedule_id = $1 AND outcome = 'S'`, s2).Returns(4)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedulefire WHERE schedule_id = $1 AND outcome = 'F'`, s2).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedulefire WHERE schedule_id = $1 AND outcome = 'S'`, s3).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedulefire WHERE schedule_id = $1 AND outcome = 'F' AND scheduled_on >= $2`, s3, start.AddDate(0, 0, 4)).Returns(2)
+
+	testsuite.AssertBatchTasks(t, testdata.Org1.ID, map[string]int{"send_broadcast": 3})
+}
@@ -0,0 +1,61 @@
+package sessions
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+func init() {
+	tasks.RegisterCron("migrate_session_outputs", &MigrateOutputsCron{})
+}
+
+// MigrateOutputsCron moves the outputs of waiting sessions between the database and session storage, a limited number
+// of sessions per run so as not to overload either.
+type MigrateOutputsCron struct{}
+
+func (c *MigrateOutputsCron) Next(last time.Time) time.Time {
+	return tasks.CronNext(last, time.Minute)
+}
+
+func (c *MigrateOutputsCron) AllInstances() bool {
+	return false
+}
+
+func (c *MigrateOutputsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	m, err := models.GetSessionMigration(rc)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || m.CompletedOn != nil {
+		return nil, nil
+	}
+
+	migrated, failed := m.Migrated, m.Failed
+	processed := 0
+
+	for processed < m.MaxPerRun {
+		n, err := m.MigrateBatch(ctx, rt)
+		if err != nil {
+			return nil, err
+		}
+
+		// save after every batch so that we can resume from here if interrupted
+		if err := m.Save(rc); err != nil {
+			return nil, err
+		}
+
+		if n == 0 {
+			break
+		}
+		processed += n
+	}
+
+	return map[string]any{"migrated": m.Migrated - migrated, "failed": m.Failed - failed}, nil
+}
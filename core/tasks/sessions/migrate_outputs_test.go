@@ -0,0 +1,124 @@
+package sessions_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/sessions"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateOutputsCron(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis | testsuite.ResetStorage)
+	defer func() { rt.Config.SessionStorage = "db" }()
+
+	rt.Config.SessionStorage = "fs"
+
+	for _, c := range []*testdata.Contact{testdata.Cathy, testdata.Bob, testdata.George} {
+		testdata.InsertWaitingSession(rt, testdata.Org1, c, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), false, nil)
+	}
+
+	cron := &sessions.MigrateOutputsCron{}
+
+	// no migration started
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	_, err = models.StartSessionMigration(rc, models.SessionMigrationToStorage, 2, 2)
+	require.NoError(t, err)
+
+	// first run is throttled to 2 sessions
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"migrated": 2, "failed": 0}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowsession WHERE output IS NULL AND output_url LIKE 'file://%'`).Returns(2)
+
+	m, err := models.GetSessionMigration(rc)
+	require.NoError(t, err)
+	assert.Nil(t, m.CompletedOn)
+
+	remaining, err := m.Remaining(ctx, rt.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, remaining)
+
+	// second run resumes from where we left off and completes the migration
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"migrated": 1, "failed": 0}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowsession WHERE output IS NULL AND output_url LIKE 'file://%'`).Returns(3)
+
+	m, err = models.GetSessionMigration(rc)
+	require.NoError(t, err)
+	assert.NotNil(t, m.CompletedOn)
+	assert.Equal(t, 3, m.Migrated)
+
+	// completed migrations are a noop
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	// now migrate them all back
+	rt.Config.SessionStorage = "db"
+
+	_, err = models.StartSessionMigration(rc, models.SessionMigrationToDB, 100, 1000)
+	require.NoError(t, err)
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"migrated": 3, "failed": 0}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowsession WHERE output = '{"status":"waiting"}' AND output_url IS NULL`).Returns(3)
+}
+
+func TestMigrateOutputsCronSkipsUndecodable(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis | testsuite.ResetStorage)
+	defer func() { rt.Config.SessionStorage = "db" }()
+
+	rt.Config.SessionStorage = "fs"
+
+	testdata.InsertWaitingSession(rt, testdata.Org1, testdata.Cathy, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), false, nil)
+	bobSessionID := testdata.InsertWaitingSession(rt, testdata.Org1, testdata.Bob, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), false, nil)
+	testdata.InsertWaitingSession(rt, testdata.Org1, testdata.George, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), false, nil)
+
+	rt.DB.MustExec(`UPDATE flows_flowsession SET output = 'garbage' WHERE id = $1`, bobSessionID)
+
+	_, err := models.StartSessionMigration(rc, models.SessionMigrationToStorage, 2, 2)
+	require.NoError(t, err)
+
+	cron := &sessions.MigrateOutputsCron{}
+
+	// the undecodable session is counted as failed but the rest of the batch is still migrated
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"migrated": 1, "failed": 1}, res)
+
+	// and the migration moves on past it
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"migrated": 1, "failed": 0}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowsession WHERE output IS NULL AND output_url LIKE 'file://%'`).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT output FROM flows_flowsession WHERE id = $1`, bobSessionID).Returns("garbage")
+
+	m, err := models.GetSessionMigration(rc)
+	require.NoError(t, err)
+	assert.NotNil(t, m.CompletedOn)
+	assert.Equal(t, 2, m.Migrated)
+	assert.Equal(t, 1, m.Failed)
+}
@@ -3,7 +3,6 @@ package starts
 import (
 	"context"
 	"fmt"
-	"log/slog"
 	"slices"
 	"time"
 
@@ -116,11 +115,12 @@ func createFlowStartBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 		q = tasks.HandlerQueue
 	}
 
-	// split the contact ids into batches to become batch tasks
-	idBatches := slices.Collect(slices.Chunk(contactIDs, startBatchSize))
+	// if start is rate limited, batches are smaller if necessary and released at intervals
+	batchSize, batchInterval := tasks.BatchRateLimit(startBatchSize, start.ContactsPerMinute)
 
-	rc := rt.RP.Get()
-	defer rc.Close()
+	// split the contact ids into batches to become batch tasks
+	idBatches := slices.Collect(slices.Chunk(contactIDs, batchSize))
+	batchTasks := make([]tasks.Task, len(idBatches))
 
 	for i, idBatch := range idBatches {
 		isFirst := (i == 0)
@@ -129,21 +129,18 @@ func createFlowStartBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 		batch := start.CreateBatch(idBatch, isFirst, isLast, len(contactIDs))
 
 		// task is different if we are an IVR flow
-		var batchTask tasks.Task
 		if flow.FlowType() == models.FlowTypeVoice {
-			batchTask = &ivr.StartIVRFlowBatchTask{FlowStartBatch: batch}
+			batchTasks[i] = &ivr.StartIVRFlowBatchTask{FlowStartBatch: batch}
 		} else {
-			batchTask = &StartFlowBatchTask{FlowStartBatch: batch}
+			batchTasks[i] = &StartFlowBatchTask{FlowStartBatch: batch}
 		}
+	}
 
-		err = tasks.Queue(rc, q, start.OrgID, batchTask, queues.DefaultPriority)
-		if err != nil {
-			if i == 0 {
-				return fmt.Errorf("error queuing flow start batch: %w", err)
-			}
-			// if we've already queued other batches.. we don't want to error and have the task be retried
-			slog.Error("error queuing flow start batch", "error", err)
-		}
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := tasks.QueueBatches(rc, q, start.OrgID, batchTasks, queues.DefaultPriority, batchInterval); err != nil {
+		return fmt.Errorf("error queuing flow start batch: %w", err)
 	}
 
 	return nil
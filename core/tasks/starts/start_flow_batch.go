@@ -3,6 +3,7 @@ package starts
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/nyaruka/mailroom/core/models"
@@ -67,6 +68,11 @@ func (t *StartFlowBatchTask) Perform(ctx context.Context, rt *runtime.Runtime, o
 		return fmt.Errorf("error starting flow batch: %w", err)
 	}
 
+	// progress is only informational so don't fail the batch (and restart its contacts) if it can't be updated
+	if err := start.AddProgress(ctx, rt.DB, len(t.ContactIDs)); err != nil {
+		slog.Warn("error updating start progress", "start_id", start.ID, "error", err)
+	}
+
 	// if this is our last batch, mark start as done
 	if t.IsLast {
 		if err := start.SetCompleted(ctx, rt.DB); err != nil {
@@ -52,6 +52,7 @@ func TestStartFlowBatchTask(t *testing.T) {
 		Returns(2)
 
 	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowstart WHERE id = $1`, start1.ID).Returns("S")
+	assertdb.Query(t, rt.DB, `SELECT progress FROM flows_flowstart WHERE id = $1`, start1.ID).Returns(2)
 
 	// start the second and final batch...
 	err = tasks.Queue(rc, tasks.ThrottledQueue, testdata.Org1.ID, &starts.StartFlowBatchTask{FlowStartBatch: batch2}, queues.DefaultPriority)
@@ -60,6 +61,7 @@ func TestStartFlowBatchTask(t *testing.T) {
 
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowrun WHERE start_id = $1`, start1.ID).Returns(4)
 	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowstart WHERE id = $1`, start1.ID).Returns("C")
+	assertdb.Query(t, rt.DB, `SELECT progress FROM flows_flowstart WHERE id = $1`, start1.ID).Returns(4)
 
 	// create a second start
 	start2 := models.NewFlowStart(models.OrgID(1), models.StartTypeManual, testdata.SingleMessage.ID).
@@ -78,7 +80,14 @@ func TestStartFlowBatchTask(t *testing.T) {
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowrun WHERE start_id = $1`, start2.ID).Returns(2)
 
 	// interrupt the start
-	rt.DB.MustExec(`UPDATE flows_flowstart SET status = 'I' WHERE id = $1`, start2.ID)
+	interrupted, err := models.InterruptFlowStart(ctx, rt.DB, testdata.Org1.ID, start2.ID)
+	assert.NoError(t, err)
+	assert.True(t, interrupted)
+
+	// can't interrupt it again
+	interrupted, err = models.InterruptFlowStart(ctx, rt.DB, testdata.Org1.ID, start2.ID)
+	assert.NoError(t, err)
+	assert.False(t, interrupted)
 
 	// start the second batch...
 	err = tasks.Queue(rc, tasks.ThrottledQueue, testdata.Org1.ID, &starts.StartFlowBatchTask{FlowStartBatch: start2Batch2}, queues.DefaultPriority)
@@ -88,6 +97,7 @@ func TestStartFlowBatchTask(t *testing.T) {
 	// check that second batch didn't create any runs and start status is still interrupted
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowrun WHERE start_id = $1`, start2.ID).Returns(2)
 	assertdb.Query(t, rt.DB, `SELECT status FROM flows_flowstart WHERE id = $1`, start2.ID).Returns("I")
+	assertdb.Query(t, rt.DB, `SELECT progress FROM flows_flowstart WHERE id = $1`, start2.ID).Returns(2)
 }
 
 func TestStartFlowBatchTaskNonPersistedStart(t *testing.T) {
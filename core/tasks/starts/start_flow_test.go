@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	_ "github.com/nyaruka/mailroom/core/handlers"
 	"github.com/nyaruka/mailroom/core/models"
@@ -272,3 +273,37 @@ func TestStartFlowTaskNonPersistedStart(t *testing.T) {
 
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowrun`).Returns(2)
 }
+
+func TestStartFlowTaskRateLimited(t *testing.T) {
+	_, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer dates.SetNowFunc(time.Now)
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	// a start of 4 contacts at 2 contacts per minute should be split into 2 batches released a minute apart
+	start := models.NewFlowStart(models.OrgID(1), models.StartTypeManual, testdata.SingleMessage.ID).
+		WithContactIDs([]models.ContactID{testdata.Cathy.ID, testdata.Bob.ID, testdata.George.ID, testdata.Alexandria.ID}).
+		WithContactsPerMinute(2)
+
+	err := tasks.Queue(rc, tasks.ThrottledQueue, testdata.Org1.ID, &starts.StartFlowTask{FlowStart: start}, queues.DefaultPriority)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]int{"start_flow": 1, "start_flow_batch": 1}, testsuite.FlushTasks(t, rt))
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowrun`).Returns(2)
+
+	// second batch isn't released until a minute later
+	released, err := tasks.ThrottledQueue.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Now().Add(time.Minute)))
+
+	released, err = tasks.ThrottledQueue.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	assert.Equal(t, map[string]int{"start_flow_batch": 1}, testsuite.FlushTasks(t, rt))
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowrun`).Returns(4)
+}
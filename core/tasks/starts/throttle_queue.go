@@ -11,10 +11,6 @@ import (
 	"github.com/nyaruka/mailroom/utils/queues"
 )
 
-const (
-	outboxThreshold = 10_000
-)
-
 func init() {
 	tasks.RegisterCron("throttle_queue", &ThrottleQueueCron{Queue: tasks.ThrottledQueue})
 }
@@ -31,11 +27,17 @@ func (c *ThrottleQueueCron) AllInstances() bool {
 	return false
 }
 
-// Run throttles processing of starts based on that org's current outbox size
+// Run releases any rate limited batches which are now due and throttles processing of starts based on each org's
+// current outbox size
 func (c *ThrottleQueueCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
 	rc := rt.RP.Get()
 	defer rc.Close()
 
+	numReleased, err := c.Queue.Release(rc)
+	if err != nil {
+		return nil, fmt.Errorf("error releasing delayed tasks: %w", err)
+	}
+
 	owners, err := c.Queue.Owners(rc)
 	if err != nil {
 		return nil, fmt.Errorf("error getting task owners: %w", err)
@@ -49,7 +51,7 @@ func (c *ThrottleQueueCron) Run(ctx context.Context, rt *runtime.Runtime) (map[s
 			return nil, fmt.Errorf("error org assets for org #%d: %w", ownerID, err)
 		}
 
-		if oa.Org().OutboxCount() >= outboxThreshold {
+		if oa.Org().OutboxCount() >= oa.Org().OutboxThreshold() {
 			c.Queue.Pause(rc, ownerID)
 			numPaused++
 		} else {
@@ -58,5 +60,5 @@ func (c *ThrottleQueueCron) Run(ctx context.Context, rt *runtime.Runtime) (map[s
 		}
 	}
 
-	return map[string]any{"paused": numPaused, "resumed": numResumed}, nil
+	return map[string]any{"released": numReleased, "paused": numPaused, "resumed": numResumed}, nil
 }
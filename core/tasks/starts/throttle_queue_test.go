@@ -2,6 +2,7 @@ package starts_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/tasks/starts"
@@ -22,13 +23,13 @@ func TestThrottleQueue(t *testing.T) {
 	cron := &starts.ThrottleQueueCron{Queue: queue}
 	res, err := cron.Run(ctx, rt)
 	require.NoError(t, err)
-	assert.Equal(t, map[string]any{"paused": 0, "resumed": 0}, res)
+	assert.Equal(t, map[string]any{"released": 0, "paused": 0, "resumed": 0}, res)
 
 	queue.Push(rc, "type1", 1, "task1", queues.DefaultPriority)
 
 	res, err = cron.Run(ctx, rt)
 	require.NoError(t, err)
-	assert.Equal(t, map[string]any{"paused": 0, "resumed": 1}, res)
+	assert.Equal(t, map[string]any{"released": 0, "paused": 0, "resumed": 1}, res)
 
 	// make it look like org 1 has 20,000 messages in its outbox
 	rt.DB.MustExec(`INSERT INTO msgs_systemlabelcount(org_id, label_type, count, is_squashed) VALUES (1, 'O', 10050, FALSE)`)
@@ -37,7 +38,7 @@ func TestThrottleQueue(t *testing.T) {
 
 	res, err = cron.Run(ctx, rt)
 	require.NoError(t, err)
-	assert.Equal(t, map[string]any{"paused": 1, "resumed": 0}, res)
+	assert.Equal(t, map[string]any{"released": 0, "paused": 1, "resumed": 0}, res)
 
 	// make it look like most of the inbox has cleared
 	rt.DB.MustExec(`INSERT INTO msgs_systemlabelcount(org_id, label_type, count, is_squashed) VALUES (1, 'O', -10000, FALSE)`)
@@ -46,5 +47,30 @@ func TestThrottleQueue(t *testing.T) {
 
 	res, err = cron.Run(ctx, rt)
 	require.NoError(t, err)
-	assert.Equal(t, map[string]any{"paused": 0, "resumed": 1}, res)
+	assert.Equal(t, map[string]any{"released": 0, "paused": 0, "resumed": 1}, res)
+
+	// org can lower its threshold
+	rt.DB.MustExec(`UPDATE orgs_org SET config = COALESCE(config, '{}') || '{"outbox_threshold": 25}' WHERE id = 1`)
+
+	models.FlushCache()
+
+	res, err = cron.Run(ctx, rt)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"released": 0, "paused": 1, "resumed": 0}, res)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config - 'outbox_threshold' WHERE id = 1`)
+
+	models.FlushCache()
+
+	// delayed tasks are released once due
+	queue.PushAt(rc, "type1", 1, "task2", queues.DefaultPriority, time.Now().Add(-time.Second))
+	queue.PushAt(rc, "type1", 1, "task3", queues.DefaultPriority, time.Now().Add(time.Hour))
+
+	res, err = cron.Run(ctx, rt)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"released": 1, "paused": 0, "resumed": 1}, res)
+
+	size, err := queue.Size(rc)
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -61,6 +62,44 @@ func Queue(rc redis.Conn, q *queues.FairSorted, orgID models.OrgID, task Task, p
 	return q.Push(rc, task.Type(), int(orgID), task, priority)
 }
 
+// QueueBatches adds the given batch tasks to the given queue. If interval is non-zero then only the first batch is
+// queued for immediate processing and each of the rest is released the interval after the previous one was released.
+func QueueBatches(rc redis.Conn, q *queues.FairSorted, orgID models.OrgID, batches []Task, priority queues.Priority, interval time.Duration) error {
+	for i, batch := range batches {
+		if interval > 0 && i > 0 {
+			rest := make([]any, 0, len(batches)-i)
+			for _, b := range batches[i:] {
+				rest = append(rest, b)
+			}
+
+			if err := q.PushSequence(rc, batch.Type(), int(orgID), rest, priority, interval); err != nil {
+				slog.Error("error queuing rate limited batches", "error", err)
+			}
+			return nil
+		}
+
+		if err := Queue(rc, q, orgID, batch, priority); err != nil {
+			if i == 0 {
+				return err
+			}
+			// if we've already queued other batches.. we don't want to error and have the task be retried
+			slog.Error("error queuing batch", "error", err)
+		}
+	}
+	return nil
+}
+
+// BatchRateLimit returns the size of batches and the interval between them needed to process contacts at the given
+// rate per minute. If there's no rate limit, batches are the given max size and there's no interval.
+func BatchRateLimit(maxSize, contactsPerMinute int) (int, time.Duration) {
+	if contactsPerMinute <= 0 {
+		return maxSize, 0
+	}
+
+	size := min(maxSize, contactsPerMinute)
+	return size, time.Duration(size) * time.Minute / time.Duration(contactsPerMinute)
+}
+
 //------------------------------------------------------------------------------------------
 // JSON Encoding / Decoding
 //------------------------------------------------------------------------------------------
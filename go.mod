@@ -20,6 +20,7 @@ require (
 	github.com/gomodule/redigo v1.9.2
 	github.com/gorilla/schema v1.4.1
 	github.com/jmoiron/sqlx v1.4.0
+	github.com/klauspost/compress v1.17.7
 	github.com/lib/pq v1.10.9
 	github.com/nyaruka/ezconf v0.3.0
 	github.com/nyaruka/gocommon v1.59.1
@@ -34,6 +35,7 @@ require (
 	github.com/samber/slog-sentry v1.2.2
 	github.com/shopspring/decimal v1.4.0
 	github.com/stretchr/testify v1.9.0
+	github.com/teambition/rrule-go v1.8.2
 	google.golang.org/api v0.197.0
 )
 
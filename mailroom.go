@@ -14,6 +14,7 @@ import (
 	"github.com/nyaruka/gocommon/analytics"
 	"github.com/nyaruka/gocommon/aws/dynamo"
 	"github.com/nyaruka/gocommon/aws/s3x"
+	"github.com/nyaruka/mailroom/core/search"
 	"github.com/nyaruka/mailroom/core/tasks"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/nyaruka/mailroom/web"
@@ -124,12 +125,16 @@ func (mr *Mailroom) Start() error {
 		log.Info("sessions bucket ok")
 	}
 
-	// initialize our elastic client
-	mr.rt.ES, err = elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{c.Elastic}, Username: c.ElasticUsername, Password: c.ElasticPassword})
-	if err != nil {
-		log.Error("elastic search not available", "error", err)
+	// initialize our elastic client if that's where we search contacts
+	if c.SearchBackend == search.BackendPostgres {
+		log.Info("using postgres for contact searches")
 	} else {
-		log.Info("elastic ok")
+		mr.rt.ES, err = elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{c.Elastic}, Username: c.ElasticUsername, Password: c.ElasticPassword})
+		if err != nil {
+			log.Error("elastic search not available", "error", err)
+		} else {
+			log.Info("elastic ok")
+		}
 	}
 
 	// if we have a librato token, configure it
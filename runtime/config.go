@@ -17,7 +17,9 @@ import (
 )
 
 func init() {
-	utils.RegisterValidatorAlias("session_storage", "eq=db|eq=s3", func(e validator.FieldError) string { return "is not a valid session storage mode" })
+	utils.RegisterValidatorAlias("session_storage", "eq=db|eq=s3|eq=fs", func(e validator.FieldError) string { return "is not a valid session storage mode" })
+	utils.RegisterValidatorAlias("search_backend", "eq=elastic|eq=postgres", func(e validator.FieldError) string { return "is not a valid search backend" })
+	utils.RegisterValidatorAlias("session_compression", "eq=none|eq=gzip|eq=zstd", func(e validator.FieldError) string { return "is not a valid session compression method" })
 }
 
 // Config is our top level configuration object
@@ -50,8 +52,13 @@ type Config struct {
 	MaxStepsPerSprint    int    `help:"the maximum number of steps allowed per engine sprint"`
 	MaxResumesPerSession int    `help:"the maximum number of resumes allowed per engine session"`
 	MaxValueLength       int    `help:"the maximum size in characters for contact field values and run result values"`
-	SessionStorage       string `validate:"omitempty,session_storage"         help:"where to store session output (s3|db)"`
+	SessionStorage       string `validate:"omitempty,session_storage"         help:"where to store session output (s3|db|fs)"`
+	SessionStoragePath   string `help:"the directory to store session output in when using fs storage"`
+	SessionCompression   string `validate:"omitempty,session_compression"     help:"how to compress session output (none|gzip|zstd)"`
 
+	SearchBackend        string `validate:"omitempty,search_backend" help:"the backend to use for contact searches (elastic|postgres)"`
+	SearchCacheTTL       int    `help:"the number of seconds to cache contact search counts and pages for, 0 (the default) to disable"`
+	SearchEstimateAbove  int    `help:"the count above which contact totals for previews are estimated rather than counted, 0 (the default) to always count"`
 	Elastic              string `validate:"url" help:"the URL of your ElasticSearch instance"`
 	ElasticUsername      string `help:"the username for ElasticSearch if using basic auth"`
 	ElasticPassword      string `help:"the password for ElasticSearch if using basic auth"`
@@ -67,8 +74,12 @@ type Config struct {
 	S3Endpoint          string `help:"S3 service endpoint, e.g. https://s3.amazonaws.com"`
 	S3AttachmentsBucket string `help:"S3 bucket to write attachments to"`
 	S3SessionsBucket    string `help:"S3 bucket to write flow sessions to"`
+	S3ExportsBucket     string `help:"S3 bucket to write contact exports to"`
 	S3Minio             bool   `help:"S3 is actually Minio or other compatible service"`
 
+	PrepareAttachments bool `help:"whether to validate outgoing attachments against channel media limits and convert them where possible"`
+	ScheduleRules      bool `help:"whether schedules can repeat by iCalendar rule, which needs RapidPro to support the R repeat period"`
+
 	CourierAuthToken string `help:"the authentication token used for requests to Courier"`
 	LibratoUsername  string `help:"the username that will be used to authenticate to Librato"`
 	LibratoToken     string `help:"the token that will be used to authenticate to Librato"`
@@ -111,7 +122,12 @@ func NewDefaultConfig() *Config {
 		MaxResumesPerSession: 250,
 		MaxValueLength:       640,
 		SessionStorage:       "db",
+		SessionStoragePath:   "_storage/sessions",
+		SessionCompression:   "none",
 
+		SearchBackend:        "elastic",
+		SearchCacheTTL:       0,
+		SearchEstimateAbove:  0,
 		Elastic:              "http://localhost:9200",
 		ElasticUsername:      "",
 		ElasticPassword:      "",
@@ -127,6 +143,7 @@ func NewDefaultConfig() *Config {
 		S3Endpoint:          "https://s3.amazonaws.com",
 		S3AttachmentsBucket: "temba-attachments",
 		S3SessionsBucket:    "temba-sessions",
+		S3ExportsBucket:     "temba-exports",
 
 		InstanceID: hostname,
 		LogLevel:   slog.LevelWarn,
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+)
+
+const (
+	// TypeWebhook is the type of our webhook content filter
+	TypeWebhook = "webhook"
+
+	urlConfig   = "url"
+	tokenConfig = "token"
+)
+
+func init() {
+	models.RegisterContentFilterType(TypeWebhook, New)
+}
+
+// Filter is a content filter which asks an external service to make decisions about messages
+type Filter struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+// New creates a new webhook content filter from the given org config
+func New(config map[string]any) (models.ContentFilter, error) {
+	url, _ := config[urlConfig].(string)
+	if url == "" {
+		return nil, errors.New("missing url")
+	}
+	token, _ := config[tokenConfig].(string)
+
+	return &Filter{httpClient: http.DefaultClient, url: url, token: token}, nil
+}
+
+type filterRequest struct {
+	Direction models.MsgDirection `json:"direction"`
+	Text      string              `json:"text"`
+}
+
+type filterResponse struct {
+	Action models.ContentFilterAction `json:"action"`
+	Reason string                     `json:"reason"`
+	Text   string                     `json:"text"`
+	Labels []assets.LabelUUID         `json:"labels"`
+}
+
+// Filter posts the given text to our URL and reads the decision from the response
+func (f *Filter) Filter(ctx context.Context, direction models.MsgDirection, text string) (*models.ContentFilterDecision, error) {
+	body := jsonx.MustMarshal(&filterRequest{Direction: direction, Text: text})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating content filter request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.token != "" {
+		req.Header.Set("Authorization", "Token "+f.token)
+	}
+
+	trace, err := httpx.DoTrace(f.httpClient, req, nil, nil, -1)
+	if err != nil {
+		return nil, fmt.Errorf("error calling content filter: %w", err)
+	}
+	if trace.Response.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("content filter returned non-2XX status: %d", trace.Response.StatusCode)
+	}
+
+	resp := &filterResponse{}
+	if err := jsonx.Unmarshal(trace.ResponseBody, resp); err != nil {
+		return nil, fmt.Errorf("error unmarshalling content filter response: %w", err)
+	}
+
+	switch resp.Action {
+	case models.ContentFilterActionAllow, models.ContentFilterActionFlag, models.ContentFilterActionBlock:
+	case models.ContentFilterActionRedact:
+		if resp.Text == "" {
+			return nil, errors.New("content filter redacted without replacement text")
+		}
+	default:
+		return nil, fmt.Errorf("content filter returned invalid action: %s", resp.Action)
+	}
+
+	return &models.ContentFilterDecision{Action: resp.Action, Reason: resp.Reason, Text: resp.Text, Labels: resp.Labels}, nil
+}
@@ -0,0 +1,59 @@
+package webhook_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/services/filters/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://filter.example.com/check": {
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "allow"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "flag", "reason": "rude", "labels": ["ebc4dedc-91c4-4ed4-9dd6-daa05ea82698"]}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "redact", "text": "what the ****"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "redact"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "explode"}`)),
+			httpx.NewMockResponse(503, nil, []byte(`unavailable`)),
+		},
+	}))
+
+	_, err := webhook.New(map[string]any{"type": "webhook"})
+	assert.EqualError(t, err, "missing url")
+
+	f, err := webhook.New(map[string]any{"type": "webhook", "url": "https://filter.example.com/check", "token": "sesame"})
+	require.NoError(t, err)
+
+	d, err := f.Filter(ctx, models.DirectionIn, "Hello")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContentFilterActionAllow, d.Action)
+
+	d, err = f.Filter(ctx, models.DirectionIn, "You're a jerk")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContentFilterActionFlag, d.Action)
+	assert.Equal(t, "rude", d.Reason)
+	assert.Equal(t, []assets.LabelUUID{"ebc4dedc-91c4-4ed4-9dd6-daa05ea82698"}, d.Labels)
+
+	d, err = f.Filter(ctx, models.DirectionOut, "what the heck")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContentFilterActionRedact, d.Action)
+	assert.Equal(t, "what the ****", d.Text)
+
+	_, err = f.Filter(ctx, models.DirectionOut, "what the heck")
+	assert.EqualError(t, err, "content filter redacted without replacement text")
+
+	_, err = f.Filter(ctx, models.DirectionOut, "what the heck")
+	assert.EqualError(t, err, "content filter returned invalid action: explode")
+
+	_, err = f.Filter(ctx, models.DirectionOut, "what the heck")
+	assert.EqualError(t, err, "content filter returned non-2XX status: 503")
+}
@@ -0,0 +1,80 @@
+package words
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+)
+
+const (
+	// TypeWords is the type of our word list content filter
+	TypeWords = "words"
+
+	wordsConfig  = "words"
+	actionConfig = "action"
+	labelConfig  = "label_uuid"
+)
+
+func init() {
+	models.RegisterContentFilterType(TypeWords, New)
+}
+
+// Filter is a content filter which matches messages against a list of words
+type Filter struct {
+	pattern *regexp.Regexp
+	action  models.ContentFilterAction
+	label   assets.LabelUUID
+}
+
+// New creates a new word list content filter from the given org config
+func New(config map[string]any) (models.ContentFilter, error) {
+	rawWords, _ := config[wordsConfig].([]any)
+	quoted := make([]string, 0, len(rawWords))
+	for _, w := range rawWords {
+		if s, ok := w.(string); ok && strings.TrimSpace(s) != "" {
+			quoted = append(quoted, regexp.QuoteMeta(strings.TrimSpace(s)))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil, errors.New("missing or empty words list")
+	}
+
+	action := models.ContentFilterActionFlag
+	if a, _ := config[actionConfig].(string); a != "" {
+		action = models.ContentFilterAction(a)
+	}
+	if action != models.ContentFilterActionFlag && action != models.ContentFilterActionRedact && action != models.ContentFilterActionBlock {
+		return nil, errors.New("invalid action: " + string(action))
+	}
+
+	label, _ := config[labelConfig].(string)
+
+	return &Filter{
+		pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`),
+		action:  action,
+		label:   assets.LabelUUID(label),
+	}, nil
+}
+
+// Filter checks the given text against our word list
+func (f *Filter) Filter(ctx context.Context, direction models.MsgDirection, text string) (*models.ContentFilterDecision, error) {
+	matches := f.pattern.FindAllString(text, -1)
+	if len(matches) == 0 {
+		return &models.ContentFilterDecision{Action: models.ContentFilterActionAllow}, nil
+	}
+
+	decision := &models.ContentFilterDecision{Action: f.action, Reason: "matched: " + strings.ToLower(matches[0])}
+
+	if f.action == models.ContentFilterActionRedact {
+		decision.Text = f.pattern.ReplaceAllStringFunc(text, func(s string) string { return strings.Repeat("*", len([]rune(s))) })
+	}
+	if f.label != "" {
+		decision.Labels = []assets.LabelUUID{f.label}
+	}
+
+	return decision, nil
+}
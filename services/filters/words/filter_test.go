@@ -0,0 +1,50 @@
+package words_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/services/filters/words"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := words.New(map[string]any{"type": "words"})
+	assert.EqualError(t, err, "missing or empty words list")
+
+	_, err = words.New(map[string]any{"type": "words", "words": []any{"darn"}, "action": "explode"})
+	assert.EqualError(t, err, "invalid action: explode")
+
+	// default action is to flag
+	f, err := words.New(map[string]any{"type": "words", "words": []any{"darn", "heck"}, "label_uuid": "ebc4dedc-91c4-4ed4-9dd6-daa05ea82698"})
+	require.NoError(t, err)
+
+	d, err := f.Filter(ctx, models.DirectionIn, "Hello there")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContentFilterActionAllow, d.Action)
+
+	d, err = f.Filter(ctx, models.DirectionIn, "What the HECK")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContentFilterActionFlag, d.Action)
+	assert.Equal(t, "matched: heck", d.Reason)
+	assert.Equal(t, []assets.LabelUUID{"ebc4dedc-91c4-4ed4-9dd6-daa05ea82698"}, d.Labels)
+
+	// words must match whole words
+	d, err = f.Filter(ctx, models.DirectionIn, "Checking in")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContentFilterActionAllow, d.Action)
+
+	f, err = words.New(map[string]any{"type": "words", "words": []any{"darn", "heck"}, "action": "redact"})
+	require.NoError(t, err)
+
+	d, err = f.Filter(ctx, models.DirectionOut, "Darn it, what the heck")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContentFilterActionRedact, d.Action)
+	assert.Equal(t, "**** it, what the ****", d.Text)
+	assert.Nil(t, d.Labels)
+}
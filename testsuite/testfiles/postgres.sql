@@ -0,0 +1,53 @@
+-- Columns and tables which mailroom uses but which don't exist in RapidPro's schema (and so aren't in postgres.dump)
+-- until RapidPro's matching migrations land and the dump is regenerated. This file is applied after the dump is
+-- restored so that the features which use them can be tested, but it is NOT a copy of any RapidPro migration.
+--
+-- Mailroom still works against a database without these. Columns are read through to_jsonb(row) and only written when
+-- the feature which needs them is used, and start progress and schedule fires are only recorded on a best-effort basis:
+--
+--   campaigns_campaignevent.recurrence           - yearly/monthly recurring campaign events
+--   campaigns_campaignevent.delivery_window      - delivery windows on campaign events
+--   campaigns_campaign.max_fires_per_minute      - campaign fire throttling
+--   campaigns_campaign.spread_minutes            - campaign fire spreading
+--   flows_flowstart.progress                     - flow start progress tracking
+--   flows_flowstart.contacts_per_minute          - flow start rate limiting
+--   msgs_broadcast.contacts_per_minute           - broadcast rate limiting
+--   msgs_broadcast.variants                      - broadcast variants
+--   schedules_schedule.repeat_rule               - iCalendar recurrence rules on schedules
+--   schedules_schedule.catch_up                  - catch-up policy for missed schedule fires
+--   schedules_schedule.catch_up_limit            - catch-up limit for missed schedule fires
+--   schedules_schedulefire (table)               - log of schedule fires
+--
+-- Mailroom also writes values which RapidPro doesn't know about yet, and which need adding to the choices on its models
+-- so that they can be displayed:
+--
+--   msgs_msg.failed_reason 'B'                   - blocked by the workspace's content filter
+--   msgs_msg.failed_reason 'A'                   - attachment can't be sent on the channel
+--   msgs_msg.failed_reason 'X'                   - broadcast was cancelled before the message was sent
+--   msgs_msg.failed_reason 'V'                   - failed by the Android relayer device
+--   notifications_incident.incident_type 'messages:looping' - messages are looping in flows
+--   schedules_schedule.repeat_period 'R'         - repeating by rule, which also has to be enabled in mailroom
+
+ALTER TABLE campaigns_campaignevent ADD COLUMN recurrence character varying(1) NULL;
+ALTER TABLE campaigns_campaignevent ADD COLUMN delivery_window jsonb NULL;
+ALTER TABLE campaigns_campaign ADD COLUMN max_fires_per_minute integer NULL;
+ALTER TABLE campaigns_campaign ADD COLUMN spread_minutes integer NULL;
+ALTER TABLE flows_flowstart ADD COLUMN progress integer NOT NULL DEFAULT 0;
+ALTER TABLE flows_flowstart ADD COLUMN contacts_per_minute integer NOT NULL DEFAULT 0;
+ALTER TABLE msgs_broadcast ADD COLUMN contacts_per_minute integer NOT NULL DEFAULT 0;
+ALTER TABLE msgs_broadcast ADD COLUMN variants jsonb NULL;
+ALTER TABLE schedules_schedule ADD COLUMN repeat_rule text NULL;
+ALTER TABLE schedules_schedule ADD COLUMN catch_up character varying(1) NOT NULL DEFAULT 'O';
+ALTER TABLE schedules_schedule ADD COLUMN catch_up_limit integer NULL;
+
+CREATE TABLE schedules_schedulefire (
+    id serial PRIMARY KEY,
+    org_id integer NOT NULL REFERENCES orgs_org(id),
+    schedule_id integer NOT NULL,
+    scheduled_on timestamp with time zone NOT NULL,
+    fired_on timestamp with time zone NOT NULL,
+    outcome character varying(1) NOT NULL,
+    broadcast_id integer NULL,
+    flow_start_id integer NULL
+);
+CREATE INDEX schedules_schedulefire_schedule ON schedules_schedulefire(schedule_id, scheduled_on DESC);
@@ -79,7 +79,9 @@ func Runtime() (context.Context, *runtime.Runtime) {
 	cfg.S3Endpoint = "http://localhost:9000"
 	cfg.S3AttachmentsBucket = "test-attachments"
 	cfg.S3SessionsBucket = "test-sessions"
+	cfg.S3ExportsBucket = "test-exports"
 	cfg.S3Minio = true
+	cfg.SessionStoragePath = absPath("_test_storage/sessions")
 	cfg.DynamoEndpoint = "http://localhost:6000"
 	cfg.DynamoTablePrefix = "Test"
 
@@ -188,6 +190,12 @@ func loadTestDump() {
 		_db.Close()
 		_db = nil
 	}
+
+	// apply schema additions which mailroom needs but which RapidPro doesn't have migrations for yet
+	changes, err := os.ReadFile(absPath("./testsuite/testfiles/postgres.sql"))
+	must(err)
+
+	getDB().MustExec(string(changes))
 }
 
 // Converts a project root relative path to an absolute path usable in any test. This is needed because go tests
@@ -212,6 +220,8 @@ func resetRedis() {
 func resetStorage(ctx context.Context, rt *runtime.Runtime) {
 	rt.S3.EmptyBucket(ctx, rt.Config.S3AttachmentsBucket)
 	rt.S3.EmptyBucket(ctx, rt.Config.S3SessionsBucket)
+	rt.S3.EmptyBucket(ctx, rt.Config.S3ExportsBucket)
+	os.RemoveAll(rt.Config.SessionStoragePath)
 }
 
 // clears indexed data in Elastic
@@ -303,6 +313,7 @@ DELETE FROM msgs_broadcast;
 DELETE FROM msgs_optin;
 DELETE FROM templates_templatetranslation WHERE id >= 30000;
 DELETE FROM templates_template WHERE id >= 30000;
+DELETE FROM schedules_schedulefire;
 DELETE FROM schedules_schedule;
 DELETE FROM campaigns_campaignevent WHERE id >= 30000;
 DELETE FROM campaigns_campaign WHERE id >= 30000;
@@ -322,6 +333,7 @@ ALTER SEQUENCE msgs_broadcast_id_seq RESTART WITH 1;
 ALTER SEQUENCE flows_flowrun_id_seq RESTART WITH 1;
 ALTER SEQUENCE flows_flowstart_id_seq RESTART WITH 1;
 ALTER SEQUENCE flows_flowsession_id_seq RESTART WITH 1;
+ALTER SEQUENCE schedules_schedulefire_id_seq RESTART WITH 1;
 ALTER SEQUENCE contacts_contact_id_seq RESTART WITH 30000;
 ALTER SEQUENCE contacts_contacturn_id_seq RESTART WITH 30000;
 ALTER SEQUENCE contacts_contactgroup_id_seq RESTART WITH 30000;
@@ -0,0 +1,186 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TableWriter writes rows of a table to an underlying writer
+type TableWriter interface {
+	WriteRow(values []string) error
+	Close() error
+}
+
+// CSVWriter writes rows as CSV
+type CSVWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter creates a new CSV writer
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// WriteRow writes a row, prefixing any values which spreadsheet applications would interpret as formulas with a '
+func (w *CSVWriter) WriteRow(values []string) error {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+			v = "'" + v
+		}
+		escaped[i] = v
+	}
+
+	return w.w.Write(escaped)
+}
+
+func (w *CSVWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// the most rows a worksheet can have, including its header row
+const xlsxMaxRows = 1048576
+
+// XLSXWriter writes rows as an XLSX workbook without holding them in memory. Rows after the first are written to
+// additional worksheets, each starting with the first row, when a worksheet reaches the maximum number of rows.
+type XLSXWriter struct {
+	zw       *zip.Writer
+	sheet    *bufio.Writer
+	header   []string
+	sheets   int
+	rows     int
+	maxRows  int
+	finished bool
+}
+
+// NewXLSXWriter creates a new XLSX writer
+func NewXLSXWriter(w io.Writer) *XLSXWriter {
+	return &XLSXWriter{zw: zip.NewWriter(w), maxRows: xlsxMaxRows}
+}
+
+func (w *XLSXWriter) WriteRow(values []string) error {
+	if w.header == nil {
+		w.header = values
+	}
+
+	if w.sheet == nil || w.rows == w.maxRows {
+		if err := w.nextSheet(); err != nil {
+			return err
+		}
+	}
+
+	return w.writeRow(values)
+}
+
+func (w *XLSXWriter) nextSheet() error {
+	if w.sheet != nil {
+		if err := w.endSheet(); err != nil {
+			return err
+		}
+	}
+
+	w.sheets++
+	f, err := w.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", w.sheets))
+	if err != nil {
+		return err
+	}
+	w.sheet = bufio.NewWriter(f)
+	w.rows = 0
+
+	if _, err := w.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+
+	// repeat the header on every sheet after the first
+	if w.sheets > 1 {
+		return w.writeRow(w.header)
+	}
+	return nil
+}
+
+func (w *XLSXWriter) writeRow(values []string) error {
+	w.rows++
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<row r="%d">`, w.rows)
+	for _, v := range values {
+		b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(b, []byte(v))
+		b.WriteString(`</t></is></c>`)
+	}
+	b.WriteString(`</row>`)
+
+	_, err := w.sheet.WriteString(b.String())
+	return err
+}
+
+func (w *XLSXWriter) endSheet() error {
+	if _, err := w.sheet.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return w.sheet.Flush()
+}
+
+// Close finishes the workbook, writing the parts which depend on how many worksheets were written
+func (w *XLSXWriter) Close() error {
+	if w.finished {
+		return nil
+	}
+	w.finished = true
+
+	if w.sheet == nil {
+		if err := w.nextSheet(); err != nil {
+			return err
+		}
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	contentTypes := &strings.Builder{}
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	contentTypes.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	contentTypes.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+
+	workbook := &strings.Builder{}
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+
+	workbookRels := &strings.Builder{}
+	workbookRels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i := 1; i <= w.sheets; i++ {
+		fmt.Fprintf(contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+		fmt.Fprintf(workbook, `<sheet name="Sheet%d" sheetId="%d" r:id="rId%d"/>`, i, i, i)
+		fmt.Fprintf(workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	workbookRels.WriteString(`</Relationships>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+	}
+
+	for _, p := range parts {
+		f, err := w.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.content); err != nil {
+			return err
+		}
+	}
+
+	return w.zw.Close()
+}
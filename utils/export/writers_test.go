@@ -0,0 +1,61 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/nyaruka/mailroom/utils/export"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := export.NewCSVWriter(b)
+
+	require.NoError(t, w.WriteRow([]string{"UUID", "Name"}))
+	require.NoError(t, w.WriteRow([]string{"1234", `Bob "the builder", Jr`}))
+	require.NoError(t, w.WriteRow([]string{"5678", "=HYPERLINK(\"http://evil.com\")"}))
+	require.NoError(t, w.WriteRow([]string{"+250788123123", "-1", "@SUM(A1)", "a=b", ""}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "UUID,Name\n1234,\"Bob \"\"the builder\"\", Jr\"\n5678,\"'=HYPERLINK(\"\"http://evil.com\"\")\"\n'+250788123123,'-1,'@SUM(A1),a=b,\n", b.String())
+}
+
+func TestXLSXWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := export.NewXLSXWriter(b)
+
+	require.NoError(t, w.WriteRow([]string{"UUID", "Name"}))
+	require.NoError(t, w.WriteRow([]string{"1234", "Bob & <Ann>"}))
+	require.NoError(t, w.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		files[f.Name] = string(content)
+	}
+
+	assert.Len(t, files, 5)
+	assert.Contains(t, files, "[Content_Types].xml")
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="Sheet1" sheetId="1" r:id="rId1"/>`)
+	assert.Contains(t, files["xl/worksheets/sheet1.xml"], `<row r="1"><c t="inlineStr"><is><t xml:space="preserve">UUID</t></is></c><c t="inlineStr"><is><t xml:space="preserve">Name</t></is></c></row>`)
+	assert.Contains(t, files["xl/worksheets/sheet1.xml"], `<t xml:space="preserve">Bob &amp; &lt;Ann&gt;</t>`)
+
+	// an empty workbook still has a worksheet
+	b.Reset()
+	w = export.NewXLSXWriter(b)
+	require.NoError(t, w.Close())
+
+	r, err = zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+	assert.Len(t, r.File, 5)
+}
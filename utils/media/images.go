@@ -0,0 +1,107 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	// register decoders for the image formats we can convert from
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ErrCantShrink is returned when an image can't be made small enough
+var ErrCantShrink = errors.New("unable to shrink image to size limit")
+
+// jpeg qualities we try in order until an image is small enough
+var jpegQualities = []int{85, 70, 55, 40}
+
+// ImageConfig decodes just the dimensions and format of the given image
+func ImageConfig(data []byte) (image.Config, string, error) {
+	return image.DecodeConfig(bytes.NewReader(data))
+}
+
+// ShrinkImage decodes the given image and re-encodes it as a JPEG which fits within the given max dimension and max
+// number of bytes, scaling it down and lowering quality as needed.
+func ShrinkImage(data []byte, maxDimension, maxBytes int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+
+	img = flatten(img)
+	if maxDimension > 0 {
+		img = Resize(img, maxDimension)
+	}
+
+	// try decreasing qualities and if that's not enough, halve the dimensions and try again
+	for attempt := 0; attempt < 3; attempt++ {
+		for _, quality := range jpegQualities {
+			out := &bytes.Buffer{}
+			if err := jpeg.Encode(out, img, &jpeg.Options{Quality: quality}); err != nil {
+				return nil, fmt.Errorf("error encoding image: %w", err)
+			}
+			if maxBytes <= 0 || out.Len() <= maxBytes {
+				return out.Bytes(), nil
+			}
+		}
+
+		b := img.Bounds()
+		img = Resize(img, max(b.Dx(), b.Dy())/2)
+	}
+
+	return nil, ErrCantShrink
+}
+
+// Resize scales the given image down so that neither dimension exceeds the given max, averaging the source pixels
+// which map onto each destination pixel. Images already within the limit are returned as is.
+func Resize(src image.Image, maxDimension int) image.Image {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	if (sw <= maxDimension && sh <= maxDimension) || maxDimension <= 0 {
+		return src
+	}
+
+	dw, dh := maxDimension, maxDimension
+	if sw > sh {
+		dh = max(1, sh*maxDimension/sw)
+	} else {
+		dw = max(1, sw*maxDimension/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := sb.Min.Y+dy*sh/dh, sb.Min.Y+max((dy+1)*sh/dh, dy*sh/dh+1)
+
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := sb.Min.X+dx*sw/dw, sb.Min.X+max((dx+1)*sw/dw, dx*sw/dw+1)
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := src.At(x, y).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			dst.Set(dx, dy, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+
+	return dst
+}
+
+// JPEGs have no transparency so we draw images onto a white background before encoding
+func flatten(src image.Image) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,67 @@
+package media_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/nyaruka/mailroom/utils/media"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 200; y++ {
+			img.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+
+	// already within limit
+	assert.Equal(t, img, media.Resize(img, 400))
+
+	resized := media.Resize(img, 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), resized.Bounds())
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, color.RGBAModel.Convert(resized.At(50, 25)))
+
+	tall := image.NewRGBA(image.Rect(0, 0, 30, 300))
+	assert.Equal(t, image.Rect(0, 0, 10, 100), media.Resize(tall, 100).Bounds())
+}
+
+func TestShrinkImage(t *testing.T) {
+	// create a noisy PNG which doesn't compress well
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 800))
+	rnd := rand.New(rand.NewSource(1))
+	for x := 0; x < 1000; x++ {
+		for y := 0; y < 800; y++ {
+			img.Set(x, y, color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, img))
+
+	cfg, format, err := media.ImageConfig(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, 1000, cfg.Width)
+
+	shrunk, err := media.ShrinkImage(buf.Bytes(), 500, 200_000)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(shrunk), 200_000)
+
+	cfg, format, err = media.ImageConfig(shrunk)
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, 500, cfg.Width)
+	assert.Equal(t, 400, cfg.Height)
+
+	_, err = media.ShrinkImage(buf.Bytes(), 0, 10)
+	assert.Equal(t, media.ErrCantShrink, err)
+
+	_, err = media.ShrinkImage([]byte("not an image"), 500, 1000)
+	assert.EqualError(t, err, "error decoding image: image: unknown format")
+}
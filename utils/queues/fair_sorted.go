@@ -10,6 +10,7 @@ import (
 	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
 )
 
 // Task is a wrapper for encoding a task
@@ -65,6 +66,61 @@ func (q *FairSorted) Push(rc redis.Conn, taskType string, ownerID int, task any,
 	return err
 }
 
+// a task waiting in the delayed set to be released into its owner's queue
+type delayedTask struct {
+	OwnerID  int      `json:"owner_id"`
+	Priority Priority `json:"priority"`
+	Task     string   `json:"task"`
+	Sequence string   `json:"sequence,omitempty"` // the sequence this task belongs to
+	Interval float64  `json:"interval,omitempty"` // seconds after this task is released that the next in its sequence is
+}
+
+// PushAt adds the passed in task to our queue but it won't be released for execution until the given time, and only
+// then if Release is called
+func (q *FairSorted) PushAt(rc redis.Conn, taskType string, ownerID int, task any, priority Priority, releaseOn time.Time) error {
+	taskBody, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	wrapper := &Task{Type: taskType, OwnerID: ownerID, Task: taskBody, QueuedOn: dates.Now()}
+	delayed := &delayedTask{OwnerID: ownerID, Priority: priority, Task: string(jsonx.MustMarshal(wrapper))}
+
+	_, err = rc.Do("ZADD", q.delayedKey(), releaseOn.Unix(), jsonx.MustMarshal(delayed))
+	return err
+}
+
+// PushSequence adds the passed in tasks to our queue as a sequence. The first task will be released for execution after
+// the given interval and each of the rest will be released the interval after the previous one was due, so that the
+// sequence keeps its rate however often Release is called. Tasks of paused owners aren't released and a sequence
+// continues from when its owner is resumed, so it doesn't build up whilst its owner is paused.
+func (q *FairSorted) PushSequence(rc redis.Conn, taskType string, ownerID int, tasks []any, priority Priority, interval time.Duration) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	sequence := string(uuids.NewV4())
+	items := make([]any, len(tasks))
+
+	for i, task := range tasks {
+		taskBody, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+
+		wrapper := &Task{Type: taskType, OwnerID: ownerID, Task: taskBody, QueuedOn: dates.Now()}
+		items[i] = jsonx.MustMarshal(&delayedTask{OwnerID: ownerID, Priority: priority, Task: string(jsonx.MustMarshal(wrapper)), Sequence: sequence, Interval: interval.Seconds()})
+	}
+
+	rc.Send("MULTI")
+	rc.Send("ZADD", q.delayedKey(), dates.Now().Add(interval).Unix(), items[0])
+	if len(items) > 1 {
+		rc.Send("RPUSH", redis.Args{}.Add(q.sequenceKey(sequence)).Add(items[1:]...)...)
+	}
+	_, err := rc.Do("EXEC")
+	return err
+}
+
 func (q *FairSorted) Owners(rc redis.Conn) ([]int, error) {
 	strs, err := redis.Strings(rc.Do("ZRANGE", q.activeKey(), 0, -1))
 	if err != nil {
@@ -84,6 +140,14 @@ func (q *FairSorted) activeKey() string {
 	return fmt.Sprintf("%s:active", q.keyBase)
 }
 
+func (q *FairSorted) delayedKey() string {
+	return fmt.Sprintf("%s:delayed", q.keyBase)
+}
+
+func (q *FairSorted) sequenceKey(sequence string) string {
+	return fmt.Sprintf("%s:sequence:%s", q.keyBase, sequence)
+}
+
 func (q *FairSorted) queueKey(ownerID int) string {
 	return fmt.Sprintf("%s:%d", q.keyBase, ownerID)
 }
@@ -169,3 +233,15 @@ func (q *FairSorted) Resume(rc redis.Conn, ownerID int) error {
 	_, err := scriptFSResume.Do(rc, q.activeKey(), strconv.FormatInt(int64(ownerID), 10))
 	return err
 }
+
+//go:embed lua/fair_sorted_release.lua
+var luaFSRelease string
+var scriptFSRelease = redis.NewScript(2, luaFSRelease)
+
+// Release moves any delayed tasks whose release time has passed into their owners' queues, unless the owner is paused,
+// returning the number of tasks released.
+func (q *FairSorted) Release(rc redis.Conn) (int, error) {
+	now := strconv.FormatFloat(float64(dates.Now().UnixMicro())/float64(1000000), 'f', 6, 64)
+
+	return redis.Int(scriptFSRelease.Do(rc, q.activeKey(), q.delayedKey(), q.keyBase, now))
+}
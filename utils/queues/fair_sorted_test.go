@@ -1,6 +1,7 @@
 package queues_test
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -141,3 +142,192 @@ func TestQueues(t *testing.T) {
 
 	assertredis.ZGetAll(t, rc, "test:active", map[string]float64{"1": 0})
 }
+
+func TestQueuesDelayed(t *testing.T) {
+	_, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer dates.SetNowFunc(time.Now)
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	q := queues.NewFairSorted("test")
+
+	q.PushAt(rc, "type1", 1, "task1", queues.DefaultPriority, time.Date(2022, 1, 1, 12, 1, 0, 0, time.UTC))
+	q.PushAt(rc, "type1", 1, "task2", queues.DefaultPriority, time.Date(2022, 1, 1, 12, 2, 0, 0, time.UTC))
+	q.PushAt(rc, "type1", 2, "task3", queues.HighPriority, time.Date(2022, 1, 1, 12, 1, 0, 0, time.UTC))
+
+	assertredis.ZGetAll(t, rc, "test:delayed", map[string]float64{
+		`{"owner_id":1,"priority":0,"task":"{\"type\":\"type1\",\"task\":\"task1\",\"queued_on\":\"2022-01-01T12:00:00Z\"}"}`:         1641038460,
+		`{"owner_id":1,"priority":0,"task":"{\"type\":\"type1\",\"task\":\"task2\",\"queued_on\":\"2022-01-01T12:00:00Z\"}"}`:         1641038520,
+		`{"owner_id":2,"priority":-10000000,"task":"{\"type\":\"type1\",\"task\":\"task3\",\"queued_on\":\"2022-01-01T12:00:00Z\"}"}`: 1641038460,
+	})
+
+	// nothing is released or can be popped until its release time
+	released, err := q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	task, err := q.Pop(rc)
+	assert.NoError(t, err)
+	assert.Nil(t, task)
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2022, 1, 1, 12, 1, 30, 0, time.UTC)))
+
+	released, err = q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, released)
+
+	assertredis.ZGetAll(t, rc, "test:active", map[string]float64{"1": 0, "2": 0})
+	assertredis.ZGetAll(t, rc, "test:1", map[string]float64{
+		`{"type":"type1","task":"task1","queued_on":"2022-01-01T12:00:00Z"}`: 1641038490,
+	})
+	assertredis.ZGetAll(t, rc, "test:2", map[string]float64{
+		`{"type":"type1","task":"task3","queued_on":"2022-01-01T12:00:00Z"}`: 1631038490,
+	})
+
+	task, err = q.Pop(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, `"task1"`, string(task.Task))
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2022, 1, 1, 12, 5, 0, 0, time.UTC)))
+
+	released, err = q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	assertredis.ZGetAll(t, rc, "test:delayed", map[string]float64{})
+}
+
+func TestQueuesSequence(t *testing.T) {
+	_, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer dates.SetNowFunc(time.Now)
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	setNow := func(t time.Time) { dates.SetNowFunc(dates.NewFixedNow(t)) }
+	setNow(time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	q := queues.NewFairSorted("test")
+
+	err := q.PushSequence(rc, "type1", 1, []any{"task1", "task2", "task3"}, queues.DefaultPriority, time.Minute)
+	assert.NoError(t, err)
+
+	// only the first task of the sequence is delayed, the rest wait for it to be released
+	assertredis.ZCard(t, rc, "test:delayed", 1)
+
+	released, err := q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	setNow(time.Date(2022, 1, 1, 12, 1, 0, 0, time.UTC))
+
+	released, err = q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	task, err := q.Pop(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, `"task1"`, string(task.Task))
+	q.Done(rc, 1)
+
+	// pause the owner and let a lot of time pass.. nothing is released whilst paused
+	q.Pause(rc, 1)
+	setNow(time.Date(2022, 1, 1, 12, 10, 0, 0, time.UTC))
+
+	released, err = q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	// once resumed, the next task is released but the one after is an interval after that, not also overdue
+	q.Resume(rc, 1)
+
+	released, err = q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	task, err = q.Pop(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, `"task2"`, string(task.Task))
+	q.Done(rc, 1)
+
+	setNow(time.Date(2022, 1, 1, 12, 10, 30, 0, time.UTC))
+
+	released, err = q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	setNow(time.Date(2022, 1, 1, 12, 11, 0, 0, time.UTC))
+
+	released, err = q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	task, err = q.Pop(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, `"task3"`, string(task.Task))
+
+	assertredis.ZGetAll(t, rc, "test:delayed", map[string]float64{})
+	assertredis.Keys(t, rc, "test:sequence:*", []string{})
+}
+
+func TestQueuesSequenceRate(t *testing.T) {
+	_, rt := testsuite.Runtime()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer dates.SetNowFunc(time.Now)
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	setNow := func(t time.Time) { dates.SetNowFunc(dates.NewFixedNow(t)) }
+	setNow(time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	q := queues.NewFairSorted("test")
+
+	tasks := make([]any, 10)
+	for i := range tasks {
+		tasks[i] = fmt.Sprintf("task%d", i+1)
+	}
+
+	// a sequence which should release 3 tasks a minute
+	err := q.PushSequence(rc, "type1", 1, tasks, queues.DefaultPriority, 20*time.Second)
+	assert.NoError(t, err)
+
+	// release is called every minute but never exactly on the minute
+	total := 0
+	for _, now := range []time.Time{
+		time.Date(2022, 1, 1, 12, 1, 5, 0, time.UTC),
+		time.Date(2022, 1, 1, 12, 2, 1, 0, time.UTC),
+		time.Date(2022, 1, 1, 12, 3, 7, 0, time.UTC),
+	} {
+		setNow(now)
+
+		released, err := q.Release(rc)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, released, "released mismatch at %s", now)
+		total += released
+	}
+
+	// so after 3 minutes we've achieved the target rate
+	assert.Equal(t, 9, total)
+
+	setNow(time.Date(2022, 1, 1, 12, 4, 3, 0, time.UTC))
+
+	released, err := q.Release(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	for i := 1; i <= 10; i++ {
+		task, err := q.Pop(rc)
+		assert.NoError(t, err)
+		assert.NotNil(t, task)
+		q.Done(rc, 1)
+	}
+
+	assertredis.ZGetAll(t, rc, "test:delayed", map[string]float64{})
+	assertredis.Keys(t, rc, "test:sequence:*", []string{})
+}
@@ -0,0 +1,46 @@
+local activeSetKey, delayedKey = KEYS[1], KEYS[2]
+local queueBase, now = ARGV[1], tonumber(ARGV[2])
+
+-- get all delayed tasks whose release time has passed
+local due = redis.call("ZRANGEBYSCORE", delayedKey, "-inf", now, "WITHSCORES")
+local released = 0
+
+local i = 1
+while i < #due do
+    local item, score = due[i], tonumber(due[i + 1])
+    local delayed = cjson.decode(item)
+    local ownerID = tostring(delayed["owner_id"])
+    local sequence = delayed["sequence"]
+
+    -- tasks of paused owners stay delayed until they're resumed
+    local active = redis.call("ZSCORE", activeSetKey, ownerID)
+    if active == false or tonumber(active) <= 999999 then
+        -- add to the owner's queue as if it was pushed now
+        redis.call("ZADD", queueBase .. ":" .. ownerID, string.format("%.6f", now + delayed["priority"]), delayed["task"])
+        redis.call("ZINCRBY", activeSetKey, 0, ownerID) -- ensure exists in active set
+        redis.call("ZREM", delayedKey, item)
+        released = released + 1
+
+        -- if this task is part of a sequence, the next task is due an interval after this one was due, and if that has
+        -- also passed, it's released now too so that sequences keep their rate regardless of how often we're called
+        if sequence then
+            local nextItem = redis.call("LPOP", queueBase .. ":sequence:" .. sequence)
+            if nextItem then
+                local nextScore = score + delayed["interval"]
+                if nextScore <= now then
+                    table.insert(due, nextItem)
+                    table.insert(due, tostring(nextScore))
+                else
+                    redis.call("ZADD", delayedKey, nextScore, nextItem)
+                end
+            end
+        end
+    elseif sequence then
+        -- a paused sequence is due from now, so that once it's resumed it doesn't try to catch up on the time it was paused
+        redis.call("ZADD", delayedKey, now, item)
+    end
+
+    i = i + 2
+end
+
+return released
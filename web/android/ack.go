@@ -0,0 +1,50 @@
+package android
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/android/ack", web.RequireAuthToken(web.JSONPayload(handleAck)))
+}
+
+// Acknowledges messages pulled by an Android relayer with their statuses, one of W(ired), S(ent), D(elivered) or
+// F(ailed). Statuses for messages which don't belong to the channel are ignored.
+//
+//	{
+//	  "org_id": 1,
+//	  "channel_id": 12,
+//	  "statuses": [
+//	    {"id": 12345, "status": "S"},
+//	    {"id": 12346, "status": "F"}
+//	  ]
+//	}
+type ackRequest struct {
+	OrgID     models.OrgID               `json:"org_id"      validate:"required"`
+	ChannelID models.ChannelID           `json:"channel_id"  validate:"required"`
+	Statuses  []*models.AndroidMsgStatus `json:"statuses"    validate:"required,dive"`
+}
+
+func handleAck(ctx context.Context, rt *runtime.Runtime, r *ackRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	channel := oa.ChannelByID(r.ChannelID)
+	if channel == nil || !channel.IsAndroid() {
+		return fmt.Errorf("no such android channel: %d", r.ChannelID), http.StatusBadRequest, nil
+	}
+
+	if err := models.UpdateAndroidMsgStatuses(ctx, rt.DB, r.ChannelID, r.Statuses); err != nil {
+		return nil, 0, fmt.Errorf("error updating message statuses: %w", err)
+	}
+
+	return map[string]any{}, http.StatusOK, nil
+}
@@ -2,8 +2,10 @@ package android_test
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 	"github.com/stretchr/testify/assert"
@@ -43,3 +45,61 @@ func TestSync(t *testing.T) {
 
 	testsuite.RunWebTests(t, ctx, rt, "testdata/sync.json", map[string]string{"channel_id_1": fmt.Sprintf("%d", androidChannel1.ID)})
 }
+
+func TestPullAndAck(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	androidChannel := testdata.InsertChannel(rt, testdata.Org1, "A", "Android 1", "123", []string{"tel"}, "SR", map[string]any{})
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, androidChannel, testdata.Cathy, "Hi 1", nil, models.MsgStatusQueued, false)
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, androidChannel, testdata.Cathy, "Hi 2", nil, models.MsgStatusQueued, false)
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, androidChannel, testdata.Bob, "Hi 3", nil, models.MsgStatusQueued, false)
+	testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi 4", nil, models.MsgStatusQueued, false)
+	rt.DB.MustExec(`UPDATE msgs_msg SET is_android = TRUE, created_on = '2024-04-01T12:00:00Z' WHERE channel_id = $1`, androidChannel.ID)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/pull_ack.json", map[string]string{"channel_id_1": fmt.Sprintf("%d", androidChannel.ID)})
+
+	// messages which are pulled but not acknowledged are never returned again
+	msg5 := testdata.InsertOutgoingMsg(rt, testdata.Org1, androidChannel, testdata.Cathy, "Hi 5", nil, models.MsgStatusQueued, false)
+	rt.DB.MustExec(`UPDATE msgs_msg SET is_android = TRUE WHERE id = $1`, msg5.ID)
+
+	msgs, err := models.GetAndroidMsgsToSend(ctx, rt.DB, androidChannel.ID, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, msgs, 1) {
+		assert.Equal(t, msg5.ID, msgs[0].ID)
+	}
+
+	msgs, err = models.GetAndroidMsgsToSend(ctx, rt.DB, androidChannel.ID, 10)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 0)
+
+	// concurrent pulls never return the same message
+	for i := 0; i < 20; i++ {
+		m := testdata.InsertOutgoingMsg(rt, testdata.Org1, androidChannel, testdata.Bob, "Hi", nil, models.MsgStatusQueued, false)
+		rt.DB.MustExec(`UPDATE msgs_msg SET is_android = TRUE WHERE id = $1`, m.ID)
+	}
+
+	pulled := make(chan []*models.AndroidMsg, 4)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msgs, err := models.GetAndroidMsgsToSend(ctx, rt.DB, androidChannel.ID, 10)
+			assert.NoError(t, err)
+			pulled <- msgs
+		}()
+	}
+	wg.Wait()
+	close(pulled)
+
+	seen := make(map[models.MsgID]bool)
+	for msgs := range pulled {
+		for _, m := range msgs {
+			assert.False(t, seen[m.ID], "msg %d pulled twice", m.ID)
+			seen[m.ID] = true
+		}
+	}
+	assert.Len(t, seen, 20)
+}
@@ -0,0 +1,62 @@
+package android
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/android/pull", web.RequireAuthToken(web.JSONPayload(handlePull)))
+}
+
+const defaultPullLimit = 50
+
+// Fetches a batch of pending outgoing messages for an Android relayer, oldest first. Pulled messages are marked as
+// wired and are never returned by another pull, so the relayer should acknowledge them with their final statuses.
+//
+//	{
+//	  "org_id": 1,
+//	  "channel_id": 12,
+//	  "limit": 50
+//	}
+type pullRequest struct {
+	OrgID     models.OrgID     `json:"org_id"      validate:"required"`
+	ChannelID models.ChannelID `json:"channel_id"  validate:"required"`
+	Limit     int              `json:"limit"       validate:"omitempty,min=1,max=100"`
+}
+
+// Response is the batch of messages.
+//
+//	{
+//	  "messages": [
+//	    {"id": 12346, "text": "Hello", "attachments": [], "phone": "+250788123123", "created_on": "2021-01-01T12:00:00Z"}
+//	  ]
+//	}
+func handlePull(ctx context.Context, rt *runtime.Runtime, r *pullRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	channel := oa.ChannelByID(r.ChannelID)
+	if channel == nil || !channel.IsAndroid() {
+		return fmt.Errorf("no such android channel: %d", r.ChannelID), http.StatusBadRequest, nil
+	}
+
+	limit := r.Limit
+	if limit == 0 {
+		limit = defaultPullLimit
+	}
+
+	msgs, err := models.GetAndroidMsgsToSend(ctx, rt.DB, r.ChannelID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return map[string]any{"messages": msgs}, http.StatusOK, nil
+}
@@ -0,0 +1,27 @@
+package campaign_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+)
+
+func TestPreview(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+	defer rt.DB.MustExec(`UPDATE orgs_org SET config = config - 'holidays' WHERE id = $1`, testdata.Org1.ID)
+
+	// put Cathy, Bob and Alexandria in the campaign group, and give Cathy and Bob joined dates
+	rt.DB.MustExec(`INSERT INTO contacts_contactgroup_contacts(contactgroup_id, contact_id) VALUES($1, $2), ($1, $3), ($1, $4) ON CONFLICT DO NOTHING`, testdata.DoctorsGroup.ID, testdata.Cathy.ID, testdata.Bob.ID, testdata.Alexandria.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = COALESCE(fields, '{}') || jsonb_build_object($2::text, jsonb_build_object('text', '2018-07-08T09:00:00Z', 'datetime', '2018-07-08T09:00:00Z')) WHERE id = $1`, testdata.Cathy.ID, testdata.JoinedField.UUID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = COALESCE(fields, '{}') || jsonb_build_object($2::text, jsonb_build_object('text', '2018-07-10T14:30:00Z', 'datetime', '2018-07-10T14:30:00Z')) WHERE id = $1`, testdata.Bob.ID, testdata.JoinedField.UUID)
+
+	// and make Monday July 9th a holiday
+	rt.DB.MustExec(`UPDATE orgs_org SET config = COALESCE(config, '{}') || '{"holidays": ["2018-07-09"]}' WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/preview.json", nil)
+}
@@ -0,0 +1,97 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/campaign/preview", web.RequireAuthToken(web.JSONPayload(handlePreview)))
+}
+
+// Previews when a proposed campaign event would fire for the contacts in the campaign group, returning the number of
+// fires on each of the next N days and a sample of the soonest fires.
+//
+//	{
+//	  "org_id": 1,
+//	  "campaign_id": 3,
+//	  "relative_to": "joined",
+//	  "offset": -1,
+//	  "unit": "D",
+//	  "delivery_hour": 9,
+//	  "recurrence": "Y",
+//	  "delivery_window": {"start": "08:00", "end": "17:00", "exclude_weekdays": [0, 6], "exclude_holidays": true},
+//	  "days": 30
+//	}
+//
+//	{
+//	  "total": 234,
+//	  "days": [
+//	    {"date": "2024-10-18", "count": 10},
+//	    {"date": "2024-10-19", "count": 0},
+//	    ...
+//	  ],
+//	  "sample": [
+//	    {"contact_id": 1234, "scheduled": "2024-10-18T09:00:00Z"},
+//	    ...
+//	  ]
+//	}
+type previewRequest struct {
+	OrgID        models.OrgID           `json:"org_id"          validate:"required"`
+	CampaignID   models.CampaignID      `json:"campaign_id"     validate:"required"`
+	RelativeTo   string                 `json:"relative_to"     validate:"required"`
+	Offset       int                    `json:"offset"`
+	Unit         models.OffsetUnit      `json:"unit"            validate:"required,oneof=M H D W"`
+	DeliveryHour *int                   `json:"delivery_hour"   validate:"omitempty,min=-1,max=23"`
+	Recurrence   models.Recurrence      `json:"recurrence"      validate:"omitempty,oneof=Y M"`
+	Window       *models.DeliveryWindow `json:"delivery_window"`
+	Days         int                    `json:"days"            validate:"omitempty,min=1,max=365"`
+	SampleSize   int                    `json:"sample_size"     validate:"omitempty,min=1,max=100"`
+}
+
+func handlePreview(ctx context.Context, rt *runtime.Runtime, r *previewRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	campaign := oa.CampaignByID(r.CampaignID)
+	if campaign == nil {
+		return errors.New("no such campaign"), http.StatusBadRequest, nil
+	}
+
+	field := oa.FieldByKey(r.RelativeTo)
+	if field == nil || field.Type() != assets.FieldTypeDatetime {
+		return fmt.Errorf("no such date field with key: %s", r.RelativeTo), http.StatusBadRequest, nil
+	}
+
+	deliveryHour := models.NilDeliveryHour
+	if r.DeliveryHour != nil {
+		deliveryHour = *r.DeliveryHour
+	}
+	days := r.Days
+	if days == 0 {
+		days = 30
+	}
+	sampleSize := r.SampleSize
+	if sampleSize == 0 {
+		sampleSize = 10
+	}
+
+	event := models.NewCampaignEvent(campaign, field, r.Offset, r.Unit, deliveryHour, r.Recurrence, r.Window)
+
+	preview, err := models.PreviewCampaignEvent(ctx, rt.DB, oa, event, dates.Now(), days, sampleSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error previewing campaign event: %w", err)
+	}
+
+	return preview, http.StatusOK, nil
+}
@@ -44,12 +44,40 @@ func TestExport(t *testing.T) {
 	testsuite.RunWebTests(t, ctx, rt, "testdata/export.json", nil)
 }
 
+func TestExportStart(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/export_start.json", nil)
+}
+
 func TestExportPreview(t *testing.T) {
 	ctx, rt := testsuite.Runtime()
 
 	testsuite.RunWebTests(t, ctx, rt, "testdata/export_preview.json", nil)
 }
 
+func TestGroupPopulation(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/group_population.json", nil)
+}
+
+func TestHistory(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetDynamo)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/history.json", nil)
+}
+
+func TestImportDryRun(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/import_dry_run.json", nil)
+}
+
 func TestInspect(t *testing.T) {
 	ctx, rt := testsuite.Runtime()
 
@@ -61,6 +89,14 @@ func TestInspect(t *testing.T) {
 	testsuite.RunWebTests(t, ctx, rt, "testdata/inspect.json", nil)
 }
 
+func TestMerge(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/merge.json", nil)
+}
+
 func TestModify(t *testing.T) {
 	ctx, rt := testsuite.Runtime()
 
@@ -20,6 +20,7 @@ func init() {
 //	{
 //	  "org_id": 1,
 //	  "user_id": 1,
+//	  "via": "api",
 //	  "contact": {
 //	    "name": "Joe Blow",
 //	    "language": "eng",
@@ -29,9 +30,10 @@ func init() {
 //	  }
 //	}
 type createRequest struct {
-	OrgID   models.OrgID        `json:"org_id"   validate:"required"`
-	UserID  models.UserID       `json:"user_id"  validate:"required"`
-	Contact *models.ContactSpec `json:"contact"  validate:"required"`
+	OrgID   models.OrgID            `json:"org_id"   validate:"required"`
+	UserID  models.UserID           `json:"user_id"  validate:"required"`
+	Via     models.ContactChangeVia `json:"via"      validate:"omitempty,oneof=user api"`
+	Contact *models.ContactSpec     `json:"contact"  validate:"required"`
 }
 
 // handles a request to create the given contact
@@ -51,8 +53,13 @@ func handleCreate(ctx context.Context, rt *runtime.Runtime, r *createRequest) (a
 		return nil, 0, err
 	}
 
+	source := models.ContactChangeSource{Via: models.ContactChangeViaUser, UserID: r.UserID}
+	if r.Via != "" {
+		source.Via = r.Via
+	}
+
 	modifiersByContact := map[*flows.Contact][]flows.Modifier{contact: c.Mods}
-	_, err = models.ApplyModifiers(ctx, rt, oa, r.UserID, modifiersByContact)
+	_, err = models.ApplyModifiers(ctx, rt, oa, source, modifiersByContact)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error modifying new contact: %w", err)
 	}
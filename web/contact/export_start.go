@@ -0,0 +1,111 @@
+package contact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/queues"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/contact/export_start", web.RequireAuthToken(web.JSONPayload(handleExportStart)))
+	web.RegisterRoute(http.MethodPost, "/mr/contact/export_status", web.RequireAuthToken(web.JSONPayload(handleExportStatus)))
+}
+
+// Starts an asynchronous export of the contacts matching a query in a group, which are written to a file in storage
+// with their fields, URNs and groups. The format can be csv (the default), xlsx or ndjson.
+//
+//	{
+//	  "org_id": 1,
+//	  "group_id": 45,
+//	  "query": "age < 65",
+//	  "format": "xlsx"
+//	}
+//
+//	{
+//	  "uuid": "0b2ad61c-0ad2-4d8b-b9bd-1b1f1b3b1f2a",
+//	  "org_id": 1,
+//	  "group_id": 45,
+//	  "query": "age < 65",
+//	  "format": "xlsx",
+//	  "status": "P",
+//	  "total": 0,
+//	  "exported": 0,
+//	  "created_on": "2018-07-06T12:30:00.123456789Z",
+//	  "finished_on": null
+//	}
+type exportStartRequest struct {
+	OrgID   models.OrgID               `json:"org_id"   validate:"required"`
+	GroupID models.GroupID             `json:"group_id" validate:"required"`
+	Query   string                     `json:"query"`
+	Format  models.ContactExportFormat `json:"format"   validate:"omitempty,oneof=csv xlsx ndjson"`
+}
+
+func handleExportStart(ctx context.Context, rt *runtime.Runtime, r *exportStartRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	if oa.GroupByID(r.GroupID) == nil {
+		return errors.New("no such group"), http.StatusBadRequest, nil
+	}
+
+	format := r.Format
+	if format == "" {
+		format = models.ContactExportFormatCSV
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	export := models.NewContactExport(r.OrgID, r.GroupID, r.Query, format)
+	if err := export.Save(rc); err != nil {
+		return nil, 0, err
+	}
+
+	if err := tasks.Queue(rc, tasks.BatchQueue, r.OrgID, &contacts.ExportContactsTask{ExportUUID: export.UUID}, queues.DefaultPriority); err != nil {
+		return nil, 0, fmt.Errorf("error queuing export task: %w", err)
+	}
+
+	return export, http.StatusOK, nil
+}
+
+// Gets the progress of a contact export, which will include a download URL once complete.
+//
+//	{
+//	  "org_id": 1,
+//	  "uuid": "0b2ad61c-0ad2-4d8b-b9bd-1b1f1b3b1f2a"
+//	}
+type exportStatusRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	UUID  uuids.UUID   `json:"uuid"   validate:"required"`
+}
+
+func handleExportStatus(ctx context.Context, rt *runtime.Runtime, r *exportStatusRequest) (any, int, error) {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	export, err := models.GetContactExport(rc, r.OrgID, r.UUID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if export == nil {
+		return errors.New("no such contact export"), http.StatusNotFound, nil
+	}
+
+	// the URL saved with the export may have expired so give the caller a new one
+	if err := export.SignURL(ctx, rt); err != nil {
+		return nil, 0, err
+	}
+
+	return export, http.StatusOK, nil
+}
@@ -0,0 +1,62 @@
+package contact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/contact/group_population", web.RequireAuthToken(web.JSONPayload(handleGroupPopulation)))
+}
+
+// Gets the progress of the current or last population of a smart group.
+//
+//	{
+//	  "org_id": 1,
+//	  "group_id": 45
+//	}
+//
+//	{
+//	  "group_id": 45,
+//	  "query": "age < 65",
+//	  "incremental": false,
+//	  "total": 25000,
+//	  "processed": 10000,
+//	  "started_on": "2018-07-06T12:30:00.123456789Z",
+//	  "completed_on": null,
+//	  "evaluated_as_of": null
+//	}
+type groupPopulationRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	GroupID models.GroupID `json:"group_id" validate:"required"`
+}
+
+func handleGroupPopulation(ctx context.Context, rt *runtime.Runtime, r *groupPopulationRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	if oa.GroupByID(r.GroupID) == nil {
+		return errors.New("no such group"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	pop, err := models.GetGroupPopulation(rc, r.GroupID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if pop == nil {
+		return errors.New("group hasn't been populated"), http.StatusNotFound, nil
+	}
+
+	return pop, http.StatusOK, nil
+}
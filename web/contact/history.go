@@ -0,0 +1,75 @@
+package contact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/contact/history", web.RequireAuthToken(web.JSONPayload(handleHistory)))
+}
+
+// Gets the recorded changes to a contact, newest first. To get the next page, pass the value of next as before.
+//
+//	{
+//	  "org_id": 1,
+//	  "contact_uuid": "559d4cf7-8ed3-43db-9bbb-2be85345f87e",
+//	  "before": "01928c9f-4a0e-7a2f-8b2e-2a1e3b7c1d9f",
+//	  "limit": 50
+//	}
+//
+//	{
+//	  "changes": [
+//	    {
+//	      "uuid": "01928c9f-4a0e-7a2f-8b2e-2a1e3b7c1d9e",
+//	      "contact_uuid": "559d4cf7-8ed3-43db-9bbb-2be85345f87e",
+//	      "property": "field",
+//	      "field": "age",
+//	      "old_value": "23",
+//	      "new_value": "24",
+//	      "via": "flow",
+//	      "session_uuid": "9f7ea8a4-b1b9-4bc4-8b1d-0e7c4e0b2f55",
+//	      "flow_id": 30,
+//	      "created_on": "2024-10-10T12:30:00.123456789Z"
+//	    },
+//	    ...
+//	  ],
+//	  "next": "01928c9f-4a0e-7a2f-8b2e-2a1e3b7c1d9e"
+//	}
+type historyRequest struct {
+	OrgID       models.OrgID      `json:"org_id"       validate:"required"`
+	ContactUUID flows.ContactUUID `json:"contact_uuid" validate:"required,uuid"`
+	Before      uuids.UUID        `json:"before"       validate:"omitempty,uuid"`
+	Limit       int               `json:"limit"        validate:"omitempty,min=1,max=1000"`
+}
+
+type historyResponse struct {
+	Changes []*models.ContactChange `json:"changes"`
+	Next    uuids.UUID              `json:"next,omitempty"`
+}
+
+func handleHistory(ctx context.Context, rt *runtime.Runtime, r *historyRequest) (any, int, error) {
+	limit := r.Limit
+	if limit == 0 {
+		limit = 50
+	}
+
+	changes, err := models.GetContactHistory(ctx, rt, r.OrgID, r.ContactUUID, r.Before, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting contact history: %w", err)
+	}
+
+	resp := &historyResponse{Changes: changes}
+	if len(changes) == limit {
+		resp.Next = changes[len(changes)-1].UUID
+	}
+
+	return resp, http.StatusOK, nil
+}
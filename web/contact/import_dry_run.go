@@ -0,0 +1,77 @@
+package contact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/contact/import_dry_run", web.RequireAuthToken(web.JSONPayload(handleImportDryRun)))
+}
+
+// Works out what a contact import would do without writing anything. Only the first 10,000 records are checked and
+// only the first 100 of each kind of issue are listed, and if either limit is reached the report is marked incomplete.
+//
+//	{
+//	  "org_id": 1,
+//	  "import_id": 123
+//	}
+//
+//	{
+//	  "num_create": 2,
+//	  "num_update": 1,
+//	  "num_errored": 1,
+//	  "invalid_urns": [{"record": 3, "row": 5, "urn": "tel:xyz"}],
+//	  "unknown_fields": ["goats"],
+//	  "unknown_groups": [],
+//	  "truncated": [{"record": 1, "row": 3, "field": "notes", "length": 700}],
+//	  "errors": [
+//	    {"record": 3, "row": 5, "message": "Unable to find or create contact with URNs tel:xyz"},
+//	    {"record": 2, "row": 4, "message": "'goats' is not a valid contact field key"}
+//	  ],
+//	  "incomplete": false
+//	}
+type importDryRunRequest struct {
+	OrgID    models.OrgID           `json:"org_id"    validate:"required"`
+	ImportID models.ContactImportID `json:"import_id" validate:"required"`
+}
+
+// the maximum number of records of an import which are checked by a dry run
+const maxImportDryRunRecords = 10000
+
+func handleImportDryRun(ctx context.Context, rt *runtime.Runtime, r *importDryRunRequest) (any, int, error) {
+	imp, err := models.LoadContactImport(ctx, rt.DB, r.ImportID)
+	if err != nil || imp.OrgID != r.OrgID {
+		return errors.New("no such contact import"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	batches, err := models.LoadContactImportBatches(ctx, rt.DB, r.ImportID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	report := models.NewContactImportReport()
+	for _, b := range batches {
+		if b.RecordStart >= maxImportDryRunRecords {
+			report.Incomplete = true
+			break
+		}
+
+		if err := b.DryRun(ctx, rt, oa, report); err != nil {
+			return nil, 0, fmt.Errorf("error running batch #%d: %w", b.ID, err)
+		}
+	}
+
+	return report, http.StatusOK, nil
+}
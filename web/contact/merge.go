@@ -0,0 +1,97 @@
+package contact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/contact/merge", web.RequireAuthToken(web.JSONPayload(handleMerge)))
+}
+
+// Merges a source contact into a target contact, moving its URNs, fields, groups, tickets, messages, runs, campaign
+// event fires, channel events and calls, and then releasing it. Conflicting field values are resolved using the fields
+// policy which can be keep_target (the default) or keep_source. Changes to the target are recorded in its history.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "source_id": 10001,
+//	  "target_id": 10000,
+//	  "fields": "keep_target"
+//	}
+//
+//	{
+//	  "urns": 1,
+//	  "groups": 2,
+//	  "tickets": 0,
+//	  "msgs": 12,
+//	  "runs": 3,
+//	  "event_fires": 1,
+//	  "channel_events": 2,
+//	  "calls": 0,
+//	  "interrupted": 1
+//	}
+type mergeRequest struct {
+	OrgID    models.OrgID                    `json:"org_id"    validate:"required"`
+	UserID   models.UserID                   `json:"user_id"   validate:"required"`
+	SourceID models.ContactID                `json:"source_id" validate:"required"`
+	TargetID models.ContactID                `json:"target_id" validate:"required,nefield=SourceID"`
+	Fields   models.ContactMergeFieldsPolicy `json:"fields"    validate:"omitempty,oneof=keep_target keep_source"`
+}
+
+func handleMerge(ctx context.Context, rt *runtime.Runtime, r *mergeRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	ids := []models.ContactID{r.SourceID, r.TargetID}
+
+	locks, skipped, err := models.LockContacts(ctx, rt, oa.OrgID(), ids, 10*time.Second)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer models.UnlockContacts(rt, oa.OrgID(), locks)
+
+	if len(skipped) > 0 {
+		return errors.New("unable to lock contacts"), http.StatusConflict, nil
+	}
+
+	contacts, err := models.LoadContacts(ctx, rt.DB, oa, ids)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load contacts: %w", err)
+	}
+
+	var source, target *models.Contact
+	for _, c := range contacts {
+		if c.ID() == r.SourceID {
+			source = c
+		} else {
+			target = c
+		}
+	}
+	if source == nil || target == nil {
+		return errors.New("no such contact"), http.StatusBadRequest, nil
+	}
+
+	policy := r.Fields
+	if policy == "" {
+		policy = models.ContactMergeKeepTarget
+	}
+
+	merge, err := models.MergeContacts(ctx, rt, oa, r.UserID, source, target, policy)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error merging contacts: %w", err)
+	}
+
+	return merge, http.StatusOK, nil
+}
@@ -25,6 +25,7 @@ func init() {
 //	{
 //	  "org_id": 1,
 //	  "user_id": 1,
+//	  "via": "api",
 //	  "contact_ids": [15,235],
 //	  "modifiers": [{
 //	     "type": "groups",
@@ -36,10 +37,11 @@ func init() {
 //	  }]
 //	}
 type modifyRequest struct {
-	OrgID      models.OrgID       `json:"org_id"      validate:"required"`
-	UserID     models.UserID      `json:"user_id"     validate:"required"`
-	ContactIDs []models.ContactID `json:"contact_ids" validate:"required"`
-	Modifiers  []json.RawMessage  `json:"modifiers"   validate:"required"`
+	OrgID      models.OrgID            `json:"org_id"      validate:"required"`
+	UserID     models.UserID           `json:"user_id"     validate:"required"`
+	Via        models.ContactChangeVia `json:"via"         validate:"omitempty,oneof=user api"`
+	ContactIDs []models.ContactID      `json:"contact_ids" validate:"required"`
+	Modifiers  []json.RawMessage       `json:"modifiers"   validate:"required"`
 }
 
 // Response for contact modify. Will return the full contact state and the events generated. Contacts that we couldn't
@@ -86,12 +88,17 @@ func handleModify(ctx context.Context, rt *runtime.Runtime, r *modifyRequest) (a
 		return nil, 0, err
 	}
 
+	source := models.ContactChangeSource{Via: models.ContactChangeViaUser, UserID: r.UserID}
+	if r.Via != "" {
+		source.Via = r.Via
+	}
+
 	results := make(map[flows.ContactID]modifyResult, len(r.ContactIDs))
 	remaining := r.ContactIDs
 	start := time.Now()
 
 	for len(remaining) > 0 && time.Since(start) < time.Second*10 {
-		eventsByContact, skipped, err := tryToLockAndModify(ctx, rt, oa, remaining, mods, r.UserID)
+		eventsByContact, skipped, err := tryToLockAndModify(ctx, rt, oa, remaining, mods, source)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -106,7 +113,7 @@ func handleModify(ctx context.Context, rt *runtime.Runtime, r *modifyRequest) (a
 	return &modifyResponse{Modified: results, Skipped: remaining}, http.StatusOK, nil
 }
 
-func tryToLockAndModify(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, ids []models.ContactID, mods []flows.Modifier, userID models.UserID) (map[*flows.Contact][]flows.Event, []models.ContactID, error) {
+func tryToLockAndModify(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, ids []models.ContactID, mods []flows.Modifier, source models.ContactChangeSource) (map[*flows.Contact][]flows.Event, []models.ContactID, error) {
 	locks, skipped, err := models.LockContacts(ctx, rt, oa.OrgID(), ids, time.Second)
 	if err != nil {
 		return nil, nil, err
@@ -133,7 +140,7 @@ func tryToLockAndModify(ctx context.Context, rt *runtime.Runtime, oa *models.Org
 		modifiersByContact[flowContact] = mods
 	}
 
-	eventsByContact, err := models.ApplyModifiers(ctx, rt, oa, userID, modifiersByContact)
+	eventsByContact, err := models.ApplyModifiers(ctx, rt, oa, source, modifiersByContact)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1,9 +1,11 @@
 package flow_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
 )
 
 func TestChangeLanguage(t *testing.T) {
@@ -35,3 +37,29 @@ func TestStartPreview(t *testing.T) {
 
 	testsuite.RunWebTests(t, ctx, rt, "testdata/start_preview.json", nil)
 }
+
+func TestStartInterrupt(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	start1 := testdata.InsertFlowStart(rt, testdata.Org1, testdata.Admin, testdata.Favorites, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+	start2 := testdata.InsertFlowStart(rt, testdata.Org1, testdata.Admin, testdata.Favorites, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+	rt.DB.MustExec(`UPDATE flows_flowstart SET status = 'C' WHERE id = $1`, start2)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/start_interrupt.json", map[string]string{
+		"start1_id": fmt.Sprint(start1),
+		"start2_id": fmt.Sprint(start2),
+	})
+}
+
+func TestStartProgress(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	start1 := testdata.InsertFlowStart(rt, testdata.Org1, testdata.Admin, testdata.Favorites, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+	rt.DB.MustExec(`UPDATE flows_flowstart SET status = 'S', progress = 1 WHERE id = $1`, start1)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/start_progress.json", map[string]string{"start1_id": fmt.Sprint(start1)})
+}
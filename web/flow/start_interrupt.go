@@ -0,0 +1,41 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/flow_start/interrupt", web.RequireAuthToken(web.JSONPayload(handleStartInterrupt)))
+}
+
+// Interrupts a flow start so that any of its contacts not yet started won't be.
+//
+//	{
+//	  "org_id": 1,
+//	  "start_id": 234
+//	}
+//
+//	{}
+type startInterruptRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	StartID models.StartID `json:"start_id" validate:"required"`
+}
+
+func handleStartInterrupt(ctx context.Context, rt *runtime.Runtime, r *startInterruptRequest) (any, int, error) {
+	interrupted, err := models.InterruptFlowStart(ctx, rt.DB, r.OrgID, r.StartID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error interrupting flow start: %w", err)
+	}
+	if !interrupted {
+		return errors.New("no such start or start has already finished"), http.StatusBadRequest, nil
+	}
+
+	return map[string]any{}, http.StatusOK, nil
+}
@@ -39,6 +39,13 @@ func init() {
 //	  "query": "(group = \"No Age\" OR group = \"No Name\" OR uuid = \"e5bb9e6f-7703-4ba1-afba-0b12791de38b\") AND history != \"Registration\"",
 //	  "total": 567
 //	}
+//
+// If the total is larger than the configured estimation threshold, it will be an approximation and the response will
+// include "approximate": true. If the search backend can only tell that there are at least that many contacts, the total
+// is a lower bound and the response will also include "lower_bound": true.
+//
+// Frequency caps (started_since_hours and bulk_msgs_since_days) can't be expressed as a query, so contacts they would
+// exclude are still counted in the total, and if any are set the response will include "frequency_caps_ignored": true.
 type previewRequest struct {
 	OrgID   models.OrgID  `json:"org_id"    validate:"required"`
 	FlowID  models.FlowID `json:"flow_id"   validate:"required"`
@@ -51,8 +58,12 @@ type previewRequest struct {
 }
 
 type previewResponse struct {
-	Query string `json:"query"`
-	Total int    `json:"total"`
+	Query       string `json:"query"`
+	Total       int    `json:"total"`
+	Approximate bool   `json:"approximate,omitempty"`
+	LowerBound  bool   `json:"lower_bound,omitempty"`
+
+	FrequencyCapsIgnored bool `json:"frequency_caps_ignored,omitempty"`
 }
 
 func handleStartPreview(ctx context.Context, rt *runtime.Runtime, r *previewRequest) (any, int, error) {
@@ -82,10 +93,17 @@ func handleStartPreview(ctx context.Context, rt *runtime.Runtime, r *previewRequ
 		return &previewResponse{Query: "", Total: 0}, http.StatusOK, nil
 	}
 
-	parsedQuery, total, err := search.GetContactTotal(ctx, rt, oa, nil, query)
+	// totals for very large orgs are estimated to keep previews responsive
+	parsedQuery, estimate, err := search.EstimateContactTotal(ctx, rt, oa, nil, query)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error querying preview: %w", err)
 	}
 
-	return &previewResponse{Query: parsedQuery.String(), Total: int(total)}, http.StatusOK, nil
+	return &previewResponse{
+		Query:                parsedQuery.String(),
+		Total:                int(estimate.Total),
+		Approximate:          estimate.Approximate,
+		LowerBound:           estimate.LowerBound,
+		FrequencyCapsIgnored: r.Exclude.HasFrequencyCaps(),
+	}, http.StatusOK, nil
 }
@@ -0,0 +1,46 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/flow_start/progress", web.RequireAuthToken(web.JSONPayload(handleStartProgress)))
+}
+
+// Gets the progress of a flow start, i.e. how many of its contacts have been started so far. Total will be zero until
+// the start's contacts have been resolved.
+//
+//	{
+//	  "org_id": 1,
+//	  "start_id": 234
+//	}
+//
+//	{
+//	  "status": "S",
+//	  "total": 2500,
+//	  "started": 1200
+//	}
+type startProgressRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	StartID models.StartID `json:"start_id" validate:"required"`
+}
+
+func handleStartProgress(ctx context.Context, rt *runtime.Runtime, r *startProgressRequest) (any, int, error) {
+	progress, err := models.GetFlowStartProgress(ctx, rt.DB, r.OrgID, r.StartID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting flow start progress: %w", err)
+	}
+	if progress == nil {
+		return errors.New("no such start"), http.StatusBadRequest, nil
+	}
+
+	return progress, http.StatusOK, nil
+}
@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/testsuite"
@@ -70,6 +72,9 @@ func TestBroadcast(t *testing.T) {
 
 	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
 
+	rt.Config.ScheduleRules = true
+	defer func() { rt.Config.ScheduleRules = false }()
+
 	polls := testdata.InsertOptIn(rt, testdata.Org1, "Polls")
 
 	createRun := func(org *testdata.Org, contact *testdata.Contact, nodeUUID flows.NodeUUID) {
@@ -85,7 +90,71 @@ func TestBroadcast(t *testing.T) {
 		"polls_id": fmt.Sprintf("%d", polls.ID),
 	})
 
-	testsuite.AssertBatchTasks(t, testdata.Org1.ID, map[string]int{"send_broadcast": 2})
+	testsuite.AssertBatchTasks(t, testdata.Org1.ID, map[string]int{"send_broadcast": 3})
+}
+
+func TestBroadcastStats(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	bcastID := testdata.InsertBroadcast(rt, testdata.Org1, "eng", map[i18n.Language]string{"eng": "Hi"}, nil, models.NilScheduleID, []*testdata.Contact{testdata.Cathy, testdata.Bob, testdata.George}, nil)
+
+	insertVariantMsg := func(contact *testdata.Contact, variant string, status models.MsgStatus, age string) {
+		m := testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, contact, "Hi", nil, status, false)
+		rt.DB.MustExec(`UPDATE msgs_msg SET broadcast_id = $2, metadata = json_build_object('variant', $3::text)::text, created_on = NOW() - $4::interval WHERE id = $1`, m.ID, bcastID, variant, age)
+	}
+
+	insertVariantMsg(testdata.Cathy, "8c1e5b8a-9a67-4c8e-bd4f-5e0bd2e4d8a4", models.MsgStatusDelivered, "1 hour")
+	insertVariantMsg(testdata.Bob, "8c1e5b8a-9a67-4c8e-bd4f-5e0bd2e4d8a4", models.MsgStatusSent, "3 days")
+	insertVariantMsg(testdata.George, "2f7d0b1c-3e5e-4b0a-9b1d-1f1c6d2f7e01", models.MsgStatusFailed, "1 hour")
+
+	// cathy replies, and bob replies but too long after his message to count as a reply to it
+	testdata.InsertIncomingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "hello", models.MsgStatusHandled)
+	testdata.InsertIncomingMsg(rt, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "hello", models.MsgStatusHandled)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/broadcast_stats.json", map[string]string{
+		"bcast_id": fmt.Sprintf("%d", bcastID),
+	})
+}
+
+func TestBroadcastScheduleRulesDisabled(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/broadcast_rules_disabled.json", nil)
+}
+
+func TestBroadcastCancel(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	bcast1ID := testdata.InsertBroadcast(rt, testdata.Org1, "eng", map[i18n.Language]string{"eng": "Hi"}, nil, models.NilScheduleID, []*testdata.Contact{testdata.Cathy, testdata.Bob}, nil)
+	bcast2ID := testdata.InsertBroadcast(rt, testdata.Org1, "eng", map[i18n.Language]string{"eng": "Oops"}, nil, models.NilScheduleID, []*testdata.Contact{testdata.Cathy, testdata.Bob, testdata.George}, nil)
+	rt.DB.MustExec(`UPDATE msgs_broadcast SET status = 'C' WHERE id = $1`, bcast2ID)
+
+	insertBroadcastMsg := func(contact *testdata.Contact, status models.MsgStatus) {
+		m := testdata.InsertOutgoingMsg(rt, testdata.Org1, testdata.TwilioChannel, contact, "Oops", nil, status, false)
+		rt.DB.MustExec(`UPDATE msgs_msg SET broadcast_id = $2 WHERE id = $1`, m.ID, bcast2ID)
+	}
+
+	insertBroadcastMsg(testdata.Cathy, models.MsgStatusQueued)
+	insertBroadcastMsg(testdata.Bob, models.MsgStatusQueued)
+	insertBroadcastMsg(testdata.George, models.MsgStatusWired)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/broadcast_cancel.json", map[string]string{
+		"bcast1_id": fmt.Sprintf("%d", bcast1ID),
+		"bcast2_id": fmt.Sprintf("%d", bcast2ID),
+	})
+
+	// failing of queued messages is done by a task
+	testsuite.AssertBatchTasks(t, testdata.Org1.ID, map[string]int{"fail_broadcast_messages": 1})
+	testsuite.FlushTasks(t, rt)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND status = 'F' AND failed_reason = 'X'`, bcast2ID).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND status = 'W'`, bcast2ID).Returns(1)
 }
 
 func TestBroadcastPreview(t *testing.T) {
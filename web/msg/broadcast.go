@@ -29,11 +29,16 @@ func init() {
 //	  "org_id": 1,
 //	  "user_id": 56,
 //	  "translations": {"eng": {"text": "Hello @contact"}, "spa": {"text": "Hola @contact"}},
+//	  "variants": [
+//	    {"uuid": "8c1e5b8a-9a67-4c8e-bd4f-5e0bd2e4d8a4", "translations": {"eng": {"text": "Hi @contact"}}, "percent": 50},
+//	    {"uuid": "2f7d0b1c-3e5e-4b0a-9b1d-1f1c6d2f7e01", "translations": {"eng": {"text": "Hey @contact"}}, "percent": 50}
+//	  ],
 //	  "base_language": "eng",
 //	  "optin_id": 456,
 //	  "group_ids": [101, 102],
 //	  "contact_ids": [4646],
 //	  "urns": [4646],
+//	  "contacts_per_minute": 500,
 //	  "schedule": {
 //	    "start": "2024-06-20T09:04:30Z",
 //	    "repeat_period": "W",
@@ -44,6 +49,7 @@ type broadcastRequest struct {
 	OrgID             models.OrgID                `json:"org_id"        validate:"required"`
 	UserID            models.UserID               `json:"user_id"       validate:"required"`
 	Translations      flows.BroadcastTranslations `json:"translations"  validate:"required"`
+	Variants          models.BroadcastVariants    `json:"variants"      validate:"omitempty,dive"`
 	BaseLanguage      i18n.Language               `json:"base_language" validate:"required"`
 	OptInID           models.OptInID              `json:"optin_id"`
 	TemplateID        models.TemplateID           `json:"template_id"`
@@ -54,10 +60,14 @@ type broadcastRequest struct {
 	Query             string                      `json:"query"`
 	NodeUUID          flows.NodeUUID              `json:"node_uuid"`
 	Exclude           models.Exclusions           `json:"exclude"`
+	ContactsPerMinute int                         `json:"contacts_per_minute" validate:"omitempty,min=1"`
 	Schedule          *struct {
-		Start            time.Time           `json:"start"`
-		RepeatPeriod     models.RepeatPeriod `json:"repeat_period"`
-		RepeatDaysOfWeek string              `json:"repeat_days_of_week"`
+		Start            time.Time            `json:"start"`
+		RepeatPeriod     models.RepeatPeriod  `json:"repeat_period"`
+		RepeatDaysOfWeek string               `json:"repeat_days_of_week"`
+		RepeatRule       string               `json:"repeat_rule"`
+		CatchUp          models.CatchUpPolicy `json:"catch_up"            validate:"omitempty,oneof=O S A"`
+		CatchUpLimit     *int                 `json:"catch_up_limit"      validate:"omitempty,min=1"`
 	} `json:"schedule"`
 }
 
@@ -71,6 +81,14 @@ func handleBroadcast(ctx context.Context, rt *runtime.Runtime, r *broadcastReque
 	if len(r.ContactIDs) == 0 && len(r.GroupIDs) == 0 && len(r.URNs) == 0 && r.Query == "" && r.NodeUUID == "" {
 		return errors.New("can't create broadcast with no recipients"), http.StatusBadRequest, nil
 	}
+	if err := r.Variants.Validate(r.BaseLanguage); err != nil {
+		return err, http.StatusBadRequest, nil
+	}
+
+	// RapidPro doesn't know about this repeat period yet so schedules can't use it unless it's been enabled
+	if r.Schedule != nil && r.Schedule.RepeatPeriod == models.RepeatPeriodRule && !rt.Config.ScheduleRules {
+		return errors.New("error creating schedule: repeating by rule isn't enabled"), http.StatusBadRequest, nil
+	}
 
 	tx, err := rt.DB.BeginTxx(ctx, nil)
 	if err != nil {
@@ -81,6 +99,7 @@ func handleBroadcast(ctx context.Context, rt *runtime.Runtime, r *broadcastReque
 		OrgID:             r.OrgID,
 		Status:            models.BroadcastStatusPending,
 		Translations:      r.Translations,
+		Variants:          r.Variants,
 		BaseLanguage:      r.BaseLanguage,
 		Expressions:       true,
 		OptInID:           r.OptInID,
@@ -93,13 +112,23 @@ func handleBroadcast(ctx context.Context, rt *runtime.Runtime, r *broadcastReque
 		NodeUUID:          r.NodeUUID,
 		Exclusions:        r.Exclude,
 		CreatedByID:       r.UserID,
+		ContactsPerMinute: r.ContactsPerMinute,
 	}
 
 	if r.Schedule != nil {
-		sched, err := models.NewSchedule(oa, r.Schedule.Start, r.Schedule.RepeatPeriod, r.Schedule.RepeatDaysOfWeek)
+		var sched *models.Schedule
+		if r.Schedule.RepeatPeriod == models.RepeatPeriodRule {
+			sched, err = models.NewRuleSchedule(oa, r.Schedule.Start, r.Schedule.RepeatRule)
+		} else {
+			sched, err = models.NewSchedule(oa, r.Schedule.Start, r.Schedule.RepeatPeriod, r.Schedule.RepeatDaysOfWeek)
+		}
 		if err != nil {
 			return fmt.Errorf("error creating schedule: %w", err), http.StatusBadRequest, nil
 		}
+		if r.Schedule.CatchUp != "" {
+			sched.CatchUp = r.Schedule.CatchUp
+		}
+		sched.CatchUpLimit = r.Schedule.CatchUpLimit
 
 		if err := sched.Insert(ctx, tx); err != nil {
 			return nil, 0, fmt.Errorf("error inserting schedule: %w", err)
@@ -0,0 +1,66 @@
+package msg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/core/tasks/msgs"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/queues"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/msg/broadcast_cancel", web.RequireAuthToken(web.JSONPayload(handleBroadcastCancel)))
+}
+
+// Request to cancel a broadcast so that any batches not yet sent are skipped. If fail_queued is set then a task is
+// queued to fail messages which have been created but not yet wired and remove them from the courier queues.
+//
+//	{
+//	  "org_id": 1,
+//	  "broadcast_id": 123,
+//	  "fail_queued": true
+//	}
+//
+//	{
+//	  "interrupted": true
+//	}
+type broadcastCancelRequest struct {
+	OrgID       models.OrgID       `json:"org_id"       validate:"required"`
+	BroadcastID models.BroadcastID `json:"broadcast_id" validate:"required"`
+	FailQueued  bool               `json:"fail_queued"`
+}
+
+type broadcastCancelResponse struct {
+	Interrupted bool `json:"interrupted"`
+}
+
+// handles a request to cancel a broadcast
+func handleBroadcastCancel(ctx context.Context, rt *runtime.Runtime, r *broadcastCancelRequest) (any, int, error) {
+	interrupted, err := models.InterruptBroadcast(ctx, rt.DB, r.OrgID, r.BroadcastID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error interrupting broadcast: %w", err)
+	}
+
+	// a finished broadcast can still have queued messages, so only error if there's nothing else to do
+	if !interrupted && !r.FailQueued {
+		return errors.New("no such broadcast or broadcast has already finished"), http.StatusBadRequest, nil
+	}
+
+	if r.FailQueued {
+		rc := rt.RP.Get()
+		defer rc.Close()
+
+		task := &msgs.FailBroadcastMessagesTask{BroadcastID: r.BroadcastID}
+		if err := tasks.Queue(rc, tasks.BatchQueue, r.OrgID, task, queues.HighPriority); err != nil {
+			return nil, 0, fmt.Errorf("error queuing fail broadcast messages task: %w", err)
+		}
+	}
+
+	return &broadcastCancelResponse{Interrupted: interrupted}, http.StatusOK, nil
+}
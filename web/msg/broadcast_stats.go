@@ -0,0 +1,47 @@
+package msg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/msg/broadcast_stats", web.RequireAuthToken(web.JSONPayload(handleBroadcastStats)))
+}
+
+// Request for the delivery and reply stats of each variant of a split broadcast.
+//
+//	{
+//	  "org_id": 1,
+//	  "broadcast_id": 123
+//	}
+//
+//	{
+//	  "variants": [
+//	    {"uuid": "8c1e5b8a-9a67-4c8e-bd4f-5e0bd2e4d8a4", "sent": 500, "delivered": 480, "failed": 3, "replied": 120},
+//	    {"uuid": "2f7d0b1c-3e5e-4b0a-9b1d-1f1c6d2f7e01", "sent": 500, "delivered": 470, "failed": 8, "replied": 95}
+//	  ]
+//	}
+type broadcastStatsRequest struct {
+	OrgID       models.OrgID       `json:"org_id"       validate:"required"`
+	BroadcastID models.BroadcastID `json:"broadcast_id" validate:"required"`
+}
+
+type broadcastStatsResponse struct {
+	Variants []*models.BroadcastVariantStats `json:"variants"`
+}
+
+// handles a request for the stats of a split broadcast
+func handleBroadcastStats(ctx context.Context, rt *runtime.Runtime, r *broadcastStatsRequest) (any, int, error) {
+	stats, err := models.GetBroadcastVariantStats(ctx, rt.DB, r.OrgID, r.BroadcastID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting broadcast stats: %w", err)
+	}
+
+	return &broadcastStatsResponse{Variants: stats}, http.StatusOK, nil
+}
@@ -0,0 +1,39 @@
+package schedule_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreview(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/preview.json", nil)
+}
+
+func TestFires(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	sched := &models.Schedule{OrgID: testdata.Org1.ID, ID: testdata.InsertSchedule(rt, testdata.Org1, models.RepeatPeriodDaily, time.Now())}
+	firedOn := time.Date(2018, 7, 6, 19, 0, 1, 0, time.UTC)
+
+	skipped := models.NewScheduleFire(sched, time.Date(2018, 7, 4, 19, 0, 0, 0, time.UTC), firedOn, models.ScheduleFireOutcomeSkipped)
+	fired := models.NewScheduleFire(sched, time.Date(2018, 7, 5, 19, 0, 0, 0, time.UTC), firedOn, models.ScheduleFireOutcomeFired)
+	fired.BroadcastID = 123
+	require.NoError(t, models.InsertScheduleFires(ctx, rt.DB, []*models.ScheduleFire{skipped, fired}))
+
+	// failures to fire at the same scheduled time are only recorded once
+	failedOn := time.Date(2018, 7, 6, 19, 0, 0, 0, time.UTC)
+	require.NoError(t, models.InsertScheduleFireFailed(ctx, rt.DB, sched, failedOn, firedOn))
+	require.NoError(t, models.InsertScheduleFireFailed(ctx, rt.DB, sched, failedOn, firedOn.Add(time.Minute)))
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/fires.json", map[string]string{"schedule_id": fmt.Sprint(sched.ID)})
+}
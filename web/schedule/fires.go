@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/schedule/fires", web.RequireAuthToken(web.JSONPayload(handleFires)))
+}
+
+// Gets the log of fires of a schedule, newest first. Outcome is one of F (fired), S (skipped), N (no target) or
+// E (failed).
+//
+//	{
+//	  "org_id": 1,
+//	  "schedule_id": 12,
+//	  "limit": 50
+//	}
+//
+//	{
+//	  "fires": [
+//	    {
+//	      "id": 123,
+//	      "schedule_id": 12,
+//	      "scheduled_on": "2024-10-10T12:30:00Z",
+//	      "fired_on": "2024-10-10T12:30:01.123456Z",
+//	      "outcome": "F",
+//	      "broadcast_id": 345
+//	    },
+//	    ...
+//	  ]
+//	}
+type firesRequest struct {
+	OrgID      models.OrgID      `json:"org_id"      validate:"required"`
+	ScheduleID models.ScheduleID `json:"schedule_id" validate:"required"`
+	Limit      int               `json:"limit"       validate:"omitempty,min=1,max=1000"`
+}
+
+type firesResponse struct {
+	Fires []*models.ScheduleFire `json:"fires"`
+}
+
+func handleFires(ctx context.Context, rt *runtime.Runtime, r *firesRequest) (any, int, error) {
+	limit := r.Limit
+	if limit == 0 {
+		limit = 50
+	}
+
+	fires, err := models.GetScheduleFires(ctx, rt.DB, r.OrgID, r.ScheduleID, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting schedule fires: %w", err)
+	}
+
+	return &firesResponse{Fires: fires}, http.StatusOK, nil
+}
@@ -0,0 +1,74 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/schedule/preview", web.RequireAuthToken(web.JSONPayload(handlePreview)))
+}
+
+// Previews the next fires of a proposed schedule, evaluated in the org's timezone.
+//
+//	{
+//	  "org_id": 1,
+//	  "start": "2024-06-20T09:04:30Z",
+//	  "repeat_period": "R",
+//	  "repeat_rule": "FREQ=MONTHLY;BYDAY=-1FR;COUNT=6",
+//	  "count": 10
+//	}
+//
+//	{
+//	  "fires": ["2024-06-28T09:04:00Z", "2024-07-26T09:04:00Z", ...]
+//	}
+type previewRequest struct {
+	OrgID            models.OrgID        `json:"org_id"              validate:"required"`
+	Start            time.Time           `json:"start"               validate:"required"`
+	RepeatPeriod     models.RepeatPeriod `json:"repeat_period"       validate:"required,oneof=O D W M R"`
+	RepeatDaysOfWeek string              `json:"repeat_days_of_week"`
+	RepeatRule       string              `json:"repeat_rule"`
+	Count            int                 `json:"count"               validate:"omitempty,min=1,max=100"`
+}
+
+type previewResponse struct {
+	Fires []time.Time `json:"fires"`
+}
+
+func handlePreview(ctx context.Context, rt *runtime.Runtime, r *previewRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	var sched *models.Schedule
+	if r.RepeatPeriod == models.RepeatPeriodRule {
+		sched, err = models.NewRuleSchedule(oa, r.Start, r.RepeatRule)
+	} else {
+		sched, err = models.NewSchedule(oa, r.Start, r.RepeatPeriod, r.RepeatDaysOfWeek)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating schedule: %w", err), http.StatusBadRequest, nil
+	}
+
+	count := r.Count
+	if count == 0 {
+		count = 10
+	}
+
+	fires, err := sched.GetNextFires(count)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error calculating schedule fires: %w", err)
+	}
+	for i := range fires {
+		fires[i] = fires[i].UTC()
+	}
+
+	return &previewResponse{Fires: fires}, http.StatusOK, nil
+}
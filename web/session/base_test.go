@@ -0,0 +1,15 @@
+package session_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+)
+
+func TestMigrateOutputs(t *testing.T) {
+	ctx, rt := testsuite.Runtime()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	testsuite.RunWebTests(t, ctx, rt, "testdata/migrate_outputs.json", nil)
+}
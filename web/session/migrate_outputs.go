@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/session/migrate_outputs", web.RequireAuthToken(web.JSONPayload(handleMigrateOutputs)))
+	web.RegisterRoute(http.MethodPost, "/mr/session/migrate_outputs_status", web.RequireAuthToken(web.JSONPayload(handleMigrateOutputsStatus)))
+}
+
+// Starts a migration of waiting session outputs from the database to session storage or back. Any existing
+// migration is replaced. Sessions are migrated in batches by a cron job, up to max_per_run sessions per minute.
+//
+//	{
+//	  "direction": "to_storage",
+//	  "batch_size": 100,
+//	  "max_per_run": 10000
+//	}
+type migrateOutputsRequest struct {
+	Direction models.SessionMigrationDirection `json:"direction"    validate:"required,oneof=to_storage to_db"`
+	BatchSize int                              `json:"batch_size"   validate:"omitempty,min=1,max=1000"`
+	MaxPerRun int                              `json:"max_per_run"  validate:"omitempty,min=1"`
+}
+
+func handleMigrateOutputs(ctx context.Context, rt *runtime.Runtime, r *migrateOutputsRequest) (any, int, error) {
+	if r.Direction == models.SessionMigrationToStorage && models.GetSessionStorage(rt) == nil {
+		return errors.New("can't migrate session outputs to storage when no session storage is configured"), http.StatusBadRequest, nil
+	}
+
+	batchSize, maxPerRun := r.BatchSize, r.MaxPerRun
+	if batchSize == 0 {
+		batchSize = 100
+	}
+	if maxPerRun == 0 {
+		maxPerRun = 10000
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	m, err := models.StartSessionMigration(rc, r.Direction, batchSize, maxPerRun)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return migrationStatus(ctx, rt, m)
+}
+
+// Gets the progress of the current or last session output migration.
+//
+//	{}
+type migrateOutputsStatusRequest struct{}
+
+func handleMigrateOutputsStatus(ctx context.Context, rt *runtime.Runtime, r *migrateOutputsStatusRequest) (any, int, error) {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	m, err := models.GetSessionMigration(rc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if m == nil {
+		return errors.New("no session output migration has been started"), http.StatusNotFound, nil
+	}
+
+	return migrationStatus(ctx, rt, m)
+}
+
+func migrationStatus(ctx context.Context, rt *runtime.Runtime, m *models.SessionMigration) (any, int, error) {
+	remaining, err := m.Remaining(ctx, rt.DB)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting remaining sessions: %w", err)
+	}
+
+	return map[string]any{
+		"direction":    m.Direction,
+		"migrated":     m.Migrated,
+		"failed":       m.Failed,
+		"remaining":    remaining,
+		"started_on":   m.StartedOn,
+		"completed_on": m.CompletedOn,
+	}, http.StatusOK, nil
+}